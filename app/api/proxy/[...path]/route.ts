@@ -89,9 +89,10 @@ async function proxyRequest(
     // Make the request to the backend
     // For server-side proxy, always use the internal Docker network URL
     // Note: apiPath already includes 'api/' from the frontend request, so we don't add it again
+    const query = request.nextUrl.search
     const backendUrl = process.env.NEXT_PUBLIC_API_URL 
-      ? `${process.env.NEXT_PUBLIC_API_URL}/${apiPath}` 
-      : `http://localhost:8080/${apiPath}`;
+      ? `${process.env.NEXT_PUBLIC_API_URL}/${apiPath}${query}` 
+      : `http://localhost:8080/${apiPath}${query}`;
     
     console.log(`[Proxy] ${method} ${backendUrl}`)
     
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/certificates"
+	"github.com/Lazarev-Cloud/localca-go/pkg/config"
+	"github.com/Lazarev-Cloud/localca-go/pkg/signer"
+	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
+)
+
+// runCommand runs a maintenance subcommand instead of the server
+func runCommand(name string, args []string, in io.Reader, out io.Writer) error {
+	switch name {
+	case "check-serials":
+		return runCheckSerials(args, out)
+	case "unseal":
+		return runUnseal(args, in, out)
+	case "key-ceremony":
+		return runKeyCeremony(args, in, out)
+	case "signer":
+		return runSigner(args, out)
+	}
+	return fmt.Errorf("unknown command: %s", name)
+}
+
+// runCheckSerials prints the serial numbers shared by more than one
+// certificate in a data directory
+func runCheckSerials(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("check-serials", flag.ContinueOnError)
+	flags.SetOutput(out)
+	dataDir := flags.String("data-dir", getDataDir(), "data directory to check")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(*dataDir); err != nil {
+		return fmt.Errorf("data directory not found: %w", err)
+	}
+
+	store, err := storage.NewStorage(*dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+
+	certSvc, err := certificates.NewCertificateService(&config.Config{DataDir: *dataDir}, store)
+	if err != nil {
+		return err
+	}
+
+	report, err := certSvc.CheckSerialNumbers()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Checked %d certificates in %s\n", report.CertificatesChecked, *dataDir)
+	if len(report.Duplicates) == 0 {
+		fmt.Fprintln(out, "No duplicate serial numbers found")
+		return nil
+	}
+
+	for _, duplicate := range report.Duplicates {
+		fmt.Fprintf(out, "Duplicate serial %s: %v\n", duplicate.SerialNumber, duplicate.Certificates)
+	}
+	return fmt.Errorf("found %d duplicate serial numbers", len(report.Duplicates))
+}
+
+// runUnseal unlocks the CA of a running server. It logs in as the admin and
+// posts the CA passphrase, prompting for both on in unless read from files.
+// With -shares it posts unseal shares one at a time instead until the
+// threshold is reached.
+func runUnseal(args []string, in io.Reader, out io.Writer) error {
+	flags := flag.NewFlagSet("unseal", flag.ContinueOnError)
+	flags.SetOutput(out)
+	serverURL := flags.String("url", getServerURL(), "URL of the running server")
+	username := flags.String("username", "admin", "admin username")
+	passwordFile := flags.String("password-file", "", "file holding the admin password")
+	passphraseFile := flags.String("passphrase-file", "", "file holding the CA passphrase")
+	useShares := flags.Bool("shares", false, "unseal with shares from a key ceremony instead of the passphrase")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(in)
+	client, baseURL, err := loginAPI(reader, out, *serverURL, *username, *passwordFile)
+	if err != nil {
+		return err
+	}
+
+	if *useShares {
+		return submitUnsealShares(client, baseURL, reader, out)
+	}
+
+	passphrase, err := readSecret(reader, out, *passphraseFile, "CA passphrase: ")
+	if err != nil {
+		return err
+	}
+	if err := postAPI(client, baseURL+"/api/ca/unseal", map[string]string{
+		"passphrase": passphrase,
+	}, nil); err != nil {
+		return fmt.Errorf("failed to unseal CA: %w", err)
+	}
+
+	fmt.Fprintln(out, "CA unsealed")
+	return nil
+}
+
+// submitUnsealShares prompts for unseal shares until the CA is unsealed.
+// Shares from earlier submissions, also by other custodians, count as well.
+func submitUnsealShares(client *http.Client, baseURL string, reader *bufio.Reader, out io.Writer) error {
+	for {
+		share, err := readSecret(reader, out, "", "Unseal share: ")
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(share) == "" {
+			continue
+		}
+
+		var progress certificates.UnsealProgress
+		if err := postAPI(client, baseURL+"/api/ca/unseal/shares", map[string]string{
+			"share": share,
+		}, &progress); err != nil {
+			return fmt.Errorf("failed to submit unseal share: %w", err)
+		}
+		if !progress.Sealed {
+			fmt.Fprintln(out, "CA unsealed")
+			return nil
+		}
+		fmt.Fprintf(out, "Share accepted, %d of %d submitted\n", progress.Submitted, progress.Threshold)
+	}
+}
+
+// runKeyCeremony splits the CA passphrase of a running, unsealed server into
+// unseal shares and prints them for the custodians
+func runKeyCeremony(args []string, in io.Reader, out io.Writer) error {
+	flags := flag.NewFlagSet("key-ceremony", flag.ContinueOnError)
+	flags.SetOutput(out)
+	serverURL := flags.String("url", getServerURL(), "URL of the running server")
+	username := flags.String("username", "admin", "admin username")
+	passwordFile := flags.String("password-file", "", "file holding the admin password")
+	count := flags.Int("shares", 5, "number of shares to create")
+	threshold := flags.Int("threshold", 3, "number of shares required to unseal")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(in)
+	client, baseURL, err := loginAPI(reader, out, *serverURL, *username, *passwordFile)
+	if err != nil {
+		return err
+	}
+
+	var result certificates.UnsealShares
+	if err := postAPI(client, baseURL+"/api/ca/shares", map[string]int{
+		"shares":    *count,
+		"threshold": *threshold,
+	}, &result); err != nil {
+		return fmt.Errorf("failed to create unseal shares: %w", err)
+	}
+
+	fmt.Fprintf(out, "Created %d unseal shares, any %d of them unseal the CA.\n", len(result.Shares), result.Threshold)
+	fmt.Fprintln(out, "Hand each share to a different custodian; they are not stored on the server.")
+	for i, share := range result.Shares {
+		fmt.Fprintf(out, "\nShare %d of %d:\n%s\n", i+1, len(result.Shares), share)
+	}
+	return nil
+}
+
+// loginAPI logs in to a running server as the admin, prompting for the
+// password unless read from a file, and returns a client holding the session
+func loginAPI(reader *bufio.Reader, out io.Writer, serverURL, username, passwordFile string) (*http.Client, string, error) {
+	password, err := readSecret(reader, out, passwordFile, "Admin password: ")
+	if err != nil {
+		return nil, "", err
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, "", err
+	}
+	client := &http.Client{Jar: jar, Timeout: 30 * time.Second}
+	baseURL := strings.TrimRight(serverURL, "/")
+
+	if err := postAPI(client, baseURL+"/api/login", map[string]string{
+		"username": username,
+		"password": password,
+	}, nil); err != nil {
+		return nil, "", fmt.Errorf("failed to log in: %w", err)
+	}
+	return client, baseURL, nil
+}
+
+// runSigner runs a standalone signing process for CA_SIGNER=remote. It keeps
+// the CA keys encrypted in its own directory and answers the server on a Unix
+// socket that only the owner can use.
+func runSigner(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("signer", flag.ContinueOnError)
+	flags.SetOutput(out)
+	socket := flags.String("socket", getSignerSocket(), "Unix socket to listen on")
+	keyDir := flags.String("key-dir", "./signer-keys", "directory holding the encrypted keys")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	backend, err := signer.NewDirectoryBackend(*keyDir)
+	if err != nil {
+		return err
+	}
+
+	// A socket left by a previous run would make Listen fail
+	if err := os.Remove(*socket); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	listener, err := net.Listen("unix", *socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", *socket, err)
+	}
+	defer listener.Close()
+	if err := os.Chmod(*socket, 0600); err != nil {
+		return fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+
+	fmt.Fprintf(out, "Signer listening on %s, keys in %s\n", *socket, *keyDir)
+	return signer.Serve(listener, backend)
+}
+
+// readSecret reads a secret from a file or, without one, the next input line
+func readSecret(reader *bufio.Reader, out io.Writer, path, prompt string) (string, error) {
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		return strings.TrimSpace(string(content)), nil
+	}
+
+	fmt.Fprint(out, prompt)
+	line, err := reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// postAPI posts a JSON body to the server API and checks the response. The
+// response data is decoded into data unless it is nil.
+func postAPI(client *http.Client, url string, body interface{}, data interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "localca-cli")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Success bool            `json:"success"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&response); err != nil {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || !response.Success {
+		return fmt.Errorf("%s: %s", resp.Status, response.Message)
+	}
+	if data != nil {
+		if err := json.Unmarshal(response.Data, data); err != nil {
+			return fmt.Errorf("unexpected response data: %w", err)
+		}
+	}
+	return nil
+}
+
+// getServerURL returns the local server URL from the listen address
+func getServerURL() string {
+	addr := os.Getenv("LISTEN_ADDR")
+	if addr == "" {
+		addr = ":8080"
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	return "http://" + addr
+}
+
+// getSignerSocket returns the remote signer socket from the environment
+func getSignerSocket() string {
+	if socket := os.Getenv("REMOTE_SIGNER_SOCKET"); socket != "" {
+		return socket
+	}
+	return "./signer.sock"
+}
+
+// getDataDir returns the data directory from the environment
+func getDataDir() string {
+	if dir := os.Getenv("DATA_DIR"); dir != "" {
+		return dir
+	}
+	return "./data"
+}
@@ -65,7 +65,7 @@ export function DashboardHeader() {
 
   const handleDownloadCA = async () => {
     try {
-      const response = await fetch('/api/proxy/api/download/ca', {
+      const response = await fetch('/api/proxy/api/download/ca?format=pem', {
         credentials: 'include'
       })
       
@@ -98,7 +98,7 @@ export function DashboardHeader() {
 
   const handleDownloadCRL = async () => {
     try {
-      const response = await fetch('/api/proxy/api/download/crl', {
+      const response = await fetch('/api/proxy/api/download/crl?format=pem', {
         credentials: 'include'
       })
       
@@ -25,7 +25,7 @@ export function QuickActions() {
 
   const handleDownloadCA = async () => {
     try {
-      const response = await fetch('/api/proxy/api/download/ca', {
+      const response = await fetch('/api/proxy/api/download/ca?format=pem', {
         credentials: 'include'
       })
       
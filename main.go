@@ -45,6 +45,14 @@ func getSecureTLSConfig() *tls.Config {
 }
 
 func main() {
+	// Maintenance subcommands run instead of the server
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Initialize configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -124,13 +132,24 @@ func main() {
 		logger.WithError(err).Fatal("Failed to initialize certificate service")
 	}
 
+	// Unseal at startup when the operator supplied the passphrase, otherwise
+	// stay sealed until it is given through the API or the unseal command
+	if cfg.CAKeyPassword != "" {
+		if err := certSvc.Unseal(cfg.CAKeyPassword); err != nil {
+			logger.WithError(err).Fatal("Failed to unseal CA")
+		}
+		logger.Info("CA unsealed with the configured passphrase")
+	}
+
 	// Check if CA exists, create if it doesn't
 	exists, err := certSvc.CAExists()
 	if err != nil {
 		logger.WithError(err).Fatal("Failed to check CA existence")
 	}
 
-	if !exists {
+	if certSvc.Sealed() {
+		logger.Warn("CA is sealed, signing is unavailable until it is unsealed via POST /api/ca/unseal or the unseal command")
+	} else if !exists {
 		logger.Info("Creating new CA certificate...")
 		if err := certSvc.CreateCA(); err != nil {
 			logger.WithError(err).Fatal("Failed to create CA")
@@ -143,6 +162,13 @@ func main() {
 		logger.Info("Using existing CA certificate")
 	}
 
+	// Rebuild the certificate index so changes made while the server was down are picked up
+	if count, err := certSvc.RebuildIndex(); err != nil {
+		logger.WithError(err).Warn("Failed to rebuild certificate index")
+	} else {
+		logger.WithField("certificates", count).Info("Certificate index rebuilt")
+	}
+
 	// Load auth config and log setup token if setup is not completed
 	authConfig, err := handlers.LoadAuthConfig(baseStore)
 	if err != nil {
@@ -193,10 +219,26 @@ func main() {
 		}
 	}()
 
+	// Regenerate the CRL before it reaches its nextUpdate
+	go certSvc.StartCRLScheduler(ctx)
+
+	// Email certificate owners about certificates nearing expiry
+	go certSvc.StartExpiryNotifier(ctx)
+
+	// Renew certificates that opted into automatic renewal
+	go certSvc.StartRenewalScheduler(ctx)
+
+	// Revoke renewed certificates once their overlap window has passed
+	go certSvc.StartSupersedeScheduler(ctx)
+
 	// Start ACME server
 	go func() {
 		log.Println("Starting ACME server on port 8555...")
-		if err := acme.StartACMEServer(ctx, certSvc, baseStore, ":8555", getSecureTLSConfig()); err != nil {
+		if err := acme.StartACMEServer(ctx, certSvc, baseStore, ":8555", getSecureTLSConfig(), acme.ValidationOptions{
+			HTTPPort:    cfg.ACMEHTTP01Port,
+			TLSALPNPort: cfg.ACMETLSALPN01Port,
+			Resolver:    acme.NewResolver(cfg.ACMEResolvers),
+		}); err != nil {
 			if err != http.ErrServerClosed {
 				log.Printf("ACME server error: %v", err)
 			}
@@ -205,10 +247,6 @@ func main() {
 
 	// Start HTTPS server if TLS is enabled
 	if cfg.TLSEnabled {
-		// Make sure we have a CA cert and key
-		caCertPath := store.GetCAPublicKeyPath()
-		caKeyPath := store.GetCAPrivateKeyPath()
-
 		// Certificate paths for the service
 		serviceCert := filepath.Join(store.GetBasePath(), "service.crt")
 		serviceKey := filepath.Join(store.GetBasePath(), "service.key")
@@ -216,12 +254,9 @@ func main() {
 		// Check if service certificate exists
 		if _, err := os.Stat(serviceCert); os.IsNotExist(err) {
 			log.Println("Creating service certificate for HTTPS...")
-			// Use caCertPath and caKeyPath here
-			if _, err := os.Stat(caCertPath); os.IsNotExist(err) {
-				log.Fatalf("CA certificate not found at %s", caCertPath)
-			}
-			if _, err := os.Stat(caKeyPath); os.IsNotExist(err) {
-				log.Fatalf("CA private key not found at %s", caKeyPath)
+			// Make sure we have a CA that can issue; the root key may be offline in two-tier mode
+			if exists, err := certSvc.CAExists(); err != nil || !exists {
+				log.Fatalf("CA certificate or issuing key not found in %s", store.GetCADirectory())
 			}
 			if err := certSvc.CreateServiceCertificate(); err != nil {
 				log.Printf("Warning: Failed to create service certificate: %v. HTTPS will not be available.", err)
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/Lazarev-Cloud/localca-go/pkg/config"
@@ -98,3 +103,80 @@ func TestStorageInitialization(t *testing.T) {
 		t.Errorf("Base directory '%s' was not created", tempDir)
 	}
 }
+
+// TestRunUnseal tests that the unseal command logs in and posts the passphrase
+func TestRunUnseal(t *testing.T) {
+	var passphrase string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		switch r.URL.Path {
+		case "/api/login":
+			if body["username"] != "admin" || body["password"] != "admin-password" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"success":false,"message":"Invalid credentials"}`))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "token", Path: "/"})
+		case "/api/ca/unseal":
+			if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"success":false,"message":"Authentication required"}`))
+				return
+			}
+			passphrase = body["passphrase"]
+		}
+		w.Write([]byte(`{"success":true,"message":"ok"}`))
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	in := strings.NewReader("admin-password\nca passphrase\n")
+	if err := runCommand("unseal", []string{"-url", server.URL}, in, &out); err != nil {
+		t.Fatalf("Unseal failed: %v", err)
+	}
+	if passphrase != "ca passphrase" {
+		t.Errorf("Expected passphrase to be posted, got %q", passphrase)
+	}
+
+	in = strings.NewReader("wrong\nca passphrase\n")
+	if err := runCommand("unseal", []string{"-url", server.URL}, in, &out); err == nil {
+		t.Error("Expected unseal with a wrong admin password to fail")
+	}
+}
+
+// TestRunUnsealShares tests that the unseal command posts shares until the CA is unsealed
+func TestRunUnsealShares(t *testing.T) {
+	var shares []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if r.URL.Path == "/api/ca/unseal/shares" {
+			shares = append(shares, body["share"])
+			if len(shares) < 2 {
+				w.Write([]byte(`{"success":true,"message":"ok","data":{"sealed":true,"shares_submitted":1,"shares_required":2}}`))
+			} else {
+				w.Write([]byte(`{"success":true,"message":"ok","data":{"sealed":false}}`))
+			}
+			return
+		}
+		w.Write([]byte(`{"success":true,"message":"ok"}`))
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	in := strings.NewReader("admin-password\nAAAA-BBBB\n\nCCCC-DDDD\nEEEE-FFFF\n")
+	if err := runCommand("unseal", []string{"-url", server.URL, "-shares"}, in, &out); err != nil {
+		t.Fatalf("Unseal failed: %v", err)
+	}
+	if len(shares) != 2 || shares[0] != "AAAA-BBBB" || shares[1] != "CCCC-DDDD" {
+		t.Errorf("Expected two shares to be posted, got %q", shares)
+	}
+	if !strings.Contains(out.String(), "CA unsealed") {
+		t.Errorf("Expected the CA to be reported unsealed, got %q", out.String())
+	}
+}
@@ -1,14 +1,22 @@
 package acme
 
 import (
+	"context"
+	"crypto"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
-	"os"
 	"strings"
 	"time"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/certificates"
+	"github.com/Lazarev-Cloud/localca-go/pkg/security"
 )
 
 // handleNewAccount handles ACME account creation
@@ -18,37 +26,8 @@ func (s *ACMEServer) handleNewAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Read request body
-	body, err := readRequestBody(r)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
-	// Parse JWS
-	jws, err := ParseJWS(body)
-	if err != nil {
-		http.Error(w, "Invalid JWS", http.StatusBadRequest)
-		return
-	}
-
-	// Get nonce from header
-	nonce := r.Header.Get("Replay-Nonce")
-	if nonce == "" {
-		http.Error(w, "Missing nonce", http.StatusBadRequest)
-		return
-	}
-
-	// Verify nonce
-	if !s.validateNonce(nonce) {
-		http.Error(w, "Invalid nonce", http.StatusBadRequest)
-		return
-	}
-
-	// Verify JWS
-	payload, pubKey, err := VerifyJWS(jws, nonce, r.URL.String())
-	if err != nil {
-		http.Error(w, "Invalid JWS signature", http.StatusBadRequest)
+	req, ok := s.verifyRequest(w, r, false)
+	if !ok {
 		return
 	}
 
@@ -59,48 +38,43 @@ func (s *ACMEServer) handleNewAccount(w http.ResponseWriter, r *http.Request) {
 		OnlyReturnExisting   bool     `json:"onlyReturnExisting"`
 	}
 
-	if len(payload) > 0 {
-		if err := json.Unmarshal(payload, &accountReq); err != nil {
-			http.Error(w, "Invalid account request", http.StatusBadRequest)
+	if len(req.payload) > 0 {
+		if err := json.Unmarshal(req.payload, &accountReq); err != nil {
+			writeProblem(w, http.StatusBadRequest, "malformed", "Invalid account request")
 			return
 		}
 	}
 
-	// Check if account already exists
-	pubKeyBytes, err := x509.MarshalPKIXPublicKey(pubKey)
-	if err != nil {
-		log.Printf("Failed to marshal public key: %v", err)
-		http.Error(w, "Invalid public key", http.StatusBadRequest)
-		return
-	}
-
-	existingAccount, err := s.acmeStorage.FindAccountByKey(pubKeyBytes)
-	if err == nil && existingAccount != nil {
-		// Account exists, return it
-		baseURL := fmt.Sprintf("%s://%s", schemeFromRequest(r), r.Host)
-		accountURL := fmt.Sprintf("%s/acme/account/%s", baseURL, existingAccount.ID)
+	baseURL := requestBaseURL(r)
 
+	// Account exists, return it
+	if req.account != nil {
+		if req.account.Status != AccountStatusValid {
+			writeProblem(w, http.StatusUnauthorized, "unauthorized", fmt.Sprintf("Account is %s", req.account.Status))
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Location", accountURL)
+		w.Header().Set("Location", fmt.Sprintf("%s/acme/account/%s", baseURL, req.account.ID))
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  existingAccount.Status,
-			"contact": existingAccount.Contact,
-			"orders":  fmt.Sprintf("%s/acme/orders/%s", baseURL, existingAccount.ID),
-		})
+		json.NewEncoder(w).Encode(accountResponse(baseURL, req.account))
 		return
 	}
 
 	// If onlyReturnExisting is true and account doesn't exist, return error
 	if accountReq.OnlyReturnExisting {
-		http.Error(w, "Account does not exist", http.StatusBadRequest)
+		writeProblem(w, http.StatusBadRequest, "accountDoesNotExist", "Account does not exist")
+		return
+	}
+
+	if err := validateContacts(accountReq.Contact); err != nil {
+		writeProblem(w, http.StatusBadRequest, "invalidContact", err.Error())
 		return
 	}
 
 	// Create new account
 	account := &Account{
 		ID:        generateID(),
-		Key:       pubKey,
+		Key:       req.key,
 		Contact:   accountReq.Contact,
 		Status:    AccountStatusValid,
 		CreatedAt: time.Now(),
@@ -109,22 +83,15 @@ func (s *ACMEServer) handleNewAccount(w http.ResponseWriter, r *http.Request) {
 	// Save account
 	if err := s.acmeStorage.SaveAccount(account); err != nil {
 		log.Printf("Failed to save account: %v", err)
-		http.Error(w, "Failed to create account", http.StatusInternalServerError)
+		writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to create account")
 		return
 	}
 
 	// Return account
-	baseURL := fmt.Sprintf("%s://%s", schemeFromRequest(r), r.Host)
-	accountURL := fmt.Sprintf("%s/acme/account/%s", baseURL, account.ID)
-
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Location", accountURL)
+	w.Header().Set("Location", fmt.Sprintf("%s/acme/account/%s", baseURL, account.ID))
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  account.Status,
-		"contact": account.Contact,
-		"orders":  fmt.Sprintf("%s/acme/orders/%s", baseURL, account.ID),
-	})
+	json.NewEncoder(w).Encode(accountResponse(baseURL, account))
 }
 
 // handleNewOrder handles ACME order creation
@@ -134,53 +101,11 @@ func (s *ACMEServer) handleNewOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Read request body
-	body, err := readRequestBody(r)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
-	}
-
-	// Parse JWS
-	jws, err := ParseJWS(body)
-	if err != nil {
-		http.Error(w, "Invalid JWS", http.StatusBadRequest)
-		return
-	}
-
-	// Get nonce from header
-	nonce := r.Header.Get("Replay-Nonce")
-	if nonce == "" {
-		http.Error(w, "Missing nonce", http.StatusBadRequest)
-		return
-	}
-
-	// Verify nonce
-	if !s.validateNonce(nonce) {
-		http.Error(w, "Invalid nonce", http.StatusBadRequest)
-		return
-	}
-
-	// Verify JWS and get account
-	payload, pubKey, err := VerifyJWS(jws, nonce, r.URL.String())
-	if err != nil {
-		http.Error(w, "Invalid JWS signature", http.StatusBadRequest)
-		return
-	}
-
-	// Find account
-	pubKeyBytes, err := x509.MarshalPKIXPublicKey(pubKey)
-	if err != nil {
-		log.Printf("Failed to marshal public key: %v", err)
-		http.Error(w, "Invalid public key", http.StatusBadRequest)
-		return
-	}
-
-	account, err := s.acmeStorage.FindAccountByKey(pubKeyBytes)
-	if err != nil || account == nil {
-		http.Error(w, "Account not found", http.StatusBadRequest)
+	req, ok := s.verifyRequest(w, r, true)
+	if !ok {
 		return
 	}
+	account := req.account
 
 	// Parse order request
 	var orderReq struct {
@@ -192,9 +117,17 @@ func (s *ACMEServer) handleNewOrder(w http.ResponseWriter, r *http.Request) {
 		NotAfter  *time.Time `json:"notAfter,omitempty"`
 	}
 
-	if len(payload) > 0 {
-		if err := json.Unmarshal(payload, &orderReq); err != nil {
-			http.Error(w, "Invalid order request", http.StatusBadRequest)
+	if err := json.Unmarshal(req.payload, &orderReq); err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Invalid order request")
+		return
+	}
+	if len(orderReq.Identifiers) == 0 {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Order has no identifiers")
+		return
+	}
+	for _, id := range orderReq.Identifiers {
+		if errorType, detail := orderIdentifierProblem(Identifier{Type: id.Type, Value: id.Value}); errorType != "" {
+			writeProblem(w, http.StatusBadRequest, errorType, detail)
 			return
 		}
 	}
@@ -218,7 +151,7 @@ func (s *ACMEServer) handleNewOrder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create authorizations for each identifier
-	baseURL := fmt.Sprintf("%s://%s", schemeFromRequest(r), r.Host)
+	baseURL := requestBaseURL(r)
 	for _, identifier := range order.Identifiers {
 		authz := &Authorization{
 			ID:         generateID(),
@@ -229,32 +162,46 @@ func (s *ACMEServer) handleNewOrder(w http.ResponseWriter, r *http.Request) {
 			CreatedAt:  time.Now(),
 		}
 
-		// Create HTTP-01 challenge
-		challenge := &Challenge{
-			ID:              generateID(),
-			AuthorizationID: authz.ID,
-			Type:            ChallengeTypeHTTP01,
-			Status:          ChallengeStatusPending,
-			Token:           generateToken(),
-			URL:             fmt.Sprintf("%s/acme/challenge/%s", baseURL, generateID()),
-			CreatedAt:       time.Now(),
+		// Wildcard names are authorized for their base domain, by dns-01 only.
+		// IP addresses have no zone for dns-01 (RFC 8738) and tls-alpn-01 is
+		// only validated for DNS names, which leaves http-01.
+		challengeTypes := []string{ChallengeTypeHTTP01, ChallengeTypeDNS01, ChallengeTypeTLSALPN01}
+		switch {
+		case identifier.Type == "ip":
+			challengeTypes = []string{ChallengeTypeHTTP01}
+		case strings.HasPrefix(identifier.Value, "*."):
+			authz.Identifier.Value = strings.TrimPrefix(identifier.Value, "*.")
+			authz.Wildcard = true
+			challengeTypes = []string{ChallengeTypeDNS01}
+		}
+
+		for _, challengeType := range challengeTypes {
+			challenge := &Challenge{
+				ID:              generateID(),
+				AuthorizationID: authz.ID,
+				Type:            challengeType,
+				Status:          ChallengeStatusPending,
+				Token:           generateToken(),
+				CreatedAt:       time.Now(),
+			}
+			challenge.URL = fmt.Sprintf("%s/acme/challenge/%s", baseURL, challenge.ID)
+			authz.Challenges = append(authz.Challenges, challenge)
 		}
 
-		authz.Challenges = []*Challenge{challenge}
 		authz.Status = AuthzStatusPending
 		order.Authorizations = append(order.Authorizations, fmt.Sprintf("%s/acme/authz/%s", baseURL, authz.ID))
 
 		// Save authorization and challenges
 		if err := s.acmeStorage.SaveAuthorization(authz); err != nil {
 			log.Printf("Failed to save authorization: %v", err)
-			http.Error(w, "Failed to create authorization", http.StatusInternalServerError)
+			writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to create authorization")
 			return
 		}
 
 		for _, challenge := range authz.Challenges {
 			if err := s.acmeStorage.SaveChallenge(challenge); err != nil {
 				log.Printf("Failed to save challenge: %v", err)
-				http.Error(w, "Failed to create challenge", http.StatusInternalServerError)
+				writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to create challenge")
 				return
 			}
 		}
@@ -266,7 +213,7 @@ func (s *ACMEServer) handleNewOrder(w http.ResponseWriter, r *http.Request) {
 	// Save order
 	if err := s.acmeStorage.SaveOrder(order); err != nil {
 		log.Printf("Failed to save order: %v", err)
-		http.Error(w, "Failed to create order", http.StatusInternalServerError)
+		writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to create order")
 		return
 	}
 
@@ -274,16 +221,11 @@ func (s *ACMEServer) handleNewOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Location", fmt.Sprintf("%s/acme/order/%s", baseURL, order.ID))
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":         order.Status,
-		"expires":        order.Expires.Format(time.RFC3339),
-		"identifiers":    order.Identifiers,
-		"authorizations": order.Authorizations,
-		"finalize":       order.FinalizeURL,
-	})
+	json.NewEncoder(w).Encode(orderResponse(order))
 }
 
-// handleChallenge handles ACME challenge validation
+// handleChallenge handles ACME challenge validation. A POST-as-GET returns
+// the challenge; any other payload asks for it to be validated.
 func (s *ACMEServer) handleChallenge(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -296,102 +238,113 @@ func (s *ACMEServer) handleChallenge(w http.ResponseWriter, r *http.Request) {
 	// Get challenge
 	challenge, err := s.acmeStorage.GetChallenge(challengeID)
 	if err != nil {
-		http.Error(w, "Challenge not found", http.StatusNotFound)
+		writeProblem(w, http.StatusNotFound, "malformed", "Challenge not found")
 		return
 	}
 
-	// Read request body
-	body, err := readRequestBody(r)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+	req, ok := s.verifyRequest(w, r, true)
+	if !ok {
 		return
 	}
 
-	// Parse JWS
-	jws, err := ParseJWS(body)
+	// Only the account that placed the order may answer its challenges
+	authz, err := s.acmeStorage.GetAuthorization(challenge.AuthorizationID)
 	if err != nil {
-		http.Error(w, "Invalid JWS", http.StatusBadRequest)
+		writeProblem(w, http.StatusNotFound, "malformed", "Authorization not found")
 		return
 	}
-
-	// Get nonce from header
-	nonce := r.Header.Get("Replay-Nonce")
-	if nonce == "" {
-		http.Error(w, "Missing nonce", http.StatusBadRequest)
+	order, err := s.acmeStorage.GetOrder(authz.OrderID)
+	if err != nil || order.AccountID != req.account.ID {
+		writeProblem(w, http.StatusForbidden, "unauthorized", "Challenge belongs to another account")
 		return
 	}
+	s.refreshAuthorizationStatus(authz)
 
-	// Verify nonce
-	if !s.validateNonce(nonce) {
-		http.Error(w, "Invalid nonce", http.StatusBadRequest)
-		return
-	}
+	w.Header().Add("Link", fmt.Sprintf(`<%s/acme/authz/%s>;rel="up"`, requestBaseURL(r), authz.ID))
 
-	// Verify JWS
-	_, pubKey, err := VerifyJWS(jws, nonce, r.URL.String())
-	if err != nil {
-		http.Error(w, "Invalid JWS signature", http.StatusBadRequest)
+	// A challenge is only validated once, and only while its authorization
+	// is pending
+	if req.postAsGet() || challenge.Status != ChallengeStatusPending || authz.Status != AuthzStatusPending {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(challengeResponse(challenge))
 		return
 	}
 
-	// Find account
-	pubKeyBytes, err := x509.MarshalPKIXPublicKey(pubKey)
+	keyAuth, err := keyAuthorization(challenge.Token, req.key)
 	if err != nil {
-		log.Printf("Failed to marshal public key: %v", err)
-		http.Error(w, "Invalid public key", http.StatusBadRequest)
-		return
-	}
-
-	account, err := s.acmeStorage.FindAccountByKey(pubKeyBytes)
-	if err != nil || account == nil {
-		http.Error(w, "Account not found", http.StatusBadRequest)
+		writeProblem(w, http.StatusBadRequest, "badPublicKey", "Invalid account key")
 		return
 	}
 
 	// Update challenge status to processing
 	challenge.Status = ChallengeStatusProcessing
+	challenge.KeyAuthorization = keyAuth
 	if err := s.acmeStorage.SaveChallenge(challenge); err != nil {
 		log.Printf("Failed to update challenge: %v", err)
-		http.Error(w, "Failed to update challenge", http.StatusInternalServerError)
+		writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to update challenge")
 		return
 	}
 
 	// Validate challenge
-	if s.validateHTTP01Challenge(challenge) {
+	if err := s.validateChallenge(r.Context(), authz, challenge); err != nil {
+		log.Printf("%s challenge for %s failed: %v", challenge.Type, authz.Identifier.Value, err)
+		challenge.Status = ChallengeStatusInvalid
+		challenge.Error = challengeProblem(err)
+		authz.Status = AuthzStatusInvalid
+	} else {
 		challenge.Status = ChallengeStatusValid
 		challenge.Validated = time.Now()
-	} else {
-		challenge.Status = ChallengeStatusInvalid
-		challenge.Error = &ProblemDetails{
-			Type:   "urn:ietf:params:acme:error:unauthorized",
-			Detail: "Challenge validation failed",
-		}
+		authz.Status = AuthzStatusValid
 	}
 
 	if err := s.acmeStorage.SaveChallenge(challenge); err != nil {
 		log.Printf("Failed to update challenge: %v", err)
-		http.Error(w, "Failed to update challenge", http.StatusInternalServerError)
+		writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to update challenge")
 		return
 	}
+	if err := s.acmeStorage.SaveAuthorization(authz); err != nil {
+		log.Printf("Failed to update authorization: %v", err)
+	}
+	if err := s.refreshOrderStatus(order); err != nil {
+		log.Printf("Failed to update order: %v", err)
+	}
 
 	// Return challenge
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(challenge)
+	json.NewEncoder(w).Encode(challengeResponse(challenge))
 }
 
-// validateHTTP01Challenge validates an HTTP-01 challenge
-func (s *ACMEServer) validateHTTP01Challenge(challenge *Challenge) bool {
-	// Get authorization
-	authz, err := s.acmeStorage.GetAuthorization(challenge.AuthorizationID)
-	if err != nil {
-		log.Printf("Failed to get authorization: %v", err)
-		return false
+// identifier
+func (s *ACMEServer) validateChallenge(ctx context.Context, authz *Authorization, challenge *Challenge) error {
+	switch challenge.Type {
+	case ChallengeTypeHTTP01:
+		if authz.Wildcard {
+			return &validationError{"unauthorized", "wildcard identifiers must be validated with dns-01"}
+		}
+		return s.validation.validateHTTP01(ctx, authz.Identifier, challenge.Token, challenge.KeyAuthorization)
+	case ChallengeTypeDNS01:
+		return s.validation.validateDNS01(ctx, authz.Identifier, challenge.KeyAuthorization)
+	case ChallengeTypeTLSALPN01:
+		if authz.Wildcard {
+			return &validationError{"unauthorized", "wildcard identifiers must be validated with dns-01"}
+		}
+		return s.validation.validateTLSALPN01(ctx, authz.Identifier, challenge.KeyAuthorization)
+	default:
+		return &validationError{"malformed", fmt.Sprintf("unsupported challenge type %s", challenge.Type)}
 	}
+}
 
-	// For now, just return true for testing
-	// In a real implementation, you would make an HTTP request to validate
-	log.Printf("Validating HTTP-01 challenge for %s", authz.Identifier.Value)
-	return true
+// challengeProblem returns the problem document for a failed validation
+func challengeProblem(err error) *ProblemDetails {
+	var validationErr *validationError
+	if errors.As(err, &validationErr) {
+		return validationErr.problem()
+	}
+	return &ProblemDetails{
+		Type:   "urn:ietf:params:acme:error:serverInternal",
+		Detail: err.Error(),
+		Status: http.StatusInternalServerError,
+	}
 }
 
 // handleFinalize handles ACME order finalization
@@ -402,103 +355,483 @@ func (s *ACMEServer) handleFinalize(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Extract order ID from URL
-	certID := strings.TrimPrefix(r.URL.Path, "/acme/finalize/")
+	orderID := strings.TrimPrefix(r.URL.Path, "/acme/finalize/")
 
 	// Get order
-	order, err := s.acmeStorage.GetOrder(certID)
+	order, err := s.acmeStorage.GetOrder(orderID)
 	if err != nil {
-		http.Error(w, "Order not found", http.StatusNotFound)
+		writeProblem(w, http.StatusNotFound, "malformed", "Order not found")
 		return
 	}
 
-	// Read request body
-	body, err := readRequestBody(r)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+	req, ok := s.verifyRequest(w, r, true)
+	if !ok {
 		return
 	}
 
-	// Parse JWS
-	jws, err := ParseJWS(body)
-	if err != nil {
-		http.Error(w, "Invalid JWS", http.StatusBadRequest)
+	// Only the account that placed the order may finalize it, once every
+	// identifier is authorized
+	if order.AccountID != req.account.ID {
+		writeProblem(w, http.StatusForbidden, "unauthorized", "Order belongs to another account")
 		return
 	}
-
-	// Get nonce from header
-	nonce := r.Header.Get("Replay-Nonce")
-	if nonce == "" {
-		http.Error(w, "Missing nonce", http.StatusBadRequest)
+	if err := s.refreshOrderStatus(order); err != nil {
+		log.Printf("Failed to update order: %v", err)
+	}
+	if order.Status != OrderStatusReady {
+		writeProblem(w, http.StatusForbidden, "orderNotReady", fmt.Sprintf("Order is %s", order.Status))
 		return
 	}
 
-	// Verify nonce
-	if !s.validateNonce(nonce) {
-		http.Error(w, "Invalid nonce", http.StatusBadRequest)
+	// Parse finalize request
+	var finalizeReq struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(req.payload, &finalizeReq); err != nil || finalizeReq.CSR == "" {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Invalid finalize request")
 		return
 	}
 
-	// Verify JWS
-	_, pubKey, err := VerifyJWS(jws, nonce, r.URL.String())
+	csrDER, err := base64.RawURLEncoding.DecodeString(finalizeReq.CSR)
 	if err != nil {
-		http.Error(w, "Invalid JWS signature", http.StatusBadRequest)
+		writeProblem(w, http.StatusBadRequest, "badCSR", "CSR is not base64url encoded")
 		return
 	}
-
-	// Find account
-	pubKeyBytes, err := x509.MarshalPKIXPublicKey(pubKey)
+	csr, err := certificates.ParseCSR(csrDER)
 	if err != nil {
-		log.Printf("Failed to marshal public key: %v", err)
-		http.Error(w, "Invalid public key", http.StatusBadRequest)
+		writeProblem(w, http.StatusBadRequest, "badCSR", err.Error())
 		return
 	}
-
-	account, err := s.acmeStorage.FindAccountByKey(pubKeyBytes)
-	if err != nil || account == nil {
-		http.Error(w, "Account not found", http.StatusBadRequest)
+	if err := matchCSRIdentifiers(csr, order.Identifiers); err != nil {
+		writeProblem(w, http.StatusBadRequest, "badCSR", err.Error())
 		return
 	}
 
-	// Create certificate using the certificate service
-	certName := fmt.Sprintf("acme-%s", order.ID)
-	domains := make([]string, len(order.Identifiers))
-	for i, identifier := range order.Identifiers {
-		domains[i] = identifier.Value
+	order.Status = OrderStatusProcessing
+	if err := s.acmeStorage.SaveOrder(order); err != nil {
+		log.Printf("Failed to update order: %v", err)
+		writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to update order")
+		return
 	}
 
-	// Issue certificate
-	err = s.certSvc.CreateServerCertificate(certName, domains)
-	if err != nil {
-		log.Printf("Failed to issue certificate: %v", err)
-		http.Error(w, "Failed to issue certificate", http.StatusInternalServerError)
+	// Sign the public key of the CSR; the private key stays with the client.
+	// The order goes back to ready when the CSR or a sealed CA is to blame, so
+	// that the client can try again.
+	signed, err := s.certSvc.SignCSR(csrDER, certificates.CSRSignOptions{Name: acmeCertificateName(order.ID)})
+	if errors.Is(err, certificates.ErrCASealed) || errors.Is(err, certificates.ErrInvalidCSR) {
+		order.Status = OrderStatusReady
+		if saveErr := s.acmeStorage.SaveOrder(order); saveErr != nil {
+			log.Printf("Failed to update order: %v", saveErr)
+		}
+		if errors.Is(err, certificates.ErrCASealed) {
+			w.Header().Set("Retry-After", "60")
+			writeProblem(w, http.StatusServiceUnavailable, "serverInternal", "CA is sealed")
+		} else {
+			writeProblem(w, http.StatusBadRequest, "badCSR", err.Error())
+		}
 		return
 	}
-
-	// Read certificate file
-	certPath := s.storage.GetCertificatePath(certName)
-	certData, err := os.ReadFile(certPath)
 	if err != nil {
-		log.Printf("Failed to read certificate: %v", err)
-		http.Error(w, "Failed to read certificate", http.StatusInternalServerError)
+		log.Printf("Failed to issue certificate: %v", err)
+		order.Status = OrderStatusInvalid
+		order.Error = &ProblemDetails{
+			Type:   "urn:ietf:params:acme:error:serverInternal",
+			Detail: "Failed to issue certificate",
+			Status: http.StatusInternalServerError,
+		}
+		if saveErr := s.acmeStorage.SaveOrder(order); saveErr != nil {
+			log.Printf("Failed to update order: %v", saveErr)
+		}
+		writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to issue certificate")
 		return
 	}
 
 	// Update order status
+	baseURL := requestBaseURL(r)
+	order.CSR = csrDER
+	order.Certificate = append(append([]byte{}, signed.CertificatePEM...), signed.ChainPEM...)
 	order.Status = OrderStatusValid
-	order.CertificateURL = fmt.Sprintf("%s://%s/acme/certificate/%s", schemeFromRequest(r), r.Host, order.ID)
+	order.CertificateURL = fmt.Sprintf("%s/acme/certificate/%s", baseURL, order.ID)
 	if err := s.acmeStorage.SaveOrder(order); err != nil {
 		log.Printf("Failed to update order: %v", err)
+		writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to update order")
+		return
 	}
 
-	// Return certificate
-	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	// Return order
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("%s/acme/order/%s", baseURL, order.ID))
 	w.WriteHeader(http.StatusOK)
-	w.Write(certData)
+	json.NewEncoder(w).Encode(orderResponse(order))
+}
+
+// acmeCertificateName returns the storage name of the certificate issued for an order
+func acmeCertificateName(orderID string) string {
+	return fmt.Sprintf("acme-%s", orderID)
 }
 
+// checkOrderAuthorized returns an error unless every identifier of an order
+// has a valid, unexpired authorization
+func (s *ACMEServer) checkOrderAuthorized(order *Order) error {
+	authzs, err := s.acmeStorage.GetAuthorizationsByOrder(order.ID)
+	if err != nil {
+		return err
+	}
+
+	authorized := make(map[Identifier]bool)
+	now := time.Now()
+	for _, authz := range authzs {
+		if authz.Status != AuthzStatusValid || authz.Expires.Before(now) {
+			continue
+		}
+		identifier := authz.Identifier
+		if authz.Wildcard {
+			identifier.Value = "*." + identifier.Value
+		}
+		authorized[normalizeIdentifier(identifier)] = true
+	}
+
+	for _, identifier := range order.Identifiers {
+		if !authorized[normalizeIdentifier(identifier)] {
+			return fmt.Errorf("identifier %s is not authorized", identifier.Value)
+		}
+	}
+	return nil
+}
+
+// refreshAuthorizationStatus expires a pending or valid authorization whose
+// expiry has passed
+func (s *ACMEServer) refreshAuthorizationStatus(authz *Authorization) {
+	if (authz.Status != AuthzStatusPending && authz.Status != AuthzStatusValid) || time.Now().Before(authz.Expires) {
+		return
+	}
+	authz.Status = AuthzStatusExpired
+	if err := s.acmeStorage.SaveAuthorization(authz); err != nil {
+		log.Printf("Failed to update authorization: %v", err)
+	}
+}
+
+// refreshOrderStatus moves a pending or ready order to the status its
+// authorizations call for: invalid once the order expires or one of them
+// can no longer become valid, ready once every identifier is authorized and
+// pending otherwise. Orders that are processing or final are left alone.
+func (s *ACMEServer) refreshOrderStatus(order *Order) error {
+	if order.Status != OrderStatusPending && order.Status != OrderStatusReady {
+		return nil
+	}
+
+	authzs, err := s.acmeStorage.GetAuthorizationsByOrder(order.ID)
+	if err != nil {
+		return err
+	}
+
+	status := OrderStatusPending
+	var problem *ProblemDetails
+	if time.Now().After(order.Expires) {
+		status = OrderStatusInvalid
+		problem = &ProblemDetails{Type: "urn:ietf:params:acme:error:unauthorized", Detail: "Order expired", Status: http.StatusForbidden}
+	} else {
+		for _, authz := range authzs {
+			s.refreshAuthorizationStatus(authz)
+			if authz.Status != AuthzStatusPending && authz.Status != AuthzStatusValid {
+				status = OrderStatusInvalid
+				problem = &ProblemDetails{
+					Type:   "urn:ietf:params:acme:error:unauthorized",
+					Detail: fmt.Sprintf("Authorization for %s is %s", authz.Identifier.Value, authz.Status),
+					Status: http.StatusForbidden,
+				}
+				break
+			}
+		}
+		if status == OrderStatusPending && s.checkOrderAuthorized(order) == nil {
+			status = OrderStatusReady
+		}
+	}
+
+	if status == order.Status {
+		return nil
+	}
+	order.Status = status
+	order.Error = problem
+	return s.acmeStorage.SaveOrder(order)
+}
+
+// orderIdentifierProblem returns the ACME error type and detail when an
+// identifier cannot be ordered: only DNS names, optionally with a leading
+// wildcard label, and IP addresses are supported. Both are empty when the
+// identifier is acceptable.
+func orderIdentifierProblem(identifier Identifier) (string, string) {
+	switch identifier.Type {
+	case "dns":
+		if !security.ValidateDNSName(identifier.Value) {
+			return "rejectedIdentifier", fmt.Sprintf("%q is not a valid DNS name", identifier.Value)
+		}
+		if net.ParseIP(identifier.Value) != nil {
+			return "rejectedIdentifier", fmt.Sprintf("%s is an IP address, order it as an ip identifier", identifier.Value)
+		}
+	case "ip":
+		if strings.HasPrefix(identifier.Value, "*.") {
+			return "rejectedIdentifier", "IP identifiers cannot be wildcards"
+		}
+		if !security.ValidateIPAddress(identifier.Value) {
+			return "rejectedIdentifier", fmt.Sprintf("%q is not a valid IP address", identifier.Value)
+		}
+	default:
+		return "unsupportedIdentifier", fmt.Sprintf("identifier type %q is not supported", identifier.Type)
+	}
+	return "", ""
+}
+
+// normalizeIdentifier returns an identifier in the form used for comparison:
+// DNS names in lower case without a trailing dot, IP addresses in canonical form
+func normalizeIdentifier(identifier Identifier) Identifier {
+	identifier.Type = strings.ToLower(identifier.Type)
+	switch identifier.Type {
+	case "dns":
+		identifier.Value = strings.TrimSuffix(strings.ToLower(identifier.Value), ".")
+	case "ip":
+		if ip := net.ParseIP(identifier.Value); ip != nil {
+			identifier.Value = ip.String()
+		}
+	}
+	return identifier
+}
+
+// matchCSRIdentifiers checks that a CSR requests exactly the identifiers of
+// an order: its common name, DNS names and IP addresses together must cover
+// every identifier and nothing else
+func matchCSRIdentifiers(csr *x509.CertificateRequest, identifiers []Identifier) error {
+	if len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
+		return fmt.Errorf("CSR requests email addresses or URIs, which orders cannot authorize")
+	}
+
+	requested := make(map[Identifier]bool)
+	if cn := csr.Subject.CommonName; cn != "" {
+		if net.ParseIP(cn) != nil {
+			requested[normalizeIdentifier(Identifier{Type: "ip", Value: cn})] = true
+		} else {
+			requested[normalizeIdentifier(Identifier{Type: "dns", Value: cn})] = true
+		}
+	}
+	for _, name := range csr.DNSNames {
+		requested[normalizeIdentifier(Identifier{Type: "dns", Value: name})] = true
+	}
+	for _, ip := range csr.IPAddresses {
+		requested[normalizeIdentifier(Identifier{Type: "ip", Value: ip.String()})] = true
+	}
+
+	ordered := make(map[Identifier]bool)
+	for _, identifier := range identifiers {
+		ordered[normalizeIdentifier(identifier)] = true
+	}
+
+	for identifier := range requested {
+		if !ordered[identifier] {
+			return fmt.Errorf("CSR requests %s identifier %s, which is not in the order", identifier.Type, identifier.Value)
+		}
+	}
+	for identifier := range ordered {
+		if !requested[identifier] {
+			return fmt.Errorf("CSR does not request %s identifier %s of the order", identifier.Type, identifier.Value)
+		}
+	}
+	return nil
+}
+
+// writeProblem writes an ACME problem document
+func writeProblem(w http.ResponseWriter, status int, errorType, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ProblemDetails{
+		Type:   "urn:ietf:params:acme:error:" + errorType,
+		Detail: detail,
+		Status: status,
+	})
+}
+
+// maxRequestBodySize caps the size of ACME request bodies
+const maxRequestBodySize = 64 * 1024
+
 // readRequestBody reads the request body
 func readRequestBody(r *http.Request) ([]byte, error) {
-	body := make([]byte, r.ContentLength)
-	_, err := r.Body.Read(body)
-	return body, err
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxRequestBodySize {
+		return nil, fmt.Errorf("request body exceeds %d bytes", maxRequestBodySize)
+	}
+	return body, nil
+}
+
+// accountResponse returns the ACME account object of an account
+func accountResponse(baseURL string, account *Account) map[string]interface{} {
+	response := map[string]interface{}{
+		"status": account.Status,
+		"orders": fmt.Sprintf("%s/acme/orders/%s", baseURL, account.ID),
+	}
+	if len(account.Contact) > 0 {
+		response["contact"] = account.Contact
+	}
+	return response
+}
+
+// orderResponse returns the ACME order object of an order
+func orderResponse(order *Order) map[string]interface{} {
+	response := map[string]interface{}{
+		"status":         order.Status,
+		"expires":        order.Expires.UTC().Format(time.RFC3339),
+		"identifiers":    order.Identifiers,
+		"authorizations": order.Authorizations,
+		"finalize":       order.FinalizeURL,
+	}
+	if order.CertificateURL != "" {
+		response["certificate"] = order.CertificateURL
+	}
+	if order.Error != nil {
+		response["error"] = order.Error
+	}
+	return response
+}
+
+// authorizationResponse returns the ACME authorization object of an
+// authorization with its challenges
+func authorizationResponse(authz *Authorization, challenges []*Challenge) map[string]interface{} {
+	challengeResponses := make([]map[string]interface{}, 0, len(challenges))
+	for _, challenge := range challenges {
+		challengeResponses = append(challengeResponses, challengeResponse(challenge))
+	}
+
+	response := map[string]interface{}{
+		"identifier": authz.Identifier,
+		"status":     authz.Status,
+		"expires":    authz.Expires.UTC().Format(time.RFC3339),
+		"challenges": challengeResponses,
+	}
+	if authz.Wildcard {
+		response["wildcard"] = true
+	}
+	return response
+}
+
+// challengeResponse returns the ACME challenge object of a challenge
+func challengeResponse(challenge *Challenge) map[string]interface{} {
+	response := map[string]interface{}{
+		"type":   challenge.Type,
+		"url":    challenge.URL,
+		"status": challenge.Status,
+		"token":  challenge.Token,
+	}
+	if !challenge.Validated.IsZero() {
+		response["validated"] = challenge.Validated.UTC().Format(time.RFC3339)
+	}
+	if challenge.Error != nil {
+		response["error"] = challenge.Error
+	}
+	return response
+}
+
+// validateContacts checks that account contacts are mailto URLs
+func validateContacts(contacts []string) error {
+	for _, contact := range contacts {
+		address, ok := strings.CutPrefix(contact, "mailto:")
+		if !ok {
+			return fmt.Errorf("contact %q is not a mailto URL", contact)
+		}
+		if strings.ContainsAny(address, ",?") || !strings.Contains(address, "@") {
+			return fmt.Errorf("contact %q is not a single email address", contact)
+		}
+	}
+	return nil
+}
+
+// acmeRequest is a verified ACME request
+type acmeRequest struct {
+	payload []byte
+	key     crypto.PublicKey
+	// account signed the request; nil when a new-account request comes from
+	// an unknown key
+	account *Account
+}
+
+// postAsGet reports whether the request is a POST-as-GET, which has an
+// empty payload
+func (req *acmeRequest) postAsGet() bool {
+	return len(req.payload) == 0
+}
+
+// verifyRequest reads the JWS of a request and verifies its nonce, URL and
+// signature, by the jwk it embeds or by the key of the account its kid
+// refers to. With requireAccount the signer must have a valid account. A
+// rejected request gets a problem document and false is returned.
+func (s *ACMEServer) verifyRequest(w http.ResponseWriter, r *http.Request, requireAccount bool) (*acmeRequest, bool) {
+	baseURL := requestBaseURL(r)
+
+	// Every response carries a fresh nonce, so clients can retry a badNonce
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	w.Header().Add("Link", fmt.Sprintf(`<%s/acme/directory>;rel="index"`, baseURL))
+
+	body, err := readRequestBody(r)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Failed to read request body")
+		return nil, false
+	}
+	jws, err := ParseJWS(body)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Invalid JWS")
+		return nil, false
+	}
+	header, err := jws.ProtectedHeader()
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Invalid JWS header")
+		return nil, false
+	}
+	if !s.validateNonce(header.Nonce) {
+		writeProblem(w, http.StatusBadRequest, "badNonce", "Invalid nonce")
+		return nil, false
+	}
+
+	// The kid is the URL of the account
+	var account *Account
+	if header.Kid != "" {
+		accountID, ok := strings.CutPrefix(header.Kid, baseURL+"/acme/account/")
+		if ok {
+			account, err = s.acmeStorage.GetAccount(accountID)
+		}
+		if !ok || err != nil {
+			writeProblem(w, http.StatusBadRequest, "accountDoesNotExist", "Account not found")
+			return nil, false
+		}
+	}
+	lookup := func(string) (crypto.PublicKey, error) {
+		return account.Key, nil
+	}
+
+	payload, pubKey, err := VerifyJWSWithKeyLookup(jws, header.Nonce, baseURL+r.URL.Path, lookup)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Invalid JWS signature")
+		return nil, false
+	}
+
+	if account == nil {
+		pubKeyBytes, err := x509.MarshalPKIXPublicKey(pubKey)
+		if err != nil {
+			writeProblem(w, http.StatusBadRequest, "badPublicKey", "Invalid public key")
+			return nil, false
+		}
+		account, _ = s.acmeStorage.FindAccountByKey(pubKeyBytes)
+	}
+
+	if requireAccount {
+		if account == nil {
+			writeProblem(w, http.StatusBadRequest, "accountDoesNotExist", "Account not found")
+			return nil, false
+		}
+		if account.Status != AccountStatusValid {
+			writeProblem(w, http.StatusUnauthorized, "unauthorized", fmt.Sprintf("Account is %s", account.Status))
+			return nil, false
+		}
+	}
+
+	return &acmeRequest{payload: payload, key: pubKey, account: account}, true
 }
@@ -0,0 +1,727 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testACMEServerURL is the base URL test requests are sent to
+const testACMEServerURL = "http://example.com"
+
+// testACMEClient signs requests to an ACME server with an account key, by
+// kid once the account is registered the way stock clients do
+type testACMEClient struct {
+	t          *testing.T
+	server     *ACMEServer
+	router     *http.ServeMux
+	key        *ecdsa.PrivateKey
+	accountURL string
+}
+
+func newTestACMEClient(t *testing.T, server *ACMEServer, router *http.ServeMux) *testACMEClient {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate account key: %v", err)
+	}
+	return &testACMEClient{t: t, server: server, router: router, key: key}
+}
+
+// post sends a JWS signed with the account key and a fresh nonce to a path
+// of the server. A nil payload makes it a POST-as-GET.
+func (c *testACMEClient) post(target string, payload interface{}) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	target = testACMEServerURL + target
+	header := JWSHeader{Alg: "ES256", Nonce: c.server.newNonce(), URL: target, Kid: c.accountURL}
+	if c.accountURL == "" {
+		header.Jwk = &JWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64URLEncode(c.key.X.FillBytes(make([]byte, 32))),
+			Y:   base64URLEncode(c.key.Y.FillBytes(make([]byte, 32))),
+		}
+	}
+	headerJSON, _ := json.Marshal(header)
+	var payloadJSON []byte
+	if payload != nil {
+		payloadJSON, _ = json.Marshal(payload)
+	}
+	jws := JWS{Protected: base64URLEncode(headerJSON), Payload: base64URLEncode(payloadJSON)}
+
+	hash := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, hash[:])
+	if err != nil {
+		c.t.Fatalf("Failed to sign JWS: %v", err)
+	}
+	jws.Signature = base64URLEncode(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...))
+
+	body, _ := json.Marshal(jws)
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/jose+json")
+
+	// A test sends more requests than the burst rate limit allows
+	c.server.rateLimitMutex.Lock()
+	delete(c.server.ipRateLimits, req.RemoteAddr)
+	c.server.rateLimitMutex.Unlock()
+
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, req)
+	return w
+}
+
+func newTestCSR(t *testing.T, key *ecdsa.PrivateKey, commonName string, dnsNames ...string) string {
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: dnsNames,
+	}, key)
+	if err != nil {
+		t.Fatalf("Failed to create CSR: %v", err)
+	}
+	return base64URLEncode(csrDER)
+}
+
+// register creates an account for the client, which signs later requests
+// with its kid
+func (c *testACMEClient) register(contact ...string) {
+	c.t.Helper()
+
+	c.accountURL = ""
+	w := c.post("/acme/new-account", map[string]interface{}{"termsOfServiceAgreed": true, "contact": contact})
+	if w.Code != http.StatusCreated && w.Code != http.StatusOK {
+		c.t.Fatalf("Failed to create account: %d %s", w.Code, w.Body.String())
+	}
+	c.accountURL = w.Header().Get("Location")
+}
+
+// newTestOrder creates an account for the client and places an order for DNS names
+func (c *testACMEClient) newTestOrder(names ...string) string {
+	c.t.Helper()
+
+	if c.accountURL == "" {
+		c.register()
+	}
+	identifiers := make([]map[string]string, len(names))
+	for i, name := range names {
+		identifiers[i] = map[string]string{"type": "dns", "value": name}
+	}
+	w := c.post("/acme/new-order", map[string]interface{}{"identifiers": identifiers})
+	if w.Code != http.StatusCreated {
+		c.t.Fatalf("Failed to create order: %d %s", w.Code, w.Body.String())
+	}
+	return path.Base(w.Header().Get("Location"))
+}
+
+// orderChallenges returns the challenges of a type offered for an order
+func orderChallenges(server *ACMEServer, orderID, challengeType string) []*Challenge {
+	authzs, _ := server.acmeStorage.GetAuthorizationsByOrder(orderID)
+	var challenges []*Challenge
+	for _, authz := range authzs {
+		authzChallenges, _ := server.acmeStorage.GetChallengesByAuthorization(authz.ID)
+		for _, challenge := range authzChallenges {
+			if challenge.Type == challengeType {
+				challenges = append(challenges, challenge)
+			}
+		}
+	}
+	return challenges
+}
+
+// serveHTTP01 serves the key authorizations of the client's challenges on a
+// local HTTP server and returns the DNS server the validation resolves with,
+// which points every identifier at it
+func serveHTTP01(t *testing.T, server *ACMEServer, client *testACMEClient, override map[string]string) *testDNSServer {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.URL.Path, "/.well-known/acme-challenge/")
+		if body, ok := override[token]; ok {
+			w.Write([]byte(body))
+			return
+		}
+		keyAuth, _ := keyAuthorization(token, &client.key.PublicKey)
+		w.Write([]byte(keyAuth + "\n"))
+	}))
+	t.Cleanup(httpServer.Close)
+
+	port, _ := strconv.Atoi(httpServer.URL[strings.LastIndex(httpServer.URL, ":")+1:])
+	dns := startTestDNSServer(t)
+	server.validation = ValidationOptions{HTTPPort: port, Resolver: dns.resolver()}
+	return dns
+}
+
+func urlPath(t *testing.T, rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL %q: %v", rawURL, err)
+	}
+	return parsed.Path
+}
+
+func TestHandleFinalize(t *testing.T) {
+	acmeServer, certSvc, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	router := http.NewServeMux()
+	acmeServer.SetupRoutes(router)
+	client := newTestACMEClient(t, acmeServer, router)
+
+	serveHTTP01(t, acmeServer, client, nil)
+	orderID := client.newTestOrder("www.example.test", "api.example.test")
+	finalizeURL := "/acme/finalize/" + orderID
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate certificate key: %v", err)
+	}
+	csr := newTestCSR(t, certKey, "www.example.test", "www.example.test", "api.example.test")
+
+	// Finalizing before the identifiers are authorized is refused
+	if w := client.post(finalizeURL, map[string]string{"csr": csr}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 before authorization, got %d %s", w.Code, w.Body.String())
+	}
+
+	if challenges := orderChallenges(acmeServer, orderID, ChallengeTypeTLSALPN01); len(challenges) != 2 {
+		t.Errorf("Expected a tls-alpn-01 challenge per identifier, got %d", len(challenges))
+	}
+	challenges := orderChallenges(acmeServer, orderID, ChallengeTypeHTTP01)
+	if len(challenges) != 2 {
+		t.Fatalf("Expected an http-01 challenge per identifier, got %d", len(challenges))
+	}
+	for _, challenge := range challenges {
+		if w := client.post(urlPath(t, challenge.URL), map[string]string{}); w.Code != http.StatusOK || challenge.Status != ChallengeStatusValid {
+			t.Fatalf("Failed to validate challenge: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	// The CSR must request exactly the identifiers of the order
+	for _, bad := range []string{
+		newTestCSR(t, certKey, "www.example.test"),
+		newTestCSR(t, certKey, "www.example.test", "api.example.test", "evil.example.test"),
+		"not base64!",
+	} {
+		w := client.post(finalizeURL, map[string]string{"csr": bad})
+		var problem ProblemDetails
+		json.Unmarshal(w.Body.Bytes(), &problem)
+		if w.Code != http.StatusBadRequest || problem.Type != "urn:ietf:params:acme:error:badCSR" {
+			t.Errorf("Expected a badCSR problem, got %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	// Another account cannot finalize the order
+	other := newTestACMEClient(t, acmeServer, router)
+	other.post("/acme/new-account", map[string]interface{}{"termsOfServiceAgreed": true})
+	if w := other.post(finalizeURL, map[string]string{"csr": csr}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for another account, got %d %s", w.Code, w.Body.String())
+	}
+
+	w := client.post(finalizeURL, map[string]string{"csr": csr})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to finalize order: %d %s", w.Code, w.Body.String())
+	}
+	var order struct {
+		Status      string `json:"status"`
+		Certificate string `json:"certificate"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil {
+		t.Fatalf("Failed to parse order: %v", err)
+	}
+	if order.Status != OrderStatusValid || order.Certificate == "" {
+		t.Fatalf("Expected a valid order with a certificate URL, got %+v", order)
+	}
+
+	// The certificate chain is served for the order and certifies the CSR key
+	req := httptest.NewRequest(http.MethodGet, urlPath(t, order.Certificate), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pem-certificate-chain" {
+		t.Fatalf("Failed to download certificate: %d %s", w.Code, w.Body.String())
+	}
+	block, rest := pem.Decode(w.Body.Bytes())
+	if block == nil || !strings.Contains(string(rest), "BEGIN CERTIFICATE") {
+		t.Fatalf("Expected a PEM chain, got %s", w.Body.String())
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	if !certKey.PublicKey.Equal(cert.PublicKey) {
+		t.Error("Expected the certificate to certify the CSR public key")
+	}
+	if strings.Join(cert.DNSNames, ",") != "www.example.test,api.example.test" {
+		t.Errorf("Expected the order identifiers as SANs, got %v", cert.DNSNames)
+	}
+
+	// The CA keeps no private key for the certificate
+	name := acmeCertificateName(orderID)
+	if _, err := certSvc.GetCertificateInfo(name); err != nil {
+		t.Errorf("Expected the certificate to be stored: %v", err)
+	}
+	if _, err := os.Stat(store.GetCertificateKeyPath(name)); !os.IsNotExist(err) {
+		t.Errorf("Expected no key file, got %v", err)
+	}
+
+	if w := client.post(finalizeURL, map[string]string{"csr": csr}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a finalized order, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Only the account of the order can revoke the certificate, once
+	revoke := map[string]interface{}{"certificate": base64URLEncode(block.Bytes), "reason": 1}
+	if w := other.post("/acme/revoke-cert", revoke); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for revocation by another account, got %d %s", w.Code, w.Body.String())
+	}
+	if w := client.post("/acme/revoke-cert", map[string]interface{}{"certificate": base64URLEncode(block.Bytes), "reason": 7}); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "badRevocationReason") {
+		t.Errorf("Expected a badRevocationReason problem, got %d %s", w.Code, w.Body.String())
+	}
+	if w := client.post("/acme/revoke-cert", revoke); w.Code != http.StatusOK {
+		t.Fatalf("Failed to revoke certificate: %d %s", w.Code, w.Body.String())
+	}
+	if info, err := certSvc.GetCertificateInfo(name); err != nil || !info.Revoked || info.RevocationReason != "keyCompromise" {
+		t.Errorf("Expected the certificate to be revoked for keyCompromise, got %+v %v", info, err)
+	}
+	if w := client.post("/acme/revoke-cert", revoke); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "alreadyRevoked") {
+		t.Errorf("Expected an alreadyRevoked problem, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleNewOrderIdentifiers(t *testing.T) {
+	acmeServer, _, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	router := http.NewServeMux()
+	acmeServer.SetupRoutes(router)
+	client := newTestACMEClient(t, acmeServer, router)
+
+	w := client.post("/acme/new-account", map[string]interface{}{"termsOfServiceAgreed": true})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Failed to create account: %d %s", w.Code, w.Body.String())
+	}
+	accountID := path.Base(w.Header().Get("Location"))
+
+	tests := []struct {
+		name       string
+		identifier map[string]string
+		errorType  string
+	}{
+		{"dns", map[string]string{"type": "dns", "value": "www.example.test"}, ""},
+		{"wildcard", map[string]string{"type": "dns", "value": "*.example.test"}, ""},
+		{"ipv4", map[string]string{"type": "ip", "value": "192.0.2.10"}, ""},
+		{"ipv6", map[string]string{"type": "ip", "value": "2001:db8::10"}, ""},
+		{"unsupported type", map[string]string{"type": "email", "value": "admin@example.test"}, "unsupportedIdentifier"},
+		{"empty dns", map[string]string{"type": "dns", "value": ""}, "rejectedIdentifier"},
+		{"malformed dns", map[string]string{"type": "dns", "value": "bad_name..example.test"}, "rejectedIdentifier"},
+		{"inner wildcard", map[string]string{"type": "dns", "value": "www.*.example.test"}, "rejectedIdentifier"},
+		{"ip as dns", map[string]string{"type": "dns", "value": "192.0.2.10"}, "rejectedIdentifier"},
+		{"empty ip", map[string]string{"type": "ip", "value": ""}, "rejectedIdentifier"},
+		{"malformed ip", map[string]string{"type": "ip", "value": "192.0.2.300"}, "rejectedIdentifier"},
+		{"wildcard ip", map[string]string{"type": "ip", "value": "*.192.0.2.10"}, "rejectedIdentifier"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := client.post("/acme/new-order", map[string]interface{}{
+				"identifiers": []map[string]string{{"type": "dns", "value": "ok.example.test"}, tt.identifier},
+			})
+			if tt.errorType == "" {
+				if w.Code != http.StatusCreated {
+					t.Errorf("Expected the order to be created, got %d %s", w.Code, w.Body.String())
+				}
+				return
+			}
+			var problem ProblemDetails
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("Failed to decode problem: %v", err)
+			}
+			if w.Code != http.StatusBadRequest || problem.Type != "urn:ietf:params:acme:error:"+tt.errorType {
+				t.Errorf("Expected a %s problem, got %d %s", tt.errorType, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// Rejected orders leave nothing behind
+	orders, _ := acmeServer.acmeStorage.GetOrdersByAccount(accountID)
+	if len(orders) != 4 {
+		t.Errorf("Expected only the four valid orders to be stored, got %d", len(orders))
+	}
+}
+
+func TestHandleChallenge(t *testing.T) {
+	acmeServer, _, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	router := http.NewServeMux()
+	acmeServer.SetupRoutes(router)
+	client := newTestACMEClient(t, acmeServer, router)
+
+	orderID := client.newTestOrder("wrong.example.test")
+	challenge := orderChallenges(acmeServer, orderID, ChallengeTypeHTTP01)[0]
+	serveHTTP01(t, acmeServer, client, map[string]string{challenge.Token: challenge.Token + ".not-the-thumbprint"})
+
+	// Another account cannot answer the challenge
+	other := newTestACMEClient(t, acmeServer, router)
+	other.newTestOrder("other.example.test")
+	if w := other.post(urlPath(t, challenge.URL), map[string]string{}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for another account, got %d %s", w.Code, w.Body.String())
+	}
+	if challenge.Status != ChallengeStatusPending {
+		t.Fatalf("Expected the challenge to stay pending, got %s", challenge.Status)
+	}
+
+	// A wrong key authorization fails the challenge and its authorization
+	if w := client.post(urlPath(t, challenge.URL), map[string]string{}); w.Code != http.StatusOK {
+		t.Fatalf("Failed to post challenge: %d %s", w.Code, w.Body.String())
+	}
+	if challenge.Status != ChallengeStatusInvalid || challenge.Error == nil ||
+		challenge.Error.Type != "urn:ietf:params:acme:error:incorrectResponse" {
+		t.Errorf("Expected an incorrectResponse problem, got %s %+v", challenge.Status, challenge.Error)
+	}
+	authz, _ := acmeServer.acmeStorage.GetAuthorization(challenge.AuthorizationID)
+	if authz.Status != AuthzStatusInvalid {
+		t.Errorf("Expected the authorization to be invalid, got %s", authz.Status)
+	}
+
+	// The outcome is final even once the right response is served
+	serveHTTP01(t, acmeServer, client, nil)
+	client.post(urlPath(t, challenge.URL), map[string]string{})
+	if challenge.Status != ChallengeStatusInvalid {
+		t.Errorf("Expected the challenge to stay invalid, got %s", challenge.Status)
+	}
+}
+
+func TestHandleWildcardOrder(t *testing.T) {
+	acmeServer, _, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	router := http.NewServeMux()
+	acmeServer.SetupRoutes(router)
+	client := newTestACMEClient(t, acmeServer, router)
+	dns := serveHTTP01(t, acmeServer, client, nil)
+
+	// Wildcard names can only be authorized with dns-01, for their base domain
+	orderID := client.newTestOrder("*.wild.example.test")
+	if challenges := orderChallenges(acmeServer, orderID, ChallengeTypeHTTP01); len(challenges) != 0 {
+		t.Errorf("Expected no http-01 challenge for a wildcard, got %d", len(challenges))
+	}
+	if challenges := orderChallenges(acmeServer, orderID, ChallengeTypeTLSALPN01); len(challenges) != 0 {
+		t.Errorf("Expected no tls-alpn-01 challenge for a wildcard, got %d", len(challenges))
+	}
+	challenges := orderChallenges(acmeServer, orderID, ChallengeTypeDNS01)
+	if len(challenges) != 1 {
+		t.Fatalf("Expected one dns-01 challenge, got %d", len(challenges))
+	}
+	authz, _ := acmeServer.acmeStorage.GetAuthorization(challenges[0].AuthorizationID)
+	if !authz.Wildcard || authz.Identifier.Value != "wild.example.test" {
+		t.Errorf("Expected a wildcard authorization for the base domain, got %+v", authz)
+	}
+
+	keyAuth, _ := keyAuthorization(challenges[0].Token, &client.key.PublicKey)
+	digest := sha256.Sum256([]byte(keyAuth))
+	dns.setTXT("_acme-challenge.wild.example.test", base64URLEncode(digest[:]))
+	if w := client.post(urlPath(t, challenges[0].URL), map[string]string{}); w.Code != http.StatusOK || challenges[0].Status != ChallengeStatusValid {
+		t.Fatalf("Failed to validate challenge: %d %s", w.Code, w.Body.String())
+	}
+
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	csr := newTestCSR(t, certKey, "*.wild.example.test", "*.wild.example.test")
+	if w := client.post("/acme/finalize/"+orderID, map[string]string{"csr": csr}); w.Code != http.StatusOK {
+		t.Fatalf("Failed to finalize wildcard order: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleIPOrderChallenges(t *testing.T) {
+	acmeServer, _, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	router := http.NewServeMux()
+	acmeServer.SetupRoutes(router)
+	client := newTestACMEClient(t, acmeServer, router)
+	client.newTestOrder("www.example.test")
+
+	// IP addresses can only be authorized with http-01
+	w := client.post("/acme/new-order", map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "ip", "value": "192.0.2.10"}},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Failed to create order: %d %s", w.Code, w.Body.String())
+	}
+	orderID := path.Base(w.Header().Get("Location"))
+
+	authzs, _ := acmeServer.acmeStorage.GetAuthorizationsByOrder(orderID)
+	if len(authzs) != 1 {
+		t.Fatalf("Expected one authorization, got %d", len(authzs))
+	}
+	challenges, _ := acmeServer.acmeStorage.GetChallengesByAuthorization(authzs[0].ID)
+	if len(challenges) != 1 || challenges[0].Type != ChallengeTypeHTTP01 {
+		types := make([]string, len(challenges))
+		for i, challenge := range challenges {
+			types[i] = challenge.Type
+		}
+		t.Errorf("Expected only an http-01 challenge for an IP address, got %v", types)
+	}
+}
+
+// decodeResponse parses a JSON response body
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("Failed to parse response %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestHandleAccount(t *testing.T) {
+	acmeServer, _, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	router := http.NewServeMux()
+	acmeServer.SetupRoutes(router)
+	client := newTestACMEClient(t, acmeServer, router)
+	client.register("mailto:admin@example.test")
+	accountPath := urlPath(t, client.accountURL)
+
+	type account struct {
+		Status  string   `json:"status"`
+		Contact []string `json:"contact"`
+		Orders  string   `json:"orders"`
+	}
+	w := client.post(accountPath, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Replay-Nonce") == "" {
+		t.Fatalf("Failed to fetch account: %d %s", w.Code, w.Body.String())
+	}
+	var fetched account
+	decodeResponse(t, w, &fetched)
+	if fetched.Status != AccountStatusValid || strings.Join(fetched.Contact, ",") != "mailto:admin@example.test" {
+		t.Errorf("Expected the registered account, got %+v", fetched)
+	}
+
+	// Registering the same key again returns the account
+	client.register()
+	if urlPath(t, client.accountURL) != accountPath {
+		t.Errorf("Expected the existing account %s, got %s", accountPath, client.accountURL)
+	}
+
+	// Contacts can be replaced, but only with email addresses
+	w = client.post(accountPath, map[string]interface{}{"contact": []string{"mailto:ops@example.test"}})
+	decodeResponse(t, w, &fetched)
+	if w.Code != http.StatusOK || strings.Join(fetched.Contact, ",") != "mailto:ops@example.test" {
+		t.Errorf("Failed to update contacts: %d %s", w.Code, w.Body.String())
+	}
+	if w := client.post(accountPath, map[string]interface{}{"contact": []string{"tel:+15555550100"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a non-email contact, got %d %s", w.Code, w.Body.String())
+	}
+
+	// The orders list holds the orders of the account
+	orderID := client.newTestOrder("list.example.test")
+	var orders struct {
+		Orders []string `json:"orders"`
+	}
+	w = client.post(urlPath(t, fetched.Orders), nil)
+	decodeResponse(t, w, &orders)
+	if len(orders.Orders) != 1 || path.Base(orders.Orders[0]) != orderID {
+		t.Errorf("Expected the order in the account orders, got %+v", orders)
+	}
+
+	// Other accounts can neither read nor change the account
+	other := newTestACMEClient(t, acmeServer, router)
+	other.register()
+	if w := other.post(accountPath, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for another account, got %d %s", w.Code, w.Body.String())
+	}
+	if w := other.post(urlPath(t, fetched.Orders), nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for the orders of another account, got %d %s", w.Code, w.Body.String())
+	}
+
+	// A deactivated account can no longer be used
+	w = client.post(accountPath, map[string]string{"status": AccountStatusDeactivated})
+	decodeResponse(t, w, &fetched)
+	if w.Code != http.StatusOK || fetched.Status != AccountStatusDeactivated {
+		t.Fatalf("Failed to deactivate account: %d %s", w.Code, w.Body.String())
+	}
+	if w := client.post("/acme/new-order", map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": "late.example.test"}},
+	}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a deactivated account, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Requests for unknown accounts are refused
+	client.accountURL = testACMEServerURL + "/acme/account/unknown"
+	var problem ProblemDetails
+	w = client.post("/acme/new-order", map[string]interface{}{})
+	decodeResponse(t, w, &problem)
+	if w.Code != http.StatusBadRequest || problem.Type != "urn:ietf:params:acme:error:accountDoesNotExist" {
+		t.Errorf("Expected an accountDoesNotExist problem, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Error responses carry a fresh nonce, which is accepted once
+	nonce := w.Header().Get("Replay-Nonce")
+	if !acmeServer.validateNonce(nonce) {
+		t.Error("Expected a fresh nonce on the error response")
+	}
+	if acmeServer.validateNonce(nonce) {
+		t.Error("Expected a nonce to be accepted only once")
+	}
+}
+
+func TestAccountSurvivesRestart(t *testing.T) {
+	acmeServer, certSvc, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	router := http.NewServeMux()
+	acmeServer.SetupRoutes(router)
+	client := newTestACMEClient(t, acmeServer, router)
+	orderID := client.newTestOrder("restart.example.test")
+
+	// A restarted server loads the account from disk and accepts its kid
+	restarted, err := NewACMEServer(certSvc, store)
+	if err != nil {
+		t.Fatalf("Failed to restart ACME server: %v", err)
+	}
+	client.server = restarted
+	client.router = http.NewServeMux()
+	restarted.SetupRoutes(client.router)
+
+	if w := client.post(urlPath(t, client.accountURL), nil); w.Code != http.StatusOK {
+		t.Fatalf("Failed to fetch account after restart: %d %s", w.Code, w.Body.String())
+	}
+	if w := client.post("/acme/order/"+orderID, nil); w.Code != http.StatusOK {
+		t.Errorf("Failed to fetch order after restart: %d %s", w.Code, w.Body.String())
+	}
+
+	// The key finds the account again, and challenges are answered with it
+	accountURL := client.accountURL
+	client.register()
+	if client.accountURL != accountURL {
+		t.Errorf("Expected the existing account %s, got %s", accountURL, client.accountURL)
+	}
+	challenge := orderChallenges(restarted, orderID, ChallengeTypeHTTP01)[0]
+	serveHTTP01(t, restarted, client, nil)
+	if w := client.post(urlPath(t, challenge.URL), map[string]string{}); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"valid"`) {
+		t.Errorf("Failed to validate challenge after restart: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleOrderLifecycle(t *testing.T) {
+	acmeServer, _, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	router := http.NewServeMux()
+	acmeServer.SetupRoutes(router)
+	client := newTestACMEClient(t, acmeServer, router)
+	serveHTTP01(t, acmeServer, client, nil)
+
+	type order struct {
+		Status         string          `json:"status"`
+		Identifiers    []Identifier    `json:"identifiers"`
+		Authorizations []string        `json:"authorizations"`
+		Finalize       string          `json:"finalize"`
+		Certificate    string          `json:"certificate"`
+		Error          *ProblemDetails `json:"error"`
+	}
+	type authorization struct {
+		Status     string     `json:"status"`
+		Identifier Identifier `json:"identifier"`
+		Challenges []struct {
+			Type      string `json:"type"`
+			URL       string `json:"url"`
+			Status    string `json:"status"`
+			Token     string `json:"token"`
+			Validated string `json:"validated"`
+		} `json:"challenges"`
+	}
+
+	orderID := client.newTestOrder("life.example.test")
+	orderPath := "/acme/order/" + orderID
+	var fetched order
+	w := client.post(orderPath, nil)
+	decodeResponse(t, w, &fetched)
+	if w.Code != http.StatusOK || fetched.Status != OrderStatusPending || len(fetched.Authorizations) != 1 ||
+		len(fetched.Identifiers) != 1 || fetched.Identifiers[0].Value != "life.example.test" {
+		t.Fatalf("Expected a pending order, got %d %s", w.Code, w.Body.String())
+	}
+	if w := client.post(orderPath, map[string]string{}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an order request with a payload, got %d %s", w.Code, w.Body.String())
+	}
+
+	// The authorization lists its challenges by their URLs
+	authzPath := urlPath(t, fetched.Authorizations[0])
+	var authz authorization
+	w = client.post(authzPath, nil)
+	decodeResponse(t, w, &authz)
+	if w.Code != http.StatusOK || authz.Status != AuthzStatusPending || authz.Identifier.Value != "life.example.test" || len(authz.Challenges) != 3 {
+		t.Fatalf("Expected a pending authorization with three challenges, got %d %s", w.Code, w.Body.String())
+	}
+	challenge := authz.Challenges[0]
+	if challenge.Type != ChallengeTypeHTTP01 || challenge.Token == "" || challenge.Status != ChallengeStatusPending {
+		t.Fatalf("Expected a pending http-01 challenge first, got %+v", challenge)
+	}
+
+	// A POST-as-GET fetches the challenge without validating it
+	w = client.post(urlPath(t, challenge.URL), nil)
+	if w.Code != http.StatusOK || !strings.Contains(strings.Join(w.Header().Values("Link"), ","), `rel="up"`) || !strings.Contains(w.Body.String(), `"status":"pending"`) {
+		t.Fatalf("Expected the pending challenge with an up link, got %d %v %s", w.Code, w.Header()["Link"], w.Body.String())
+	}
+	if w := client.post(urlPath(t, challenge.URL), map[string]string{}); w.Code != http.StatusOK {
+		t.Fatalf("Failed to validate challenge: %d %s", w.Code, w.Body.String())
+	}
+
+	w = client.post(authzPath, nil)
+	decodeResponse(t, w, &authz)
+	if authz.Status != AuthzStatusValid || authz.Challenges[0].Status != ChallengeStatusValid || authz.Challenges[0].Validated == "" {
+		t.Errorf("Expected a valid authorization, got %s", w.Body.String())
+	}
+	decodeResponse(t, client.post(orderPath, nil), &fetched)
+	if fetched.Status != OrderStatusReady {
+		t.Fatalf("Expected the order to be ready, got %s", fetched.Status)
+	}
+
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	csr := newTestCSR(t, certKey, "life.example.test", "life.example.test")
+	if w := client.post(urlPath(t, fetched.Finalize), map[string]string{"csr": csr}); w.Code != http.StatusOK {
+		t.Fatalf("Failed to finalize order: %d %s", w.Code, w.Body.String())
+	}
+	decodeResponse(t, client.post(orderPath, nil), &fetched)
+	if fetched.Status != OrderStatusValid || fetched.Certificate == "" {
+		t.Fatalf("Expected a valid order with a certificate, got %+v", fetched)
+	}
+
+	// The certificate is fetched with POST-as-GET by the account of the order
+	w = client.post(urlPath(t, fetched.Certificate), nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "BEGIN CERTIFICATE") {
+		t.Errorf("Failed to fetch certificate: %d %s", w.Code, w.Body.String())
+	}
+	other := newTestACMEClient(t, acmeServer, router)
+	other.register()
+	for _, target := range []string{orderPath, authzPath, urlPath(t, fetched.Certificate)} {
+		if w := other.post(target, nil); w.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 for %s of another account, got %d %s", target, w.Code, w.Body.String())
+		}
+	}
+
+	// Deactivating an authorization invalidates its order
+	orderID = client.newTestOrder("dropped.example.test")
+	orderPath = "/acme/order/" + orderID
+	decodeResponse(t, client.post(orderPath, nil), &fetched)
+	w = client.post(urlPath(t, fetched.Authorizations[0]), map[string]string{"status": AuthzStatusDeactivated})
+	decodeResponse(t, w, &authz)
+	if w.Code != http.StatusOK || authz.Status != AuthzStatusDeactivated {
+		t.Fatalf("Failed to deactivate authorization: %d %s", w.Code, w.Body.String())
+	}
+	decodeResponse(t, client.post(orderPath, nil), &fetched)
+	if fetched.Status != OrderStatusInvalid || fetched.Error == nil {
+		t.Errorf("Expected the order to be invalid, got %+v", fetched)
+	}
+	if w := client.post("/acme/finalize/"+orderID, map[string]string{"csr": csr}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for finalizing an invalid order, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -48,18 +48,34 @@ func ParseJWS(data []byte) (*JWS, error) {
 	return &jws, nil
 }
 
-// VerifyJWS verifies a JWS signature
-func VerifyJWS(jws *JWS, expectedNonce string, expectedURL string) ([]byte, crypto.PublicKey, error) {
-	// Decode protected header
+// KeyLookup returns the key of the account a JWS kid refers to
+type KeyLookup func(kid string) (crypto.PublicKey, error)
+
+// ProtectedHeader decodes the protected header of a JWS
+func (jws *JWS) ProtectedHeader() (*JWSHeader, error) {
 	headerJSON, err := base64.RawURLEncoding.DecodeString(jws.Protected)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to decode JWS protected header: %w", err)
+		return nil, fmt.Errorf("failed to decode JWS protected header: %w", err)
 	}
 
-	// Parse header
 	var header JWSHeader
 	if err := json.Unmarshal(headerJSON, &header); err != nil {
-		return nil, nil, fmt.Errorf("failed to parse JWS header: %w", err)
+		return nil, fmt.Errorf("failed to parse JWS header: %w", err)
+	}
+	return &header, nil
+}
+
+// VerifyJWS verifies a JWS signature
+func VerifyJWS(jws *JWS, expectedNonce string, expectedURL string) ([]byte, crypto.PublicKey, error) {
+	return VerifyJWSWithKeyLookup(jws, expectedNonce, expectedURL, nil)
+}
+
+// VerifyJWSWithKeyLookup verifies a JWS signed with the key embedded in its
+// jwk or, when a lookup is given, with the account key its kid refers to
+func VerifyJWSWithKeyLookup(jws *JWS, expectedNonce string, expectedURL string, lookup KeyLookup) ([]byte, crypto.PublicKey, error) {
+	header, err := jws.ProtectedHeader()
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Verify nonce if expected
@@ -74,7 +90,9 @@ func VerifyJWS(jws *JWS, expectedNonce string, expectedURL string) ([]byte, cryp
 
 	// Get public key
 	var pubKey crypto.PublicKey
-	if header.Jwk != nil {
+	if header.Jwk != nil && header.Kid != "" {
+		return nil, nil, fmt.Errorf("JWS must not contain both jwk and kid")
+	} else if header.Jwk != nil {
 		// Key is in the JWK
 		pubKey, err = jwkToPublicKey(header.Jwk)
 		if err != nil {
@@ -82,8 +100,13 @@ func VerifyJWS(jws *JWS, expectedNonce string, expectedURL string) ([]byte, cryp
 		}
 	} else if header.Kid != "" {
 		// Key is referenced by KID
-		// This would typically involve looking up the key in a database
-		return nil, nil, fmt.Errorf("KID-based key lookup not implemented")
+		if lookup == nil {
+			return nil, nil, fmt.Errorf("KID-based key lookup not supported")
+		}
+		pubKey, err = lookup(header.Kid)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to look up key %s: %w", header.Kid, err)
+		}
 	} else {
 		return nil, nil, fmt.Errorf("no key provided in JWS")
 	}
@@ -215,3 +238,36 @@ func jwkToPublicKey(jwk *JWK) (crypto.PublicKey, error) {
 		return nil, fmt.Errorf("unsupported key type: %s", jwk.Kty)
 	}
 }
+
+// JWKThumbprint returns the base64url encoded SHA-256 JWK thumbprint of a
+// public key as defined in RFC 7638
+func JWKThumbprint(pub crypto.PublicKey) (string, error) {
+	var jwk string
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		jwk = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			base64.RawURLEncoding.EncodeToString(key.N.Bytes()))
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`,
+			key.Curve.Params().Name,
+			base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size))),
+			base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size))))
+	default:
+		return "", fmt.Errorf("unsupported key type: %T", pub)
+	}
+
+	thumbprint := sha256.Sum256([]byte(jwk))
+	return base64.RawURLEncoding.EncodeToString(thumbprint[:]), nil
+}
+
+// keyAuthorization returns the key authorization of a challenge token for
+// an account key
+func keyAuthorization(token string, accountKey crypto.PublicKey) (string, error) {
+	thumbprint, err := JWKThumbprint(accountKey)
+	if err != nil {
+		return "", err
+	}
+	return token + "." + thumbprint, nil
+}
@@ -3,6 +3,7 @@ package acme
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"time"
 )
 
@@ -16,6 +17,7 @@ type Order struct {
 	Authorizations []string
 	FinalizeURL    string
 	CertificateURL string
+	Certificate    []byte
 	CSR            []byte
 	NotBefore      time.Time
 	NotAfter       time.Time
@@ -25,8 +27,8 @@ type Order struct {
 
 // Identifier represents an ACME identifier
 type Identifier struct {
-	Type  string
-	Value string
+	Type  string `json:"type"`
+	Value string `json:"value"`
 }
 
 // Authorization represents an ACME authorization
@@ -94,8 +96,9 @@ const (
 
 // ChallengeType constants
 const (
-	ChallengeTypeHTTP01 = "http-01"
-	ChallengeTypeDNS01  = "dns-01"
+	ChallengeTypeHTTP01    = "http-01"
+	ChallengeTypeDNS01     = "dns-01"
+	ChallengeTypeTLSALPN01 = "tls-alpn-01"
 )
 
 // AccountStatus constants
@@ -147,9 +150,12 @@ func NewChallenge(authzID string, challengeType string) *Challenge {
 	}
 }
 
-// generateID generates a random ID
+// generateID generates a random ID. IDs are hex so that they can be used in
+// certificate names.
 func generateID() string {
-	return generateToken()[:16]
+	idBytes := make([]byte, 8)
+	rand.Read(idBytes)
+	return hex.EncodeToString(idBytes)
 }
 
 // generateToken generates a random token
@@ -1,6 +1,7 @@
 package acme
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/ecdsa"
@@ -11,11 +12,15 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -34,6 +39,7 @@ type ACMEServer struct {
 	accounts    map[string]*Account
 	mutex       sync.RWMutex
 	keyPair     *ecdsa.PrivateKey
+	validation  ValidationOptions
 	// Rate limiting
 	ipRateLimits      map[string]*RateLimit
 	accountRateLimits map[string]*RateLimit
@@ -295,6 +301,9 @@ func (s *ACMEServer) SetupRoutes(router *http.ServeMux) {
 	// Account endpoint
 	router.HandleFunc("/acme/account/", s.securityMiddleware(s.handleAccount))
 
+	// Account orders endpoint
+	router.HandleFunc("/acme/orders/", s.securityMiddleware(s.handleAccountOrders))
+
 	// Order endpoint
 	router.HandleFunc("/acme/order/", s.securityMiddleware(s.handleOrder))
 
@@ -340,14 +349,13 @@ func (s *ACMEServer) handleDirectory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	baseURL := fmt.Sprintf("%s://%s", schemeFromRequest(r), r.Host)
+	baseURL := requestBaseURL(r)
 
 	directory := map[string]interface{}{
 		"newNonce":   baseURL + "/acme/new-nonce",
 		"newAccount": baseURL + "/acme/new-account",
 		"newOrder":   baseURL + "/acme/new-order",
 		"revokeCert": baseURL + "/acme/revoke-cert",
-		"keyChange":  baseURL + "/acme/key-change",
 		"meta": map[string]interface{}{
 			"termsOfService": baseURL + "/acme/terms",
 			"website":        baseURL,
@@ -366,14 +374,18 @@ func (s *ACMEServer) handleNewNonce(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newNonce issues a nonce that is valid until it is used or expires
+func (s *ACMEServer) newNonce() string {
 	nonce := generateNonce()
 	s.mutex.Lock()
 	s.nonces[nonce] = time.Now().Add(NonceExpiration) // Store with expiration time
 	s.mutex.Unlock()
-
-	w.Header().Set("Replay-Nonce", nonce)
-	w.Header().Set("Cache-Control", "no-store")
-	w.WriteHeader(http.StatusNoContent)
+	return nonce
 }
 
 // validateNonce validates a nonce and removes it if valid
@@ -397,98 +409,313 @@ func (s *ACMEServer) validateNonce(nonce string) bool {
 	return true
 }
 
-// handleAccount handles the ACME account endpoint
+// handleAccount returns an account on POST-as-GET and otherwise updates its
+// contacts or deactivates it
 func (s *ACMEServer) handleAccount(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// For now, return a placeholder response
+	// Extract account ID from URL
+	accountID := strings.TrimPrefix(r.URL.Path, "/acme/account/")
+
+	req, ok := s.verifyRequest(w, r, true)
+	if !ok {
+		return
+	}
+	account := req.account
+	if account.ID != accountID {
+		writeProblem(w, http.StatusForbidden, "unauthorized", "Account belongs to another key")
+		return
+	}
+
+	if !req.postAsGet() {
+		var updateReq struct {
+			Contact *[]string `json:"contact"`
+			Status  string    `json:"status"`
+		}
+		if err := json.Unmarshal(req.payload, &updateReq); err != nil {
+			writeProblem(w, http.StatusBadRequest, "malformed", "Invalid account update")
+			return
+		}
+		if updateReq.Status != "" && updateReq.Status != AccountStatusDeactivated {
+			writeProblem(w, http.StatusBadRequest, "malformed", "Accounts can only be deactivated")
+			return
+		}
+		if updateReq.Contact != nil {
+			if err := validateContacts(*updateReq.Contact); err != nil {
+				writeProblem(w, http.StatusBadRequest, "invalidContact", err.Error())
+				return
+			}
+			account.Contact = *updateReq.Contact
+		}
+		if updateReq.Status == AccountStatusDeactivated {
+			account.Status = AccountStatusDeactivated
+		}
+		if err := s.acmeStorage.SaveAccount(account); err != nil {
+			log.Printf("Failed to update account: %v", err)
+			writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to update account")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accountResponse(requestBaseURL(r), account))
+}
+
+// handleAccountOrders lists the orders of an account that are not invalid
+func (s *ACMEServer) handleAccountOrders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract account ID from URL
+	accountID := strings.TrimPrefix(r.URL.Path, "/acme/orders/")
+
+	req, ok := s.verifyRequest(w, r, true)
+	if !ok {
+		return
+	}
+	if req.account.ID != accountID {
+		writeProblem(w, http.StatusForbidden, "unauthorized", "Account belongs to another key")
+		return
+	}
+
+	orders, err := s.acmeStorage.GetOrdersByAccount(accountID)
+	if err != nil {
+		log.Printf("Failed to list orders: %v", err)
+		writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to list orders")
+		return
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+	})
+
+	baseURL := requestBaseURL(r)
+	orderURLs := []string{}
+	for _, order := range orders {
+		if err := s.refreshOrderStatus(order); err != nil {
+			log.Printf("Failed to update order: %v", err)
+		}
+		if order.Status != OrderStatusInvalid {
+			orderURLs = append(orderURLs, fmt.Sprintf("%s/acme/order/%s", baseURL, order.ID))
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "valid",
-		"contact": []string{"mailto:admin@example.com"},
-		"orders":  fmt.Sprintf("%s://%s/acme/orders", schemeFromRequest(r), r.Host),
+		"orders": orderURLs,
 	})
 }
 
-// handleOrder handles the ACME order endpoint
+// handleOrder returns an order on POST-as-GET
 func (s *ACMEServer) handleOrder(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// For now, return a placeholder response
+	// Extract order ID from URL
+	orderID := strings.TrimPrefix(r.URL.Path, "/acme/order/")
+
+	order, err := s.acmeStorage.GetOrder(orderID)
+	if err != nil {
+		writeProblem(w, http.StatusNotFound, "malformed", "Order not found")
+		return
+	}
+
+	req, ok := s.verifyRequest(w, r, true)
+	if !ok {
+		return
+	}
+	if order.AccountID != req.account.ID {
+		writeProblem(w, http.StatusForbidden, "unauthorized", "Order belongs to another account")
+		return
+	}
+	if !req.postAsGet() {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Orders are fetched with POST-as-GET")
+		return
+	}
+
+	if err := s.refreshOrderStatus(order); err != nil {
+		log.Printf("Failed to update order: %v", err)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "pending",
-		"expires": time.Now().Add(24 * time.Hour).Format(time.RFC3339),
-		"identifiers": []map[string]string{
-			{"type": "dns", "value": "example.com"},
-		},
-		"authorizations": []string{
-			fmt.Sprintf("%s://%s/acme/authz/example", schemeFromRequest(r), r.Host),
-		},
-		"finalize": fmt.Sprintf("%s://%s/acme/finalize/example", schemeFromRequest(r), r.Host),
-	})
+	json.NewEncoder(w).Encode(orderResponse(order))
 }
 
-// handleAuthorization handles the ACME authorization endpoint
+// handleAuthorization returns an authorization on POST-as-GET and otherwise
+// deactivates it
 func (s *ACMEServer) handleAuthorization(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// For now, return a placeholder response
+	// Extract authorization ID from URL
+	authzID := strings.TrimPrefix(r.URL.Path, "/acme/authz/")
+
+	authz, err := s.acmeStorage.GetAuthorization(authzID)
+	if err != nil {
+		writeProblem(w, http.StatusNotFound, "malformed", "Authorization not found")
+		return
+	}
+
+	req, ok := s.verifyRequest(w, r, true)
+	if !ok {
+		return
+	}
+	order, err := s.acmeStorage.GetOrder(authz.OrderID)
+	if err != nil || order.AccountID != req.account.ID {
+		writeProblem(w, http.StatusForbidden, "unauthorized", "Authorization belongs to another account")
+		return
+	}
+	s.refreshAuthorizationStatus(authz)
+
+	if !req.postAsGet() {
+		var updateReq struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal(req.payload, &updateReq); err != nil || updateReq.Status != AuthzStatusDeactivated {
+			writeProblem(w, http.StatusBadRequest, "malformed", "Authorizations can only be deactivated")
+			return
+		}
+		if authz.Status != AuthzStatusPending && authz.Status != AuthzStatusValid {
+			writeProblem(w, http.StatusBadRequest, "malformed", fmt.Sprintf("Authorization is %s", authz.Status))
+			return
+		}
+		authz.Status = AuthzStatusDeactivated
+		if err := s.acmeStorage.SaveAuthorization(authz); err != nil {
+			log.Printf("Failed to update authorization: %v", err)
+			writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to update authorization")
+			return
+		}
+		if err := s.refreshOrderStatus(order); err != nil {
+			log.Printf("Failed to update order: %v", err)
+		}
+	}
+
+	// The challenges are listed in the order they were offered
+	challenges := make([]*Challenge, 0, len(authz.Challenges))
+	for _, offered := range authz.Challenges {
+		challenge, err := s.acmeStorage.GetChallenge(offered.ID)
+		if err != nil {
+			challenge = offered
+		}
+		challenges = append(challenges, challenge)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "pending",
-		"expires": time.Now().Add(24 * time.Hour).Format(time.RFC3339),
-		"identifier": map[string]string{
-			"type":  "dns",
-			"value": "example.com",
-		},
-		"challenges": []map[string]interface{}{
-			{
-				"type":  "http-01",
-				"url":   fmt.Sprintf("%s://%s/acme/challenge/http01/example", schemeFromRequest(r), r.Host),
-				"token": "token",
-			},
-			{
-				"type":  "dns-01",
-				"url":   fmt.Sprintf("%s://%s/acme/challenge/dns01/example", schemeFromRequest(r), r.Host),
-				"token": "token",
-			},
-		},
-	})
+	json.NewEncoder(w).Encode(authorizationResponse(authz, challenges))
 }
 
-// handleRevocation handles the ACME certificate revocation endpoint
+// handleRevocation revokes a certificate issued for one of the orders of the
+// account signing the request
 func (s *ACMEServer) handleRevocation(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// For now, return a success response
+	req, ok := s.verifyRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	var revokeReq struct {
+		Certificate string `json:"certificate"`
+		Reason      *int   `json:"reason"`
+	}
+	if err := json.Unmarshal(req.payload, &revokeReq); err != nil || revokeReq.Certificate == "" {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Invalid revocation request")
+		return
+	}
+	certDER, err := base64.RawURLEncoding.DecodeString(revokeReq.Certificate)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "malformed", "Certificate is not base64url encoded")
+		return
+	}
+	reason := certificates.ReasonUnspecified
+	if revokeReq.Reason != nil {
+		reason, err = certificates.ParseRevocationReason(strconv.Itoa(*revokeReq.Reason))
+		if err != nil {
+			writeProblem(w, http.StatusBadRequest, "badRevocationReason", err.Error())
+			return
+		}
+	}
+
+	// Find the order the certificate was issued for
+	orders, err := s.acmeStorage.GetOrdersByAccount(req.account.ID)
+	if err != nil {
+		log.Printf("Failed to list orders: %v", err)
+		writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to look up certificate")
+		return
+	}
+	var issuedFor *Order
+	for _, order := range orders {
+		if block, _ := pem.Decode(order.Certificate); block != nil && bytes.Equal(block.Bytes, certDER) {
+			issuedFor = order
+			break
+		}
+	}
+	if issuedFor == nil {
+		writeProblem(w, http.StatusForbidden, "unauthorized", "Certificate was not issued to this account")
+		return
+	}
+
+	err = s.certSvc.RevokeCertificateWithReason(acmeCertificateName(issuedFor.ID), reason, nil)
+	switch {
+	case errors.Is(err, certificates.ErrCertificateRevoked):
+		writeProblem(w, http.StatusBadRequest, "alreadyRevoked", "Certificate is already revoked")
+		return
+	case errors.Is(err, certificates.ErrCASealed):
+		w.Header().Set("Retry-After", "60")
+		writeProblem(w, http.StatusServiceUnavailable, "serverInternal", "CA is sealed")
+		return
+	case err != nil:
+		log.Printf("Failed to revoke certificate: %v", err)
+		writeProblem(w, http.StatusInternalServerError, "serverInternal", "Failed to revoke certificate")
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
 
-// handleCertificate handles the ACME certificate endpoint
+// handleCertificate serves the PEM chain issued for a finalized order.
+// Certificates are public, so plain GET is accepted besides POST-as-GET,
+// which only the account that placed the order may use.
 func (s *ACMEServer) handleCertificate(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// For now, return a placeholder response
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "pending",
-	})
+	// Extract order ID from URL
+	orderID := strings.TrimPrefix(r.URL.Path, "/acme/certificate/")
+
+	order, err := s.acmeStorage.GetOrder(orderID)
+	if err != nil || order.Status != OrderStatusValid || len(order.Certificate) == 0 {
+		writeProblem(w, http.StatusNotFound, "malformed", "Certificate not found")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		req, ok := s.verifyRequest(w, r, true)
+		if !ok {
+			return
+		}
+		if order.AccountID != req.account.ID {
+			writeProblem(w, http.StatusForbidden, "unauthorized", "Certificate belongs to another account")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.WriteHeader(http.StatusOK)
+	w.Write(order.Certificate)
 }
 
 // Helper functions
@@ -511,12 +738,18 @@ func schemeFromRequest(r *http.Request) string {
 	return "http"
 }
 
+// requestBaseURL returns the scheme and host the request was sent to
+func requestBaseURL(r *http.Request) string {
+	return fmt.Sprintf("%s://%s", schemeFromRequest(r), r.Host)
+}
+
 // StartACMEServer starts the ACME server
-func StartACMEServer(ctx context.Context, certSvc *certificates.CertificateService, store *storage.Storage, addr string, tlsConfig *tls.Config) error {
+func StartACMEServer(ctx context.Context, certSvc *certificates.CertificateService, store *storage.Storage, addr string, tlsConfig *tls.Config, validation ValidationOptions) error {
 	acmeServer, err := NewACMEServer(certSvc, store)
 	if err != nil {
 		return fmt.Errorf("failed to create ACME server: %w", err)
 	}
+	acmeServer.validation = validation
 
 	mux := http.NewServeMux()
 	acmeServer.SetupRoutes(mux)
@@ -54,6 +54,10 @@ func setupTestEnvironment(t *testing.T) (*ACMEServer, *certificates.CertificateS
 	}
 
 	// Create CA certificate
+	if err := certSvc.Unseal(cfg.CAKeyPassword); err != nil {
+		os.RemoveAll(tempDir)
+		t.Fatalf("Failed to unseal CA: %v", err)
+	}
 	if err := certSvc.CreateCA(); err != nil {
 		os.RemoveAll(tempDir)
 		t.Fatalf("Failed to create CA: %v", err)
@@ -118,6 +122,11 @@ func TestHandleDirectory(t *testing.T) {
 			t.Errorf("Directory missing required field: %s", field)
 		}
 	}
+
+	// Only endpoints the server implements are advertised
+	if _, ok := directory["keyChange"]; ok {
+		t.Error("Directory advertises keyChange, which is not implemented")
+	}
 }
 
 func TestHandleNewNonce(t *testing.T) {
@@ -169,7 +178,7 @@ func TestStartACMEServer(t *testing.T) {
 
 	// Start ACME server in a goroutine
 	go func() {
-		err := StartACMEServer(ctx, certSvc, store, ":0", nil)
+		err := StartACMEServer(ctx, certSvc, store, ":0", nil, ValidationOptions{})
 		if err != nil && err != http.ErrServerClosed {
 			t.Errorf("ACME server error: %v", err)
 		}
@@ -178,6 +178,46 @@ func (s *ACMEStorage) loadData() error {
 	return nil
 }
 
+// storedAccount is the form accounts are saved in. The key is PKIX DER so
+// that it decodes to a concrete key again.
+type storedAccount struct {
+	ID        string
+	Key       []byte
+	Contact   []string
+	Status    string
+	CreatedAt time.Time
+}
+
+// MarshalJSON encodes an account with its key as PKIX DER
+func (a *Account) MarshalJSON() ([]byte, error) {
+	stored := storedAccount{ID: a.ID, Contact: a.Contact, Status: a.Status, CreatedAt: a.CreatedAt}
+	if a.Key != nil {
+		key, err := x509.MarshalPKIXPublicKey(a.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal account key: %w", err)
+		}
+		stored.Key = key
+	}
+	return json.Marshal(stored)
+}
+
+// UnmarshalJSON decodes an account saved by MarshalJSON
+func (a *Account) UnmarshalJSON(data []byte) error {
+	var stored storedAccount
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	*a = Account{ID: stored.ID, Contact: stored.Contact, Status: stored.Status, CreatedAt: stored.CreatedAt}
+	if len(stored.Key) > 0 {
+		key, err := x509.ParsePKIXPublicKey(stored.Key)
+		if err != nil {
+			return fmt.Errorf("failed to parse account key: %w", err)
+		}
+		a.Key = key
+	}
+	return nil
+}
+
 // SaveAccount saves an account to disk
 func (s *ACMEStorage) SaveAccount(account *Account) error {
 	s.mutex.Lock()
@@ -1,7 +1,9 @@
 package acme
 
 import (
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
 	"os"
 	"testing"
 	"time"
@@ -60,9 +62,13 @@ func TestSaveAndGetAccount(t *testing.T) {
 	}
 
 	// Create test account
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate account key: %v", err)
+	}
 	account := &Account{
 		ID:        "test-account",
-		Key:       &rsa.PublicKey{},
+		Key:       &key.PublicKey,
 		Contact:   []string{"mailto:test@example.com"},
 		Status:    AccountStatusValid,
 		CreatedAt: time.Now(),
@@ -91,6 +97,20 @@ func TestSaveAndGetAccount(t *testing.T) {
 	} else if retrievedAccount.Contact[0] != account.Contact[0] {
 		t.Errorf("Expected contact %s, got %s", account.Contact[0], retrievedAccount.Contact[0])
 	}
+
+	// The key is found again after the accounts are reloaded from disk
+	reloaded, err := NewACMEStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reload ACME storage: %v", err)
+	}
+	keyBytes, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	found, err := reloaded.FindAccountByKey(keyBytes)
+	if err != nil {
+		t.Fatalf("Failed to find reloaded account by key: %v", err)
+	}
+	if found.ID != account.ID || !key.PublicKey.Equal(found.Key) {
+		t.Errorf("Expected the reloaded account with its key, got %+v", found)
+	}
 }
 
 func TestSaveAndGetOrder(t *testing.T) {
@@ -0,0 +1,375 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Limits of challenge validation requests
+const (
+	// DefaultHTTP01Port is the port HTTP-01 challenges are fetched from
+	DefaultHTTP01Port = 80
+	// DefaultTLSALPN01Port is the port TLS-ALPN-01 challenges connect to
+	DefaultTLSALPN01Port = 443
+	// validationTimeout bounds a single challenge validation
+	validationTimeout = 10 * time.Second
+	// maxValidationRedirects is how many redirects an HTTP-01 fetch follows
+	maxValidationRedirects = 10
+	// maxHTTP01ResponseSize caps the body read from an HTTP-01 response
+	maxHTTP01ResponseSize = 8 * 1024
+	// maxCNAMEChain is how many CNAME records a DNS-01 lookup follows
+	maxCNAMEChain = 8
+)
+
+// Resolver looks up the addresses and TXT records of the identifiers being
+// validated. *net.Resolver implements it.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+}
+
+// ValidationOptions configures how challenges are validated
+type ValidationOptions struct {
+	// HTTPPort is the port HTTP-01 challenges are fetched from; zero uses port 80
+	HTTPPort int
+	// TLSALPNPort is the port TLS-ALPN-01 challenges connect to; zero uses port 443
+	TLSALPNPort int
+	// Resolver resolves identifiers; nil uses the system resolver
+	Resolver Resolver
+}
+
+// NewResolver returns a resolver that queries the given DNS servers, taking
+// turns so that a retry goes to the next server, or the system resolver when
+// none are given. Servers without a port use port 53.
+func NewResolver(servers []string) Resolver {
+	if len(servers) == 0 {
+		return net.DefaultResolver
+	}
+
+	addrs := make([]string, len(servers))
+	for i, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		addrs[i] = server
+	}
+
+	var next uint32
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			addr := addrs[int(atomic.AddUint32(&next, 1)-1)%len(addrs)]
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// validationError is a failed challenge validation with its ACME error type
+type validationError struct {
+	errorType string
+	detail    string
+}
+
+func (e *validationError) Error() string {
+	return e.detail
+}
+
+// problem returns the problem document recorded on the challenge
+func (e *validationError) problem() *ProblemDetails {
+	return &ProblemDetails{
+		Type:   "urn:ietf:params:acme:error:" + e.errorType,
+		Detail: e.detail,
+		Status: http.StatusForbidden,
+	}
+}
+
+// resolver returns the configured resolver or the system resolver
+func (o ValidationOptions) resolver() Resolver {
+	if o.Resolver == nil {
+		return net.DefaultResolver
+	}
+	return o.Resolver
+}
+
+// httpPort returns the configured HTTP-01 port or the default
+func (o ValidationOptions) httpPort() int {
+	if o.HTTPPort == 0 {
+		return DefaultHTTP01Port
+	}
+	return o.HTTPPort
+}
+
+// tlsALPNPort returns the configured TLS-ALPN-01 port or the default
+func (o ValidationOptions) tlsALPNPort() int {
+	if o.TLSALPNPort == 0 {
+		return DefaultTLSALPN01Port
+	}
+	return o.TLSALPNPort
+}
+
+// dialContext connects to a host through the configured resolver, trying
+// each of its addresses in turn
+func (o ValidationOptions) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := []string{host}
+	if net.ParseIP(host) == nil {
+		addrs, err = o.resolver().LookupHost(ctx, host)
+		if err != nil {
+			return nil, &validationError{"dns", fmt.Sprintf("failed to resolve %s: %v", host, err)}
+		}
+		if len(addrs) == 0 {
+			return nil, &validationError{"dns", fmt.Sprintf("no addresses found for %s", host)}
+		}
+	}
+
+	var dialer net.Dialer
+	var lastErr error
+	for _, ip := range addrs {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// fetchHTTP01 fetches the HTTP-01 resource of a token from a host. Redirects
+// are followed to HTTP and HTTPS URLs only, and the body read is capped.
+func (o ValidationOptions) fetchHTTP01(ctx context.Context, host, token string) (string, error) {
+	transport := &http.Transport{
+		Proxy:             nil,
+		DialContext:       o.dialContext,
+		DisableKeepAlives: true,
+		// Redirects to HTTPS are allowed to hosts without a trusted certificate yet
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	defer transport.CloseIdleConnections()
+
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxValidationRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxValidationRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+
+	url := fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", net.JoinHostPort(host, strconv.Itoa(o.httpPort())), token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", &validationError{"malformed", fmt.Sprintf("invalid challenge URL %s: %v", url, err)}
+	}
+	req.Header.Set("User-Agent", "localca-acme")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var validationErr *validationError
+		if errors.As(err, &validationErr) {
+			return "", validationErr
+		}
+		return "", &validationError{"connection", fmt.Sprintf("failed to fetch %s: %v", url, err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &validationError{"unauthorized", fmt.Sprintf("fetching %s returned status %d", url, resp.StatusCode)}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTP01ResponseSize+1))
+	if err != nil {
+		return "", &validationError{"connection", fmt.Sprintf("failed to read %s: %v", url, err)}
+	}
+	if len(body) > maxHTTP01ResponseSize {
+		return "", &validationError{"unauthorized", fmt.Sprintf("response from %s exceeds %d bytes", url, maxHTTP01ResponseSize)}
+	}
+	return string(body), nil
+}
+
+// validateHTTP01 checks that the host of an identifier serves the key
+// authorization of a challenge token as described in RFC 8555 section 8.3
+func (o ValidationOptions) validateHTTP01(ctx context.Context, identifier Identifier, token, keyAuth string) error {
+	if identifier.Type != "dns" && identifier.Type != "ip" {
+		return &validationError{"unsupportedIdentifier", fmt.Sprintf("http-01 cannot validate %s identifiers", identifier.Type)}
+	}
+	if strings.HasPrefix(identifier.Value, "*.") {
+		return &validationError{"unauthorized", "http-01 cannot validate wildcard identifiers"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, validationTimeout)
+	defer cancel()
+
+	body, err := o.fetchHTTP01(ctx, identifier.Value, token)
+	if err != nil {
+		return err
+	}
+
+	// Trailing whitespace such as a newline is ignored
+	if got := strings.TrimRight(body, " \t\r\n"); got != keyAuth {
+		return &validationError{"incorrectResponse", fmt.Sprintf("key authorization mismatch: expected %q, got %q", keyAuth, truncate(got, 128))}
+	}
+	return nil
+}
+
+// lookupTXT returns the TXT records of a name. When the name has none but is
+// a CNAME, the records of its target are returned instead, so validation can
+// be delegated to another zone.
+func (o ValidationOptions) lookupTXT(ctx context.Context, name string) ([]string, error) {
+	resolver := o.resolver()
+	seen := map[string]bool{strings.ToLower(name): true}
+
+	for i := 0; i <= maxCNAMEChain; i++ {
+		records, err := resolver.LookupTXT(ctx, name)
+		if err == nil && len(records) > 0 {
+			return records, nil
+		}
+
+		target, cnameErr := resolver.LookupCNAME(ctx, name)
+		target = strings.ToLower(strings.TrimSuffix(target, "."))
+		if cnameErr != nil || target == "" || target == strings.ToLower(strings.TrimSuffix(name, ".")) {
+			return nil, err
+		}
+		if seen[target] {
+			return nil, fmt.Errorf("CNAME loop at %s", target)
+		}
+		seen[target] = true
+		name = target
+	}
+	return nil, fmt.Errorf("more than %d CNAME records for %s", maxCNAMEChain, name)
+}
+
+// validateDNS01 checks that the _acme-challenge name of an identifier has a
+// TXT record with the digest of the key authorization as described in RFC
+// 8555 section 8.4. Wildcard identifiers are validated for their base domain.
+func (o ValidationOptions) validateDNS01(ctx context.Context, identifier Identifier, keyAuth string) error {
+	if identifier.Type != "dns" {
+		return &validationError{"unsupportedIdentifier", fmt.Sprintf("dns-01 cannot validate %s identifiers", identifier.Type)}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, validationTimeout)
+	defer cancel()
+
+	name := "_acme-challenge." + strings.TrimPrefix(identifier.Value, "*.")
+	records, err := o.lookupTXT(ctx, name)
+	if err != nil {
+		return &validationError{"dns", fmt.Sprintf("failed to look up TXT records for %s: %v", name, err)}
+	}
+	if len(records) == 0 {
+		return &validationError{"unauthorized", fmt.Sprintf("no TXT records found for %s", name)}
+	}
+
+	digest := sha256.Sum256([]byte(keyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(digest[:])
+	for _, record := range records {
+		if strings.TrimSpace(record) == expected {
+			return nil
+		}
+	}
+	return &validationError{"incorrectResponse", fmt.Sprintf("no TXT record for %s matches the key authorization digest %s", name, expected)}
+}
+
+// acmeTLSALPNProtocol is the ALPN protocol of TLS-ALPN-01 validation
+const acmeTLSALPNProtocol = "acme-tls/1"
+
+// oidACMEIdentifier is the id-pe-acmeIdentifier certificate extension
+var oidACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// validateTLSALPN01 checks that the host of an identifier answers a TLS
+// handshake for the acme-tls/1 protocol with a certificate for the identifier
+// carrying the digest of the key authorization, as described in RFC 8737
+func (o ValidationOptions) validateTLSALPN01(ctx context.Context, identifier Identifier, keyAuth string) error {
+	if identifier.Type != "dns" {
+		return &validationError{"unsupportedIdentifier", fmt.Sprintf("tls-alpn-01 cannot validate %s identifiers", identifier.Type)}
+	}
+	if strings.HasPrefix(identifier.Value, "*.") {
+		return &validationError{"unauthorized", "tls-alpn-01 cannot validate wildcard identifiers"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, validationTimeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(identifier.Value, strconv.Itoa(o.tlsALPNPort()))
+	rawConn, err := o.dialContext(ctx, "tcp", addr)
+	if err != nil {
+		var validationErr *validationError
+		if errors.As(err, &validationErr) {
+			return validationErr
+		}
+		return &validationError{"connection", fmt.Sprintf("failed to connect to %s: %v", addr, err)}
+	}
+	defer rawConn.Close()
+
+	// The challenge certificate is self-signed, so it is checked by hand below
+	conn := tls.Client(rawConn, &tls.Config{
+		ServerName:         identifier.Value,
+		NextProtos:         []string{acmeTLSALPNProtocol},
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+	})
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return &validationError{"tls", fmt.Sprintf("TLS handshake with %s failed: %v", addr, err)}
+	}
+	state := conn.ConnectionState()
+	if state.NegotiatedProtocol != acmeTLSALPNProtocol {
+		return &validationError{"unauthorized", fmt.Sprintf("%s did not negotiate the %s protocol", addr, acmeTLSALPNProtocol)}
+	}
+
+	if len(state.PeerCertificates) == 0 {
+		return &validationError{"unauthorized", fmt.Sprintf("%s presented no challenge certificate", addr)}
+	}
+	cert := state.PeerCertificates[0]
+	if len(cert.DNSNames) != 1 || !strings.EqualFold(cert.DNSNames[0], identifier.Value) ||
+		len(cert.IPAddresses) > 0 || len(cert.EmailAddresses) > 0 || len(cert.URIs) > 0 {
+		return &validationError{"unauthorized", fmt.Sprintf("challenge certificate from %s must name only %s", addr, identifier.Value)}
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidACMEIdentifier) {
+			continue
+		}
+		if !ext.Critical {
+			return &validationError{"unauthorized", "acmeIdentifier extension of the challenge certificate is not critical"}
+		}
+		var value []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &value); err != nil || len(rest) > 0 {
+			return &validationError{"unauthorized", "malformed acmeIdentifier extension in the challenge certificate"}
+		}
+		digest := sha256.Sum256([]byte(keyAuth))
+		if subtle.ConstantTimeCompare(value, digest[:]) != 1 {
+			return &validationError{"incorrectResponse", "acmeIdentifier extension does not match the key authorization digest"}
+		}
+		return nil
+	}
+	return &validationError{"unauthorized", fmt.Sprintf("challenge certificate from %s has no acmeIdentifier extension", addr)}
+}
+
+// truncate shortens a string for error messages
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
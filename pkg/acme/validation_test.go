@@ -0,0 +1,336 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testDNSServer answers DNS queries over UDP from fixed records. Names under
+// example.test resolve to the loopback address unless they are CNAMEs or
+// start with an underscore. CNAMEs are returned without following them, the
+// way an authoritative server for another zone would.
+type testDNSServer struct {
+	conn  net.PacketConn
+	mutex sync.Mutex
+	txt   map[string][]string
+	cname map[string]string
+}
+
+func startTestDNSServer(t *testing.T) *testDNSServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start DNS server: %v", err)
+	}
+	server := &testDNSServer{conn: conn, txt: make(map[string][]string), cname: make(map[string]string)}
+	t.Cleanup(func() { conn.Close() })
+	go server.serve()
+	return server
+}
+
+// resolver returns a resolver that queries the server
+func (s *testDNSServer) resolver() Resolver {
+	return NewResolver([]string{s.conn.LocalAddr().String()})
+}
+
+func (s *testDNSServer) setTXT(name string, values ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.txt[name+"."] = values
+}
+
+func (s *testDNSServer) setCNAME(name, target string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cname[name+"."] = target + "."
+}
+
+func (s *testDNSServer) serve() {
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp, err := s.answer(buf[:n]); err == nil {
+			s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *testDNSServer) answer(query []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	name := strings.ToLower(question.Name.String())
+	target, isCNAME := s.cname[name]
+	txt, hasTXT := s.txt[name]
+	hasA := strings.HasSuffix(name, ".example.test.") && !strings.HasPrefix(name, "_") && !isCNAME
+
+	rcode := dnsmessage.RCodeSuccess
+	if !isCNAME && !hasTXT && !hasA {
+		rcode = dnsmessage.RCodeNameError
+	}
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, Authoritative: true, RCode: rcode})
+	builder.EnableCompression()
+	builder.StartQuestions()
+	builder.Question(question)
+	builder.StartAnswers()
+
+	resource := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	switch {
+	case isCNAME:
+		builder.CNAMEResource(resource, dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(target)})
+	case question.Type == dnsmessage.TypeTXT && hasTXT:
+		for _, value := range txt {
+			builder.TXTResource(resource, dnsmessage.TXTResource{TXT: []string{value}})
+		}
+	case question.Type == dnsmessage.TypeA && hasA:
+		builder.AResource(resource, dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}})
+	}
+	return builder.Finish()
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// Example from RFC 7638 section 3.1
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	thumbprint, err := JWKThumbprint(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	if err != nil {
+		t.Fatalf("Failed to compute thumbprint: %v", err)
+	}
+	if thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("Unexpected thumbprint %s", thumbprint)
+	}
+}
+
+func TestValidateHTTP01(t *testing.T) {
+	const keyAuth = "token.thumbprint"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, port, _ := net.SplitHostPort(r.Host)
+		switch host {
+		case "valid.example.test":
+			w.Write([]byte(keyAuth + "\r\n"))
+		case "wrong.example.test":
+			w.Write([]byte("token.other"))
+		case "large.example.test":
+			w.Write([]byte(strings.Repeat("a", maxHTTP01ResponseSize+1)))
+		case "redirect.example.test":
+			http.Redirect(w, r, "http://valid.example.test:"+port+r.URL.Path, http.StatusFound)
+		case "loop.example.test":
+			http.Redirect(w, r, r.URL.Path, http.StatusFound)
+		case "ftp.example.test":
+			http.Redirect(w, r, "ftp://valid.example.test/", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	port, _ := strconv.Atoi(server.URL[strings.LastIndex(server.URL, ":")+1:])
+	opts := ValidationOptions{HTTPPort: port, Resolver: startTestDNSServer(t).resolver()}
+
+	tests := []struct {
+		name      string
+		host      string
+		errorType string
+	}{
+		{"valid", "valid.example.test", ""},
+		{"redirect", "redirect.example.test", ""},
+		{"wrong key authorization", "wrong.example.test", "incorrectResponse"},
+		{"not found", "missing.example.test", "unauthorized"},
+		{"body too large", "large.example.test", "unauthorized"},
+		{"redirect loop", "loop.example.test", "connection"},
+		{"unsupported redirect", "ftp.example.test", "connection"},
+		{"unresolvable", "valid.example.invalid", "dns"},
+		{"wildcard", "*.example.test", "unauthorized"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := opts.validateHTTP01(context.Background(), Identifier{Type: "dns", Value: tt.host}, "token", keyAuth)
+			if tt.errorType == "" {
+				if err != nil {
+					t.Errorf("Expected validation to succeed, got %v", err)
+				}
+				return
+			}
+			var validationErr *validationError
+			if !errors.As(err, &validationErr) || validationErr.errorType != tt.errorType {
+				t.Errorf("Expected a %s error, got %v", tt.errorType, err)
+			}
+		})
+	}
+}
+
+func TestValidateDNS01(t *testing.T) {
+	const keyAuth = "token.thumbprint"
+	digest := sha256.Sum256([]byte(keyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(digest[:])
+
+	dns := startTestDNSServer(t)
+	dns.setTXT("_acme-challenge.valid.example.test", "unrelated", expected)
+	dns.setTXT("_acme-challenge.wrong.example.test", "not-the-digest")
+	dns.setCNAME("_acme-challenge.delegated.example.test", "valid.acme.example.test")
+	dns.setTXT("valid.acme.example.test", expected)
+	dns.setCNAME("_acme-challenge.loop.example.test", "loop.acme.example.test")
+	dns.setCNAME("loop.acme.example.test", "_acme-challenge.loop.example.test")
+	opts := ValidationOptions{Resolver: dns.resolver()}
+
+	tests := []struct {
+		name       string
+		identifier Identifier
+		errorType  string
+	}{
+		{"valid", Identifier{Type: "dns", Value: "valid.example.test"}, ""},
+		{"wildcard", Identifier{Type: "dns", Value: "*.valid.example.test"}, ""},
+		{"CNAME delegation", Identifier{Type: "dns", Value: "delegated.example.test"}, ""},
+		{"wrong digest", Identifier{Type: "dns", Value: "wrong.example.test"}, "incorrectResponse"},
+		{"missing record", Identifier{Type: "dns", Value: "missing.example.test"}, "dns"},
+		{"CNAME loop", Identifier{Type: "dns", Value: "loop.example.test"}, "dns"},
+		{"IP identifier", Identifier{Type: "ip", Value: "127.0.0.1"}, "unsupportedIdentifier"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := opts.validateDNS01(context.Background(), tt.identifier, keyAuth)
+			if tt.errorType == "" {
+				if err != nil {
+					t.Errorf("Expected validation to succeed, got %v", err)
+				}
+				return
+			}
+			var validationErr *validationError
+			if !errors.As(err, &validationErr) || validationErr.errorType != tt.errorType {
+				t.Errorf("Expected a %s error, got %v", tt.errorType, err)
+			}
+		})
+	}
+}
+
+// newTLSALPNCertificate creates a self-signed TLS-ALPN-01 challenge
+// certificate for a name carrying a digest in the acmeIdentifier extension
+func newTLSALPNCertificate(t *testing.T, name string, digest []byte, critical bool) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	value, _ := asn1.Marshal(digest)
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: name},
+		DNSNames:        []string{name},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: oidACMEIdentifier, Critical: critical, Value: value}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create challenge certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestValidateTLSALPN01(t *testing.T) {
+	const keyAuth = "token.thumbprint"
+	digest := sha256.Sum256([]byte(keyAuth))
+	wrong := sha256.Sum256([]byte("token.other"))
+
+	certs := map[string]tls.Certificate{
+		"valid.example.test":       newTLSALPNCertificate(t, "valid.example.test", digest[:], true),
+		"noalpn.example.test":      newTLSALPNCertificate(t, "noalpn.example.test", digest[:], true),
+		"wrong.example.test":       newTLSALPNCertificate(t, "wrong.example.test", wrong[:], true),
+		"noncritical.example.test": newTLSALPNCertificate(t, "noncritical.example.test", digest[:], false),
+		"othername.example.test":   newTLSALPNCertificate(t, "valid.example.test", digest[:], true),
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, ok := certs[hello.ServerName]
+			if !ok {
+				return nil, errors.New("unknown server name")
+			}
+			config := &tls.Config{Certificates: []tls.Certificate{cert}}
+			if hello.ServerName != "noalpn.example.test" {
+				config.NextProtos = []string{acmeTLSALPNProtocol}
+			}
+			return config, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	opts := ValidationOptions{TLSALPNPort: port, Resolver: startTestDNSServer(t).resolver()}
+
+	tests := []struct {
+		name      string
+		host      string
+		errorType string
+	}{
+		{"valid", "valid.example.test", ""},
+		{"no ALPN", "noalpn.example.test", "unauthorized"},
+		{"wrong digest", "wrong.example.test", "incorrectResponse"},
+		{"non-critical extension", "noncritical.example.test", "unauthorized"},
+		{"other name", "othername.example.test", "unauthorized"},
+		{"handshake failure", "unknown.example.test", "tls"},
+		{"unresolvable", "valid.example.invalid", "dns"},
+		{"wildcard", "*.valid.example.test", "unauthorized"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := opts.validateTLSALPN01(context.Background(), Identifier{Type: "dns", Value: tt.host}, keyAuth)
+			if tt.errorType == "" {
+				if err != nil {
+					t.Errorf("Expected validation to succeed, got %v", err)
+				}
+				return
+			}
+			var validationErr *validationError
+			if !errors.As(err, &validationErr) || validationErr.errorType != tt.errorType {
+				t.Errorf("Expected a %s error, got %v", tt.errorType, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package certificates
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
+)
+
+// Client fields of audit entries for actions the server takes on its own
+const (
+	systemAuditIP        = "system"
+	systemAuditUserAgent = "localca-server"
+)
+
+// recordAudit appends an entry for an action the server took on its own to
+// the audit log served by the API, and to the database when one is enabled
+func (c *CertificateService) recordAudit(action, resource, resourceID, details string, actionErr error) {
+	success := actionErr == nil
+	errorMsg := ""
+	if actionErr != nil {
+		errorMsg = actionErr.Error()
+	}
+
+	if enhanced, ok := c.storage.(*storage.EnhancedStorage); ok {
+		enhanced.LogAudit(action, resource, resourceID, systemAuditIP, systemAuditUserAgent, details, success, errorMsg)
+	}
+
+	// Same entry format as the audit log written by the API handlers
+	entry := map[string]interface{}{
+		"id":          time.Now().UnixNano(),
+		"action":      action,
+		"resource":    resource,
+		"resource_id": resourceID,
+		"user_ip":     systemAuditIP,
+		"user_agent":  systemAuditUserAgent,
+		"details":     details,
+		"success":     success,
+		"error":       errorMsg,
+		"created_at":  time.Now().Format(time.RFC3339),
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to marshal audit log entry: %v", err)
+		return
+	}
+
+	file, err := os.OpenFile(filepath.Join(c.storage.GetBasePath(), "audit.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("Failed to open audit log file: %v", err)
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write audit log entry: %v", err)
+	}
+}
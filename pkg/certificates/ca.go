@@ -1,59 +1,85 @@
 package certificates
 
 import (
+	"crypto"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
-	"math/big"
+	"log"
 	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Lazarev-Cloud/localca-go/pkg/config"
+	"github.com/Lazarev-Cloud/localca-go/pkg/signer"
 	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
 )
 
 // CertificateService handles certificate operations
 type CertificateService struct {
-	config  *config.Config
-	storage storage.StorageInterface
+	config          *config.Config
+	storage         storage.StorageInterface
+	revocationMutex sync.Mutex
+	profileMutex    sync.Mutex
+	ocspMutex       sync.Mutex
+	ocspCache       map[string]ocspCacheEntry
+	sealMutex       sync.RWMutex
+	passphrase      []byte
+	caKeys          map[string]crypto.Signer
+	signerBackend   signer.Backend
+	shareMutex      sync.Mutex
+	pendingShares   pendingShares
+	indexMutex      sync.Mutex
+	index           *certificateIndex
+	renewalMutex    sync.Mutex
+	renewalFailures map[string]renewalFailure
 }
 
 // NewCertificateService creates a new certificate service
 func NewCertificateService(cfg *config.Config, store storage.StorageInterface) (*CertificateService, error) {
+	backend, err := newSignerBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	return &CertificateService{
-		config:  cfg,
-		storage: store,
+		config:        cfg,
+		storage:       store,
+		signerBackend: backend,
 	}, nil
 }
 
 // CAExists checks if CA certificate exists
 func (c *CertificateService) CAExists() (bool, error) {
 	caCertPath := c.storage.GetCAPublicKeyPath()
-	caKeyPath := c.storage.GetCAPrivateKeyPath()
 
-	// Check if both files exist
+	// Check if both the certificate and a key exist
 	if _, err := os.Stat(caCertPath); os.IsNotExist(err) {
 		return false, nil
 	}
-	if _, err := os.Stat(caKeyPath); os.IsNotExist(err) {
+	if !c.rootKeyOnline() {
+		// The root key may have been taken offline in two-tier mode
+		if _, err := os.Stat(c.getIntermediateKeyPath()); err == nil && c.hasIntermediate() {
+			return true, nil
+		}
 		return false, nil
 	}
 
 	return true, nil
 }
 
-// CreateCA creates a new CA certificate
+// CreateCA creates a new CA certificate. The CA must be unsealed so the new
+// keys can be encrypted.
 func (c *CertificateService) CreateCA() error {
-	// Save CA info
-	if err := c.storage.SaveCAInfo(c.config.CAName, c.config.CAKeyPassword, c.config.Organization, c.config.Country); err != nil {
-		return fmt.Errorf("failed to save CA info: %w", err)
+	if c.Sealed() {
+		return ErrCASealed
 	}
 
 	// Create directory for CA
@@ -63,14 +89,25 @@ func (c *CertificateService) CreateCA() error {
 	}
 
 	// Generate CA key pair
-	caPrivKey, err := rsa.GenerateKey(rand.Reader, 4096)
+	keySpec, err := c.caKeySpec()
+	if err != nil {
+		return err
+	}
+
+	caPrivKey, err := c.generateCAKey(keySpec)
 	if err != nil {
 		return fmt.Errorf("failed to generate CA private key: %w", err)
 	}
 
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return err
+	}
+
 	// Create CA certificate template
+	twoTier := c.config.CAMode == CAModeTwoTier
 	caTemplate := x509.Certificate{
-		SerialNumber: big.NewInt(time.Now().Unix()),
+		SerialNumber: serial,
 		Subject: pkix.Name{
 			CommonName:   c.config.CAName,
 			Organization: []string{c.config.Organization},
@@ -83,50 +120,52 @@ func (c *CertificateService) CreateCA() error {
 		IsCA:                  true,
 		MaxPathLen:            0,
 	}
+	if twoTier {
+		// The root only certifies the issuing intermediate
+		caTemplate.MaxPathLen = 1
+	}
 
 	// Create CA certificate
-	caBytes, err := x509.CreateCertificate(rand.Reader, &caTemplate, &caTemplate, &caPrivKey.PublicKey, caPrivKey)
+	caBytes, err := x509.CreateCertificate(rand.Reader, &caTemplate, &caTemplate, caPrivKey.Public(), caPrivKey)
 	if err != nil {
 		return fmt.Errorf("failed to create CA certificate: %w", err)
 	}
 
-	// Save CA certificate to file
-	caCertFile, err := os.Create(c.storage.GetCAPublicKeyPath())
-	if err != nil {
-		return fmt.Errorf("failed to create CA certificate file: %w", err)
+	if err := c.saveRootCA(caBytes, caPrivKey); err != nil {
+		return err
 	}
-	defer caCertFile.Close()
 
-	// Write CA certificate in PEM format
-	if err := pem.Encode(caCertFile, &pem.Block{Type: "CERTIFICATE", Bytes: caBytes}); err != nil {
-		return fmt.Errorf("failed to encode CA certificate: %w", err)
+	// Create the issuing intermediate in two-tier mode
+	if twoTier {
+		caCert, err := x509.ParseCertificate(caBytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse CA certificate: %w", err)
+		}
+		if err := c.createIntermediate(caCert, caPrivKey); err != nil {
+			return err
+		}
 	}
 
-	// Save CA private key to file
-	caKeyFile, err := os.Create(c.storage.GetCAPrivateKeyPath())
-	if err != nil {
-		return fmt.Errorf("failed to create CA key file: %w", err)
+	// Save CA info
+	if err := c.storage.SaveCAInfo(c.config.CAName, c.config.Organization, c.config.Country); err != nil {
+		return fmt.Errorf("failed to save CA info: %w", err)
 	}
-	defer caKeyFile.Close()
 
-	// Write CA private key in PEM format
-	if err := pem.Encode(caKeyFile, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(caPrivKey),
-	}); err != nil {
-		return fmt.Errorf("failed to encode CA private key: %w", err)
+	return nil
+}
+
+// saveRootCA writes the root certificate, its encrypted private key and the
+// public copy of the certificate
+func (c *CertificateService) saveRootCA(caBytes []byte, caPrivKey crypto.Signer) error {
+	// Save CA certificate to file
+	caCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caBytes})
+	if err := os.WriteFile(c.storage.GetCAPublicKeyPath(), caCertPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write CA certificate: %w", err)
 	}
 
-	// Create an encrypted version of the private key using OpenSSL (for compatibility)
-	cmd := exec.Command(
-		"openssl", "rsa",
-		"-in", c.storage.GetCAPrivateKeyPath(),
-		"-out", c.storage.GetCAEncryptedKeyPath(),
-		"-aes256",
-		"-passout", fmt.Sprintf("pass:%s", c.config.CAKeyPassword),
-	)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to encrypt CA private key: %w", err)
+	// Save the CA private key encrypted with the unsealed passphrase
+	if err := c.writeCAKeyFile(c.storage.GetCAEncryptedKeyPath(), caPrivKey); err != nil {
+		return fmt.Errorf("failed to save CA private key: %w", err)
 	}
 
 	// Copy CA certificate to public location using safe Go file operations
@@ -135,17 +174,8 @@ func (c *CertificateService) CreateCA() error {
 	}
 
 	// Set appropriate permissions with proper error handling
-	const (
-		privateFileMode = 0600 // Read/write for owner only
-		publicFileMode  = 0644 // Read for everyone, write for owner
-	)
+	const publicFileMode = 0644 // Read for everyone, write for owner
 
-	if err := os.Chmod(c.storage.GetCAPrivateKeyPath(), privateFileMode); err != nil {
-		return fmt.Errorf("failed to set permissions on CA private key: %w", err)
-	}
-	if err := os.Chmod(c.storage.GetCAEncryptedKeyPath(), privateFileMode); err != nil {
-		return fmt.Errorf("failed to set permissions on CA encrypted key: %w", err)
-	}
 	if err := os.Chmod(c.storage.GetCAPublicKeyPath(), publicFileMode); err != nil {
 		return fmt.Errorf("failed to set permissions on CA public key: %w", err)
 	}
@@ -158,49 +188,46 @@ func (c *CertificateService) CreateCA() error {
 
 // RenewCA renews the CA certificate
 func (c *CertificateService) RenewCA() error {
-	// Use full path to OpenSSL for security
-	opensslPath, err := exec.LookPath("openssl")
+	caCert, err := c.loadCACertificate()
 	if err != nil {
-		return fmt.Errorf("failed to find openssl executable: %w", err)
+		return err
 	}
 
-	// Create a CSR from the current CA certificate and key
-	cmd := exec.Command(
-		opensslPath, "x509",
-		"-x509toreq",
-		"-in", c.storage.GetCAPublicKeyPath(),
-		"-signkey", c.storage.GetCAPrivateKeyPath(),
-		"-out", c.storage.GetCADirectory()+"/ca.csr",
-	)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create CSR from CA: %w", err)
-	}
-
-	// Create a new CA certificate with extended validity
-	cmd = exec.Command(
-		opensslPath, "x509",
-		"-req",
-		"-days", "3650", // 10 years
-		"-in", c.storage.GetCADirectory()+"/ca.csr",
-		"-signkey", c.storage.GetCAPrivateKeyPath(),
-		"-out", c.storage.GetCADirectory()+"/ca-new.pem",
-	)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create new CA certificate: %w", err)
+	caKey, err := c.loadCAPrivateKey()
+	if err != nil {
+		return err
+	}
+
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return err
+	}
+
+	// Re-sign the CA certificate with the same key and subject and extended validity
+	caTemplate := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               caCert.Subject,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(10, 0, 0), // 10 years validity
+		KeyUsage:              caCert.KeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            caCert.MaxPathLen,
+		MaxPathLenZero:        caCert.MaxPathLenZero,
 	}
 
-	// Replace existing CA certificate - use Go's file operations instead of exec
-	srcFile, err := os.ReadFile(c.storage.GetCADirectory() + "/ca-new.pem")
+	caBytes, err := x509.CreateCertificate(rand.Reader, &caTemplate, &caTemplate, caKey.Public(), caKey)
 	if err != nil {
-		return fmt.Errorf("failed to read new CA certificate: %w", err)
+		return fmt.Errorf("failed to create new CA certificate: %w", err)
 	}
+	caCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caBytes})
 
-	if err := os.WriteFile(c.storage.GetCAPublicKeyPath(), srcFile, 0644); err != nil {
+	if err := os.WriteFile(c.storage.GetCAPublicKeyPath(), caCertPEM, 0644); err != nil {
 		return fmt.Errorf("failed to replace CA certificate: %w", err)
 	}
 
 	// Copy to public location - use Go's file operations instead of exec
-	if err := os.WriteFile(c.storage.GetCAPublicCopyPath(), srcFile, 0644); err != nil {
+	if err := os.WriteFile(c.storage.GetCAPublicCopyPath(), caCertPEM, 0644); err != nil {
 		return fmt.Errorf("failed to copy new CA certificate: %w", err)
 	}
 
@@ -215,139 +242,96 @@ func (c *CertificateService) CreateServiceCertificate() error {
 		return fmt.Errorf("failed to get hostname: %w", err)
 	}
 
+	// Load the issuer first, so a sealed CA leaves the existing service key
+	// and certificate in place
+	caCert, caKey, err := c.loadIssuer()
+	if err != nil {
+		return err
+	}
+
 	// Create directory for the service certificate
 	certDir := filepath.Join(c.storage.GetBasePath(), "service")
 	if err := os.MkdirAll(certDir, 0755); err != nil {
 		return fmt.Errorf("failed to create service certificate directory: %w", err)
 	}
 
-	// Create additional domains for the service certificate
-	// Include common local names and the CA name itself
-	additionalDomains := []string{
-		"localhost",
-		"localca",
-		"localca.local",
-		c.config.CAName,
-	}
-
-	// If hostname is not already in the list, add it
-	hostnameExists := false
-	for _, domain := range additionalDomains {
-		if domain == hostname {
-			hostnameExists = true
-			break
+	// Include common local names, the CA name and the host name; names that
+	// are not valid DNS names, such as a CA name with spaces, are skipped
+	sans := &SubjectAltNames{}
+	for _, name := range []string{"localhost", "localca", "localca.local", c.config.CAName, hostname} {
+		if err := sans.Add(name); err != nil {
+			log.Printf("Skipping service certificate name %q: %v", name, err)
 		}
 	}
-	if !hostnameExists {
-		additionalDomains = append(additionalDomains, hostname)
-	}
 
-	// Add IP addresses as well
-	// Get all IP addresses of the host
+	// Add the IP addresses of the host as IP address SANs
 	addrs, err := net.InterfaceAddrs()
 	if err == nil {
 		for _, addr := range addrs {
 			// Check if it's an IP address and not a network prefix
 			ipnet, ok := addr.(*net.IPNet)
-			if ok && !ipnet.IP.IsLoopback() {
-				// Only add IPv4 addresses for now
-				if ipnet.IP.To4() != nil {
-					additionalDomains = append(additionalDomains, ipnet.IP.String())
-				}
+			if ok && !ipnet.IP.IsLoopback() && !ipnet.IP.IsLinkLocalUnicast() {
+				sans.Add(ipnet.IP.String())
 			}
 		}
-		// Always add localhost IP
-		additionalDomains = append(additionalDomains, "127.0.0.1")
 	}
+	// Always add the loopback addresses
+	sans.Add("127.0.0.1")
+	sans.Add("::1")
 
 	// Generate server key pair
-	serverPrivKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	keySpec, err := ParseKeySpec(string(KeyAlgorithmRSA), DefaultRSAKeySize)
 	if err != nil {
-		return fmt.Errorf("failed to generate service private key: %w", err)
+		return err
 	}
 
-	// Save server private key to file
-	serverKeyPath := filepath.Join(c.storage.GetBasePath(), "service.key")
-	serverKeyFile, err := os.Create(serverKeyPath)
+	serverPrivKey, err := generateKey(keySpec)
 	if err != nil {
-		return fmt.Errorf("failed to create service key file: %w", err)
+		return fmt.Errorf("failed to generate service private key: %w", err)
 	}
-	defer serverKeyFile.Close()
 
-	if err := pem.Encode(serverKeyFile, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(serverPrivKey),
-	}); err != nil {
-		return fmt.Errorf("failed to encode service private key: %w", err)
+	serial, err := c.newSerialNumber()
+	if err != nil {
+		return err
 	}
 
 	// Create server certificate template
 	serverTemplate := x509.Certificate{
-		SerialNumber: big.NewInt(time.Now().Unix()),
+		SerialNumber: serial,
 		Subject: pkix.Name{
 			CommonName: "localca-service",
 		},
 		NotBefore:   time.Now(),
 		NotAfter:    time.Now().AddDate(3, 0, 0), // 3 years validity
-		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		KeyUsage:    leafKeyUsage(serverPrivKey.Public()),
 		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		DNSNames:    additionalDomains,
-	}
-
-	// Load CA certificate
-	caCertBytes, err := os.ReadFile(c.storage.GetCAPublicKeyPath())
-	if err != nil {
-		return fmt.Errorf("failed to read CA certificate: %w", err)
-	}
-
-	caCertBlock, _ := pem.Decode(caCertBytes)
-	if caCertBlock == nil {
-		return fmt.Errorf("failed to decode CA certificate PEM")
-	}
-
-	caCert, err := x509.ParseCertificate(caCertBlock.Bytes)
-	if err != nil {
-		return fmt.Errorf("failed to parse CA certificate: %w", err)
-	}
-
-	// Load CA private key
-	caKeyBytes, err := os.ReadFile(c.storage.GetCAPrivateKeyPath())
-	if err != nil {
-		return fmt.Errorf("failed to read CA private key: %w", err)
-	}
-
-	caKeyBlock, _ := pem.Decode(caKeyBytes)
-	if caKeyBlock == nil {
-		return fmt.Errorf("failed to decode CA private key PEM")
-	}
-
-	caKey, err := x509.ParsePKCS1PrivateKey(caKeyBlock.Bytes)
-	if err != nil {
-		return fmt.Errorf("failed to parse CA private key: %w", err)
 	}
+	sans.apply(&serverTemplate)
+	c.applyDistributionPoints(&serverTemplate, caCert)
 
 	// Create server certificate
 	serverCertBytes, err := x509.CreateCertificate(
 		rand.Reader,
 		&serverTemplate,
 		caCert,
-		&serverPrivKey.PublicKey,
+		serverPrivKey.Public(),
 		caKey,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create service certificate: %w", err)
 	}
 
-	// Save server certificate to file
-	serverCertPath := filepath.Join(c.storage.GetBasePath(), "service.crt")
-	serverCertFile, err := os.Create(serverCertPath)
-	if err != nil {
-		return fmt.Errorf("failed to create service certificate file: %w", err)
+	// Save server private key to file
+	serverKeyPath := filepath.Join(c.storage.GetBasePath(), "service.key")
+	if err := writePrivateKeyFile(serverKeyPath, serverPrivKey); err != nil {
+		return fmt.Errorf("failed to save service private key: %w", err)
 	}
-	defer serverCertFile.Close()
 
-	if err := pem.Encode(serverCertFile, &pem.Block{Type: "CERTIFICATE", Bytes: serverCertBytes}); err != nil {
-		return fmt.Errorf("failed to encode service certificate: %w", err)
+	// Save server certificate to file
+	serverCertPath := filepath.Join(c.storage.GetBasePath(), "service.crt")
+	serverCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCertBytes})
+	if err := os.WriteFile(serverCertPath, serverCertPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write service certificate: %w", err)
 	}
 
 	// Set proper permissions
@@ -366,68 +350,90 @@ func (c *CertificateService) CreateServiceCertificate() error {
 	return nil
 }
 
-// GetAllCertificates returns a list of all issued certificates
-func (c *CertificateService) GetAllCertificates() ([]Certificate, error) {
-	// Get the list of certificate names
-	certNames, err := c.storage.ListCertificates()
-	if err != nil {
-		return nil, fmt.Errorf("failed to list certificates: %w", err)
+// caKeySpec returns the key spec configured for the CA key
+func (c *CertificateService) caKeySpec() (KeySpec, error) {
+	size := c.config.CAKeySize
+	if size == 0 {
+		switch strings.ToLower(c.config.CAKeyType) {
+		case "", "rsa":
+			size = DefaultCARSAKeySize
+		case "ecdsa", "ec":
+			size = DefaultCAECDSASize
+		}
 	}
+	return ParseKeySpec(c.config.CAKeyType, size)
+}
 
-	// Get certificate details for each
-	certificates := make([]Certificate, 0, len(certNames))
-	for _, name := range certNames {
-		cert, err := c.GetCertificateInfo(name)
-		if err != nil {
-			continue
-		}
-		certificates = append(certificates, *cert)
+// loadCACertificate reads and parses the CA certificate
+func (c *CertificateService) loadCACertificate() (*x509.Certificate, error) {
+	caCert, err := readCertificateFile(c.storage.GetCAPublicKeyPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA certificate: %w", err)
 	}
+	return caCert, nil
+}
 
-	return certificates, nil
+// loadCAPrivateKey decrypts the CA private key as a generic signer
+func (c *CertificateService) loadCAPrivateKey() (crypto.Signer, error) {
+	caKey, err := c.readCAKeyFile(c.storage.GetCAEncryptedKeyPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrRootKeyOffline
+	}
+	if errors.Is(err, ErrCASealed) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA private key: %w", err)
+	}
+	return caKey, nil
 }
 
-// GetCertificateInfo returns information about a specific certificate
-func (c *CertificateService) GetCertificateInfo(name string) (*Certificate, error) {
-	certPath := c.storage.GetCertificatePath(name)
+// readCertificateFile reads and parses a PEM encoded certificate
+func readCertificateFile(path string) (*x509.Certificate, error) {
+	certBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
 
-	// Check if certificate exists
-	if _, err := os.Stat(certPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("certificate does not exist: %s", name)
+	certBlock, _ := pem.Decode(certBytes)
+	if certBlock == nil {
+		return nil, fmt.Errorf("failed to decode certificate PEM")
 	}
 
-	// Use OpenSSL to get certificate details
-	cmd := exec.Command(
-		"openssl", "x509",
-		"-in", certPath,
-		"-noout",
-		"-text",
-		"-serial",
-	)
-	_, err := cmd.Output()
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get certificate info: %w", err)
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
 	}
 
-	// Parse the output to create a Certificate struct
-	// This is a simplified implementation and may need to be expanded
-	cert := &Certificate{
-		CommonName: name,
-		Path:       certPath,
+	return cert, nil
+}
+
+// readPrivateKeyFile reads and parses a PEM encoded private key
+func readPrivateKeyFile(path string) (crypto.Signer, error) {
+	keyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
 	}
 
-	// Check if it's a client certificate
-	p12Path := c.storage.GetCertificateP12Path(name)
-	cert.IsClient = false
-	if _, err := os.Stat(p12Path); err == nil {
-		cert.IsClient = true
+	key, err := parsePrivateKeyPEM(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
 	}
 
-	// Extract details from output
-	// This would require parsing the OpenSSL output
-	// Full implementation would need to extract SerialNumber, NotBefore, NotAfter, etc.
+	return key, nil
+}
 
-	return cert, nil
+// writePrivateKeyFile writes a private key as PKCS#8 PEM readable only by the owner
+func writePrivateKeyFile(path string, key crypto.Signer) error {
+	keyPEM, err := encodePrivateKeyPEM(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, keyPEM, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0600)
 }
 
 // safeCopyFile safely copies a file from src to dst using Go standard library
@@ -16,7 +16,9 @@ import (
 	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
 )
 
-// mockCreateCA is a test helper function that creates a CA without using OpenSSL
+// mockCreateCA is a test helper function that creates a CA without using OpenSSL.
+// It writes a plaintext key the way earlier versions did and unseals the CA,
+// which encrypts the key.
 func mockCreateCA(certService *CertificateService) error {
 	// Create directory for CA
 	caDir := certService.storage.GetCADirectory()
@@ -105,7 +107,9 @@ func mockCreateCA(certService *CertificateService) error {
 		return err
 	}
 
-	return nil
+	// Unsealing again migrates the plaintext key
+	certService.Seal()
+	return certService.Unseal(certService.config.CAKeyPassword)
 }
 
 func TestCertificateService_CreateCA(t *testing.T) {
@@ -148,7 +152,7 @@ func TestCertificateService_CreateCA(t *testing.T) {
 
 	// Check if files were created
 	certFile := store.GetCAPublicKeyPath()
-	keyFile := store.GetCAPrivateKeyPath()
+	keyFile := store.GetCAEncryptedKeyPath()
 
 	if _, err := os.Stat(certFile); os.IsNotExist(err) {
 		t.Errorf("CA certificate file was not created at %s", certFile)
@@ -157,6 +161,11 @@ func TestCertificateService_CreateCA(t *testing.T) {
 	if _, err := os.Stat(keyFile); os.IsNotExist(err) {
 		t.Errorf("CA key file was not created at %s", keyFile)
 	}
+
+	// Only the encrypted key is left on disk
+	if _, err := os.Stat(store.GetCAPrivateKeyPath()); !os.IsNotExist(err) {
+		t.Errorf("Plaintext CA key was not removed: %v", err)
+	}
 }
 
 func TestCertificateService_CAExists(t *testing.T) {
@@ -2,16 +2,12 @@ package certificates
 
 import (
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
-	"math/big"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/Lazarev-Cloud/localca-go/pkg/security"
@@ -19,142 +15,132 @@ import (
 
 // CreateClientCertificate creates a new client certificate and p12 file
 func (c *CertificateService) CreateClientCertificate(commonName string, p12Password string) error {
-	// Create directory for the certificate
-	certDir := c.storage.GetCertificateDirectory(commonName)
-	if err := os.MkdirAll(certDir, 0755); err != nil {
-		return fmt.Errorf("failed to create certificate directory: %w", err)
+	return c.CreateClientCertificateWithOptions(commonName, p12Password, IssueOptions{})
+}
+
+// CreateClientCertificateWithOptions creates a new client certificate and p12 file using the given issue options
+func (c *CertificateService) CreateClientCertificateWithOptions(commonName string, p12Password string, opts IssueOptions) error {
+	keySpec, err := opts.keySpec()
+	if err != nil {
+		return err
+	}
+	if err := opts.Metadata.Validate(); err != nil {
+		return err
 	}
 
-	// Save p12 password
-	if err := os.WriteFile(c.storage.GetCertificatePasswordPath(commonName), []byte(p12Password), 0600); err != nil {
-		return fmt.Errorf("failed to save certificate password: %w", err)
+	// The common name of a client certificate is an identity, not a host name
+	sans, err := ParseSubjectAltNames(opts.SubjectAltNames)
+	if err != nil {
+		return err
 	}
 
-	// Generate client key pair
-	clientPrivKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	// Refuse to replace an existing certificate and fail on a sealed CA
+	// before anything is written
+	if _, err := os.Stat(c.storage.GetCertificatePath(commonName)); err == nil {
+		return ErrCertificateAlreadyExists
+	}
+
+	profile, err := c.resolveProfile(opts.Profile, true)
 	if err != nil {
-		return fmt.Errorf("failed to generate client private key: %w", err)
+		return err
+	}
+	if err := profile.allowsAlgorithm(keySpec.Algorithm); err != nil {
+		return err
 	}
 
-	// Save client private key to file
-	clientKeyPath := c.storage.GetCertificateKeyPath(commonName)
-	clientKeyFile, err := os.Create(clientKeyPath)
+	// Load issuing CA certificate and key
+	caCert, caKey, err := c.loadIssuer()
 	if err != nil {
-		return fmt.Errorf("failed to create client key file: %w", err)
+		return err
 	}
-	defer clientKeyFile.Close()
 
-	if err := pem.Encode(clientKeyFile, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(clientPrivKey),
-	}); err != nil {
-		return fmt.Errorf("failed to encode client private key: %w", err)
+	// Generate client key pair
+	clientPrivKey, err := generateKey(keySpec)
+	if err != nil {
+		return fmt.Errorf("failed to generate client private key: %w", err)
+	}
+
+	serial, err := c.newSerialNumber()
+	if err != nil {
+		return err
 	}
 
 	// Create client certificate template
 	clientTemplate := x509.Certificate{
-		SerialNumber: big.NewInt(time.Now().Unix()),
+		SerialNumber: serial,
 		Subject: pkix.Name{
 			CommonName: commonName,
 		},
-		NotBefore:   time.Now(),
-		NotAfter:    time.Now().AddDate(1, 0, 0), // 1 year validity
-		KeyUsage:    x509.KeyUsageDigitalSignature,
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageEmailProtection},
-		DNSNames:    []string{commonName},
-	}
-
-	// Load CA certificate
-	caCertBytes, err := os.ReadFile(c.storage.GetCAPublicKeyPath())
-	if err != nil {
-		return fmt.Errorf("failed to read CA certificate: %w", err)
-	}
-
-	caCertBlock, _ := pem.Decode(caCertBytes)
-	if caCertBlock == nil {
-		return fmt.Errorf("failed to decode CA certificate PEM")
 	}
-
-	caCert, err := x509.ParseCertificate(caCertBlock.Bytes)
-	if err != nil {
-		return fmt.Errorf("failed to parse CA certificate: %w", err)
+	sans.apply(&clientTemplate)
+	if err := profile.apply(&clientTemplate, clientPrivKey.Public()); err != nil {
+		return err
 	}
+	c.applyDistributionPoints(&clientTemplate, caCert)
 
-	// Load CA private key
-	caKeyBytes, err := os.ReadFile(c.storage.GetCAPrivateKeyPath())
+	// Create client certificate
+	clientCertBytes, err := x509.CreateCertificate(rand.Reader, &clientTemplate, caCert, clientPrivKey.Public(), caKey)
 	if err != nil {
-		return fmt.Errorf("failed to read CA private key: %w", err)
+		return fmt.Errorf("failed to create client certificate: %w", err)
 	}
 
-	caKeyBlock, _ := pem.Decode(caKeyBytes)
-	if caKeyBlock == nil {
-		return fmt.Errorf("failed to decode CA private key PEM")
+	// Create directory for the certificate
+	certDir := c.storage.GetCertificateDirectory(commonName)
+	if err := os.MkdirAll(certDir, 0755); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
 	}
 
-	caKey, err := x509.ParsePKCS1PrivateKey(caKeyBlock.Bytes)
-	if err != nil {
-		return fmt.Errorf("failed to parse CA private key: %w", err)
+	// Save p12 password
+	if err := os.WriteFile(c.storage.GetCertificatePasswordPath(commonName), []byte(p12Password), 0600); err != nil {
+		return fmt.Errorf("failed to save certificate password: %w", err)
 	}
 
-	// Create client certificate
-	clientCertBytes, err := x509.CreateCertificate(rand.Reader, &clientTemplate, caCert, &clientPrivKey.PublicKey, caKey)
-	if err != nil {
-		return fmt.Errorf("failed to create client certificate: %w", err)
+	// Save client private key to file
+	clientKeyPath := c.storage.GetCertificateKeyPath(commonName)
+	if err := writePrivateKeyFile(clientKeyPath, clientPrivKey); err != nil {
+		return fmt.Errorf("failed to save client private key: %w", err)
 	}
 
 	// Save client certificate to file
 	clientCertPath := c.storage.GetCertificatePath(commonName)
-	clientCertFile, err := os.Create(clientCertPath)
-	if err != nil {
-		return fmt.Errorf("failed to create client certificate file: %w", err)
-	}
-	defer clientCertFile.Close()
-
-	if err := pem.Encode(clientCertFile, &pem.Block{Type: "CERTIFICATE", Bytes: clientCertBytes}); err != nil {
-		return fmt.Errorf("failed to encode client certificate: %w", err)
+	clientCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCertBytes})
+	if err := os.WriteFile(clientCertPath, clientCertPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write client certificate: %w", err)
 	}
 
 	// Create PKCS#12 file
-	p12Path := c.storage.GetCertificateP12Path(commonName)
-	
-	// Create a temporary password file to avoid command line exposure
-	passwordFile, err := os.CreateTemp("", "p12pass")
-	if err != nil {
-		return fmt.Errorf("failed to create password file: %w", err)
+	if err := c.createPKCS12(commonName, p12Password); err != nil {
+		return err
 	}
-	defer os.Remove(passwordFile.Name())
-	defer passwordFile.Close()
-	
-	// Write password to temp file
-	validatedPassword := security.ValidatePassword(p12Password)
-	if _, err := passwordFile.WriteString(validatedPassword); err != nil {
-		return fmt.Errorf("failed to write password to temp file: %w", err)
+
+	if err := c.recordSerialNumber(serial, commonName); err != nil {
+		return err
 	}
-	passwordFile.Close()
-	
-	cmd := exec.Command(
-		"openssl", "pkcs12",
-		"-export",
-		"-out", p12Path,
-		"-inkey", clientKeyPath,
-		"-in", clientCertPath,
-		"-certfile", c.storage.GetCAPublicKeyPath(),
-		"-passout", fmt.Sprintf("file:%s", passwordFile.Name()),
-	)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create PKCS#12 file: %w", err)
+
+	if err := c.recordCertificateProfile(commonName, profile.Name); err != nil {
+		return err
 	}
 
-	// Set permissions
-	os.Chmod(clientKeyPath, 0600)
-	os.Chmod(clientCertPath, 0644)
-	os.Chmod(p12Path, 0644)
+	if err := c.recordCertificateMetadata(commonName, opts.Metadata); err != nil {
+		return err
+	}
 
+	c.updateIndex(commonName)
 	return nil
 }
 
 // RenewClientCertificate renews an existing client certificate
 func (c *CertificateService) RenewClientCertificate(commonName string) error {
+	return c.RenewClientCertificateWithOptions(commonName, RenewOptions{})
+}
+
+// RenewClientCertificateWithOptions renews a client certificate, optionally
+// with a new key
+func (c *CertificateService) RenewClientCertificateWithOptions(commonName string, opts RenewOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
 	// Check if certificate exists
 	certPath := c.storage.GetCertificatePath(commonName)
 	keyPath := c.storage.GetCertificateKeyPath(commonName)
@@ -164,71 +150,116 @@ func (c *CertificateService) RenewClientCertificate(commonName string) error {
 	if _, err := os.Stat(certPath); os.IsNotExist(err) {
 		return fmt.Errorf("certificate does not exist: %s", commonName)
 	}
-	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
-		return fmt.Errorf("certificate key does not exist: %s", commonName)
-	}
-	if _, err := os.Stat(p12Path); os.IsNotExist(err) {
-		return fmt.Errorf("p12 file does not exist: %s", commonName)
+
+	// Certificates issued from a CSR have no key, p12 or password file
+	_, keyErr := os.Stat(keyPath)
+	hasKey := keyErr == nil
+	if hasKey {
+		if _, err := os.Stat(p12Path); os.IsNotExist(err) {
+			return fmt.Errorf("p12 file does not exist: %s", commonName)
+		}
+		if _, err := os.Stat(passwordPath); os.IsNotExist(err) {
+			return fmt.Errorf("password file does not exist: %s", commonName)
+		}
 	}
-	if _, err := os.Stat(passwordPath); os.IsNotExist(err) {
-		return fmt.Errorf("password file does not exist: %s", commonName)
+
+	// Reuse the public key of the existing certificate
+	existing, err := readCertificateFile(certPath)
+	if err != nil {
+		return err
 	}
 
-	// Read p12 password
-	passwordBytes, err := os.ReadFile(passwordPath)
+	// Renew with the profile the certificate was issued with
+	profile, err := c.certificateProfile(commonName, true)
 	if err != nil {
-		return fmt.Errorf("failed to read password file: %w", err)
+		return err
 	}
-	p12Password := string(passwordBytes)
 
-	// Generate CSR
-	csrPath := c.storage.GetCertificateDirectory(commonName) + "/" + commonName + ".csr"
-	cmd := exec.Command(
-		"openssl", "req",
-		"-new",
-		"-key", keyPath,
-		"-out", csrPath,
-		"-subj", "/CN="+security.ValidateSubjectDN(commonName),
-	)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create CSR: %w", err)
+	serial, err := c.newSerialNumber()
+	if err != nil {
+		return err
 	}
 
-	// Create SAN extension config
-	sanConfig := "basicConstraints = CA:FALSE\n"
-	sanConfig += "nsCertType = client, email\n"
-	sanConfig += "nsComment = \"OpenSSL Generated Client Certificate\"\n"
-	sanConfig += "subjectKeyIdentifier = hash\n"
-	sanConfig += "authorityKeyIdentifier = keyid,issuer\n"
-	sanConfig += "keyUsage = critical, nonRepudiation, digitalSignature, keyEncipherment\n"
-	sanConfig += "extendedKeyUsage = clientAuth, emailProtection\n"
-	sanConfig += "subjectAltName = @alt_names\n\n"
-	sanConfig += "[alt_names]\n"
-	sanConfig += fmt.Sprintf("DNS.1 = %s\n", commonName)
+	clientTemplate := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+	}
+	sans := subjectAltNamesOf(existing)
+	// Earlier versions put the common name of client certificates in the DNS names
+	if len(sans.DNSNames) == 1 && sans.DNSNames[0] == commonName {
+		sans.DNSNames = nil
+	}
+	sans.apply(&clientTemplate)
 
-	sanConfigPath := c.storage.GetCertificateDirectory(commonName) + "/" + commonName + ".ext"
-	if err := os.WriteFile(sanConfigPath, []byte(sanConfig), 0644); err != nil {
-		return fmt.Errorf("failed to write SAN config: %w", err)
+	publicKey, newKey, err := c.renewalKey(commonName, existing, opts.RotateKey)
+	if err != nil {
+		return err
+	}
+	if err := profile.apply(&clientTemplate, publicKey); err != nil {
+		return err
 	}
 
 	// Sign certificate with CA
-	cmd = exec.Command(
-		"openssl", "x509",
-		"-req",
-		"-in", csrPath,
-		"-CA", c.storage.GetCAPublicKeyPath(),
-		"-CAkey", c.storage.GetCAPrivateKeyPath(),
-		"-CAcreateserial",
-		"-out", certPath,
-		"-days", "365",
-		"-sha256",
-		"-extfile", sanConfigPath,
-	)
-	if err := cmd.Run(); err != nil {
+	caCert, caKey, err := c.loadIssuer()
+	if err != nil {
+		return err
+	}
+	c.applyDistributionPoints(&clientTemplate, caCert)
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, &clientTemplate, caCert, publicKey, caKey)
+	if err != nil {
 		return fmt.Errorf("failed to sign certificate: %w", err)
 	}
 
+	// Keep the certificate and key being replaced in the version history
+	renewedAt := time.Now()
+	revokeAfter := supersedeDeadline(profile, opts, renewedAt)
+	if err := c.archiveCertificateVersion(commonName, renewedAt, revokeAfter); err != nil {
+		return err
+	}
+
+	if newKey != nil {
+		if err := writePrivateKeyFile(keyPath, newKey); err != nil {
+			return fmt.Errorf("failed to write private key: %w", err)
+		}
+	}
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+
+	if err := c.recordSerialNumber(serial, commonName); err != nil {
+		return err
+	}
+	if revokeAfter != nil && !revokeAfter.After(renewedAt) {
+		c.revokeSupersededNow(commonName)
+	}
+	defer c.updateIndex(commonName)
+
+	if !hasKey {
+		return nil
+	}
+
+	// Read p12 password
+	passwordBytes, err := os.ReadFile(passwordPath)
+	if err != nil {
+		return fmt.Errorf("failed to read password file: %w", err)
+	}
+
 	// Create PKCS#12 file
+	if err := c.createPKCS12(commonName, string(passwordBytes)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createPKCS12 exports a certificate, its key and the CA chain into a PKCS#12 file
+func (c *CertificateService) createPKCS12(commonName string, p12Password string) error {
+	p12Path := c.storage.GetCertificateP12Path(commonName)
+
 	// Create a temporary password file to avoid command line exposure
 	passwordFile, err := os.CreateTemp("", "p12pass")
 	if err != nil {
@@ -236,146 +267,46 @@ func (c *CertificateService) RenewClientCertificate(commonName string) error {
 	}
 	defer os.Remove(passwordFile.Name())
 	defer passwordFile.Close()
-	
+
 	// Write password to temp file
 	validatedPassword := security.ValidatePassword(p12Password)
 	if _, err := passwordFile.WriteString(validatedPassword); err != nil {
 		return fmt.Errorf("failed to write password to temp file: %w", err)
 	}
 	passwordFile.Close()
-	
-	cmd = exec.Command(
+
+	// Include the full CA chain
+	chainData, err := c.issuerChainPEM()
+	if err != nil {
+		return err
+	}
+
+	chainFile, err := os.CreateTemp("", "p12chain")
+	if err != nil {
+		return fmt.Errorf("failed to create chain file: %w", err)
+	}
+	defer os.Remove(chainFile.Name())
+	defer chainFile.Close()
+
+	if _, err := chainFile.Write(chainData); err != nil {
+		return fmt.Errorf("failed to write chain file: %w", err)
+	}
+	chainFile.Close()
+
+	cmd := exec.Command(
 		"openssl", "pkcs12",
 		"-export",
 		"-out", p12Path,
-		"-inkey", keyPath,
-		"-in", certPath,
-		"-certfile", c.storage.GetCAPublicKeyPath(),
+		"-inkey", c.storage.GetCertificateKeyPath(commonName),
+		"-in", c.storage.GetCertificatePath(commonName),
+		"-certfile", chainFile.Name(),
 		"-passout", fmt.Sprintf("file:%s", passwordFile.Name()),
 	)
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to create PKCS#12 file: %w", err)
 	}
 
-	// Cleanup
-	os.Remove(csrPath)
-	os.Remove(sanConfigPath)
+	os.Chmod(p12Path, 0644)
 
 	return nil
 }
-
-// RevokeCertificate revokes a certificate and updates the CRL
-func (c *CertificateService) RevokeCertificate(commonName string) error {
-    // Check if certificate exists
-    certPath := c.storage.GetCertificatePath(commonName)
-    if _, err := os.Stat(certPath); os.IsNotExist(err) {
-        return fmt.Errorf("certificate not found: %s", commonName)
-    }
-
-    // Get serial number of the certificate
-    cmd := exec.Command(
-        "openssl", "x509",
-        "-in", certPath,
-        "-noout",
-        "-serial",
-    )
-    output, err := cmd.Output()
-    if err != nil {
-        return fmt.Errorf("failed to get certificate serial number: %w", err)
-    }
-
-    serialLine := string(output)
-    serialParts := strings.SplitN(serialLine, "=", 2)
-    if len(serialParts) != 2 {
-        return fmt.Errorf("invalid serial number format: %s", serialLine)
-    }
-
-    serial := strings.TrimSpace(serialParts[1])
-
-    // Initialize CRL directory if it doesn't exist
-    crlDir := filepath.Join(c.storage.GetCADirectory(), "crl")
-    if err := os.MkdirAll(crlDir, 0755); err != nil {
-        return fmt.Errorf("failed to create CRL directory: %w", err)
-    }
-
-    // Create or update CRL index file
-    indexPath := filepath.Join(crlDir, "index.txt")
-    if _, err := os.Stat(indexPath); os.IsNotExist(err) {
-        // Create empty index file if it doesn't exist
-        if err := os.WriteFile(indexPath, []byte(""), 0644); err != nil {
-            return fmt.Errorf("failed to create CRL index file: %w", err)
-        }
-    }
-
-    // Create openssl.cnf for CRL generation if it doesn't exist
-    opensslCnfPath := filepath.Join(crlDir, "openssl.cnf")
-    if _, err := os.Stat(opensslCnfPath); os.IsNotExist(err) {
-        // Create openssl.cnf with basic CRL configuration
-        opensslCnf := `
-[ ca ]
-default_ca = CA_default
-
-[ CA_default ]
-database = ` + indexPath + `
-serial = ` + filepath.Join(crlDir, "serial.txt") + `
-default_md = sha256
-default_crl_days = 30
-`
-        if err := os.WriteFile(opensslCnfPath, []byte(opensslCnf), 0644); err != nil {
-            return fmt.Errorf("failed to create openssl.cnf: %w", err)
-        }
-    }
-
-    // Create or update serial file
-    serialPath := filepath.Join(crlDir, "serial.txt")
-    if _, err := os.Stat(serialPath); os.IsNotExist(err) {
-        // Create serial file with initial value if it doesn't exist
-        if err := os.WriteFile(serialPath, []byte("01"), 0644); err != nil {
-            return fmt.Errorf("failed to create serial file: %w", err)
-        }
-    }
-
-    // Add certificate to index file with revocation status
-    now := time.Now().UTC().Format("060102150405Z") // YYMMDDhhmmssZ format
-    revocationLine := fmt.Sprintf("R\t%s\t%s\t%s\tunknown\t/CN=%s\n", 
-        now, serial, now, commonName)
-
-    indexFile, err := os.OpenFile(indexPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-    if err != nil {
-        return fmt.Errorf("failed to open index file: %w", err)
-    }
-    defer indexFile.Close()
-
-    if _, err := indexFile.WriteString(revocationLine); err != nil {
-        return fmt.Errorf("failed to write to index file: %w", err)
-    }
-
-    // Generate CRL
-    crlPath := filepath.Join(c.storage.GetCADirectory(), "ca.crl")
-    cmd = exec.Command(
-        "openssl", "ca",
-        "-config", opensslCnfPath,
-        "-gencrl",
-        "-keyfile", c.storage.GetCAPrivateKeyPath(),
-        "-cert", c.storage.GetCAPublicKeyPath(),
-        "-out", crlPath,
-    )
-    if err := cmd.Run(); err != nil {
-        return fmt.Errorf("failed to generate CRL: %w", err)
-    }
-
-    // Make the CRL accessible using safe Go file operations
-    crlPublicPath := filepath.Join(c.storage.GetBasePath(), "ca.crl")
-    if err := safeCopyFile(crlPath, crlPublicPath); err != nil {
-        return fmt.Errorf("failed to copy CRL to public location: %w", err)
-    }
-
-    // Mark the certificate as revoked in our system
-    revokedFlagPath := filepath.Join(c.storage.GetCertificateDirectory(commonName), "revoked")
-    if err := os.WriteFile(revokedFlagPath, []byte(now), 0644); err != nil {
-        return fmt.Errorf("failed to mark certificate as revoked: %w", err)
-    }
-
-    return nil
-}
-
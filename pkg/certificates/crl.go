@@ -0,0 +1,253 @@
+package certificates
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Default CRL timing used when the configuration does not override it
+const (
+	DefaultCRLValidity        = 7 * 24 * time.Hour
+	DefaultCRLRefreshInterval = 24 * time.Hour
+)
+
+// oidInvalidityDate is the RFC 5280 invalidityDate CRL entry extension
+var oidInvalidityDate = asn1.ObjectIdentifier{2, 5, 29, 24}
+
+// getCRLPath returns the path to the CRL inside the CA directory
+func (c *CertificateService) getCRLPath() string {
+	return filepath.Join(c.storage.GetCADirectory(), "ca.crl")
+}
+
+// getCRLPublicPath returns the path to the public copy of the CRL
+func (c *CertificateService) getCRLPublicPath() string {
+	return filepath.Join(c.storage.GetBasePath(), "ca.crl")
+}
+
+// crlValidity returns how long a freshly generated CRL stays valid
+func (c *CertificateService) crlValidity() time.Duration {
+	if c.config.CRLValidityHours > 0 {
+		return time.Duration(c.config.CRLValidityHours) * time.Hour
+	}
+	return DefaultCRLValidity
+}
+
+// crlRefreshInterval returns how often the CRL is regenerated
+func (c *CertificateService) crlRefreshInterval() time.Duration {
+	if c.config.CRLRefreshHours > 0 {
+		return time.Duration(c.config.CRLRefreshHours) * time.Hour
+	}
+	return DefaultCRLRefreshInterval
+}
+
+// GenerateCRL builds and signs a new CRL from the revocation database, for
+// the current issuing CA and for retired CAs whose certificates are still valid
+func (c *CertificateService) GenerateCRL() error {
+	c.revocationMutex.Lock()
+	defer c.revocationMutex.Unlock()
+
+	// The CRL is signed by the CA that issues leaf certificates
+	caCert, caKey, err := c.loadIssuer()
+	if err != nil {
+		return err
+	}
+
+	retired, err := c.activeRetiredCAs()
+	if err != nil {
+		return err
+	}
+
+	db, err := c.loadRevocationDatabase()
+	if err != nil {
+		return err
+	}
+
+	crlPEM, err := c.signCRL(db, caCert, caKey)
+	if err != nil {
+		return err
+	}
+
+	retiredCRLs := make(map[string][]byte, len(retired))
+	for _, ca := range retired {
+		issuer, issuerKey, err := c.loadRetiredIssuer(ca.ID)
+		if err != nil {
+			return err
+		}
+		retiredCRLs[ca.ID], err = c.signCRL(db, issuer, issuerKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Persist the new CRL number before publishing the list
+	if err := c.saveRevocationDatabase(db); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(c.getCRLPath(), crlPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write CRL: %w", err)
+	}
+
+	// Make the CRL accessible
+	if err := writeFileAtomic(c.getCRLPublicPath(), crlPEM, 0644); err != nil {
+		return fmt.Errorf("failed to copy CRL to public location: %w", err)
+	}
+
+	for id, retiredPEM := range retiredCRLs {
+		if err := writeFileAtomic(c.getRetiredCRLPath(id), retiredPEM, 0644); err != nil {
+			return fmt.Errorf("failed to write CRL of retired CA %s: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+// signCRL signs a PEM encoded CRL listing every revocation entry with the
+// next CRL number. Serial numbers are unique across CA generations, so
+// listing certificates of another generation is harmless.
+func (c *CertificateService) signCRL(db *revocationDatabase, caCert *x509.Certificate, caKey crypto.Signer) ([]byte, error) {
+	// CRL numbers must increase monotonically
+	db.CRLNumber++
+
+	entries := make([]x509.RevocationListEntry, 0, len(db.Entries))
+	for _, revoked := range db.Entries {
+		serial, ok := new(big.Int).SetString(revoked.SerialNumber, 16)
+		if !ok {
+			log.Printf("Skipping revocation entry with invalid serial %q", revoked.SerialNumber)
+			continue
+		}
+
+		entry := x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: revoked.RevokedAt,
+			ReasonCode:     int(revoked.Reason),
+		}
+
+		if revoked.InvalidityDate != nil {
+			value, err := asn1.MarshalWithParams(revoked.InvalidityDate.UTC(), "generalized")
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode invalidity date: %w", err)
+			}
+			entry.ExtraExtensions = append(entry.ExtraExtensions, pkix.Extension{
+				Id:    oidInvalidityDate,
+				Value: value,
+			})
+		}
+
+		entries = append(entries, entry)
+	}
+
+	now := time.Now().UTC()
+	template := &x509.RevocationList{
+		Number:                    big.NewInt(db.CRLNumber),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(c.crlValidity()),
+		RevokedCertificateEntries: entries,
+	}
+
+	crlBytes, err := x509.CreateRevocationList(rand.Reader, template, caCert, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CRL: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crlBytes}), nil
+}
+
+// GetCRL returns the current PEM encoded CRL, regenerating it first when it is
+// missing or due for refresh
+func (c *CertificateService) GetCRL() ([]byte, error) {
+	if err := c.refreshCRL(c.getCRLPublicPath()); err != nil {
+		return nil, err
+	}
+
+	crlPEM, err := os.ReadFile(c.getCRLPublicPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CRL: %w", err)
+	}
+
+	return crlPEM, nil
+}
+
+// refreshCRL regenerates the CRLs when the one at path is due. A sealed CA
+// keeps serving the last CRL it signed.
+func (c *CertificateService) refreshCRL(path string) error {
+	if !c.crlNeedsRefresh(path) {
+		return nil
+	}
+
+	err := c.GenerateCRL()
+	if errors.Is(err, ErrCASealed) {
+		if _, statErr := os.Stat(path); statErr == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// crlNeedsRefresh reports whether a published CRL is missing, unreadable or
+// close enough to its nextUpdate that it should be reissued
+func (c *CertificateService) crlNeedsRefresh(path string) bool {
+	crlPEM, err := os.ReadFile(path)
+	if err != nil {
+		return true
+	}
+
+	block, _ := pem.Decode(crlPEM)
+	if block == nil {
+		return true
+	}
+
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return true
+	}
+
+	// Refresh once less than one refresh interval remains, so a scheduler
+	// running on that interval never lets the list lapse
+	return time.Now().Add(c.crlRefreshInterval()).After(crl.NextUpdate)
+}
+
+// StartCRLScheduler regenerates the CRL on the configured refresh interval
+// until the context is cancelled
+func (c *CertificateService) StartCRLScheduler(ctx context.Context) {
+	if c.crlNeedsRefresh(c.getCRLPublicPath()) {
+		if err := c.GenerateCRL(); err != nil {
+			log.Printf("Failed to generate CRL: %v", err)
+		}
+	}
+
+	ticker := time.NewTicker(c.crlRefreshInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.GenerateCRL(); err != nil {
+				log.Printf("Failed to regenerate CRL: %v", err)
+			}
+		}
+	}
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,179 @@
+package certificates
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/config"
+	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
+)
+
+// newTestCertificateService creates a certificate service with a mock CA in a temp directory
+func newTestCertificateService(t *testing.T) *CertificateService {
+	t.Helper()
+
+	tempDir := t.TempDir()
+
+	store, err := storage.NewStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	cfg := &config.Config{
+		CAName:        "Test CA",
+		CAKeyPassword: generateTestPassword(),
+		Organization:  "Test Org",
+		Country:       "US",
+		DataDir:       tempDir,
+	}
+
+	certService, err := NewCertificateService(cfg, store)
+	if err != nil {
+		t.Fatalf("Failed to create certificate service: %v", err)
+	}
+
+	if err := mockCreateCA(certService); err != nil {
+		t.Fatalf("Failed to create mock CA: %v", err)
+	}
+
+	return certService
+}
+
+// readTestCRL parses the published CRL
+func readTestCRL(t *testing.T, certService *CertificateService) *x509.RevocationList {
+	t.Helper()
+
+	crlPEM, err := certService.GetCRL()
+	if err != nil {
+		t.Fatalf("Failed to get CRL: %v", err)
+	}
+
+	block, _ := pem.Decode(crlPEM)
+	if block == nil || block.Type != "X509 CRL" {
+		t.Fatalf("CRL is not a PEM encoded X509 CRL")
+	}
+
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse CRL: %v", err)
+	}
+
+	return crl
+}
+
+func TestRevokeCertificateWithReason(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	certName := "crl-test"
+	if err := mockCreateServerCertificate(certService, certName, []string{"crl-test.com"}); err != nil {
+		t.Fatalf("Failed to create mock server certificate: %v", err)
+	}
+
+	invalidityDate := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	if err := certService.RevokeCertificateWithReason(certName, ReasonKeyCompromise, &invalidityDate); err != nil {
+		t.Fatalf("Failed to revoke certificate: %v", err)
+	}
+
+	crl := readTestCRL(t, certService)
+
+	caCert, err := certService.loadCACertificate()
+	if err != nil {
+		t.Fatalf("Failed to load CA certificate: %v", err)
+	}
+	if err := crl.CheckSignatureFrom(caCert); err != nil {
+		t.Errorf("CRL signature is not valid: %v", err)
+	}
+
+	if len(crl.RevokedCertificateEntries) != 1 {
+		t.Fatalf("Expected 1 revoked entry, got %d", len(crl.RevokedCertificateEntries))
+	}
+
+	entry := crl.RevokedCertificateEntries[0]
+	if entry.ReasonCode != int(ReasonKeyCompromise) {
+		t.Errorf("Expected reason code %d, got %d", ReasonKeyCompromise, entry.ReasonCode)
+	}
+
+	var found bool
+	for _, ext := range entry.Extensions {
+		if !ext.Id.Equal(oidInvalidityDate) {
+			continue
+		}
+		found = true
+
+		var value time.Time
+		if _, err := asn1.UnmarshalWithParams(ext.Value, &value, "generalized"); err != nil {
+			t.Fatalf("Failed to parse invalidity date: %v", err)
+		}
+		if !value.Equal(invalidityDate) {
+			t.Errorf("Expected invalidity date %v, got %v", invalidityDate, value)
+		}
+	}
+	if !found {
+		t.Errorf("CRL entry is missing the invalidity date extension")
+	}
+
+	// The certificate must be flagged as revoked
+	if _, err := os.Stat(filepath.Join(certService.storage.GetCertificateDirectory(certName), "revoked")); err != nil {
+		t.Errorf("Certificate was not marked as revoked: %v", err)
+	}
+
+	// Revoking twice is rejected
+	err = certService.RevokeCertificateWithReason(certName, ReasonSuperseded, nil)
+	if !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected ErrCertificateRevoked, got %v", err)
+	}
+}
+
+func TestGenerateCRLNumberIncreases(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if err := certService.GenerateCRL(); err != nil {
+		t.Fatalf("Failed to generate CRL: %v", err)
+	}
+	first := readTestCRL(t, certService)
+
+	if err := certService.GenerateCRL(); err != nil {
+		t.Fatalf("Failed to regenerate CRL: %v", err)
+	}
+	second := readTestCRL(t, certService)
+
+	if second.Number.Cmp(first.Number) <= 0 {
+		t.Errorf("CRL number did not increase: %v -> %v", first.Number, second.Number)
+	}
+
+	if !second.NextUpdate.After(time.Now().Add(DefaultCRLValidity - time.Hour)) {
+		t.Errorf("Unexpected CRL nextUpdate: %v", second.NextUpdate)
+	}
+}
+
+func TestParseRevocationReason(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected RevocationReason
+		wantErr  bool
+	}{
+		{"", ReasonUnspecified, false},
+		{"keyCompromise", ReasonKeyCompromise, false},
+		{"superseded", ReasonSuperseded, false},
+		{"4", ReasonSuperseded, false},
+		{"7", ReasonUnspecified, true},
+		{"bogus", ReasonUnspecified, true},
+	}
+
+	for _, tt := range tests {
+		reason, err := ParseRevocationReason(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRevocationReason(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if reason != tt.expected {
+			t.Errorf("ParseRevocationReason(%q) = %v, want %v", tt.input, reason, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package certificates
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/security"
+)
+
+// CSRSignOptions controls how a certificate signing request is signed
+type CSRSignOptions struct {
+	// Name is the storage name of the certificate; defaults to the CSR common name
+	Name     string
+	IsClient bool
+	// Profile names the certificate profile; empty selects the default for the certificate type
+	Profile string
+	// Metadata is the owner, team, labels and notes to attach to the certificate
+	Metadata CertificateMetadata
+}
+
+// SignedCertificate is the result of signing a certificate signing request
+type SignedCertificate struct {
+	Name           string
+	SerialNumber   string
+	CertificatePEM []byte
+	ChainPEM       []byte
+}
+
+// ParseCSR parses a PEM or DER encoded certificate signing request and verifies its signature
+func ParseCSR(data []byte) (*x509.CertificateRequest, error) {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST" {
+			return nil, fmt.Errorf("%w: unexpected PEM type %s", ErrInvalidCSR, block.Type)
+		}
+		der = block.Bytes
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCSR, err)
+	}
+
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("%w: signature verification failed: %v", ErrInvalidCSR, err)
+	}
+
+	return csr, nil
+}
+
+// SignCSR signs an externally generated certificate signing request. The
+// server never sees the private key; the certificate is stored without a key
+// file and appears in the normal listing.
+func (c *CertificateService) SignCSR(csrData []byte, opts CSRSignOptions) (*SignedCertificate, error) {
+	csr, err := ParseCSR(csrData)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Metadata.Validate(); err != nil {
+		return nil, err
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = csr.Subject.CommonName
+	}
+	// The name becomes a directory under the storage path
+	if name == "" || name == "." || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) ||
+		security.ValidateCommonName(name) != name {
+		return nil, fmt.Errorf("%w: invalid certificate name %q", ErrInvalidCSR, name)
+	}
+
+	if _, err := os.Stat(c.storage.GetCertificatePath(name)); err == nil {
+		return nil, ErrCertificateAlreadyExists
+	}
+
+	profile, err := c.resolveProfile(opts.Profile, opts.IsClient)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := csrTemplate(csr, profile, opts.IsClient)
+	if err != nil {
+		return nil, err
+	}
+
+	template.SerialNumber, err = c.newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	certDER, err := c.signTemplate(template, csr.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store the certificate and bundle; there is no key file
+	if err := os.MkdirAll(c.storage.GetCertificateDirectory(name), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+
+	certPath := c.storage.GetCertificatePath(name)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write certificate: %w", err)
+	}
+
+	if err := c.createCertificateBundle(certPath, c.storage.GetCertificateBundlePath(name)); err != nil {
+		return nil, fmt.Errorf("failed to create certificate bundle: %w", err)
+	}
+
+	if err := c.recordSerialNumber(template.SerialNumber, name); err != nil {
+		return nil, err
+	}
+
+	if err := c.recordCertificateProfile(name, profile.Name); err != nil {
+		return nil, err
+	}
+	if err := c.recordCertificateMetadata(name, opts.Metadata); err != nil {
+		return nil, err
+	}
+	c.updateIndex(name)
+
+	chainPEM, err := c.issuerChainPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedCertificate{
+		Name:           name,
+		SerialNumber:   formatSerialNumber(template.SerialNumber),
+		CertificatePEM: certPEM,
+		ChainPEM:       chainPEM,
+	}, nil
+}
+
+// csrTemplate builds a certificate template from a CSR, applying the CA's
+// policy: only the common name and subject alternative names are taken from
+// the request, while validity, key usages and extensions come from the profile
+func csrTemplate(csr *x509.CertificateRequest, profile *Profile, isClient bool) (*x509.Certificate, error) {
+	if err := validateCSRPublicKey(csr.PublicKey); err != nil {
+		return nil, err
+	}
+
+	commonName := csr.Subject.CommonName
+	if commonName == "" && len(csr.DNSNames) == 0 {
+		return nil, fmt.Errorf("%w: a common name or DNS name is required", ErrInvalidCSR)
+	}
+
+	for _, name := range csr.DNSNames {
+		if !security.ValidateDNSName(name) {
+			return nil, fmt.Errorf("%w: invalid DNS name %q", ErrInvalidCSR, name)
+		}
+	}
+	for _, email := range csr.EmailAddresses {
+		if !security.ValidateEmailAddress(email) {
+			return nil, fmt.Errorf("%w: invalid email address %q", ErrInvalidCSR, email)
+		}
+	}
+	for _, uri := range csr.URIs {
+		if !security.ValidateURI(uri.String()) {
+			return nil, fmt.Errorf("%w: invalid URI %q", ErrInvalidCSR, uri.String())
+		}
+	}
+
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+		DNSNames:       csr.DNSNames,
+		IPAddresses:    csr.IPAddresses,
+		URIs:           csr.URIs,
+		EmailAddresses: csr.EmailAddresses,
+	}
+
+	// Server certificates always cover their common name
+	if !isClient && commonName != "" && security.ValidateDNSName(commonName) && !containsString(template.DNSNames, commonName) {
+		template.DNSNames = append([]string{commonName}, template.DNSNames...)
+	}
+
+	if err := profile.apply(template, csr.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// validateCSRPublicKey rejects key types and sizes the CA does not issue for
+func validateCSRPublicKey(pub crypto.PublicKey) error {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return fmt.Errorf("%w: RSA keys must be at least 2048 bits", ErrInvalidCSR)
+		}
+	case *ecdsa.PublicKey:
+		if size := key.Curve.Params().BitSize; size != 256 && size != 384 {
+			return fmt.Errorf("%w: unsupported ECDSA curve P-%d", ErrInvalidCSR, size)
+		}
+	case ed25519.PublicKey:
+	default:
+		return fmt.Errorf("%w: unsupported public key type %T", ErrInvalidCSR, pub)
+	}
+	return nil
+}
+
+// signTemplate signs a leaf certificate template with the issuing CA and
+// embeds its distribution points
+func (c *CertificateService) signTemplate(template *x509.Certificate, pub crypto.PublicKey) ([]byte, error) {
+	caCert, caKey, err := c.loadIssuer()
+	if err != nil {
+		return nil, err
+	}
+	c.applyDistributionPoints(template, caCert)
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, caCert, pub, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate: %w", err)
+	}
+
+	return certDER, nil
+}
+
+// containsString reports whether a slice contains a value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package certificates
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestCSR creates a PEM encoded CSR for the given key
+func newTestCSR(t *testing.T, key any, commonName string, dnsNames []string) []byte {
+	t.Helper()
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: dnsNames,
+	}, key)
+	if err != nil {
+		t.Fatalf("Failed to create CSR: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func TestSignCSR(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	signed, err := certService.SignCSR(newTestCSR(t, key, "csr.example.com", []string{"www.csr.example.com"}), CSRSignOptions{})
+	if err != nil {
+		t.Fatalf("Failed to sign CSR: %v", err)
+	}
+	if signed.Name != "csr.example.com" {
+		t.Errorf("Expected name csr.example.com, got %s", signed.Name)
+	}
+
+	block, _ := pem.Decode(signed.CertificatePEM)
+	if block == nil {
+		t.Fatalf("Signed certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse signed certificate: %v", err)
+	}
+
+	if !cert.PublicKey.(*ecdsa.PublicKey).Equal(&key.PublicKey) {
+		t.Errorf("Certificate does not carry the CSR public key")
+	}
+	if !containsString(cert.DNSNames, "csr.example.com") || !containsString(cert.DNSNames, "www.csr.example.com") {
+		t.Errorf("Unexpected DNS names: %v", cert.DNSNames)
+	}
+	if cert.IsCA {
+		t.Errorf("Signed certificate must not be a CA")
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+		t.Errorf("Unexpected extended key usage: %v", cert.ExtKeyUsage)
+	}
+
+	roots := x509.NewCertPool()
+	for _, caCert := range parseBundle(t, signed.ChainPEM) {
+		roots.AddCert(caCert)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: "www.csr.example.com", Roots: roots}); err != nil {
+		t.Errorf("Signed certificate does not verify against the chain: %v", err)
+	}
+
+	// No key is stored for CSR-issued certificates
+	if _, err := os.Stat(certService.storage.GetCertificateKeyPath("csr.example.com")); !os.IsNotExist(err) {
+		t.Errorf("Expected no private key file, got %v", err)
+	}
+
+	certs, err := certService.GetAllCertificates()
+	if err != nil {
+		t.Fatalf("Failed to list certificates: %v", err)
+	}
+	found := false
+	for _, c := range certs {
+		if c.CommonName == "csr.example.com" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("CSR-issued certificate missing from listing")
+	}
+
+	// Signing again under the same name is rejected
+	if _, err := certService.SignCSR(newTestCSR(t, key, "csr.example.com", nil), CSRSignOptions{}); !errors.Is(err, ErrCertificateAlreadyExists) {
+		t.Errorf("Expected ErrCertificateAlreadyExists, got %v", err)
+	}
+
+	// Renewal re-signs the same public key without a key file
+	if err := certService.RenewServerCertificate("csr.example.com"); err != nil {
+		t.Fatalf("Failed to renew CSR-issued certificate: %v", err)
+	}
+	renewed, err := readCertificateFile(certService.storage.GetCertificatePath("csr.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read renewed certificate: %v", err)
+	}
+	if !publicKeysEqual(renewed.PublicKey, &key.PublicKey) {
+		t.Errorf("Renewal changed the public key")
+	}
+	if !containsString(renewed.DNSNames, "www.csr.example.com") {
+		t.Errorf("Renewal dropped DNS names: %v", renewed.DNSNames)
+	}
+}
+
+func TestSignCSRClient(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	signed, err := certService.SignCSR(newTestCSR(t, key, "alice", nil), CSRSignOptions{Name: "alice-laptop", IsClient: true})
+	if err != nil {
+		t.Fatalf("Failed to sign client CSR: %v", err)
+	}
+	if signed.Name != "alice-laptop" {
+		t.Errorf("Expected name alice-laptop, got %s", signed.Name)
+	}
+
+	cert, err := readCertificateFile(certService.storage.GetCertificatePath("alice-laptop"))
+	if err != nil {
+		t.Fatalf("Failed to read client certificate: %v", err)
+	}
+	if len(cert.DNSNames) != 0 {
+		t.Errorf("Client certificate should have no DNS names, got %v", cert.DNSNames)
+	}
+	if cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Errorf("Unexpected extended key usage: %v", cert.ExtKeyUsage)
+	}
+
+	if err := certService.RenewClientCertificate("alice-laptop"); err != nil {
+		t.Fatalf("Failed to renew CSR-issued client certificate: %v", err)
+	}
+}
+
+func TestSignCSRRejectsInvalidRequests(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	if _, err := certService.SignCSR(newTestCSR(t, weakKey, "weak.example.com", nil), CSRSignOptions{}); !errors.Is(err, ErrInvalidCSR) {
+		t.Errorf("Expected ErrInvalidCSR for a 1024-bit RSA key, got %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	// Corrupt the signature of an otherwise valid CSR
+	csrPEM := newTestCSR(t, key, "tampered.example.com", nil)
+	block, _ := pem.Decode(csrPEM)
+	block.Bytes[len(block.Bytes)-1] ^= 0xff
+	if _, err := certService.SignCSR(pem.EncodeToMemory(block), CSRSignOptions{}); !errors.Is(err, ErrInvalidCSR) {
+		t.Errorf("Expected ErrInvalidCSR for a bad signature, got %v", err)
+	}
+
+	if _, err := certService.SignCSR(newTestCSR(t, key, "bad.example.com", []string{"not a name"}), CSRSignOptions{}); !errors.Is(err, ErrInvalidCSR) {
+		t.Errorf("Expected ErrInvalidCSR for an invalid DNS name, got %v", err)
+	}
+
+	if _, err := certService.SignCSR([]byte("garbage"), CSRSignOptions{}); !errors.Is(err, ErrInvalidCSR) {
+		t.Errorf("Expected ErrInvalidCSR for garbage input, got %v", err)
+	}
+}
+
+func TestSignCSRRejectsTraversalNames(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	for _, name := range []string{".", "..", "a..b", "../escape", `..\escape`, "nested/name"} {
+		if _, err := certService.SignCSR(newTestCSR(t, key, name, nil), CSRSignOptions{}); !errors.Is(err, ErrInvalidCSR) {
+			t.Errorf("Expected ErrInvalidCSR for common name %q, got %v", name, err)
+		}
+		opts := CSRSignOptions{Name: name}
+		if _, err := certService.SignCSR(newTestCSR(t, key, "named.example.com", nil), opts); !errors.Is(err, ErrInvalidCSR) {
+			t.Errorf("Expected ErrInvalidCSR for name %q, got %v", name, err)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(certService.storage.GetBasePath()))
+	if err != nil {
+		t.Fatalf("Failed to read storage parent: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == "escape" {
+			t.Errorf("Expected nothing to be written outside the storage path")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package certificates
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Public paths relying parties use to fetch CA certificates and check
+// revocation. Issued certificates embed most of them, so they must not change.
+const (
+	CACertificatePath           = "/api/download/ca"
+	IntermediateCertificatePath = "/api/download/intermediate"
+	CRLPath                     = "/api/download/crl"
+	TrustBundlePath             = "/api/download/trust-bundle"
+	OCSPPath                    = "/ocsp"
+)
+
+// publicBaseURL returns the configured public base URL without a trailing slash
+func (c *CertificateService) publicBaseURL() string {
+	return strings.TrimRight(c.config.PublicBaseURL, "/")
+}
+
+// issuerPath returns the path under which a CA generation serves a file:
+// a CA certificate path or CRLPath followed by the serial number of the CA
+// certificate. Leaves keep pointing at their own issuer after a rollover.
+func issuerPath(path string, issuer *x509.Certificate) string {
+	return path + "/" + formatSerialNumber(issuer.SerialNumber)
+}
+
+// applyDistributionPoints adds the CRL distribution point and the authority
+// information access URLs for OCSP and the issuing CA to a leaf template.
+// Nothing is added when no public base URL is configured.
+func (c *CertificateService) applyDistributionPoints(template, issuer *x509.Certificate) {
+	baseURL := c.publicBaseURL()
+	if baseURL == "" {
+		return
+	}
+
+	certificatePath := CACertificatePath
+	if c.hasIntermediate() {
+		certificatePath = IntermediateCertificatePath
+	}
+
+	template.CRLDistributionPoints = []string{baseURL + issuerPath(CRLPath, issuer)}
+	template.OCSPServer = []string{baseURL + OCSPPath}
+	template.IssuingCertificateURL = []string{baseURL + issuerPath(certificatePath, issuer)}
+}
+
+// applyIntermediateDistributionPoints adds the root certificate URL to an
+// intermediate template. The published CRL and OCSP responder cover the
+// certificates the intermediate issues, not the intermediate itself.
+func (c *CertificateService) applyIntermediateDistributionPoints(template, root *x509.Certificate) {
+	baseURL := c.publicBaseURL()
+	if baseURL == "" {
+		return
+	}
+
+	template.IssuingCertificateURL = []string{baseURL + issuerPath(CACertificatePath, root)}
+}
+
+// GetIssuerCertificate returns the PEM encoded CA certificate with a serial
+// number, current or retired, as embedded in the issuer URL of certificates
+func (c *CertificateService) GetIssuerCertificate(serial string) ([]byte, error) {
+	paths := []string{c.storage.GetCAPublicKeyPath(), c.getIntermediateCertPath()}
+
+	retired, err := c.ListRetiredCAs()
+	if err != nil {
+		return nil, err
+	}
+	for _, ca := range retired {
+		dir := c.getRetiredCADirectory(ca.ID)
+		paths = append(paths,
+			filepath.Join(dir, retiredRootFile),
+			filepath.Join(dir, filepath.Base(c.getIntermediateCertPath())),
+		)
+	}
+
+	for _, path := range paths {
+		cert, err := readCertificateFile(path)
+		if err != nil || formatSerialNumber(cert.SerialNumber) != serial {
+			continue
+		}
+		certPEM, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		return certPEM, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrIssuerNotFound, serial)
+}
+
+// GetIssuerCRL returns the PEM encoded CRL of the CA that signs leaves with
+// the certificate of a serial number: the current issuer or a retired one
+// that still has valid certificates
+func (c *CertificateService) GetIssuerCRL(serial string) ([]byte, error) {
+	issuer, err := c.issuerCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if formatSerialNumber(issuer.SerialNumber) == serial {
+		return c.GetCRL()
+	}
+
+	active, err := c.activeRetiredCAs()
+	if err != nil {
+		return nil, err
+	}
+	for _, ca := range active {
+		retiredIssuer, err := c.retiredIssuerCertificate(ca.ID)
+		if err != nil {
+			return nil, err
+		}
+		if formatSerialNumber(retiredIssuer.SerialNumber) == serial {
+			return c.GetRetiredCRL(ca.ID)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrIssuerNotFound, serial)
+}
@@ -0,0 +1,86 @@
+package certificates
+
+import (
+	"testing"
+)
+
+func TestDistributionPoints(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	// Without a public base URL nothing is embedded
+	if err := certService.CreateServerCertificate("plain.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	plain, err := readCertificateFile(certService.storage.GetCertificatePath("plain.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	if len(plain.CRLDistributionPoints) != 0 || len(plain.OCSPServer) != 0 || len(plain.IssuingCertificateURL) != 0 {
+		t.Errorf("Unexpected distribution points: %v %v %v", plain.CRLDistributionPoints, plain.OCSPServer, plain.IssuingCertificateURL)
+	}
+
+	certService.config.PublicBaseURL = "https://ca.example.com/"
+
+	if err := certService.CreateServerCertificate("web.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	if err := certService.CreateClientCertificate("alice", "client-password"); err != nil {
+		t.Fatalf("Failed to create client certificate: %v", err)
+	}
+
+	root, err := certService.loadCACertificate()
+	if err != nil {
+		t.Fatalf("Failed to load CA certificate: %v", err)
+	}
+	rootSerial := formatSerialNumber(root.SerialNumber)
+
+	for _, name := range []string{"web.example.com", "alice"} {
+		cert, err := readCertificateFile(certService.storage.GetCertificatePath(name))
+		if err != nil {
+			t.Fatalf("Failed to read certificate: %v", err)
+		}
+		if len(cert.CRLDistributionPoints) != 1 || cert.CRLDistributionPoints[0] != "https://ca.example.com/api/download/crl/"+rootSerial {
+			t.Errorf("%s: unexpected CRL distribution points %v", name, cert.CRLDistributionPoints)
+		}
+		if len(cert.OCSPServer) != 1 || cert.OCSPServer[0] != "https://ca.example.com/ocsp" {
+			t.Errorf("%s: unexpected OCSP servers %v", name, cert.OCSPServer)
+		}
+		if len(cert.IssuingCertificateURL) != 1 || cert.IssuingCertificateURL[0] != "https://ca.example.com/api/download/ca/"+rootSerial {
+			t.Errorf("%s: unexpected issuer URLs %v", name, cert.IssuingCertificateURL)
+		}
+	}
+
+	// With an intermediate, leaves point at it and it points at the root
+	rootKey, err := certService.loadCAPrivateKey()
+	if err != nil {
+		t.Fatalf("Failed to load CA key: %v", err)
+	}
+	if err := certService.createIntermediate(root, rootKey); err != nil {
+		t.Fatalf("Failed to create intermediate: %v", err)
+	}
+
+	intermediate, err := readCertificateFile(certService.getIntermediateCertPath())
+	if err != nil {
+		t.Fatalf("Failed to read intermediate: %v", err)
+	}
+	if len(intermediate.IssuingCertificateURL) != 1 || intermediate.IssuingCertificateURL[0] != "https://ca.example.com/api/download/ca/"+rootSerial {
+		t.Errorf("Unexpected intermediate issuer URLs %v", intermediate.IssuingCertificateURL)
+	}
+	if len(intermediate.CRLDistributionPoints) != 0 {
+		t.Errorf("Intermediate should not point at the leaf CRL: %v", intermediate.CRLDistributionPoints)
+	}
+
+	if err := certService.CreateServerCertificate("tier.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	leaf, err := readCertificateFile(certService.storage.GetCertificatePath("tier.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	if len(leaf.IssuingCertificateURL) != 1 || leaf.IssuingCertificateURL[0] != "https://ca.example.com/api/download/intermediate/"+formatSerialNumber(intermediate.SerialNumber) {
+		t.Errorf("Unexpected leaf issuer URLs %v", leaf.IssuingCertificateURL)
+	}
+	if len(leaf.CRLDistributionPoints) != 1 || leaf.CRLDistributionPoints[0] != "https://ca.example.com/api/download/crl/"+formatSerialNumber(intermediate.SerialNumber) {
+		t.Errorf("Unexpected leaf CRL distribution points %v", leaf.CRLDistributionPoints)
+	}
+}
@@ -1,6 +1,10 @@
 package certificates
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/signer"
+)
 
 // Error definitions for certificate operations
 var (
@@ -21,4 +25,71 @@ var (
 
 	// ErrCertificateRevoked is returned when a certificate is already revoked
 	ErrCertificateRevoked = errors.New("certificate is already revoked")
+
+	// ErrInvalidCSR is returned when a certificate signing request is malformed or violates CA policy
+	ErrInvalidCSR = errors.New("invalid certificate signing request")
+
+	// ErrInvalidSAN is returned when a subject alternative name is malformed
+	ErrInvalidSAN = errors.New("invalid subject alternative name")
+
+	// ErrRootKeyOffline is returned when an operation needs the root key but it has been removed
+	ErrRootKeyOffline = errors.New("root CA key is not present on this server")
+
+	// ErrInvalidRootKey is returned when a supplied root key cannot be parsed or does not match the root certificate
+	ErrInvalidRootKey = errors.New("invalid root CA key")
+
+	// ErrNotTwoTier is returned when an operation requires a root plus intermediate hierarchy
+	ErrNotTwoTier = errors.New("CA is not running in two-tier mode")
+
+	// ErrSerialExhausted is returned when no unused serial number could be found
+	ErrSerialExhausted = errors.New("failed to allocate a unique serial number")
+
+	// ErrInvalidProfile is returned when a certificate profile is malformed
+	ErrInvalidProfile = errors.New("invalid certificate profile")
+
+	// ErrProfileNotFound is returned when a certificate profile does not exist
+	ErrProfileNotFound = errors.New("certificate profile not found")
+
+	// ErrProfileExists is returned when creating a profile whose name is taken
+	ErrProfileExists = errors.New("certificate profile already exists")
+
+	// ErrProfileProtected is returned when deleting a built-in profile
+	ErrProfileProtected = errors.New("built-in certificate profile cannot be deleted")
+
+	// ErrKeyTypeNotAllowed is returned when a profile does not permit the key type of a certificate
+	ErrKeyTypeNotAllowed = errors.New("key type not allowed by profile")
+
+	// ErrCASealed is returned when an operation needs a CA key while the CA is sealed
+	ErrCASealed = errors.New("CA is sealed")
+
+	// ErrInvalidPassphrase is returned when a passphrase does not unlock the CA keys
+	ErrInvalidPassphrase = signer.ErrInvalidPassphrase
+
+	// ErrCANotSealed is returned when unsealing a CA that is not sealed or
+	// submitting unseal shares to it
+	ErrCANotSealed = errors.New("CA is not sealed")
+
+	// ErrInvalidShare is returned when an unseal share is malformed or does not fit the shares submitted before
+	ErrInvalidShare = errors.New("invalid unseal share")
+
+	// ErrInvalidShareParameters is returned when a key ceremony asks for an impossible share count or threshold
+	ErrInvalidShareParameters = errors.New("invalid share parameters")
+
+	// ErrRetiredCANotFound is returned when a retired CA does not exist or has no valid certificates left
+	ErrRetiredCANotFound = errors.New("retired CA not found")
+
+	// ErrIssuerNotFound is returned when no current or retired CA certificate has a serial number
+	ErrIssuerNotFound = errors.New("issuing CA not found")
+
+	// ErrInvalidQuery is returned when a certificate query has an unknown filter value, sort key or cursor
+	ErrInvalidQuery = errors.New("invalid certificate query")
+
+	// ErrInvalidMetadata is returned when certificate owner, team, label or notes values are malformed
+	ErrInvalidMetadata = errors.New("invalid certificate metadata")
+
+	// ErrNoPrivateKey is returned when rotating the key of a certificate whose private key is not held by the CA
+	ErrNoPrivateKey = errors.New("certificate has no private key on this server")
+
+	// ErrInvalidRenewalPolicy is returned when an automatic renewal policy has an out of range threshold
+	ErrInvalidRenewalPolicy = errors.New("invalid renewal policy")
 )
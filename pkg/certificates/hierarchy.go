@@ -0,0 +1,334 @@
+package certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/signer"
+)
+
+// CA modes
+const (
+	CAModeSingle  = "single"
+	CAModeTwoTier = "two-tier"
+)
+
+// DefaultIntermediateValidity is the lifetime of an issuing intermediate
+const DefaultIntermediateValidity = 5 * 365 * 24 * time.Hour
+
+// CAHierarchy describes the CA certificates currently in use
+type CAHierarchy struct {
+	Mode                 string      `json:"mode"`
+	RootSubject          string      `json:"root_subject"`
+	RootNotAfter         time.Time   `json:"root_not_after"`
+	RootKeyOnline        bool        `json:"root_key_online"`
+	IntermediateSubject  string      `json:"intermediate_subject,omitempty"`
+	IntermediateNotAfter *time.Time  `json:"intermediate_not_after,omitempty"`
+	RetiredCAs           []RetiredCA `json:"retired_cas,omitempty"`
+}
+
+// getIntermediateCertPath returns the path to the issuing intermediate certificate
+func (c *CertificateService) getIntermediateCertPath() string {
+	return filepath.Join(c.storage.GetCADirectory(), "intermediate.pem")
+}
+
+// getIntermediateKeyPath returns the path to the issuing intermediate private key
+func (c *CertificateService) getIntermediateKeyPath() string {
+	return filepath.Join(c.storage.GetCADirectory(), "intermediate.key")
+}
+
+// hasIntermediate reports whether an issuing intermediate is configured
+func (c *CertificateService) hasIntermediate() bool {
+	_, err := os.Stat(c.getIntermediateCertPath())
+	return err == nil
+}
+
+// rootKeyOnline reports whether the root private key is present on the server,
+// encrypted or as a plaintext key that has not been migrated yet
+func (c *CertificateService) rootKeyOnline() bool {
+	for _, path := range []string{c.storage.GetCAEncryptedKeyPath(), c.storage.GetCAPrivateKeyPath()} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// loadIssuer returns the certificate and key used to sign leaf certificates
+// and CRLs: the intermediate in two-tier mode, otherwise the root
+func (c *CertificateService) loadIssuer() (*x509.Certificate, crypto.Signer, error) {
+	if !c.hasIntermediate() {
+		caCert, err := c.loadCACertificate()
+		if err != nil {
+			return nil, nil, err
+		}
+		caKey, err := c.loadCAPrivateKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		return caCert, caKey, nil
+	}
+
+	intermediateCert, err := readCertificateFile(c.getIntermediateCertPath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load intermediate certificate: %w", err)
+	}
+
+	intermediateKey, err := c.readCAKeyFile(c.getIntermediateKeyPath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load intermediate private key: %w", err)
+	}
+
+	return intermediateCert, intermediateKey, nil
+}
+
+// issuerCertificate returns the certificate used to sign leaf certificates
+// without loading its key
+func (c *CertificateService) issuerCertificate() (*x509.Certificate, error) {
+	if !c.hasIntermediate() {
+		return c.loadCACertificate()
+	}
+
+	intermediateCert, err := readCertificateFile(c.getIntermediateCertPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load intermediate certificate: %w", err)
+	}
+	return intermediateCert, nil
+}
+
+// issuerChainPEM returns the CA certificates above a leaf, issuer first
+func (c *CertificateService) issuerChainPEM() ([]byte, error) {
+	var chain bytes.Buffer
+
+	if c.hasIntermediate() {
+		intermediatePEM, err := os.ReadFile(c.getIntermediateCertPath())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read intermediate certificate: %w", err)
+		}
+		chain.Write(intermediatePEM)
+	}
+
+	rootPEM, err := os.ReadFile(c.storage.GetCAPublicKeyPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	chain.Write(rootPEM)
+
+	// During a rollover transition clients may only trust the old root
+	root, err := c.loadCACertificate()
+	if err != nil {
+		return nil, err
+	}
+	crossPEM, err := c.transitionCrossCertificatePEM(root)
+	if err != nil {
+		return nil, err
+	}
+	chain.Write(crossPEM)
+
+	return chain.Bytes(), nil
+}
+
+// GetIntermediateCertificate returns the PEM encoded issuing intermediate
+func (c *CertificateService) GetIntermediateCertificate() ([]byte, error) {
+	if !c.hasIntermediate() {
+		return nil, ErrNotTwoTier
+	}
+
+	certPEM, err := os.ReadFile(c.getIntermediateCertPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read intermediate certificate: %w", err)
+	}
+
+	return certPEM, nil
+}
+
+// createIntermediate generates a new intermediate key and certifies it with the root
+func (c *CertificateService) createIntermediate(rootCert *x509.Certificate, rootKey crypto.Signer) error {
+	keySpec, err := c.caKeySpec()
+	if err != nil {
+		return err
+	}
+
+	intermediateKey, err := c.generateCAKey(keySpec)
+	if err != nil {
+		return fmt.Errorf("failed to generate intermediate private key: %w", err)
+	}
+
+	if err := c.writeCAKeyFile(c.getIntermediateKeyPath(), intermediateKey); err != nil {
+		return fmt.Errorf("failed to save intermediate private key: %w", err)
+	}
+
+	return c.certifyIntermediate(rootCert, rootKey, intermediateKey)
+}
+
+// certifyIntermediate signs a certificate for the intermediate key with the root
+func (c *CertificateService) certifyIntermediate(rootCert *x509.Certificate, rootKey crypto.Signer, intermediateKey crypto.Signer) error {
+	notAfter := time.Now().Add(DefaultIntermediateValidity)
+	if notAfter.After(rootCert.NotAfter) {
+		notAfter = rootCert.NotAfter
+	}
+
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   c.config.CAName + " Issuing CA",
+			Organization: []string{c.config.Organization},
+			Country:      []string{c.config.Country},
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            0,
+		MaxPathLenZero:        true,
+	}
+	c.applyIntermediateDistributionPoints(&template, rootCert)
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, &template, rootCert, intermediateKey.Public(), rootKey)
+	if err != nil {
+		return fmt.Errorf("failed to create intermediate certificate: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+	if err := writeFileAtomic(c.getIntermediateCertPath(), certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write intermediate certificate: %w", err)
+	}
+
+	return nil
+}
+
+// ReissueIntermediate re-certifies the existing intermediate key with the root.
+// The root key is read from disk when present, otherwise rootKeyPEM must hold
+// the offline root key, either exported encrypted with the CA passphrase, as a
+// signer backend reference or in plaintext. Keeping the intermediate key means certificates and CRLs already
+// signed by it stay valid.
+func (c *CertificateService) ReissueIntermediate(rootKeyPEM []byte) error {
+	if !c.hasIntermediate() {
+		return ErrNotTwoTier
+	}
+	if c.Sealed() {
+		return ErrCASealed
+	}
+
+	rootCert, err := c.loadCACertificate()
+	if err != nil {
+		return err
+	}
+
+	var rootKey crypto.Signer
+	if signer.IsEncryptedKeyPEM(rootKeyPEM) || isKeyReferencePEM(rootKeyPEM) {
+		rootKey, err = c.loadCAKeyPEM(rootKeyPEM)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRootKey, err)
+		}
+	} else if len(rootKeyPEM) > 0 {
+		rootKey, err = parsePrivateKeyPEM(rootKeyPEM)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRootKey, err)
+		}
+	} else {
+		rootKey, err = c.loadCAPrivateKey()
+		if err != nil {
+			return err
+		}
+	}
+
+	if !publicKeysEqual(rootKey.Public(), rootCert.PublicKey) {
+		return fmt.Errorf("%w: key does not match the root certificate", ErrInvalidRootKey)
+	}
+
+	intermediateKey, err := c.readCAKeyFile(c.getIntermediateKeyPath())
+	if err != nil {
+		return fmt.Errorf("failed to load intermediate private key: %w", err)
+	}
+
+	return c.certifyIntermediate(rootCert, rootKey, intermediateKey)
+}
+
+// ExportRootKey returns the root private key, PEM encoded and encrypted with
+// the CA passphrase. When a signer backend holds the key only the reference
+// to it is returned.
+func (c *CertificateService) ExportRootKey() ([]byte, error) {
+	keyPEM, err := os.ReadFile(c.storage.GetCAEncryptedKeyPath())
+	if os.IsNotExist(err) {
+		return nil, ErrRootKeyOffline
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read root private key: %w", err)
+	}
+	return keyPEM, nil
+}
+
+// RemoveRootKey deletes the root private key, including any plaintext key left
+// by earlier versions, from disk and memory. Only allowed in two-tier mode,
+// where the intermediate keeps signing. A key held by a signer backend is only
+// dereferenced and has to be removed from the backend separately.
+func (c *CertificateService) RemoveRootKey() error {
+	if !c.hasIntermediate() {
+		return ErrNotTwoTier
+	}
+
+	if !c.rootKeyOnline() {
+		return ErrRootKeyOffline
+	}
+
+	for _, path := range []string{c.storage.GetCAPrivateKeyPath(), c.storage.GetCAEncryptedKeyPath()} {
+		if err := c.removeCAKeyFile(path); err != nil {
+			return fmt.Errorf("failed to remove root private key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetCAHierarchy describes the root and, in two-tier mode, the intermediate
+func (c *CertificateService) GetCAHierarchy() (*CAHierarchy, error) {
+	rootCert, err := c.loadCACertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	hierarchy := &CAHierarchy{
+		Mode:          CAModeSingle,
+		RootSubject:   rootCert.Subject.String(),
+		RootNotAfter:  rootCert.NotAfter,
+		RootKeyOnline: c.rootKeyOnline(),
+	}
+
+	if c.hasIntermediate() {
+		intermediateCert, err := readCertificateFile(c.getIntermediateCertPath())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load intermediate certificate: %w", err)
+		}
+		hierarchy.Mode = CAModeTwoTier
+		hierarchy.IntermediateSubject = intermediateCert.Subject.String()
+		hierarchy.IntermediateNotAfter = &intermediateCert.NotAfter
+	}
+
+	hierarchy.RetiredCAs, err = c.ListRetiredCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	return hierarchy, nil
+}
+
+// publicKeysEqual reports whether two public keys are identical
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
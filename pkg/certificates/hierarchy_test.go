@@ -0,0 +1,184 @@
+package certificates
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/config"
+	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
+)
+
+// parseBundle parses every certificate in a PEM bundle
+func parseBundle(t *testing.T, data []byte) []*x509.Certificate {
+	t.Helper()
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatalf("Failed to parse bundle certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
+func TestTwoTierHierarchy(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+
+	tempDir := t.TempDir()
+
+	store, err := storage.NewStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	cfg := &config.Config{
+		CAName:        "Test Root CA",
+		CAKeyPassword: generateTestPassword(),
+		CAKeyType:     "ecdsa",
+		CAMode:        CAModeTwoTier,
+		Organization:  "Test Org",
+		Country:       "US",
+		DataDir:       tempDir,
+	}
+
+	certService, err := NewCertificateService(cfg, store)
+	if err != nil {
+		t.Fatalf("Failed to create certificate service: %v", err)
+	}
+
+	if err := certService.Unseal(cfg.CAKeyPassword); err != nil {
+		t.Fatalf("Failed to unseal CA: %v", err)
+	}
+	if err := certService.CreateCA(); err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+
+	if err := certService.CreateServerCertificate("tier.example.com", nil); err != nil {
+		t.Fatalf("Failed to create server certificate: %v", err)
+	}
+
+	// The bundle holds leaf, intermediate and root
+	bundleData, err := os.ReadFile(store.GetCertificateBundlePath("tier.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	bundle := parseBundle(t, bundleData)
+	if len(bundle) != 3 {
+		t.Fatalf("Expected 3 certificates in bundle, got %d", len(bundle))
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(bundle[2])
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(bundle[1])
+
+	verifyLeaf := func() {
+		leaf, err := readCertificateFile(store.GetCertificatePath("tier.example.com"))
+		if err != nil {
+			t.Fatalf("Failed to read leaf certificate: %v", err)
+		}
+		chains, err := leaf.Verify(x509.VerifyOptions{
+			DNSName:       "tier.example.com",
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		if err != nil {
+			t.Fatalf("Leaf does not verify through the intermediate: %v", err)
+		}
+		if len(chains[0]) != 3 {
+			t.Errorf("Expected a chain of length 3, got %d", len(chains[0]))
+		}
+	}
+	verifyLeaf()
+
+	// Take the root key offline
+	rootKeyPEM, err := certService.ExportRootKey()
+	if err != nil {
+		t.Fatalf("Failed to export root key: %v", err)
+	}
+	if err := certService.RemoveRootKey(); err != nil {
+		t.Fatalf("Failed to remove root key: %v", err)
+	}
+
+	exists, err := certService.CAExists()
+	if err != nil || !exists {
+		t.Fatalf("CA should still exist with the root key offline")
+	}
+
+	// Issuing and CRL signing keep working through the intermediate
+	if err := certService.RenewServerCertificate("tier.example.com"); err != nil {
+		t.Fatalf("Failed to renew with root key offline: %v", err)
+	}
+	verifyLeaf()
+
+	crl := readTestCRL(t, certService)
+	if err := crl.CheckSignatureFrom(bundle[1]); err != nil {
+		t.Errorf("CRL is not signed by the intermediate: %v", err)
+	}
+
+	if err := certService.RenewCA(); !errors.Is(err, ErrRootKeyOffline) {
+		t.Errorf("Expected ErrRootKeyOffline renewing the root, got %v", err)
+	}
+
+	// Re-issuing the intermediate needs the offline root key
+	if err := certService.ReissueIntermediate(nil); !errors.Is(err, ErrRootKeyOffline) {
+		t.Errorf("Expected ErrRootKeyOffline, got %v", err)
+	}
+
+	wrongKey, err := generateKey(KeySpec{Algorithm: KeyAlgorithmEd25519})
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	wrongKeyPEM, err := encodePrivateKeyPEM(wrongKey)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+	if err := certService.ReissueIntermediate(wrongKeyPEM); !errors.Is(err, ErrInvalidRootKey) {
+		t.Errorf("Expected ErrInvalidRootKey, got %v", err)
+	}
+
+	if err := certService.ReissueIntermediate(rootKeyPEM); err != nil {
+		t.Fatalf("Failed to reissue intermediate: %v", err)
+	}
+
+	hierarchy, err := certService.GetCAHierarchy()
+	if err != nil {
+		t.Fatalf("Failed to get hierarchy: %v", err)
+	}
+	if hierarchy.Mode != CAModeTwoTier || hierarchy.RootKeyOnline {
+		t.Errorf("Unexpected hierarchy: %+v", hierarchy)
+	}
+
+	// The existing leaf still chains through the reissued intermediate
+	reissued, err := readCertificateFile(certService.getIntermediateCertPath())
+	if err != nil {
+		t.Fatalf("Failed to read reissued intermediate: %v", err)
+	}
+	if reissued.SerialNumber.Cmp(bundle[1].SerialNumber) == 0 {
+		t.Errorf("Intermediate was not reissued")
+	}
+	intermediates = x509.NewCertPool()
+	intermediates.AddCert(reissued)
+	verifyLeaf()
+}
+
+func TestRemoveRootKeyRequiresTwoTier(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if err := certService.RemoveRootKey(); !errors.Is(err, ErrNotTwoTier) {
+		t.Errorf("Expected ErrNotTwoTier, got %v", err)
+	}
+}
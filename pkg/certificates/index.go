@@ -0,0 +1,352 @@
+package certificates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// indexVersion is raised when the indexed metadata changes, so indexes
+// written by earlier versions are rebuilt
+const indexVersion = 2
+
+// indexEntry is the metadata of a stored certificate together with the state
+// of the files it was read from
+type indexEntry struct {
+	Certificate
+	ModTime    time.Time `json:"mod_time"`
+	Size       int64     `json:"size"`
+	DirModTime time.Time `json:"dir_mod_time"`
+
+	// PendingRevocations are the superseded versions still waiting to be
+	// revoked as superseded
+	PendingRevocations []pendingRevocation `json:"pending_revocations,omitempty"`
+}
+
+// applyRevocation sets the revocation status of the certificate and drops
+// pending revocations of versions that were revoked
+func (e *indexEntry) applyRevocation(revoked []RevokedCertificate) {
+	e.Certificate.applyRevocation(revoked)
+
+	pending := e.PendingRevocations[:0]
+	for _, version := range e.PendingRevocations {
+		if !serialRevoked(revoked, version.SerialNumber) {
+			pending = append(pending, version)
+		}
+	}
+	if len(pending) == 0 {
+		pending = nil
+	}
+	e.PendingRevocations = pending
+}
+
+// serialRevoked reports whether the revocation database entries hold a serial number
+func serialRevoked(revoked []RevokedCertificate, serialNumber string) bool {
+	for _, entry := range revoked {
+		if entry.SerialNumber == serialNumber {
+			return true
+		}
+	}
+	return false
+}
+
+// certificateIndex is the on-disk index of parsed certificate metadata
+type certificateIndex struct {
+	Version            int                    `json:"version"`
+	RevocationsModTime time.Time              `json:"revocations_mod_time"`
+	Entries            map[string]*indexEntry `json:"entries"`
+
+	// bySerial maps serial numbers to certificate names; it is not stored
+	bySerial map[string]string
+}
+
+// getIndexPath returns the path to the certificate index
+func (c *CertificateService) getIndexPath() string {
+	return filepath.Join(c.storage.GetCADirectory(), "certificate-index.json")
+}
+
+// newCertificateIndex returns an empty index
+func newCertificateIndex() *certificateIndex {
+	return &certificateIndex{
+		Version:  indexVersion,
+		Entries:  make(map[string]*indexEntry),
+		bySerial: make(map[string]string),
+	}
+}
+
+// loadIndex reads the stored index. A missing, unreadable or outdated index
+// yields an empty one that the next sync fills.
+func (c *CertificateService) loadIndex() *certificateIndex {
+	data, err := os.ReadFile(c.getIndexPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read certificate index, rebuilding it: %v", err)
+		}
+		return newCertificateIndex()
+	}
+
+	index := newCertificateIndex()
+	if err := json.Unmarshal(data, index); err != nil || index.Version != indexVersion || index.Entries == nil {
+		log.Printf("Certificate index is invalid or outdated, rebuilding it")
+		return newCertificateIndex()
+	}
+	for name, entry := range index.Entries {
+		entry.Path = c.storage.GetCertificatePath(name)
+	}
+	index.rebuildSerials()
+	return index
+}
+
+// saveIndex writes the index atomically. The caller must hold indexMutex.
+func (c *CertificateService) saveIndex() error {
+	if err := os.MkdirAll(c.storage.GetCADirectory(), 0755); err != nil {
+		return fmt.Errorf("failed to create CA directory: %w", err)
+	}
+
+	data, err := json.Marshal(c.index)
+	if err != nil {
+		return fmt.Errorf("failed to marshal certificate index: %w", err)
+	}
+	if err := writeFileAtomic(c.getIndexPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate index: %w", err)
+	}
+	return nil
+}
+
+// rebuildSerials recreates the serial number lookup from the entries
+func (i *certificateIndex) rebuildSerials() {
+	i.bySerial = make(map[string]string, len(i.Entries))
+	for name, entry := range i.Entries {
+		i.bySerial[entry.SerialNumber] = name
+	}
+}
+
+// syncIndex brings the index up to date with the certificate directories.
+// Only certificates whose file or directory changed since they were indexed
+// are parsed again. The caller must hold indexMutex.
+func (c *CertificateService) syncIndex() error {
+	if c.index == nil {
+		c.index = c.loadIndex()
+	}
+
+	names, err := c.storage.ListCertificates()
+	if err != nil {
+		return fmt.Errorf("failed to list certificates: %w", err)
+	}
+
+	changed := make(map[string]bool)
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+		entry, err := c.readIndexEntry(name, c.index.Entries[name])
+		if err != nil {
+			log.Printf("Failed to index certificate %s: %v", name, err)
+			if _, ok := c.index.Entries[name]; ok {
+				delete(c.index.Entries, name)
+				changed[name] = true
+			}
+			continue
+		}
+		if entry != c.index.Entries[name] {
+			c.index.Entries[name] = entry
+			changed[name] = true
+		}
+	}
+	for name := range c.index.Entries {
+		if !seen[name] {
+			delete(c.index.Entries, name)
+			changed[name] = true
+		}
+	}
+
+	// Revocations change no certificate file, so they are applied whenever
+	// the revocation database or any entry changed
+	var revocationsModTime time.Time
+	if stat, err := os.Stat(c.getRevocationDatabasePath()); err == nil {
+		revocationsModTime = stat.ModTime()
+	}
+	revocationsChanged := !revocationsModTime.Equal(c.index.RevocationsModTime)
+	if len(changed) > 0 || revocationsChanged {
+		if err := c.applyIndexRevocations(); err != nil {
+			return err
+		}
+		c.index.RevocationsModTime = revocationsModTime
+	}
+	if revocationsChanged {
+		for name := range c.index.Entries {
+			changed[name] = true
+		}
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+	c.index.rebuildSerials()
+	c.mirrorIndex(changed)
+	return c.saveIndex()
+}
+
+// readIndexEntry returns the current entry when the certificate file and
+// directory are unchanged, otherwise a freshly parsed one
+func (c *CertificateService) readIndexEntry(name string, current *indexEntry) (*indexEntry, error) {
+	certStat, err := os.Stat(c.storage.GetCertificatePath(name))
+	if err != nil {
+		return nil, err
+	}
+	dirStat, err := os.Stat(c.storage.GetCertificateDirectory(name))
+	if err != nil {
+		return nil, err
+	}
+
+	if current != nil && current.ModTime.Equal(certStat.ModTime()) && current.Size == certStat.Size() &&
+		current.DirModTime.Equal(dirStat.ModTime()) {
+		return current, nil
+	}
+
+	info, _, err := c.readCertificateMetadata(name)
+	if err != nil {
+		return nil, err
+	}
+	info.PEM = ""
+	return &indexEntry{
+		Certificate:        *info,
+		ModTime:            certStat.ModTime(),
+		Size:               certStat.Size(),
+		DirModTime:         dirStat.ModTime(),
+		PendingRevocations: c.readPendingRevocations(name, info.SerialNumber),
+	}, nil
+}
+
+// applyIndexRevocations sets the revocation status of every entry. The caller
+// must hold indexMutex.
+func (c *CertificateService) applyIndexRevocations() error {
+	revoked, err := c.GetRevokedCertificates()
+	if err != nil {
+		return err
+	}
+	for _, entry := range c.index.Entries {
+		entry.applyRevocation(revoked)
+	}
+	return nil
+}
+
+// updateIndex re-reads one certificate after it was issued, renewed, revoked
+// or deleted. The index only caches metadata, so failures are logged rather
+// than failing the operation.
+func (c *CertificateService) updateIndex(name string) {
+	c.indexMutex.Lock()
+	defer c.indexMutex.Unlock()
+
+	// An index that was never loaded picks the change up on its first sync
+	if c.index == nil {
+		return
+	}
+
+	entry, err := c.readIndexEntry(name, nil)
+	if errors.Is(err, os.ErrNotExist) {
+		delete(c.index.Entries, name)
+	} else if err != nil {
+		log.Printf("Failed to index certificate %s: %v", name, err)
+		return
+	} else {
+		revoked, err := c.GetRevokedCertificates()
+		if err != nil {
+			log.Printf("Failed to index certificate %s: %v", name, err)
+			return
+		}
+		entry.applyRevocation(revoked)
+		c.index.Entries[name] = entry
+	}
+
+	c.index.rebuildSerials()
+	c.mirrorIndex(map[string]bool{name: true})
+	if err := c.saveIndex(); err != nil {
+		log.Printf("Failed to save certificate index: %v", err)
+	}
+}
+
+// indexedCertificates returns copies of the indexed certificates sorted by
+// name. The caller must hold indexMutex.
+func (c *CertificateService) indexedCertificates() []Certificate {
+	certificates := make([]Certificate, 0, len(c.index.Entries))
+	for _, entry := range c.index.Entries {
+		certificates = append(certificates, entry.Certificate)
+	}
+	sort.Slice(certificates, func(i, j int) bool {
+		return certificates[i].Name < certificates[j].Name
+	})
+	return certificates
+}
+
+// GetAllCertificates returns the metadata of all issued certificates from the
+// certificate index, re-reading only certificates changed since they were
+// indexed
+func (c *CertificateService) GetAllCertificates() ([]Certificate, error) {
+	c.indexMutex.Lock()
+	defer c.indexMutex.Unlock()
+
+	if err := c.syncIndex(); err != nil {
+		return nil, err
+	}
+	return c.indexedCertificates(), nil
+}
+
+// FindCertificateBySerial returns the indexed metadata of the certificate
+// holding a serial number, given in upper case hex
+func (c *CertificateService) FindCertificateBySerial(serialNumber string) (*Certificate, error) {
+	c.indexMutex.Lock()
+	defer c.indexMutex.Unlock()
+
+	if err := c.syncIndex(); err != nil {
+		return nil, err
+	}
+	name, ok := c.index.bySerial[serialNumber]
+	if !ok {
+		return nil, fmt.Errorf("%w: serial %s", ErrCertificateNotFound, serialNumber)
+	}
+	cert := c.index.Entries[name].Certificate
+	return &cert, nil
+}
+
+// serialNumberIndexed reports whether the certificate index holds a serial
+// number. The index is not synced first, so no certificate is read; the
+// serial mapping covers certificates issued since the last sync.
+func (c *CertificateService) serialNumberIndexed(serialNumber string) bool {
+	c.indexMutex.Lock()
+	defer c.indexMutex.Unlock()
+
+	if c.index == nil {
+		c.index = c.loadIndex()
+	}
+	_, ok := c.index.bySerial[serialNumber]
+	return ok
+}
+
+// RebuildIndex discards the certificate index and parses every stored
+// certificate again. It returns the number of indexed certificates.
+func (c *CertificateService) RebuildIndex() (int, error) {
+	c.indexMutex.Lock()
+	defer c.indexMutex.Unlock()
+
+	c.index = newCertificateIndex()
+	// Force the revocation status to be applied even without any certificates
+	c.index.RevocationsModTime = time.Unix(0, 0)
+	if err := c.syncIndex(); err != nil {
+		return 0, err
+	}
+	return len(c.index.Entries), nil
+}
+
+// DeleteCertificate removes a certificate and its files and drops it from the index
+func (c *CertificateService) DeleteCertificate(name string) error {
+	if err := c.storage.DeleteCertificate(name); err != nil {
+		return err
+	}
+	c.updateIndex(name)
+	return nil
+}
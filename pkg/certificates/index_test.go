@@ -0,0 +1,117 @@
+package certificates
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCertificateIndex(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	for _, name := range []string{"b.example.com", "a.example.com"} {
+		if err := certService.CreateServerCertificate(name, nil); err != nil {
+			t.Fatalf("Failed to create certificate: %v", err)
+		}
+	}
+
+	certs, err := certService.GetAllCertificates()
+	if err != nil {
+		t.Fatalf("Failed to list certificates: %v", err)
+	}
+	if len(certs) != 2 || certs[0].Name != "a.example.com" || certs[1].Name != "b.example.com" {
+		t.Fatalf("Expected both certificates sorted by name, got %+v", certs)
+	}
+	if certs[0].Path != certService.storage.GetCertificatePath("a.example.com") || certs[0].PEM != "" {
+		t.Errorf("Unexpected path %q or stored PEM", certs[0].Path)
+	}
+	if _, err := os.Stat(certService.getIndexPath()); err != nil {
+		t.Fatalf("Expected the index to be stored: %v", err)
+	}
+
+	// Issuing and revoking update the index
+	if err := certService.CreateClientCertificate("client@example.com", generateTestPassword()); err != nil {
+		t.Fatalf("Failed to create client certificate: %v", err)
+	}
+	if err := certService.RevokeCertificate("b.example.com"); err != nil {
+		t.Fatalf("Failed to revoke certificate: %v", err)
+	}
+	revoked, err := certService.FindCertificateBySerial(certs[1].SerialNumber)
+	if err != nil {
+		t.Fatalf("Failed to find certificate by serial: %v", err)
+	}
+	if revoked.Name != "b.example.com" || !revoked.Revoked || revoked.RevocationReason != "unspecified" {
+		t.Errorf("Expected b.example.com to be revoked, got %+v", revoked)
+	}
+	client, err := certService.FindCertificateBySerial(serialOf(t, certService, "client@example.com"))
+	if err != nil || !client.IsClient {
+		t.Errorf("Expected the client certificate in the index, got %+v, %v", client, err)
+	}
+
+	// Renewal replaces the serial
+	if err := certService.RenewServerCertificate("a.example.com"); err != nil {
+		t.Fatalf("Failed to renew certificate: %v", err)
+	}
+	if _, err := certService.FindCertificateBySerial(certs[0].SerialNumber); !errors.Is(err, ErrCertificateNotFound) {
+		t.Errorf("Expected the old serial to be gone after renewal, got %v", err)
+	}
+	if _, err := certService.FindCertificateBySerial(serialOf(t, certService, "a.example.com")); err != nil {
+		t.Errorf("Failed to find renewed certificate: %v", err)
+	}
+
+	// Another service on the same data directory starts from the stored index
+	// and notices files changed behind its back
+	restarted, err := NewCertificateService(certService.config, certService.storage)
+	if err != nil {
+		t.Fatalf("Failed to create certificate service: %v", err)
+	}
+	aPEM, err := os.ReadFile(certService.storage.GetCertificatePath("a.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	bPath := certService.storage.GetCertificatePath("b.example.com")
+	if err := os.WriteFile(bPath, aPEM, 0644); err != nil {
+		t.Fatalf("Failed to replace certificate: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(bPath, later, later); err != nil {
+		t.Fatalf("Failed to touch certificate: %v", err)
+	}
+	if err := os.RemoveAll(certService.storage.GetCertificateDirectory("client@example.com")); err != nil {
+		t.Fatalf("Failed to remove certificate: %v", err)
+	}
+
+	certs, err = restarted.GetAllCertificates()
+	if err != nil {
+		t.Fatalf("Failed to list certificates: %v", err)
+	}
+	if len(certs) != 2 {
+		t.Fatalf("Expected the removed certificate to be dropped, got %d certificates", len(certs))
+	}
+	if certs[1].SerialNumber != certs[0].SerialNumber || certs[1].Revoked {
+		t.Errorf("Expected b.example.com to be re-read from its replaced file, got %+v", certs[1])
+	}
+
+	if err := restarted.DeleteCertificate("a.example.com"); err != nil {
+		t.Fatalf("Failed to delete certificate: %v", err)
+	}
+	count, err := restarted.RebuildIndex()
+	if err != nil {
+		t.Fatalf("Failed to rebuild index: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected one certificate after deletion, got %d", count)
+	}
+}
+
+// serialOf returns the serial number of a stored certificate
+func serialOf(t *testing.T, certService *CertificateService, name string) string {
+	t.Helper()
+
+	cert, err := readCertificateFile(certService.storage.GetCertificatePath(name))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	return formatSerialNumber(cert.SerialNumber)
+}
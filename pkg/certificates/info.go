@@ -0,0 +1,330 @@
+package certificates
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxChainLength bounds the issuer chain walk
+const maxChainLength = 5
+
+// Key usages a CA sets in addition to the leaf usages profiles may request
+var caKeyUsageNames = map[string]x509.KeyUsage{
+	"certSign":     x509.KeyUsageCertSign,
+	"cRLSign":      x509.KeyUsageCRLSign,
+	"encipherOnly": x509.KeyUsageEncipherOnly,
+	"decipherOnly": x509.KeyUsageDecipherOnly,
+}
+
+// ChainCertificate describes a CA certificate above an issued certificate
+type ChainCertificate struct {
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	SerialNumber      string    `json:"serial_number"`
+	NotBefore         time.Time `json:"not_before"`
+	NotAfter          time.Time `json:"not_after"`
+	FingerprintSHA256 string    `json:"fingerprint_sha256"`
+	PEM               string    `json:"pem"`
+}
+
+// GetCertificateInfo parses a stored certificate into its full metadata,
+// including its revocation status and issuer chain
+func (c *CertificateService) GetCertificateInfo(name string) (*Certificate, error) {
+	info, cert, err := c.readCertificateMetadata(name)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := c.GetRevokedCertificates()
+	if err != nil {
+		return nil, err
+	}
+	info.applyRevocation(revoked)
+
+	versions, err := c.ListCertificateVersions(name)
+	if err != nil {
+		return nil, err
+	}
+	info.Replaces = versions[0].Replaces
+
+	chain, err := c.certificateChain(cert)
+	if err != nil {
+		return nil, err
+	}
+	for _, ca := range chain {
+		info.Chain = append(info.Chain, ChainCertificate{
+			Subject:           ca.Subject.String(),
+			Issuer:            ca.Issuer.String(),
+			SerialNumber:      formatSerialNumber(ca.SerialNumber),
+			NotBefore:         ca.NotBefore,
+			NotAfter:          ca.NotAfter,
+			FingerprintSHA256: fingerprintSHA256(ca.Raw),
+			PEM:               string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})),
+		})
+	}
+
+	return info, nil
+}
+
+// readCertificateMetadata parses a stored certificate and the files stored
+// next to it, without its revocation status and chain
+func (c *CertificateService) readCertificateMetadata(name string) (*Certificate, *x509.Certificate, error) {
+	certPath := c.storage.GetCertificatePath(name)
+	certPEM, err := os.ReadFile(certPath)
+	if os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrCertificateNotFound, name)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, nil, fmt.Errorf("failed to decode certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	info := describeCertificate(cert)
+	info.Name = name
+	info.Path = certPath
+	info.PEM = string(certPEM)
+	info.IsClient = c.isClientCertificate(name, cert)
+	if _, err := os.Stat(c.storage.GetCertificateKeyPath(name)); err == nil {
+		info.HasPrivateKey = true
+	}
+	if profile, err := os.ReadFile(c.getCertificateProfilePath(name)); err == nil {
+		info.Profile = strings.TrimSpace(string(profile))
+	}
+	if metadata, err := c.loadCertificateMetadata(name); err == nil {
+		info.applyMetadata(metadata)
+	} else {
+		log.Printf("Ignoring metadata of certificate %s: %v", name, err)
+	}
+	if policy, err := c.loadRenewalPolicy(name); err == nil {
+		info.AutoRenew = policy
+	} else {
+		log.Printf("Ignoring renewal policy of certificate %s: %v", name, err)
+	}
+
+	return info, cert, nil
+}
+
+// applyRevocation sets the revocation status from the revocation database entries
+func (info *Certificate) applyRevocation(revoked []RevokedCertificate) {
+	info.Revoked = false
+	info.RevokedAt = nil
+	info.RevocationReason = ""
+	for _, entry := range revoked {
+		if entry.SerialNumber == info.SerialNumber {
+			revokedAt := entry.RevokedAt
+			info.Revoked = true
+			info.RevokedAt = &revokedAt
+			info.RevocationReason = entry.Reason.String()
+			return
+		}
+	}
+}
+
+// describeCertificate fills in the metadata read from the certificate itself
+func describeCertificate(cert *x509.Certificate) *Certificate {
+	info := &Certificate{
+		CommonName:         cert.Subject.CommonName,
+		Subject:            cert.Subject.String(),
+		SerialNumber:       formatSerialNumber(cert.SerialNumber),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		Issuer:             cert.Issuer.String(),
+		DNSNames:           cert.DNSNames,
+		EmailAddresses:     cert.EmailAddresses,
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		KeyUsage:           keyUsageNamesOf(cert.KeyUsage),
+		ExtKeyUsage:        extKeyUsageNamesOf(cert),
+		FingerprintSHA1:    fingerprintSHA1(cert.Raw),
+		FingerprintSHA256:  fingerprintSHA256(cert.Raw),
+		SPKIPin:            spkiPin(cert),
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		info.URIs = append(info.URIs, uri.String())
+	}
+	if spec, err := keySpecOf(cert.PublicKey); err == nil {
+		info.KeyAlgorithm = spec.Algorithm
+		info.KeySize = spec.Size
+	} else {
+		info.KeyAlgorithm = KeyAlgorithm(strings.ToLower(cert.PublicKeyAlgorithm.String()))
+	}
+	return info
+}
+
+// isClientCertificate reports whether a certificate was issued for client
+// authentication: it has a PKCS#12 bundle, or only the clientAuth EKU
+func (c *CertificateService) isClientCertificate(name string, cert *x509.Certificate) bool {
+	if _, err := os.Stat(c.storage.GetCertificateP12Path(name)); err == nil {
+		return true
+	}
+
+	client, server := false, false
+	for _, usage := range cert.ExtKeyUsage {
+		switch usage {
+		case x509.ExtKeyUsageClientAuth:
+			client = true
+		case x509.ExtKeyUsageServerAuth:
+			server = true
+		}
+	}
+	return client && !server
+}
+
+// certificateChain returns the CA certificates above a certificate, issuer
+// first, ending at a self-signed root. Certificates issued by a retired CA
+// chain to that CA.
+func (c *CertificateService) certificateChain(cert *x509.Certificate) ([]*x509.Certificate, error) {
+	candidates, err := c.chainCandidates()
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []*x509.Certificate
+	current := cert
+	for len(chain) < maxChainLength && !isSelfSigned(current) {
+		var issuer *x509.Certificate
+		for _, candidate := range candidates {
+			if bytes.Equal(candidate.RawSubject, current.RawIssuer) && current.CheckSignatureFrom(candidate) == nil {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+		current = issuer
+	}
+	return chain, nil
+}
+
+// chainCandidates returns the current and retired CA certificates. Self-signed
+// roots come before cross-certificates with the same subject so chains end at
+// a root.
+func (c *CertificateService) chainCandidates() ([]*x509.Certificate, error) {
+	chainPEM, err := c.issuerChainPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	retired, err := c.ListRetiredCAs()
+	if err != nil {
+		return nil, err
+	}
+	for _, ca := range retired {
+		dir := c.getRetiredCADirectory(ca.ID)
+		for _, file := range []string{filepath.Base(c.getIntermediateCertPath()), retiredRootFile} {
+			if data, err := os.ReadFile(filepath.Join(dir, file)); err == nil {
+				chainPEM = append(chainPEM, data...)
+			}
+		}
+	}
+
+	var candidates []*x509.Certificate
+	for rest := chainPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			candidates = append(candidates, cert)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return isSelfSigned(candidates[i]) && !isSelfSigned(candidates[j])
+	})
+	return candidates, nil
+}
+
+// isSelfSigned reports whether a certificate is a self-signed root
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// keyUsageNamesOf returns the names of the key usage bits that are set
+func keyUsageNamesOf(usage x509.KeyUsage) []string {
+	var names []string
+	for _, table := range []map[string]x509.KeyUsage{keyUsageNames, caKeyUsageNames} {
+		for name, bit := range table {
+			if usage&bit != 0 {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// extKeyUsageNamesOf returns the names of the extended key usages, with
+// unknown usages as dotted OIDs
+func extKeyUsageNamesOf(cert *x509.Certificate) []string {
+	var names []string
+	for _, usage := range cert.ExtKeyUsage {
+		name := fmt.Sprintf("unknown(%d)", int(usage))
+		for candidate, value := range extKeyUsageNames {
+			if value == usage {
+				name = candidate
+				break
+			}
+		}
+		if usage == x509.ExtKeyUsageAny {
+			name = "any"
+		}
+		names = append(names, name)
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		names = append(names, oid.String())
+	}
+	return names
+}
+
+// fingerprintSHA1 returns the SHA-1 fingerprint of a DER certificate
+func fingerprintSHA1(der []byte) string {
+	digest := sha1.Sum(der)
+	return formatFingerprint(digest[:])
+}
+
+// fingerprintSHA256 returns the SHA-256 fingerprint of a DER certificate
+func fingerprintSHA256(der []byte) string {
+	digest := sha256.Sum256(der)
+	return formatFingerprint(digest[:])
+}
+
+// formatFingerprint formats a digest as colon separated upper case hex
+func formatFingerprint(digest []byte) string {
+	parts := make([]string, len(digest))
+	for i, b := range digest {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// spkiPin returns the base64 SHA-256 hash of the subject public key info, as
+// used for HPKP and certificate pinning
+func spkiPin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
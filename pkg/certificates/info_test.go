@@ -0,0 +1,129 @@
+package certificates
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestGetCertificateInfo(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+
+	certService := newTestCertificateService(t)
+
+	if _, err := certService.GetCertificateInfo("missing.example.com"); !errors.Is(err, ErrCertificateNotFound) {
+		t.Errorf("Expected ErrCertificateNotFound, got %v", err)
+	}
+
+	err := certService.CreateServerCertificateWithOptions("info.example.com",
+		[]string{"www.info.example.com", "10.0.0.1", "spiffe://example.com/info", "ops@example.com"},
+		IssueOptions{KeyAlgorithm: KeyAlgorithmECDSA, KeySize: 384})
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	leaf, err := readCertificateFile(certService.storage.GetCertificatePath("info.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	root, err := certService.loadCACertificate()
+	if err != nil {
+		t.Fatalf("Failed to load CA certificate: %v", err)
+	}
+
+	info, err := certService.GetCertificateInfo("info.example.com")
+	if err != nil {
+		t.Fatalf("Failed to get certificate info: %v", err)
+	}
+
+	if info.Name != "info.example.com" || info.CommonName != "info.example.com" {
+		t.Errorf("Unexpected names %q and %q", info.Name, info.CommonName)
+	}
+	if info.SerialNumber != formatSerialNumber(leaf.SerialNumber) {
+		t.Errorf("Expected serial %X, got %s", leaf.SerialNumber, info.SerialNumber)
+	}
+	if !info.NotBefore.Equal(leaf.NotBefore) || !info.NotAfter.Equal(leaf.NotAfter) {
+		t.Errorf("Unexpected validity %v to %v", info.NotBefore, info.NotAfter)
+	}
+	if info.Issuer != root.Subject.String() {
+		t.Errorf("Expected issuer %s, got %s", root.Subject, info.Issuer)
+	}
+	if info.IsClient || !info.HasPrivateKey {
+		t.Errorf("Expected a server certificate with a key, got client=%v key=%v", info.IsClient, info.HasPrivateKey)
+	}
+	if info.Profile != ProfileServer {
+		t.Errorf("Expected profile %s, got %q", ProfileServer, info.Profile)
+	}
+
+	if len(info.DNSNames) != 2 || info.DNSNames[1] != "www.info.example.com" {
+		t.Errorf("Unexpected DNS names %v", info.DNSNames)
+	}
+	if len(info.IPAddresses) != 1 || info.IPAddresses[0] != "10.0.0.1" {
+		t.Errorf("Unexpected IP addresses %v", info.IPAddresses)
+	}
+	if len(info.URIs) != 1 || info.URIs[0] != "spiffe://example.com/info" {
+		t.Errorf("Unexpected URIs %v", info.URIs)
+	}
+	if len(info.EmailAddresses) != 1 || info.EmailAddresses[0] != "ops@example.com" {
+		t.Errorf("Unexpected email addresses %v", info.EmailAddresses)
+	}
+
+	if info.KeyAlgorithm != KeyAlgorithmECDSA || info.KeySize != 384 {
+		t.Errorf("Expected an ECDSA P-384 key, got %s %d", info.KeyAlgorithm, info.KeySize)
+	}
+	if info.SignatureAlgorithm != leaf.SignatureAlgorithm.String() {
+		t.Errorf("Expected signature algorithm %s, got %s", leaf.SignatureAlgorithm, info.SignatureAlgorithm)
+	}
+	if strings.Join(info.KeyUsage, ",") != "digitalSignature" {
+		t.Errorf("Unexpected key usage %v", info.KeyUsage)
+	}
+	if strings.Join(info.ExtKeyUsage, ",") != "serverAuth" {
+		t.Errorf("Unexpected extended key usage %v", info.ExtKeyUsage)
+	}
+
+	digest := sha256.Sum256(leaf.Raw)
+	if info.FingerprintSHA256 != formatFingerprint(digest[:]) || len(info.FingerprintSHA256) != 95 {
+		t.Errorf("Unexpected SHA-256 fingerprint %s", info.FingerprintSHA256)
+	}
+	if len(info.FingerprintSHA1) != 59 {
+		t.Errorf("Unexpected SHA-1 fingerprint %s", info.FingerprintSHA1)
+	}
+	pin := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	if info.SPKIPin != base64.StdEncoding.EncodeToString(pin[:]) {
+		t.Errorf("Unexpected SPKI pin %s", info.SPKIPin)
+	}
+
+	if len(info.Chain) != 1 || info.Chain[0].Subject != root.Subject.String() {
+		t.Fatalf("Expected the root as the only chain certificate, got %+v", info.Chain)
+	}
+	if info.Revoked {
+		t.Error("Certificate reported as revoked before revocation")
+	}
+
+	if err := certService.RevokeCertificateWithReason("info.example.com", ReasonKeyCompromise, nil); err != nil {
+		t.Fatalf("Failed to revoke certificate: %v", err)
+	}
+	info, err = certService.GetCertificateInfo("info.example.com")
+	if err != nil {
+		t.Fatalf("Failed to get certificate info: %v", err)
+	}
+	if !info.Revoked || info.RevokedAt == nil || info.RevocationReason != "keyCompromise" {
+		t.Errorf("Expected keyCompromise revocation, got revoked=%v at=%v reason=%q", info.Revoked, info.RevokedAt, info.RevocationReason)
+	}
+
+	// After a rollover old certificates still chain to the retired root
+	if _, err := certService.RolloverCA(); err != nil {
+		t.Fatalf("Failed to roll over CA: %v", err)
+	}
+	info, err = certService.GetCertificateInfo("info.example.com")
+	if err != nil {
+		t.Fatalf("Failed to get certificate info: %v", err)
+	}
+	if len(info.Chain) != 1 || info.Chain[0].FingerprintSHA256 != fingerprintSHA256(root.Raw) {
+		t.Errorf("Expected the retired root in the chain, got %+v", info.Chain)
+	}
+}
@@ -1,5 +1,7 @@
 package certificates
 
+import "time"
+
 // CertificateServiceInterface defines the interface for certificate operations
 type CertificateServiceInterface interface {
 	// CA operations
@@ -7,15 +9,62 @@ type CertificateServiceInterface interface {
 	CreateCA() error
 	RenewCA() error
 	CreateServiceCertificate() error
+	GetCAHierarchy() (*CAHierarchy, error)
+	ExportRootKey() ([]byte, error)
+	RemoveRootKey() error
+	ReissueIntermediate(rootKeyPEM []byte) error
+	GetIntermediateCertificate() ([]byte, error)
+	RolloverCA() (*CARollover, error)
+	GetTrustBundle() ([]byte, error)
+
+	// Seal operations
+	Sealed() bool
+	Seal()
+	Unseal(passphrase string) error
+	CreateUnsealShares(count, threshold int) (*UnsealShares, error)
+	SubmitUnsealShare(share string) (*UnsealProgress, error)
+	GetUnsealProgress() *UnsealProgress
+	ResetUnsealShares()
 
 	// Certificate operations
 	CreateServerCertificate(commonName string, domains []string) error
 	CreateClientCertificate(commonName, password string) error
+	CreateServerCertificateWithOptions(commonName string, domains []string, opts IssueOptions) error
+	CreateClientCertificateWithOptions(commonName, password string, opts IssueOptions) error
+	SignCSR(csrData []byte, opts CSRSignOptions) (*SignedCertificate, error)
 	RevokeCertificate(name string) error
+	RevokeCertificateWithReason(name string, reason RevocationReason, invalidityDate *time.Time) error
+	RevokeCertificateVersion(name, serialNumber string, reason RevocationReason, invalidityDate *time.Time) error
 	RenewServerCertificate(name string) error
 	RenewClientCertificate(name string) error
+	RenewServerCertificateWithOptions(name string, opts RenewOptions) error
+	RenewClientCertificateWithOptions(name string, opts RenewOptions) error
 	GetAllCertificates() ([]Certificate, error)
+	QueryCertificates(query CertificateQuery) (*CertificatePage, error)
 	GetCertificateInfo(name string) (*Certificate, error)
+	FindCertificateBySerial(serialNumber string) (*Certificate, error)
+	ListCertificateVersions(name string) ([]CertificateVersion, error)
+	GetCertificateVersion(name, serialNumber string) (*CertificateVersion, error)
+	DeleteCertificate(name string) error
+	UpdateCertificateMetadata(name string, metadata CertificateMetadata) error
+	SetRenewalPolicy(name string, policy *RenewalPolicy) error
+	GetRenewalStatus(name string) (*RenewalStatus, error)
+	RebuildIndex() (int, error)
+
+	// Profile operations
+	ListProfiles() ([]Profile, error)
+	GetProfile(name string) (*Profile, error)
+	CreateProfile(profile Profile) error
+	UpdateProfile(profile Profile) error
+	DeleteProfile(name string) error
+
+	// Revocation operations
+	GenerateCRL() error
+	GetCRL() ([]byte, error)
+	GetRetiredCRL(id string) ([]byte, error)
+	GetIssuerCRL(serial string) ([]byte, error)
+	GetIssuerCertificate(serial string) ([]byte, error)
+	OCSPResponse(requestDER []byte) ([]byte, error)
 }
 
 // Ensure CertificateService implements CertificateServiceInterface
@@ -0,0 +1,164 @@
+package certificates
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/signer"
+)
+
+// KeyAlgorithm identifies the public key algorithm of a generated key
+type KeyAlgorithm string
+
+// Supported key algorithms
+const (
+	KeyAlgorithmRSA     KeyAlgorithm = "rsa"
+	KeyAlgorithmECDSA   KeyAlgorithm = "ecdsa"
+	KeyAlgorithmEd25519 KeyAlgorithm = "ed25519"
+)
+
+// Default key sizes
+const (
+	DefaultRSAKeySize   = 2048
+	DefaultECDSAKeySize = 256
+	DefaultCARSAKeySize = 4096
+	DefaultCAECDSASize  = 384
+)
+
+// KeySpec describes the algorithm and size of a key to generate. Size is the
+// modulus length in bits for RSA and the curve size for ECDSA; it is ignored
+// for Ed25519.
+type KeySpec struct {
+	Algorithm KeyAlgorithm `json:"algorithm"`
+	Size      int          `json:"size,omitempty"`
+}
+
+// String returns a human readable description of the key spec
+func (k KeySpec) String() string {
+	switch k.Algorithm {
+	case KeyAlgorithmRSA:
+		return fmt.Sprintf("RSA-%d", k.Size)
+	case KeyAlgorithmECDSA:
+		return fmt.Sprintf("ECDSA-P%d", k.Size)
+	case KeyAlgorithmEd25519:
+		return "Ed25519"
+	}
+	return string(k.Algorithm)
+}
+
+// ParseKeySpec validates an algorithm name and size, filling in the default
+// size when none is given
+func ParseKeySpec(algorithm string, size int) (KeySpec, error) {
+	switch strings.ToLower(strings.TrimSpace(algorithm)) {
+	case "", "rsa":
+		if size == 0 {
+			size = DefaultRSAKeySize
+		}
+		if size != 2048 && size != 3072 && size != 4096 {
+			return KeySpec{}, fmt.Errorf("unsupported RSA key size: %d", size)
+		}
+		return KeySpec{Algorithm: KeyAlgorithmRSA, Size: size}, nil
+	case "ecdsa", "ec":
+		if size == 0 {
+			size = DefaultECDSAKeySize
+		}
+		if size != 256 && size != 384 {
+			return KeySpec{}, fmt.Errorf("unsupported ECDSA curve size: %d", size)
+		}
+		return KeySpec{Algorithm: KeyAlgorithmECDSA, Size: size}, nil
+	case "ed25519":
+		return KeySpec{Algorithm: KeyAlgorithmEd25519}, nil
+	}
+	return KeySpec{}, fmt.Errorf("unsupported key algorithm: %s", algorithm)
+}
+
+// generateKey generates a new private key for the given spec
+func generateKey(spec KeySpec) (crypto.Signer, error) {
+	return signer.GenerateKey(string(spec.Algorithm), spec.Size)
+}
+
+// keySpecOf returns the key spec matching a public key
+func keySpecOf(pub crypto.PublicKey) (KeySpec, error) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return KeySpec{Algorithm: KeyAlgorithmRSA, Size: key.N.BitLen()}, nil
+	case *ecdsa.PublicKey:
+		return KeySpec{Algorithm: KeyAlgorithmECDSA, Size: key.Curve.Params().BitSize}, nil
+	case ed25519.PublicKey:
+		return KeySpec{Algorithm: KeyAlgorithmEd25519}, nil
+	}
+	return KeySpec{}, fmt.Errorf("unsupported public key type: %T", pub)
+}
+
+// renewalKey returns the public key to certify when renewing a certificate:
+// the existing one, or that of a new key of the same type when rotating. A new
+// key is returned as well so it can be written once the certificate is signed.
+func (c *CertificateService) renewalKey(certName string, existing *x509.Certificate, rotate bool) (crypto.PublicKey, crypto.Signer, error) {
+	if !rotate {
+		return existing.PublicKey, nil, nil
+	}
+	if _, err := os.Stat(c.storage.GetCertificateKeyPath(certName)); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrNoPrivateKey, certName)
+	}
+
+	spec, err := keySpecOf(existing.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := generateKey(spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+	return key.Public(), key, nil
+}
+
+// encodePrivateKeyPEM encodes a private key as a PKCS#8 PEM block
+func encodePrivateKeyPEM(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// parsePrivateKeyPEM parses a PKCS#8, PKCS#1 or SEC 1 PEM encoded private key
+func parsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode private key PEM")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type: %T", key)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("unsupported private key PEM type: %s", block.Type)
+}
+
+// leafKeyUsage returns the key usage appropriate for a leaf key. Key
+// encipherment only applies to RSA keys.
+func leafKeyUsage(pub crypto.PublicKey) x509.KeyUsage {
+	if _, ok := pub.(*rsa.PublicKey); ok {
+		return x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	}
+	return x509.KeyUsageDigitalSignature
+}
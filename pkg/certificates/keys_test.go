@@ -0,0 +1,167 @@
+package certificates
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"os/exec"
+	"testing"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/config"
+	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
+)
+
+func TestParseKeySpec(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		size      int
+		expected  KeySpec
+		wantErr   bool
+	}{
+		{"", 0, KeySpec{Algorithm: KeyAlgorithmRSA, Size: 2048}, false},
+		{"rsa", 3072, KeySpec{Algorithm: KeyAlgorithmRSA, Size: 3072}, false},
+		{"RSA", 1024, KeySpec{}, true},
+		{"ecdsa", 0, KeySpec{Algorithm: KeyAlgorithmECDSA, Size: 256}, false},
+		{"ecdsa", 384, KeySpec{Algorithm: KeyAlgorithmECDSA, Size: 384}, false},
+		{"ecdsa", 521, KeySpec{}, true},
+		{"ed25519", 0, KeySpec{Algorithm: KeyAlgorithmEd25519}, false},
+		{"dsa", 0, KeySpec{}, true},
+	}
+
+	for _, tt := range tests {
+		spec, err := ParseKeySpec(tt.algorithm, tt.size)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseKeySpec(%q, %d) error = %v, wantErr %v", tt.algorithm, tt.size, err, tt.wantErr)
+			continue
+		}
+		if spec != tt.expected {
+			t.Errorf("ParseKeySpec(%q, %d) = %v, want %v", tt.algorithm, tt.size, spec, tt.expected)
+		}
+	}
+}
+
+func TestPrivateKeyPEMRoundTrip(t *testing.T) {
+	for _, spec := range []KeySpec{
+		{Algorithm: KeyAlgorithmRSA, Size: 2048},
+		{Algorithm: KeyAlgorithmECDSA, Size: 384},
+		{Algorithm: KeyAlgorithmEd25519},
+	} {
+		key, err := generateKey(spec)
+		if err != nil {
+			t.Fatalf("Failed to generate %s key: %v", spec, err)
+		}
+
+		keyPEM, err := encodePrivateKeyPEM(key)
+		if err != nil {
+			t.Fatalf("Failed to encode %s key: %v", spec, err)
+		}
+
+		parsed, err := parsePrivateKeyPEM(keyPEM)
+		if err != nil {
+			t.Fatalf("Failed to parse %s key: %v", spec, err)
+		}
+
+		parsedSpec, err := keySpecOf(parsed.Public())
+		if err != nil {
+			t.Fatalf("Failed to inspect %s key: %v", spec, err)
+		}
+		if parsedSpec != spec {
+			t.Errorf("Round trip changed key spec: %v -> %v", spec, parsedSpec)
+		}
+	}
+}
+
+func TestIssueWithNonRSAKeys(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+
+	tempDir := t.TempDir()
+
+	store, err := storage.NewStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	cfg := &config.Config{
+		CAName:        "Test EC CA",
+		CAKeyPassword: generateTestPassword(),
+		CAKeyType:     "ecdsa",
+		Organization:  "Test Org",
+		Country:       "US",
+		DataDir:       tempDir,
+	}
+
+	certService, err := NewCertificateService(cfg, store)
+	if err != nil {
+		t.Fatalf("Failed to create certificate service: %v", err)
+	}
+
+	if err := certService.Unseal(cfg.CAKeyPassword); err != nil {
+		t.Fatalf("Failed to unseal CA: %v", err)
+	}
+	if err := certService.CreateCA(); err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+
+	caCert, err := certService.loadCACertificate()
+	if err != nil {
+		t.Fatalf("Failed to load CA certificate: %v", err)
+	}
+	caKey, ok := caCert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || caKey.Curve.Params().BitSize != 384 {
+		t.Fatalf("Expected an ECDSA P-384 CA key, got %T", caCert.PublicKey)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	if err := certService.CreateServerCertificateWithOptions("ed.example.com", nil, IssueOptions{KeyAlgorithm: KeyAlgorithmEd25519}); err != nil {
+		t.Fatalf("Failed to create Ed25519 server certificate: %v", err)
+	}
+	if err := certService.RenewServerCertificate("ed.example.com"); err != nil {
+		t.Fatalf("Failed to renew Ed25519 server certificate: %v", err)
+	}
+
+	serverCert, err := readCertificateFile(store.GetCertificatePath("ed.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read server certificate: %v", err)
+	}
+	if _, ok := serverCert.PublicKey.(ed25519.PublicKey); !ok {
+		t.Errorf("Expected an Ed25519 server key, got %T", serverCert.PublicKey)
+	}
+	if serverCert.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+		t.Errorf("Ed25519 certificate must not assert keyEncipherment")
+	}
+	if _, err := serverCert.Verify(x509.VerifyOptions{DNSName: "ed.example.com", Roots: roots}); err != nil {
+		t.Errorf("Server certificate does not verify against the CA: %v", err)
+	}
+
+	if err := certService.CreateClientCertificateWithOptions("ec-client", "client-password", IssueOptions{KeyAlgorithm: KeyAlgorithmECDSA, KeySize: 256}); err != nil {
+		t.Fatalf("Failed to create ECDSA client certificate: %v", err)
+	}
+
+	clientCert, err := readCertificateFile(store.GetCertificatePath("ec-client"))
+	if err != nil {
+		t.Fatalf("Failed to read client certificate: %v", err)
+	}
+	if _, ok := clientCert.PublicKey.(*ecdsa.PublicKey); !ok {
+		t.Errorf("Expected an ECDSA client key, got %T", clientCert.PublicKey)
+	}
+
+	if err := certService.CreateServerCertificateWithOptions("rsa.example.com", nil, IssueOptions{KeyAlgorithm: KeyAlgorithmRSA, KeySize: 3072}); err != nil {
+		t.Fatalf("Failed to create RSA server certificate: %v", err)
+	}
+	rsaCert, err := readCertificateFile(store.GetCertificatePath("rsa.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read RSA server certificate: %v", err)
+	}
+	if key, ok := rsaCert.PublicKey.(*rsa.PublicKey); !ok || key.N.BitLen() != 3072 {
+		t.Errorf("Expected an RSA-3072 server key")
+	}
+
+	if err := certService.RenewCA(); err != nil {
+		t.Fatalf("Failed to renew CA: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package certificates
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Limits on certificate metadata
+const (
+	maxTeamLength       = 128
+	maxNotesLength      = 4096
+	maxLabels           = 64
+	maxLabelValueLength = 255
+)
+
+// labelKeyPattern restricts label keys to a form that is safe in query
+// parameters and the database label encoding
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,62}$`)
+
+// CertificateMetadata is the ownership information attached to a certificate.
+// It is not part of the X.509 certificate and survives renewal.
+type CertificateMetadata struct {
+	OwnerEmail string            `json:"owner_email,omitempty"`
+	Team       string            `json:"team,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Notes      string            `json:"notes,omitempty"`
+}
+
+// IsEmpty reports whether no metadata is set
+func (m CertificateMetadata) IsEmpty() bool {
+	return m.OwnerEmail == "" && m.Team == "" && len(m.Labels) == 0 && m.Notes == ""
+}
+
+// Validate checks the owner address, team, labels and notes
+func (m CertificateMetadata) Validate() error {
+	if m.OwnerEmail != "" {
+		addr, err := mail.ParseAddress(m.OwnerEmail)
+		if err != nil || addr.Address != m.OwnerEmail {
+			return fmt.Errorf("%w: invalid owner email %q", ErrInvalidMetadata, m.OwnerEmail)
+		}
+	}
+	if len(m.Team) > maxTeamLength || strings.ContainsFunc(m.Team, unicode.IsControl) {
+		return fmt.Errorf("%w: team must be at most %d characters on one line", ErrInvalidMetadata, maxTeamLength)
+	}
+	if len(m.Notes) > maxNotesLength {
+		return fmt.Errorf("%w: notes must be at most %d characters", ErrInvalidMetadata, maxNotesLength)
+	}
+
+	if len(m.Labels) > maxLabels {
+		return fmt.Errorf("%w: at most %d labels are allowed", ErrInvalidMetadata, maxLabels)
+	}
+	for key, value := range m.Labels {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("%w: invalid label key %q", ErrInvalidMetadata, key)
+		}
+		if len(value) > maxLabelValueLength || strings.ContainsFunc(value, unicode.IsControl) {
+			return fmt.Errorf("%w: label %s must be at most %d characters on one line", ErrInvalidMetadata, key, maxLabelValueLength)
+		}
+	}
+	return nil
+}
+
+// ParseLabels parses key=value pairs into labels
+func ParseLabels(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%w: label %q must be key=value", ErrInvalidMetadata, pair)
+		}
+		labels[key] = strings.TrimSpace(value)
+	}
+	return labels, nil
+}
+
+// getCertificateMetadataPath returns the file holding the metadata of a certificate
+func (c *CertificateService) getCertificateMetadataPath(name string) string {
+	return filepath.Join(c.storage.GetCertificateDirectory(name), "metadata.json")
+}
+
+// recordCertificateMetadata stores the metadata of a certificate; empty
+// metadata removes the file
+func (c *CertificateService) recordCertificateMetadata(certName string, metadata CertificateMetadata) error {
+	path := c.getCertificateMetadataPath(certName)
+	if metadata.IsEmpty() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove certificate metadata: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal certificate metadata: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to record certificate metadata: %w", err)
+	}
+	return nil
+}
+
+// loadCertificateMetadata reads the metadata of a certificate; a certificate
+// without metadata yields an empty one
+func (c *CertificateService) loadCertificateMetadata(certName string) (CertificateMetadata, error) {
+	var metadata CertificateMetadata
+	data, err := os.ReadFile(c.getCertificateMetadataPath(certName))
+	if os.IsNotExist(err) {
+		return metadata, nil
+	}
+	if err != nil {
+		return metadata, fmt.Errorf("failed to read certificate metadata: %w", err)
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return metadata, fmt.Errorf("failed to parse certificate metadata: %w", err)
+	}
+	return metadata, nil
+}
+
+// applyMetadata copies certificate metadata into the certificate info
+func (info *Certificate) applyMetadata(metadata CertificateMetadata) {
+	info.OwnerEmail = metadata.OwnerEmail
+	info.Team = metadata.Team
+	info.Labels = metadata.Labels
+	info.Notes = metadata.Notes
+}
+
+// UpdateCertificateMetadata replaces the owner, team, labels and notes of a
+// certificate
+func (c *CertificateService) UpdateCertificateMetadata(name string, metadata CertificateMetadata) error {
+	if err := metadata.Validate(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(c.storage.GetCertificatePath(name)); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrCertificateNotFound, name)
+	}
+
+	if err := c.recordCertificateMetadata(name, metadata); err != nil {
+		return err
+	}
+	c.updateIndex(name)
+	return nil
+}
@@ -0,0 +1,122 @@
+package certificates
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestCertificateMetadata(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	metadata := CertificateMetadata{
+		OwnerEmail: "platform@example.com",
+		Team:       "Platform",
+		Labels:     map[string]string{"env": "prod", "service": "api-gateway"},
+		Notes:      "Deployed on the edge load balancers",
+	}
+	if err := certService.CreateServerCertificateWithOptions("api-gateway-prod", nil, IssueOptions{Metadata: metadata}); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	info, err := certService.GetCertificateInfo("api-gateway-prod")
+	if err != nil {
+		t.Fatalf("Failed to get certificate info: %v", err)
+	}
+	if info.OwnerEmail != metadata.OwnerEmail || info.Team != metadata.Team || info.Notes != metadata.Notes ||
+		info.Labels["service"] != "api-gateway" {
+		t.Errorf("Unexpected metadata in certificate info: %+v", info)
+	}
+
+	// Metadata survives renewal and is searchable through the index
+	if err := certService.RenewServerCertificate("api-gateway-prod"); err != nil {
+		t.Fatalf("Failed to renew certificate: %v", err)
+	}
+	page, err := certService.QueryCertificates(CertificateQuery{Tags: []string{"env=prod"}})
+	if err != nil {
+		t.Fatalf("Failed to query certificates: %v", err)
+	}
+	if page.Total != 1 || page.Certificates[0].OwnerEmail != metadata.OwnerEmail {
+		t.Errorf("Expected the renewed certificate with its owner, got %+v", page)
+	}
+
+	// Updating replaces all fields; clearing them removes the file
+	if err := certService.UpdateCertificateMetadata("api-gateway-prod", CertificateMetadata{Team: "Edge"}); err != nil {
+		t.Fatalf("Failed to update metadata: %v", err)
+	}
+	certs, err := certService.GetAllCertificates()
+	if err != nil {
+		t.Fatalf("Failed to list certificates: %v", err)
+	}
+	if certs[0].Team != "Edge" || certs[0].OwnerEmail != "" || certs[0].Labels != nil {
+		t.Errorf("Expected only the team to remain, got %+v", certs[0])
+	}
+	if err := certService.UpdateCertificateMetadata("api-gateway-prod", CertificateMetadata{}); err != nil {
+		t.Fatalf("Failed to clear metadata: %v", err)
+	}
+	if _, err := os.Stat(certService.getCertificateMetadataPath("api-gateway-prod")); !os.IsNotExist(err) {
+		t.Errorf("Expected the metadata file to be removed, got %v", err)
+	}
+
+	if err := certService.UpdateCertificateMetadata("missing", metadata); !errors.Is(err, ErrCertificateNotFound) {
+		t.Errorf("Expected ErrCertificateNotFound, got %v", err)
+	}
+
+	invalid := []CertificateMetadata{
+		{OwnerEmail: "Platform <platform@example.com>"},
+		{OwnerEmail: "not an address"},
+		{Team: "line\nbreak"},
+		{Labels: map[string]string{"bad key": "value"}},
+		{Labels: map[string]string{"env": "multi\nline"}},
+	}
+	for _, m := range invalid {
+		if err := certService.UpdateCertificateMetadata("api-gateway-prod", m); !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("Expected ErrInvalidMetadata for %+v, got %v", m, err)
+		}
+	}
+	if err := certService.CreateServerCertificateWithOptions("other", nil, IssueOptions{Metadata: invalid[0]}); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("Expected issuing with invalid metadata to fail, got %v", err)
+	}
+	if _, err := os.Stat(certService.storage.GetCertificateDirectory("other")); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be written for invalid metadata")
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"env=prod", " team = web ", "empty="})
+	if err != nil {
+		t.Fatalf("Failed to parse labels: %v", err)
+	}
+	if len(labels) != 3 || labels["env"] != "prod" || labels["team"] != "web" || labels["empty"] != "" {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+
+	for _, pair := range []string{"novalue", "=prod"} {
+		if _, err := ParseLabels([]string{pair}); !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("Expected ErrInvalidMetadata for %q, got %v", pair, err)
+		}
+	}
+}
+
+func TestExpiryNotices(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if err := certService.CreateProfile(Profile{Name: "short", ValidityDays: 7, ExtKeyUsage: []string{"serverAuth"}}); err != nil {
+		t.Fatalf("Failed to create profile: %v", err)
+	}
+	opts := IssueOptions{Profile: "short", Metadata: CertificateMetadata{OwnerEmail: "owner@example.com"}}
+	if err := certService.CreateServerCertificateWithOptions("short.example.com", nil, opts); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	if err := certService.CreateServerCertificate("long.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	notices, err := certService.expiryNotices()
+	if err != nil {
+		t.Fatalf("Failed to collect expiry notices: %v", err)
+	}
+	if len(notices) != 1 || notices[0].CommonName != "short.example.com" || notices[0].OwnerEmail != "owner@example.com" {
+		t.Errorf("Expected a notice for the short-lived certificate's owner, got %+v", notices)
+	}
+}
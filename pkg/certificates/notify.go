@@ -0,0 +1,78 @@
+package certificates
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/email"
+)
+
+// expiryCheckInterval is how often certificates are checked for upcoming expiry
+const expiryCheckInterval = 24 * time.Hour
+
+// newEmailService returns an email service for the configured SMTP server
+func (c *CertificateService) newEmailService() *email.EmailService {
+	return email.NewEmailService(c.config.SMTPServer, c.config.SMTPPort, c.config.SMTPUser,
+		c.config.SMTPPassword, c.config.SMTPUseTLS, false)
+}
+
+// expiryNotices returns the unrevoked certificates expiring within
+// ExpiringWindow in the form expiry notifications are sent for
+func (c *CertificateService) expiryNotices() ([]email.CertificateInfo, error) {
+	page, err := c.QueryCertificates(CertificateQuery{Status: StatusExpiring, Sort: SortByNotAfter})
+	if err != nil {
+		return nil, err
+	}
+
+	notices := make([]email.CertificateInfo, 0, len(page.Certificates))
+	for _, cert := range page.Certificates {
+		notices = append(notices, email.CertificateInfo{
+			CommonName:   cert.Name,
+			ExpiryDate:   cert.NotAfter.UTC().Format("2006-01-02"),
+			IsClient:     cert.IsClient,
+			SerialNumber: cert.SerialNumber,
+			OwnerEmail:   cert.OwnerEmail,
+		})
+	}
+	return notices, nil
+}
+
+// notifyExpiringCertificates emails the owners of expiring certificates and
+// the configured recipient
+func (c *CertificateService) notifyExpiringCertificates(emailSvc *email.EmailService) {
+	notices, err := c.expiryNotices()
+	if err != nil {
+		log.Printf("Failed to check certificates for expiry: %v", err)
+		return
+	}
+
+	warningDays := int(ExpiringWindow / (24 * time.Hour))
+	notified := emailSvc.CheckCertificatesExpiry(notices, c.config.EmailFrom, c.config.EmailTo, warningDays)
+	if len(notified) > 0 {
+		log.Printf("Sent expiry notifications for %d certificates", len(notified))
+	}
+}
+
+// StartExpiryNotifier sends expiry notifications once a day until the context
+// is cancelled. It does nothing unless email notifications are enabled.
+func (c *CertificateService) StartExpiryNotifier(ctx context.Context) {
+	if !c.config.EmailEnabled {
+		return
+	}
+
+	emailSvc := c.newEmailService()
+	c.notifyExpiringCertificates(emailSvc)
+
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.notifyExpiringCertificates(emailSvc)
+		}
+	}
+}
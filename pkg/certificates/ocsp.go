@@ -0,0 +1,363 @@
+package certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSP signer modes
+const (
+	OCSPSignerCA        = "ca"
+	OCSPSignerDelegated = "delegated"
+)
+
+// DefaultOCSPResponseValidity is the time between thisUpdate and nextUpdate
+// of an OCSP response
+const DefaultOCSPResponseValidity = 24 * time.Hour
+
+// ocspSignerRenewBefore is how long before expiry the delegated OCSP signing
+// certificate is replaced
+const ocspSignerRenewBefore = 7 * 24 * time.Hour
+
+// ocspCacheSize is the most OCSP responses kept in the cache
+const ocspCacheSize = 10000
+
+// ocspCacheEntry is a signed response kept until it is half way to nextUpdate
+// or the revocation data changes
+type ocspCacheEntry struct {
+	response []byte
+	expires  time.Time
+}
+
+// getOCSPDirectory returns the directory holding the delegated OCSP signer
+func (c *CertificateService) getOCSPDirectory() string {
+	return filepath.Join(c.storage.GetCADirectory(), "ocsp")
+}
+
+// ocspSignerPaths returns the paths to the delegated OCSP signing certificate
+// and key kept in an OCSP directory
+func ocspSignerPaths(dir string) (string, string) {
+	return filepath.Join(dir, "ocsp-signer.pem"), filepath.Join(dir, "ocsp-signer.key")
+}
+
+// ocspSignerMode returns the configured OCSP signer mode
+func (c *CertificateService) ocspSignerMode() string {
+	if c.config.OCSPSigner == OCSPSignerCA {
+		return OCSPSignerCA
+	}
+	return OCSPSignerDelegated
+}
+
+// OCSPResponse answers a DER encoded RFC 6960 OCSP request for a certificate
+// issued by the current issuing CA or a retired CA that still has valid
+// certificates. Malformed requests, requests for other issuers and requests
+// that need a signature while the CA is sealed get an OCSP error response
+// rather than a Go error.
+func (c *CertificateService) OCSPResponse(requestDER []byte) ([]byte, error) {
+	request, err := ocsp.ParseRequest(requestDER)
+	if err != nil {
+		return ocsp.MalformedRequestErrorResponse, nil
+	}
+
+	cacheKey := fmt.Sprintf("%d:%s:%s", request.HashAlgorithm, hex.EncodeToString(request.IssuerKeyHash), formatSerialNumber(request.SerialNumber))
+	now := time.Now()
+
+	c.ocspMutex.Lock()
+	defer c.ocspMutex.Unlock()
+
+	// Cached responses are still served while the CA is sealed
+	if entry, ok := c.ocspCache[cacheKey]; ok {
+		if now.Before(entry.expires) {
+			return entry.response, nil
+		}
+		delete(c.ocspCache, cacheKey)
+	}
+
+	issuer, issuerKey, ocspDir, err := c.ocspIssuer(request)
+	if errors.Is(err, ErrCASealed) {
+		return ocsp.TryLaterErrorResponse, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return ocsp.UnauthorizedErrorResponse, nil
+	}
+
+	template, err := c.ocspStatus(request.SerialNumber)
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = request.SerialNumber
+	template.IssuerHash = request.HashAlgorithm
+	template.ThisUpdate = now.UTC().Truncate(time.Minute)
+	template.NextUpdate = template.ThisUpdate.Add(DefaultOCSPResponseValidity)
+
+	responderCert, responderKey := issuer, issuerKey
+	if c.ocspSignerMode() == OCSPSignerDelegated {
+		responderCert, responderKey, err = c.ocspSigner(ocspDir, issuer, issuerKey)
+		if err != nil {
+			return nil, err
+		}
+		template.Certificate = responderCert
+	}
+
+	response, err := ocsp.CreateResponse(issuer, responderCert, template, responderKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign OCSP response: %w", err)
+	}
+
+	// Unknown serials are not cached: anyone can ask for any serial, and the
+	// answer changes once a certificate with it is issued
+	if template.Status != ocsp.Unknown {
+		c.cacheOCSPResponse(cacheKey, ocspCacheEntry{
+			response: response,
+			expires:  now.Add(DefaultOCSPResponseValidity / 2),
+		}, now)
+	}
+
+	return response, nil
+}
+
+// cacheOCSPResponse stores a response in the OCSP cache. A full cache first
+// drops its expired entries and then, if none expired, the entry closest to
+// expiry. The caller holds ocspMutex.
+func (c *CertificateService) cacheOCSPResponse(cacheKey string, entry ocspCacheEntry, now time.Time) {
+	if c.ocspCache == nil {
+		c.ocspCache = make(map[string]ocspCacheEntry)
+	}
+
+	if _, ok := c.ocspCache[cacheKey]; !ok && len(c.ocspCache) >= ocspCacheSize {
+		for key, cached := range c.ocspCache {
+			if !now.Before(cached.expires) {
+				delete(c.ocspCache, key)
+			}
+		}
+		if len(c.ocspCache) >= ocspCacheSize {
+			var oldestKey string
+			var oldest time.Time
+			for key, cached := range c.ocspCache {
+				if oldestKey == "" || cached.expires.Before(oldest) {
+					oldestKey, oldest = key, cached.expires
+				}
+			}
+			delete(c.ocspCache, oldestKey)
+		}
+	}
+
+	c.ocspCache[cacheKey] = entry
+}
+
+// ocspStatus looks a serial number up in the revocation database, the serial
+// mapping and the certificate index. The responder is public, so no
+// certificate is read for serials none of them know; those are unknown.
+func (c *CertificateService) ocspStatus(serial *big.Int) (ocsp.Response, error) {
+	serialNumber := formatSerialNumber(serial)
+
+	revoked, err := c.GetRevokedCertificates()
+	if err != nil {
+		return ocsp.Response{}, err
+	}
+	for _, entry := range revoked {
+		if entry.SerialNumber == serialNumber {
+			return ocsp.Response{
+				Status:           ocsp.Revoked,
+				RevokedAt:        entry.RevokedAt,
+				RevocationReason: int(entry.Reason),
+			}, nil
+		}
+	}
+
+	inUse, err := c.serialNumberKnown(serialNumber)
+	if err != nil {
+		return ocsp.Response{}, fmt.Errorf("failed to look up serial number: %w", err)
+	}
+	if inUse {
+		return ocsp.Response{Status: ocsp.Good}, nil
+	}
+	return ocsp.Response{Status: ocsp.Unknown}, nil
+}
+
+// invalidateOCSPCache drops all cached OCSP responses
+func (c *CertificateService) invalidateOCSPCache() {
+	c.ocspMutex.Lock()
+	defer c.ocspMutex.Unlock()
+	c.ocspCache = nil
+}
+
+// ocspIssuer finds the CA a request is about and the directory holding its
+// delegated signer. It returns a nil certificate for unknown issuers.
+func (c *CertificateService) ocspIssuer(request *ocsp.Request) (*x509.Certificate, crypto.Signer, string, error) {
+	issuer, issuerKey, err := c.loadIssuer()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	matches, err := ocspIssuerMatches(issuer, request)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if matches {
+		return issuer, issuerKey, c.getOCSPDirectory(), nil
+	}
+
+	retired, err := c.activeRetiredCAs()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	for _, ca := range retired {
+		issuer, issuerKey, err := c.loadRetiredIssuer(ca.ID)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		matches, err := ocspIssuerMatches(issuer, request)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if matches {
+			return issuer, issuerKey, filepath.Join(c.getRetiredCADirectory(ca.ID), retiredOCSPDirectory), nil
+		}
+	}
+
+	return nil, nil, "", nil
+}
+
+// ocspIssuerMatches reports whether a request names the given issuer
+func ocspIssuerMatches(issuer *x509.Certificate, request *ocsp.Request) (bool, error) {
+	if !request.HashAlgorithm.Available() {
+		return false, nil
+	}
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false, fmt.Errorf("failed to parse issuer public key: %w", err)
+	}
+
+	nameHash := request.HashAlgorithm.New()
+	nameHash.Write(issuer.RawSubject)
+	keyHash := request.HashAlgorithm.New()
+	keyHash.Write(spki.PublicKey.RightAlign())
+
+	return bytes.Equal(nameHash.Sum(nil), request.IssuerNameHash) &&
+		bytes.Equal(keyHash.Sum(nil), request.IssuerKeyHash), nil
+}
+
+// ocspSigner returns the delegated OCSP signing certificate and key kept in
+// dir, issuing a new pair when none exists, it is close to expiry or the
+// issuer changed
+func (c *CertificateService) ocspSigner(dir string, issuer *x509.Certificate, issuerKey crypto.Signer) (*x509.Certificate, crypto.Signer, error) {
+	certPath, keyPath := ocspSignerPaths(dir)
+	cert, certErr := readCertificateFile(certPath)
+	key, keyErr := readPrivateKeyFile(keyPath)
+	if certErr == nil && keyErr == nil && cert.CheckSignatureFrom(issuer) == nil {
+		// A signer already capped at the issuer's expiry cannot be improved on
+		if time.Until(cert.NotAfter) > ocspSignerRenewBefore || !cert.NotAfter.Before(issuer.NotAfter) {
+			return cert, key, nil
+		}
+	}
+
+	return c.issueOCSPSigner(dir, issuer, issuerKey)
+}
+
+// issueOCSPSigner issues and stores a new delegated OCSP signing certificate
+// in dir using the ocsp-signing profile
+func (c *CertificateService) issueOCSPSigner(dir string, issuer *x509.Certificate, issuerKey crypto.Signer) (*x509.Certificate, crypto.Signer, error) {
+	// The responder key matches the issuer's algorithm; OCSP responses cannot
+	// be signed with Ed25519, so those issuers get an ECDSA responder
+	issuerSpec, err := keySpecOf(issuer.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	algorithm := issuerSpec.Algorithm
+	if algorithm == KeyAlgorithmEd25519 {
+		algorithm = KeyAlgorithmECDSA
+	}
+	spec, err := ParseKeySpec(string(algorithm), 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := generateKey(spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate OCSP signing key: %w", err)
+	}
+
+	profile := c.ocspSigningProfile(spec.Algorithm)
+
+	serial, err := c.newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   c.config.CAName + " OCSP Responder",
+			Organization: []string{c.config.Organization},
+			Country:      []string{c.config.Country},
+		},
+		BasicConstraintsValid: true,
+	}
+	if err := profile.apply(template, key.Public()); err != nil {
+		return nil, nil, err
+	}
+	if template.NotAfter.After(issuer.NotAfter) {
+		template.NotAfter = issuer.NotAfter
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), issuerKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign OCSP signing certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse OCSP signing certificate: %w", err)
+	}
+
+	certPath, keyPath := ocspSignerPaths(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create OCSP directory: %w", err)
+	}
+	if err := writePrivateKeyFile(keyPath, key); err != nil {
+		return nil, nil, fmt.Errorf("failed to write OCSP signing key: %w", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	if err := writeFileAtomic(certPath, certPEM, 0644); err != nil {
+		return nil, nil, fmt.Errorf("failed to write OCSP signing certificate: %w", err)
+	}
+
+	log.Printf("Issued OCSP signing certificate %s valid until %s", formatSerialNumber(cert.SerialNumber), cert.NotAfter.Format(time.RFC3339))
+	return cert, key, nil
+}
+
+// ocspSigningProfile returns the ocsp-signing profile, or the built-in one if
+// it was removed, no longer grants the OCSPSigning usage or rejects the key
+func (c *CertificateService) ocspSigningProfile(algorithm KeyAlgorithm) *Profile {
+	profile, err := c.GetProfile(ProfileOCSPSigning)
+	if err == nil && containsString(profile.ExtKeyUsage, "OCSPSigning") && profile.allowsAlgorithm(algorithm) == nil {
+		return profile
+	}
+	for _, profile := range DefaultProfiles() {
+		if profile.Name == ProfileOCSPSigning {
+			return &profile
+		}
+	}
+	return nil
+}
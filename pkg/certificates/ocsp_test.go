@@ -0,0 +1,245 @@
+package certificates
+
+import (
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// queryOCSP asks the responder about a certificate and parses the answer
+func queryOCSP(t *testing.T, certService *CertificateService, cert *x509.Certificate) *ocsp.Response {
+	t.Helper()
+
+	issuer, _, err := certService.loadIssuer()
+	if err != nil {
+		t.Fatalf("Failed to load issuer: %v", err)
+	}
+
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		t.Fatalf("Failed to create OCSP request: %v", err)
+	}
+
+	responseDER, err := certService.OCSPResponse(request)
+	if err != nil {
+		t.Fatalf("Failed to get OCSP response: %v", err)
+	}
+
+	response, err := ocsp.ParseResponseForCert(responseDER, cert, issuer)
+	if err != nil {
+		t.Fatalf("Failed to parse OCSP response: %v", err)
+	}
+	return response
+}
+
+func TestOCSPResponder(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if err := certService.CreateServerCertificate("ocsp.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := readCertificateFile(certService.storage.GetCertificatePath("ocsp.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+
+	response := queryOCSP(t, certService, cert)
+	if response.Status != ocsp.Good {
+		t.Errorf("Expected good status, got %d", response.Status)
+	}
+	if response.Certificate == nil {
+		t.Fatal("Expected a delegated responder certificate")
+	}
+	if len(response.Certificate.ExtKeyUsage) != 1 || response.Certificate.ExtKeyUsage[0] != x509.ExtKeyUsageOCSPSigning {
+		t.Errorf("Responder certificate lacks OCSPSigning: %v", response.Certificate.ExtKeyUsage)
+	}
+
+	// The cached good response must not survive a revocation
+	if err := certService.RevokeCertificateWithReason("ocsp.example.com", ReasonKeyCompromise, nil); err != nil {
+		t.Fatalf("Failed to revoke certificate: %v", err)
+	}
+	response = queryOCSP(t, certService, cert)
+	if response.Status != ocsp.Revoked {
+		t.Errorf("Expected revoked status, got %d", response.Status)
+	}
+	if response.RevocationReason != ocsp.KeyCompromise {
+		t.Errorf("Expected keyCompromise, got %d", response.RevocationReason)
+	}
+
+	// A serial the CA never issued is unknown
+	unknown := *cert
+	unknown.SerialNumber = big.NewInt(12345)
+	response = queryOCSP(t, certService, &unknown)
+	if response.Status != ocsp.Unknown {
+		t.Errorf("Expected unknown status, got %d", response.Status)
+	}
+
+	// Garbage gets a malformedRequest error response
+	responseDER, err := certService.OCSPResponse([]byte("not an ocsp request"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := ocsp.ParseResponse(responseDER, nil); err == nil {
+		t.Error("Expected an error response for a malformed request")
+	}
+}
+
+func TestOCSPStatusReadsNoCertificates(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if err := certService.CreateServerCertificate("mapped.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := readCertificateFile(certService.storage.GetCertificatePath("mapped.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	if response := queryOCSP(t, certService, cert); response.Status != ocsp.Good {
+		t.Fatalf("Expected good status for a mapped serial, got %d", response.Status)
+	}
+
+	// Without a mapping or an index entry the certificate files are not
+	// scanned for the serial
+	serialNumber := formatSerialNumber(cert.SerialNumber)
+	if err := os.Remove(filepath.Join(certService.storage.GetBasePath(), "serials", serialNumber)); err != nil {
+		t.Fatalf("Failed to remove serial mapping: %v", err)
+	}
+	certService.indexMutex.Lock()
+	certService.index = newCertificateIndex()
+	certService.indexMutex.Unlock()
+	certService.invalidateOCSPCache()
+	if response := queryOCSP(t, certService, cert); response.Status != ocsp.Unknown {
+		t.Errorf("Expected unknown status without a mapping or index entry, got %d", response.Status)
+	}
+
+	// The index answers for certificates stored without a mapping
+	if _, err := certService.GetAllCertificates(); err != nil {
+		t.Fatalf("Failed to index certificates: %v", err)
+	}
+	certService.invalidateOCSPCache()
+	if response := queryOCSP(t, certService, cert); response.Status != ocsp.Good {
+		t.Errorf("Expected good status for an indexed serial, got %d", response.Status)
+	}
+}
+
+func TestOCSPSignerRotation(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	issuer, issuerKey, err := certService.loadIssuer()
+	if err != nil {
+		t.Fatalf("Failed to load issuer: %v", err)
+	}
+
+	first, _, err := certService.ocspSigner(certService.getOCSPDirectory(), issuer, issuerKey)
+	if err != nil {
+		t.Fatalf("Failed to get OCSP signer: %v", err)
+	}
+	again, _, err := certService.ocspSigner(certService.getOCSPDirectory(), issuer, issuerKey)
+	if err != nil {
+		t.Fatalf("Failed to get OCSP signer: %v", err)
+	}
+	if first.SerialNumber.Cmp(again.SerialNumber) != 0 {
+		t.Error("OCSP signer was reissued while still valid")
+	}
+
+	// A new CA key makes the old signer unusable
+	if err := mockCreateCA(certService); err != nil {
+		t.Fatalf("Failed to replace CA: %v", err)
+	}
+	issuer, issuerKey, err = certService.loadIssuer()
+	if err != nil {
+		t.Fatalf("Failed to load issuer: %v", err)
+	}
+	rotated, _, err := certService.ocspSigner(certService.getOCSPDirectory(), issuer, issuerKey)
+	if err != nil {
+		t.Fatalf("Failed to get OCSP signer: %v", err)
+	}
+	if rotated.SerialNumber.Cmp(first.SerialNumber) == 0 {
+		t.Error("OCSP signer was not rotated after the CA changed")
+	}
+	if err := rotated.CheckSignatureFrom(issuer); err != nil {
+		t.Errorf("Rotated signer does not chain to the new CA: %v", err)
+	}
+}
+
+func TestOCSPSignedByCA(t *testing.T) {
+	certService := newTestCertificateService(t)
+	certService.config.OCSPSigner = OCSPSignerCA
+
+	if err := certService.CreateServerCertificate("direct.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := readCertificateFile(certService.storage.GetCertificatePath("direct.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+
+	response := queryOCSP(t, certService, cert)
+	if response.Status != ocsp.Good {
+		t.Errorf("Expected good status, got %d", response.Status)
+	}
+	if response.Certificate != nil {
+		t.Error("CA-signed responses should not embed a responder certificate")
+	}
+}
+
+func TestOCSPCache(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if err := certService.CreateServerCertificate("cached.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := readCertificateFile(certService.storage.GetCertificatePath("cached.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+
+	// Unknown serials are answered but not cached
+	unknown := *cert
+	unknown.SerialNumber = big.NewInt(12345)
+	if response := queryOCSP(t, certService, &unknown); response.Status != ocsp.Unknown {
+		t.Fatalf("Expected unknown status, got %d", response.Status)
+	}
+	if len(certService.ocspCache) != 0 {
+		t.Errorf("Expected no cached response for an unknown serial, got %d", len(certService.ocspCache))
+	}
+	if response := queryOCSP(t, certService, cert); response.Status != ocsp.Good {
+		t.Fatalf("Expected good status, got %d", response.Status)
+	}
+	if len(certService.ocspCache) != 1 {
+		t.Errorf("Expected the good response to be cached, got %d entries", len(certService.ocspCache))
+	}
+
+	// A full cache drops expired entries first
+	now := time.Now()
+	certService.invalidateOCSPCache()
+	certService.ocspMutex.Lock()
+	defer certService.ocspMutex.Unlock()
+	certService.cacheOCSPResponse("expired", ocspCacheEntry{expires: now.Add(-time.Minute)}, now)
+	certService.cacheOCSPResponse("soonest", ocspCacheEntry{expires: now.Add(time.Minute)}, now)
+	for i := len(certService.ocspCache); i < ocspCacheSize; i++ {
+		certService.cacheOCSPResponse(fmt.Sprintf("fresh-%d", i), ocspCacheEntry{expires: now.Add(time.Hour)}, now)
+	}
+	certService.cacheOCSPResponse("new", ocspCacheEntry{expires: now.Add(time.Hour)}, now)
+	if _, ok := certService.ocspCache["expired"]; ok {
+		t.Error("Expected the expired entry to be pruned")
+	}
+	if _, ok := certService.ocspCache["soonest"]; !ok {
+		t.Error("Expected unexpired entries to be kept while expired ones are pruned")
+	}
+
+	// Without expired entries the one closest to expiry is evicted
+	certService.cacheOCSPResponse("newer", ocspCacheEntry{expires: now.Add(time.Hour)}, now)
+	if _, ok := certService.ocspCache["soonest"]; ok {
+		t.Error("Expected the entry closest to expiry to be evicted")
+	}
+	if len(certService.ocspCache) != ocspCacheSize {
+		t.Errorf("Expected the cache to hold %d entries, got %d", ocspCacheSize, len(certService.ocspCache))
+	}
+}
@@ -0,0 +1,537 @@
+package certificates
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Built-in profiles used when no profile is requested
+const (
+	ProfileServer = "server"
+	ProfileClient = "client"
+)
+
+// ProfileOCSPSigning is the profile used for the delegated OCSP responder
+const ProfileOCSPSigning = "ocsp-signing"
+
+// MaxProfileValidityDays caps the validity a profile may request
+const MaxProfileValidityDays = 3650
+
+var (
+	// oidMustStaple is the TLS feature extension (RFC 7633)
+	oidMustStaple = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+	// mustStapleValue requests the status_request TLS feature
+	mustStapleValue = []byte{0x30, 0x03, 0x02, 0x01, 0x05}
+	// oidCertificateExtensionArc holds the X.509 extensions the profile
+	// fields already control
+	oidCertificateExtensionArc = asn1.ObjectIdentifier{2, 5, 29}
+)
+
+var profileNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+var keyUsageNames = map[string]x509.KeyUsage{
+	"digitalSignature":  x509.KeyUsageDigitalSignature,
+	"contentCommitment": x509.KeyUsageContentCommitment,
+	"keyEncipherment":   x509.KeyUsageKeyEncipherment,
+	"dataEncipherment":  x509.KeyUsageDataEncipherment,
+	"keyAgreement":      x509.KeyUsageKeyAgreement,
+}
+
+var extKeyUsageNames = map[string]x509.ExtKeyUsage{
+	"serverAuth":      x509.ExtKeyUsageServerAuth,
+	"clientAuth":      x509.ExtKeyUsageClientAuth,
+	"codeSigning":     x509.ExtKeyUsageCodeSigning,
+	"emailProtection": x509.ExtKeyUsageEmailProtection,
+	"timeStamping":    x509.ExtKeyUsageTimeStamping,
+	"OCSPSigning":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// ProfileSubject holds subject fields added to certificates issued with a profile
+type ProfileSubject struct {
+	Organization       string `json:"organization,omitempty"`
+	OrganizationalUnit string `json:"organizational_unit,omitempty"`
+	Country            string `json:"country,omitempty"`
+	Province           string `json:"province,omitempty"`
+	Locality           string `json:"locality,omitempty"`
+}
+
+// ProfileExtension is a custom extension added to certificates issued with a
+// profile. Value is the base64 encoded DER extension value.
+type ProfileExtension struct {
+	OID      string `json:"oid"`
+	Critical bool   `json:"critical,omitempty"`
+	Value    string `json:"value"`
+}
+
+// Profile is a named certificate template controlling validity, usages,
+// subject fields, allowed key types and extensions
+type Profile struct {
+	Name            string             `json:"name"`
+	Description     string             `json:"description,omitempty"`
+	ValidityDays    int                `json:"validity_days"`
+	KeyUsage        []string           `json:"key_usage,omitempty"`
+	ExtKeyUsage     []string           `json:"ext_key_usage"`
+	Subject         ProfileSubject     `json:"subject"`
+	AllowedKeyTypes []KeyAlgorithm     `json:"allowed_key_types,omitempty"`
+	MustStaple      bool               `json:"must_staple"`
+	Extensions      []ProfileExtension `json:"extensions,omitempty"`
+	// AutoRenew opts certificates issued with the profile into automatic renewal
+	AutoRenew *RenewalPolicy `json:"auto_renew,omitempty"`
+	// RevokeSuperseded revokes certificates replaced by renewal after an overlap window
+	RevokeSuperseded *SupersedePolicy `json:"revoke_superseded,omitempty"`
+}
+
+// profileDatabase is the on-disk representation of the profile store
+type profileDatabase struct {
+	Profiles []Profile `json:"profiles"`
+}
+
+// DefaultProfiles returns the profiles a new CA starts with
+func DefaultProfiles() []Profile {
+	return []Profile{
+		{
+			Name:         ProfileServer,
+			Description:  "Default TLS server certificate",
+			ValidityDays: 365,
+			ExtKeyUsage:  []string{"serverAuth"},
+		},
+		{
+			Name:         ProfileClient,
+			Description:  "Default client certificate",
+			ValidityDays: 365,
+			KeyUsage:     []string{"digitalSignature"},
+			ExtKeyUsage:  []string{"clientAuth", "emailProtection"},
+		},
+		{
+			Name:         "web-server-90d",
+			Description:  "Short-lived TLS server certificate",
+			ValidityDays: 90,
+			ExtKeyUsage:  []string{"serverAuth"},
+		},
+		{
+			Name:         "mtls-client-30d",
+			Description:  "Short-lived mutual TLS client certificate",
+			ValidityDays: 30,
+			KeyUsage:     []string{"digitalSignature"},
+			ExtKeyUsage:  []string{"clientAuth"},
+		},
+		{
+			Name:            "code-signing",
+			Description:     "Code signing certificate",
+			ValidityDays:    365,
+			KeyUsage:        []string{"digitalSignature"},
+			ExtKeyUsage:     []string{"codeSigning"},
+			AllowedKeyTypes: []KeyAlgorithm{KeyAlgorithmRSA, KeyAlgorithmECDSA},
+		},
+		{
+			Name:         ProfileOCSPSigning,
+			Description:  "Delegated OCSP responder certificate",
+			ValidityDays: 30,
+			KeyUsage:     []string{"digitalSignature"},
+			ExtKeyUsage:  []string{"OCSPSigning"},
+			Extensions: []ProfileExtension{
+				// id-pkix-ocsp-nocheck with a NULL value
+				{OID: "1.3.6.1.5.5.7.48.1.5", Value: "BQA="},
+			},
+		},
+	}
+}
+
+// Validate checks that a profile is well formed
+func (p *Profile) Validate() error {
+	if !profileNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("%w: name must be 1-64 lowercase letters, digits, '.', '_' or '-'", ErrInvalidProfile)
+	}
+	if p.ValidityDays < 1 || p.ValidityDays > MaxProfileValidityDays {
+		return fmt.Errorf("%w: validity_days must be between 1 and %d", ErrInvalidProfile, MaxProfileValidityDays)
+	}
+	if _, err := p.keyUsage(); err != nil {
+		return err
+	}
+	if _, err := p.extKeyUsage(); err != nil {
+		return err
+	}
+	if p.Subject.Country != "" && len(p.Subject.Country) != 2 {
+		return fmt.Errorf("%w: country must be a two-letter code", ErrInvalidProfile)
+	}
+	for _, algorithm := range p.AllowedKeyTypes {
+		if _, err := ParseKeySpec(string(algorithm), 0); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+	}
+	if _, err := p.extraExtensions(); err != nil {
+		return err
+	}
+	if p.AutoRenew != nil {
+		if err := p.AutoRenew.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+	}
+	if p.RevokeSuperseded != nil {
+		if err := p.RevokeSuperseded.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+	}
+	return nil
+}
+
+// keyUsage returns the key usage bits named by the profile
+func (p *Profile) keyUsage() (x509.KeyUsage, error) {
+	var usage x509.KeyUsage
+	for _, name := range p.KeyUsage {
+		bit, ok := keyUsageNames[name]
+		if !ok {
+			return 0, fmt.Errorf("%w: unknown key usage %q", ErrInvalidProfile, name)
+		}
+		usage |= bit
+	}
+	return usage, nil
+}
+
+// extKeyUsage returns the extended key usages named by the profile
+func (p *Profile) extKeyUsage() ([]x509.ExtKeyUsage, error) {
+	if len(p.ExtKeyUsage) == 0 {
+		return nil, fmt.Errorf("%w: at least one extended key usage is required", ErrInvalidProfile)
+	}
+	usages := make([]x509.ExtKeyUsage, 0, len(p.ExtKeyUsage))
+	for _, name := range p.ExtKeyUsage {
+		usage, ok := extKeyUsageNames[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown extended key usage %q", ErrInvalidProfile, name)
+		}
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
+
+// extraExtensions returns the must-staple and custom extensions of the profile
+func (p *Profile) extraExtensions() ([]pkix.Extension, error) {
+	var extensions []pkix.Extension
+	if p.MustStaple {
+		extensions = append(extensions, pkix.Extension{Id: oidMustStaple, Value: mustStapleValue})
+	}
+
+	for _, ext := range p.Extensions {
+		oid, err := parseOID(ext.OID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid extension OID %q", ErrInvalidProfile, ext.OID)
+		}
+		if len(oid) > len(oidCertificateExtensionArc) && oid[:len(oidCertificateExtensionArc)].Equal(oidCertificateExtensionArc) {
+			return nil, fmt.Errorf("%w: extension %s is controlled by other profile fields", ErrInvalidProfile, ext.OID)
+		}
+		if oid.Equal(oidMustStaple) {
+			return nil, fmt.Errorf("%w: use must_staple instead of extension %s", ErrInvalidProfile, ext.OID)
+		}
+		value, err := base64.StdEncoding.DecodeString(ext.Value)
+		if err != nil || len(value) == 0 {
+			return nil, fmt.Errorf("%w: extension %s value must be base64 encoded DER", ErrInvalidProfile, ext.OID)
+		}
+		extensions = append(extensions, pkix.Extension{Id: oid, Critical: ext.Critical, Value: value})
+	}
+
+	return extensions, nil
+}
+
+// allowsAlgorithm reports whether the profile permits a key algorithm
+func (p *Profile) allowsAlgorithm(algorithm KeyAlgorithm) error {
+	if len(p.AllowedKeyTypes) == 0 {
+		return nil
+	}
+	for _, allowed := range p.AllowedKeyTypes {
+		if allowed == algorithm {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: profile %s does not allow %s keys", ErrKeyTypeNotAllowed, p.Name, algorithm)
+}
+
+// apply sets validity, usages, subject fields and extensions on a template.
+// The common name and subject alternative names are left to the caller.
+func (p *Profile) apply(template *x509.Certificate, pub crypto.PublicKey) error {
+	spec, err := keySpecOf(pub)
+	if err != nil {
+		return err
+	}
+	if err := p.allowsAlgorithm(spec.Algorithm); err != nil {
+		return err
+	}
+
+	keyUsage, err := p.keyUsage()
+	if err != nil {
+		return err
+	}
+	if len(p.KeyUsage) == 0 {
+		keyUsage = leafKeyUsage(pub)
+	} else if _, isRSA := pub.(*rsa.PublicKey); !isRSA {
+		// Key encipherment only applies to RSA keys
+		keyUsage &^= x509.KeyUsageKeyEncipherment
+	}
+
+	extKeyUsage, err := p.extKeyUsage()
+	if err != nil {
+		return err
+	}
+
+	extensions, err := p.extraExtensions()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template.NotBefore = now
+	template.NotAfter = now.AddDate(0, 0, p.ValidityDays)
+	template.KeyUsage = keyUsage
+	template.ExtKeyUsage = extKeyUsage
+	template.ExtraExtensions = extensions
+
+	if p.Subject.Organization != "" {
+		template.Subject.Organization = []string{p.Subject.Organization}
+	}
+	if p.Subject.OrganizationalUnit != "" {
+		template.Subject.OrganizationalUnit = []string{p.Subject.OrganizationalUnit}
+	}
+	if p.Subject.Country != "" {
+		template.Subject.Country = []string{p.Subject.Country}
+	}
+	if p.Subject.Province != "" {
+		template.Subject.Province = []string{p.Subject.Province}
+	}
+	if p.Subject.Locality != "" {
+		template.Subject.Locality = []string{p.Subject.Locality}
+	}
+
+	return nil
+}
+
+// parseOID parses a dotted decimal object identifier
+func parseOID(value string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID: %s", value)
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid OID: %s", value)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
+
+// getProfileDatabasePath returns the path to the profile store
+func (c *CertificateService) getProfileDatabasePath() string {
+	return filepath.Join(c.storage.GetCADirectory(), "profiles.json")
+}
+
+// getCertificateProfilePath returns the file recording the profile a certificate was issued with
+func (c *CertificateService) getCertificateProfilePath(name string) string {
+	return filepath.Join(c.storage.GetCertificateDirectory(name), "profile")
+}
+
+// loadProfileDatabase reads the profile store, starting from the default
+// profiles when none has been saved yet
+func (c *CertificateService) loadProfileDatabase() (*profileDatabase, error) {
+	data, err := os.ReadFile(c.getProfileDatabasePath())
+	if os.IsNotExist(err) {
+		return &profileDatabase{Profiles: DefaultProfiles()}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile database: %w", err)
+	}
+
+	var db profileDatabase
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, fmt.Errorf("failed to parse profile database: %w", err)
+	}
+
+	return &db, nil
+}
+
+// saveProfileDatabase writes the profile store atomically
+func (c *CertificateService) saveProfileDatabase(db *profileDatabase) error {
+	if err := os.MkdirAll(c.storage.GetCADirectory(), 0755); err != nil {
+		return fmt.Errorf("failed to create CA directory: %w", err)
+	}
+
+	sort.Slice(db.Profiles, func(i, j int) bool {
+		return db.Profiles[i].Name < db.Profiles[j].Name
+	})
+
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal profile database: %w", err)
+	}
+
+	if err := writeFileAtomic(c.getProfileDatabasePath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write profile database: %w", err)
+	}
+
+	return nil
+}
+
+// ListProfiles returns all certificate profiles
+func (c *CertificateService) ListProfiles() ([]Profile, error) {
+	c.profileMutex.Lock()
+	defer c.profileMutex.Unlock()
+
+	db, err := c.loadProfileDatabase()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.Profiles, nil
+}
+
+// GetProfile returns a certificate profile by name
+func (c *CertificateService) GetProfile(name string) (*Profile, error) {
+	c.profileMutex.Lock()
+	defer c.profileMutex.Unlock()
+
+	return c.getProfile(name)
+}
+
+// getProfile looks up a profile; the caller must hold profileMutex
+func (c *CertificateService) getProfile(name string) (*Profile, error) {
+	db, err := c.loadProfileDatabase()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range db.Profiles {
+		if db.Profiles[i].Name == name {
+			return &db.Profiles[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+}
+
+// CreateProfile adds a new certificate profile
+func (c *CertificateService) CreateProfile(profile Profile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+
+	c.profileMutex.Lock()
+	defer c.profileMutex.Unlock()
+
+	db, err := c.loadProfileDatabase()
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range db.Profiles {
+		if existing.Name == profile.Name {
+			return fmt.Errorf("%w: %s", ErrProfileExists, profile.Name)
+		}
+	}
+
+	db.Profiles = append(db.Profiles, profile)
+	return c.saveProfileDatabase(db)
+}
+
+// UpdateProfile replaces an existing certificate profile. Certificates already
+// issued keep their contents; the new settings apply from their next renewal.
+func (c *CertificateService) UpdateProfile(profile Profile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+
+	c.profileMutex.Lock()
+	defer c.profileMutex.Unlock()
+
+	db, err := c.loadProfileDatabase()
+	if err != nil {
+		return err
+	}
+
+	for i := range db.Profiles {
+		if db.Profiles[i].Name == profile.Name {
+			db.Profiles[i] = profile
+			return c.saveProfileDatabase(db)
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrProfileNotFound, profile.Name)
+}
+
+// DeleteProfile removes a certificate profile. The built-in server and client
+// profiles cannot be deleted.
+func (c *CertificateService) DeleteProfile(name string) error {
+	if name == ProfileServer || name == ProfileClient {
+		return fmt.Errorf("%w: %s", ErrProfileProtected, name)
+	}
+
+	c.profileMutex.Lock()
+	defer c.profileMutex.Unlock()
+
+	db, err := c.loadProfileDatabase()
+	if err != nil {
+		return err
+	}
+
+	for i := range db.Profiles {
+		if db.Profiles[i].Name == name {
+			db.Profiles = append(db.Profiles[:i], db.Profiles[i+1:]...)
+			return c.saveProfileDatabase(db)
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+}
+
+// resolveProfile returns the named profile, or the built-in default for the
+// certificate type when no name is given
+func (c *CertificateService) resolveProfile(name string, isClient bool) (*Profile, error) {
+	if name == "" {
+		name = ProfileServer
+		if isClient {
+			name = ProfileClient
+		}
+	}
+	return c.GetProfile(name)
+}
+
+// recordCertificateProfile stores the profile a certificate was issued with
+func (c *CertificateService) recordCertificateProfile(certName, profileName string) error {
+	if err := os.WriteFile(c.getCertificateProfilePath(certName), []byte(profileName), 0644); err != nil {
+		return fmt.Errorf("failed to record certificate profile: %w", err)
+	}
+	return nil
+}
+
+// certificateProfile returns the profile to renew a certificate with: the one
+// it was issued with, or the default for its type if that profile is gone
+func (c *CertificateService) certificateProfile(certName string, isClient bool) (*Profile, error) {
+	data, err := os.ReadFile(c.getCertificateProfilePath(certName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read certificate profile: %w", err)
+	}
+
+	name := strings.TrimSpace(string(data))
+	if name != "" {
+		profile, err := c.resolveProfile(name, isClient)
+		if err == nil {
+			return profile, nil
+		}
+		log.Printf("Profile %s of certificate %s is unavailable, using the default: %v", name, certName, err)
+	}
+
+	return c.resolveProfile("", isClient)
+}
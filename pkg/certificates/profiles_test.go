@@ -0,0 +1,151 @@
+package certificates
+
+import (
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProfileValidate(t *testing.T) {
+	for _, profile := range DefaultProfiles() {
+		if err := profile.Validate(); err != nil {
+			t.Errorf("Default profile %s is invalid: %v", profile.Name, err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		profile Profile
+	}{
+		{"bad name", Profile{Name: "Bad Name", ValidityDays: 30, ExtKeyUsage: []string{"serverAuth"}}},
+		{"zero validity", Profile{Name: "p", ExtKeyUsage: []string{"serverAuth"}}},
+		{"no EKU", Profile{Name: "p", ValidityDays: 30}},
+		{"unknown EKU", Profile{Name: "p", ValidityDays: 30, ExtKeyUsage: []string{"anything"}}},
+		{"unknown KU", Profile{Name: "p", ValidityDays: 30, KeyUsage: []string{"certSign"}, ExtKeyUsage: []string{"serverAuth"}}},
+		{"bad country", Profile{Name: "p", ValidityDays: 30, ExtKeyUsage: []string{"serverAuth"}, Subject: ProfileSubject{Country: "USA"}}},
+		{"bad key type", Profile{Name: "p", ValidityDays: 30, ExtKeyUsage: []string{"serverAuth"}, AllowedKeyTypes: []KeyAlgorithm{"dsa"}}},
+		{"reserved OID", Profile{Name: "p", ValidityDays: 30, ExtKeyUsage: []string{"serverAuth"}, Extensions: []ProfileExtension{{OID: "2.5.29.19", Value: "MAA="}}}},
+		{"bad value", Profile{Name: "p", ValidityDays: 30, ExtKeyUsage: []string{"serverAuth"}, Extensions: []ProfileExtension{{OID: "1.2.3.4", Value: "%%"}}}},
+	}
+
+	for _, tt := range tests {
+		if err := tt.profile.Validate(); !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("%s: expected ErrInvalidProfile, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestProfileCRUD(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	profiles, err := certService.ListProfiles()
+	if err != nil {
+		t.Fatalf("Failed to list profiles: %v", err)
+	}
+	if len(profiles) != len(DefaultProfiles()) {
+		t.Errorf("Expected %d default profiles, got %d", len(DefaultProfiles()), len(profiles))
+	}
+
+	profile := Profile{
+		Name:         "internal-api",
+		ValidityDays: 14,
+		ExtKeyUsage:  []string{"serverAuth", "clientAuth"},
+	}
+	if err := certService.CreateProfile(profile); err != nil {
+		t.Fatalf("Failed to create profile: %v", err)
+	}
+	if err := certService.CreateProfile(profile); !errors.Is(err, ErrProfileExists) {
+		t.Errorf("Expected ErrProfileExists, got %v", err)
+	}
+
+	profile.ValidityDays = 7
+	if err := certService.UpdateProfile(profile); err != nil {
+		t.Fatalf("Failed to update profile: %v", err)
+	}
+	stored, err := certService.GetProfile("internal-api")
+	if err != nil {
+		t.Fatalf("Failed to get profile: %v", err)
+	}
+	if stored.ValidityDays != 7 {
+		t.Errorf("Expected updated validity of 7 days, got %d", stored.ValidityDays)
+	}
+
+	if err := certService.UpdateProfile(Profile{Name: "missing", ValidityDays: 1, ExtKeyUsage: []string{"serverAuth"}}); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("Expected ErrProfileNotFound, got %v", err)
+	}
+
+	if err := certService.DeleteProfile(ProfileServer); !errors.Is(err, ErrProfileProtected) {
+		t.Errorf("Expected ErrProfileProtected, got %v", err)
+	}
+	if err := certService.DeleteProfile("internal-api"); err != nil {
+		t.Fatalf("Failed to delete profile: %v", err)
+	}
+	if _, err := certService.GetProfile("internal-api"); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("Expected ErrProfileNotFound after delete, got %v", err)
+	}
+}
+
+func TestIssueWithProfile(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	profile := Profile{
+		Name:            "stapled-web",
+		ValidityDays:    90,
+		ExtKeyUsage:     []string{"serverAuth"},
+		Subject:         ProfileSubject{Organization: "Web Team", Country: "DE"},
+		AllowedKeyTypes: []KeyAlgorithm{KeyAlgorithmECDSA},
+		MustStaple:      true,
+		Extensions:      []ProfileExtension{{OID: "1.3.6.1.4.1.55555.1", Value: "DAVoZWxsbw=="}},
+	}
+	if err := certService.CreateProfile(profile); err != nil {
+		t.Fatalf("Failed to create profile: %v", err)
+	}
+
+	if err := certService.CreateServerCertificateWithOptions("rsa.example.com", nil, IssueOptions{Profile: "stapled-web"}); !errors.Is(err, ErrKeyTypeNotAllowed) {
+		t.Errorf("Expected ErrKeyTypeNotAllowed for an RSA key, got %v", err)
+	}
+	if err := certService.CreateServerCertificateWithOptions("web.example.com", nil, IssueOptions{Profile: "missing"}); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("Expected ErrProfileNotFound, got %v", err)
+	}
+
+	if err := certService.CreateServerCertificateWithOptions("web.example.com", nil, IssueOptions{KeyAlgorithm: KeyAlgorithmECDSA, Profile: "stapled-web"}); err != nil {
+		t.Fatalf("Failed to create certificate with profile: %v", err)
+	}
+
+	checkCertificate := func() {
+		cert, err := readCertificateFile(certService.storage.GetCertificatePath("web.example.com"))
+		if err != nil {
+			t.Fatalf("Failed to read certificate: %v", err)
+		}
+
+		validity := cert.NotAfter.Sub(cert.NotBefore)
+		if validity < 89*24*time.Hour || validity > 91*24*time.Hour {
+			t.Errorf("Expected 90 day validity, got %v", validity)
+		}
+		if len(cert.Subject.Organization) != 1 || cert.Subject.Organization[0] != "Web Team" {
+			t.Errorf("Unexpected organization: %v", cert.Subject.Organization)
+		}
+		if cert.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+			t.Errorf("ECDSA certificate must not assert keyEncipherment")
+		}
+
+		found := map[string]bool{}
+		for _, ext := range cert.Extensions {
+			found[ext.Id.String()] = true
+		}
+		if !found[oidMustStaple.String()] {
+			t.Errorf("Must-staple extension missing")
+		}
+		if !found["1.3.6.1.4.1.55555.1"] {
+			t.Errorf("Custom extension missing")
+		}
+	}
+	checkCertificate()
+
+	// Renewal keeps using the profile
+	if err := certService.RenewServerCertificate("web.example.com"); err != nil {
+		t.Fatalf("Failed to renew certificate: %v", err)
+	}
+	checkCertificate()
+}
@@ -0,0 +1,424 @@
+package certificates
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/database"
+)
+
+// ExpiringWindow is how long before expiry a certificate counts as expiring
+const ExpiringWindow = 30 * 24 * time.Hour
+
+// Certificate statuses; a certificate has exactly one of them
+const (
+	StatusActive   = database.StatusActive
+	StatusExpiring = database.StatusExpiring
+	StatusExpired  = database.StatusExpired
+	StatusRevoked  = database.StatusRevoked
+)
+
+// Sort keys for certificate queries
+const (
+	SortByName         = "name"
+	SortByCommonName   = "common_name"
+	SortBySerialNumber = "serial_number"
+	SortByNotBefore    = "not_before"
+	SortByNotAfter     = "not_after"
+)
+
+// MaxQueryLimit caps the page size of a certificate query
+const MaxQueryLimit = 1000
+
+// CertificateQuery filters, sorts and pages the certificate inventory. Empty
+// fields match any certificate.
+type CertificateQuery struct {
+	// Status is active, expiring, expired or revoked
+	Status string
+	// Type is client or server
+	Type string
+	// Search is a case-insensitive substring of the name, common name or a SAN
+	Search       string
+	SerialNumber string
+	// Fingerprint is a SHA-1 or SHA-256 fingerprint, with or without colons
+	Fingerprint string
+	// Issuer is a case-insensitive substring of the issuer DN
+	Issuer string
+	// ExpiresAfter and ExpiresBefore bound the expiry date
+	ExpiresAfter  time.Time
+	ExpiresBefore time.Time
+	// Tags are "key" or "key=value" label terms that must all match
+	Tags    []string
+	Profile string
+
+	// Sort is one of the SortBy keys; certificates with equal keys are
+	// ordered by name
+	Sort       string
+	Descending bool
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+	// Limit is the page size; zero returns all matching certificates
+	Limit int
+}
+
+// CertificatePage is one page of a certificate query
+type CertificatePage struct {
+	Certificates []Certificate `json:"certificates"`
+	// Total is the number of matching certificates across all pages
+	Total int `json:"total"`
+	// NextCursor continues the query after this page; it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// queryCursor is the position after the last certificate of a page. The sort
+// order is included so a cursor cannot be reused with a different one.
+type queryCursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d,omitempty"`
+	Value      string `json:"v"`
+	Name       string `json:"n"`
+}
+
+// StatusOf returns the status of a certificate at a point in time
+func StatusOf(cert Certificate, now time.Time) string {
+	switch {
+	case cert.Revoked:
+		return StatusRevoked
+	case cert.NotAfter.Before(now):
+		return StatusExpired
+	case cert.NotAfter.Before(now.Add(ExpiringWindow)):
+		return StatusExpiring
+	default:
+		return StatusActive
+	}
+}
+
+// normalize validates the query and brings its values into the form they are
+// indexed in
+func (q *CertificateQuery) normalize() error {
+	switch q.Status {
+	case "", StatusActive, StatusExpiring, StatusExpired, StatusRevoked:
+	default:
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidQuery, q.Status)
+	}
+	switch q.Type {
+	case "", "client", "server":
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidQuery, q.Type)
+	}
+
+	if q.Sort == "" {
+		q.Sort = SortByName
+	}
+	switch q.Sort {
+	case SortByName, SortByCommonName, SortBySerialNumber, SortByNotBefore, SortByNotAfter:
+	default:
+		return fmt.Errorf("%w: unknown sort key %q", ErrInvalidQuery, q.Sort)
+	}
+
+	if q.Limit < 0 {
+		return fmt.Errorf("%w: negative limit", ErrInvalidQuery)
+	}
+	if q.Limit > MaxQueryLimit {
+		q.Limit = MaxQueryLimit
+	}
+
+	q.SerialNumber = strings.ToUpper(strings.ReplaceAll(q.SerialNumber, ":", ""))
+	if q.Fingerprint != "" {
+		fingerprint, err := normalizeFingerprint(q.Fingerprint)
+		if err != nil {
+			return err
+		}
+		q.Fingerprint = fingerprint
+	}
+	for _, tag := range q.Tags {
+		if strings.HasPrefix(tag, "=") || strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("%w: invalid tag %q", ErrInvalidQuery, tag)
+		}
+	}
+
+	if q.Cursor != "" {
+		if _, err := q.decodeCursor(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeFingerprint returns a hex SHA-1 or SHA-256 fingerprint in the
+// upper case, colon separated form of the certificate metadata
+func normalizeFingerprint(fingerprint string) (string, error) {
+	digest, err := hex.DecodeString(strings.NewReplacer(":", "", " ", "").Replace(fingerprint))
+	if err != nil || (len(digest) != 20 && len(digest) != 32) {
+		return "", fmt.Errorf("%w: fingerprint must be a hex SHA-1 or SHA-256 digest", ErrInvalidQuery)
+	}
+	return formatFingerprint(digest), nil
+}
+
+// matches reports whether a certificate satisfies the filters of the query
+func (q *CertificateQuery) matches(cert Certificate, now time.Time) bool {
+	if q.Status != "" && StatusOf(cert, now) != q.Status {
+		return false
+	}
+	if q.Type != "" && cert.IsClient != (q.Type == "client") {
+		return false
+	}
+	if q.Search != "" && !certificateContains(cert, strings.ToLower(q.Search)) {
+		return false
+	}
+	if q.SerialNumber != "" && cert.SerialNumber != q.SerialNumber {
+		return false
+	}
+	if q.Fingerprint != "" && cert.FingerprintSHA256 != q.Fingerprint && cert.FingerprintSHA1 != q.Fingerprint {
+		return false
+	}
+	if q.Issuer != "" && !strings.Contains(strings.ToLower(cert.Issuer), strings.ToLower(q.Issuer)) {
+		return false
+	}
+	if !q.ExpiresAfter.IsZero() && cert.NotAfter.Before(q.ExpiresAfter) {
+		return false
+	}
+	if !q.ExpiresBefore.IsZero() && !cert.NotAfter.Before(q.ExpiresBefore) {
+		return false
+	}
+	if q.Profile != "" && cert.Profile != q.Profile {
+		return false
+	}
+	for _, tag := range q.Tags {
+		key, value, hasValue := strings.Cut(tag, "=")
+		labelValue, ok := cert.Labels[key]
+		if !ok || (hasValue && labelValue != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// certificateContains reports whether the name, common name or a SAN of a
+// certificate contains a lower case substring
+func certificateContains(cert Certificate, search string) bool {
+	for _, value := range subjectAltNameValues(cert) {
+		if strings.Contains(strings.ToLower(value), search) {
+			return true
+		}
+	}
+	return strings.Contains(strings.ToLower(cert.Name), search) ||
+		strings.Contains(strings.ToLower(cert.CommonName), search)
+}
+
+// subjectAltNameValues returns the SANs of all types of a certificate
+func subjectAltNameValues(cert Certificate) []string {
+	values := make([]string, 0, len(cert.DNSNames)+len(cert.IPAddresses)+len(cert.URIs)+len(cert.EmailAddresses))
+	values = append(values, cert.DNSNames...)
+	values = append(values, cert.IPAddresses...)
+	values = append(values, cert.URIs...)
+	return append(values, cert.EmailAddresses...)
+}
+
+// sortValue returns the sort key of a certificate in its cursor form
+func sortValue(cert Certificate, key string) string {
+	switch key {
+	case SortByCommonName:
+		return cert.CommonName
+	case SortBySerialNumber:
+		return cert.SerialNumber
+	case SortByNotBefore:
+		return cert.NotBefore.UTC().Format(time.RFC3339Nano)
+	case SortByNotAfter:
+		return cert.NotAfter.UTC().Format(time.RFC3339Nano)
+	default:
+		return cert.Name
+	}
+}
+
+// compareCertificates orders two certificates by a sort key and then by name
+func compareCertificates(a, b Certificate, key string) int {
+	var result int
+	switch key {
+	case SortByNotBefore:
+		result = a.NotBefore.Compare(b.NotBefore)
+	case SortByNotAfter:
+		result = a.NotAfter.Compare(b.NotAfter)
+	default:
+		result = strings.Compare(sortValue(a, key), sortValue(b, key))
+	}
+	if result == 0 {
+		result = strings.Compare(a.Name, b.Name)
+	}
+	return result
+}
+
+// encodeCursor returns the cursor continuing a query after a certificate
+func (q *CertificateQuery) encodeCursor(last Certificate) string {
+	data, _ := json.Marshal(queryCursor{
+		Sort:       q.Sort,
+		Descending: q.Descending,
+		Value:      sortValue(last, q.Sort),
+		Name:       last.Name,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the position encoded in the query cursor as a
+// certificate holding the sort key and name
+func (q *CertificateQuery) decodeCursor() (Certificate, error) {
+	var cursor queryCursor
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil || cursor.Name == "" {
+		return Certificate{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if cursor.Sort != q.Sort || cursor.Descending != q.Descending {
+		return Certificate{}, fmt.Errorf("%w: cursor belongs to a different sort order", ErrInvalidQuery)
+	}
+
+	position := Certificate{Name: cursor.Name}
+	switch q.Sort {
+	case SortByCommonName:
+		position.CommonName = cursor.Value
+	case SortBySerialNumber:
+		position.SerialNumber = cursor.Value
+	case SortByNotBefore, SortByNotAfter:
+		value, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return Certificate{}, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+		}
+		position.NotBefore, position.NotAfter = value, value
+	}
+	return position, nil
+}
+
+// FilterCertificates applies a query to a list of certificates in memory
+func FilterCertificates(certs []Certificate, query CertificateQuery) (*CertificatePage, error) {
+	if err := query.normalize(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	matched := make([]Certificate, 0, len(certs))
+	for _, cert := range certs {
+		if query.matches(cert, now) {
+			matched = append(matched, cert)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		result := compareCertificates(matched[i], matched[j], query.Sort)
+		if query.Descending {
+			return result > 0
+		}
+		return result < 0
+	})
+
+	page := &CertificatePage{Total: len(matched)}
+	if query.Cursor != "" {
+		position, _ := query.decodeCursor()
+		start := sort.Search(len(matched), func(i int) bool {
+			result := compareCertificates(matched[i], position, query.Sort)
+			if query.Descending {
+				return result < 0
+			}
+			return result > 0
+		})
+		matched = matched[start:]
+	}
+	if query.Limit > 0 && len(matched) > query.Limit {
+		matched = matched[:query.Limit]
+		page.NextCursor = query.encodeCursor(matched[len(matched)-1])
+	}
+	page.Certificates = matched
+	return page, nil
+}
+
+// QueryCertificates filters, sorts and pages the certificate inventory. With
+// the database enabled the query runs against the certificates table,
+// otherwise against the certificate index.
+func (c *CertificateService) QueryCertificates(query CertificateQuery) (*CertificatePage, error) {
+	if err := query.normalize(); err != nil {
+		return nil, err
+	}
+
+	certs, err := c.GetAllCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	if db := c.certificateDatabase(); db != nil {
+		page, err := c.queryDatabase(db, query, certs)
+		if err == nil {
+			return page, nil
+		}
+		log.Printf("Failed to query certificate database, using the certificate index: %v", err)
+	}
+	return FilterCertificates(certs, query)
+}
+
+// queryDatabase runs a query against the certificates table. Certificates
+// indexed on this server are returned with their full metadata.
+func (c *CertificateService) queryDatabase(db *database.Database, query CertificateQuery, indexed []Certificate) (*CertificatePage, error) {
+	filter := database.CertificateFilter{
+		Status:         query.Status,
+		Search:         query.Search,
+		Issuer:         query.Issuer,
+		SerialNumber:   query.SerialNumber,
+		Fingerprint:    query.Fingerprint,
+		Profile:        query.Profile,
+		ExpiresAfter:   query.ExpiresAfter,
+		ExpiresBefore:  query.ExpiresBefore,
+		Labels:         query.Tags,
+		ExpiringWindow: ExpiringWindow,
+		SortColumn:     query.Sort,
+		Descending:     query.Descending,
+	}
+	if query.Type != "" {
+		isClient := query.Type == "client"
+		filter.IsClient = &isClient
+	}
+	if query.Cursor != "" {
+		position, _ := query.decodeCursor()
+		filter.AfterName = position.Name
+		switch query.Sort {
+		case SortByNotBefore:
+			filter.AfterValue = position.NotBefore
+		case SortByNotAfter:
+			filter.AfterValue = position.NotAfter
+		default:
+			filter.AfterValue = sortValue(position, query.Sort)
+		}
+	}
+	// Fetch one extra row to tell whether another page follows
+	if query.Limit > 0 {
+		filter.Limit = query.Limit + 1
+	}
+
+	records, total, err := db.QueryCertificates(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]Certificate, len(indexed))
+	for _, cert := range indexed {
+		byName[cert.Name] = cert
+	}
+
+	page := &CertificatePage{Total: int(total), Certificates: make([]Certificate, 0, len(records))}
+	for _, record := range records {
+		if query.Limit > 0 && len(page.Certificates) == query.Limit {
+			page.NextCursor = query.encodeCursor(page.Certificates[len(page.Certificates)-1])
+			break
+		}
+		if cert, ok := byName[record.Name]; ok && cert.SerialNumber == record.SerialNumber {
+			page.Certificates = append(page.Certificates, cert)
+		} else {
+			page.Certificates = append(page.Certificates, certificateFromRecord(record))
+		}
+	}
+	return page, nil
+}
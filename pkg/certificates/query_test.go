@@ -0,0 +1,133 @@
+package certificates
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterCertificates(t *testing.T) {
+	now := time.Now()
+	certs := []Certificate{
+		{Name: "api.example.com", CommonName: "api.example.com", SerialNumber: "0A", NotAfter: now.AddDate(1, 0, 0),
+			Issuer: "CN=LocalCA", DNSNames: []string{"api.example.com", "api.internal"}, Profile: ProfileServer,
+			Labels: map[string]string{"team": "platform", "env": "prod"}, FingerprintSHA256: formatFingerprint(make([]byte, 32))},
+		{Name: "soon.example.com", CommonName: "soon.example.com", SerialNumber: "0B", NotAfter: now.AddDate(0, 0, 10),
+			Issuer: "CN=LocalCA", Labels: map[string]string{"team": "web"}},
+		{Name: "old.example.com", CommonName: "old.example.com", SerialNumber: "0C", NotAfter: now.AddDate(0, 0, -1),
+			Issuer: "CN=Old CA"},
+		{Name: "gone.example.com", CommonName: "gone.example.com", SerialNumber: "0D", NotAfter: now.AddDate(1, 0, 0),
+			Issuer: "CN=LocalCA", Revoked: true},
+		{Name: "alice@example.com", CommonName: "alice@example.com", SerialNumber: "0E", NotAfter: now.AddDate(0, 6, 0),
+			Issuer: "CN=LocalCA", IsClient: true, EmailAddresses: []string{"alice@example.com"}, Profile: ProfileClient},
+	}
+
+	names := func(page *CertificatePage) string {
+		var result []string
+		for _, cert := range page.Certificates {
+			result = append(result, cert.Name)
+		}
+		return strings.Join(result, ",")
+	}
+
+	tests := []struct {
+		name  string
+		query CertificateQuery
+		want  string
+	}{
+		{"all sorted by name", CertificateQuery{}, "alice@example.com,api.example.com,gone.example.com,old.example.com,soon.example.com"},
+		{"active", CertificateQuery{Status: StatusActive}, "alice@example.com,api.example.com"},
+		{"expiring", CertificateQuery{Status: StatusExpiring}, "soon.example.com"},
+		{"expired", CertificateQuery{Status: StatusExpired}, "old.example.com"},
+		{"revoked", CertificateQuery{Status: StatusRevoked}, "gone.example.com"},
+		{"client", CertificateQuery{Type: "client"}, "alice@example.com"},
+		{"SAN search", CertificateQuery{Search: "API.INTERNAL"}, "api.example.com"},
+		{"serial", CertificateQuery{SerialNumber: "0c"}, "old.example.com"},
+		{"fingerprint without colons", CertificateQuery{Fingerprint: strings.Repeat("00", 32)}, "api.example.com"},
+		{"issuer", CertificateQuery{Issuer: "old ca"}, "old.example.com"},
+		{"expiry window", CertificateQuery{ExpiresAfter: now, ExpiresBefore: now.AddDate(0, 7, 0)}, "alice@example.com,soon.example.com"},
+		{"tag key", CertificateQuery{Tags: []string{"team"}}, "api.example.com,soon.example.com"},
+		{"tag key and value", CertificateQuery{Tags: []string{"team=platform", "env=prod"}}, "api.example.com"},
+		{"profile", CertificateQuery{Profile: ProfileClient}, "alice@example.com"},
+		{"sorted by expiry descending", CertificateQuery{Sort: SortByNotAfter, Descending: true, Status: StatusActive}, "api.example.com,alice@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := FilterCertificates(certs, tt.query)
+			if err != nil {
+				t.Fatalf("Failed to filter certificates: %v", err)
+			}
+			if got := names(page); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+			if page.Total != len(page.Certificates) || page.NextCursor != "" {
+				t.Errorf("Expected a single page, got total %d and cursor %q", page.Total, page.NextCursor)
+			}
+		})
+	}
+
+	// Walk all pages sorted by expiry
+	query := CertificateQuery{Sort: SortByNotAfter, Limit: 2}
+	var walked []string
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Pagination did not terminate")
+		}
+		page, err := FilterCertificates(certs, query)
+		if err != nil {
+			t.Fatalf("Failed to filter certificates: %v", err)
+		}
+		if page.Total != len(certs) {
+			t.Errorf("Expected total %d on every page, got %d", len(certs), page.Total)
+		}
+		walked = append(walked, names(page))
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if got := strings.Join(walked, "|"); got != "old.example.com,soon.example.com|alice@example.com,api.example.com|gone.example.com" {
+		t.Errorf("Unexpected pages %s", got)
+	}
+
+	invalid := []CertificateQuery{
+		{Status: "valid"},
+		{Type: "ca"},
+		{Sort: "issuer"},
+		{Fingerprint: "00:11"},
+		{Cursor: "not a cursor"},
+		{Cursor: query.Cursor},
+		{Tags: []string{"=prod"}},
+	}
+	for _, q := range invalid {
+		if _, err := FilterCertificates(certs, q); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("Expected ErrInvalidQuery for %+v, got %v", q, err)
+		}
+	}
+}
+
+func TestQueryCertificates(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	for _, name := range []string{"one.example.com", "two.example.com"} {
+		if err := certService.CreateServerCertificate(name, []string{"shared.example.com"}); err != nil {
+			t.Fatalf("Failed to create certificate: %v", err)
+		}
+	}
+	if err := certService.RevokeCertificate("two.example.com"); err != nil {
+		t.Fatalf("Failed to revoke certificate: %v", err)
+	}
+
+	page, err := certService.QueryCertificates(CertificateQuery{Search: "shared", Status: StatusActive})
+	if err != nil {
+		t.Fatalf("Failed to query certificates: %v", err)
+	}
+	if page.Total != 1 || page.Certificates[0].Name != "one.example.com" {
+		t.Errorf("Expected only the unrevoked certificate, got %+v", page)
+	}
+
+	if _, err := certService.QueryCertificates(CertificateQuery{Limit: -1}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for a negative limit, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package certificates
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/database"
+	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
+)
+
+// certificateDatabase returns the database when the storage has one enabled
+func (c *CertificateService) certificateDatabase() *database.Database {
+	if enhanced, ok := c.storage.(*storage.EnhancedStorage); ok {
+		return enhanced.GetDatabase()
+	}
+	return nil
+}
+
+// mirrorIndex copies index entries into the certificates table so they can be
+// queried there. Names without an entry are removed from the table. The
+// caller must hold indexMutex.
+func (c *CertificateService) mirrorIndex(names map[string]bool) {
+	db := c.certificateDatabase()
+	if db == nil {
+		return
+	}
+
+	for name := range names {
+		entry, ok := c.index.Entries[name]
+		var err error
+		if ok {
+			err = db.SaveCertificate(certificateRecord(entry.Certificate))
+		} else {
+			err = db.DeleteCertificate(name)
+		}
+		if err != nil {
+			log.Printf("Failed to update certificate %s in database: %v", name, err)
+		}
+	}
+}
+
+// certificateRecord returns the database row of a certificate
+func certificateRecord(cert Certificate) *database.Certificate {
+	return &database.Certificate{
+		Name:              cert.Name,
+		SerialNumber:      cert.SerialNumber,
+		Subject:           cert.Subject,
+		Issuer:            cert.Issuer,
+		NotBefore:         cert.NotBefore,
+		NotAfter:          cert.NotAfter,
+		IsRevoked:         cert.Revoked,
+		RevokedAt:         cert.RevokedAt,
+		CommonName:        cert.CommonName,
+		SubjectAltNames:   strings.ToLower(strings.Join(subjectAltNameValues(cert), "\n")),
+		IsClient:          cert.IsClient,
+		Profile:           cert.Profile,
+		FingerprintSHA1:   cert.FingerprintSHA1,
+		FingerprintSHA256: cert.FingerprintSHA256,
+		Labels:            encodeLabels(cert.Labels),
+		OwnerEmail:        cert.OwnerEmail,
+		Team:              cert.Team,
+		Notes:             cert.Notes,
+	}
+}
+
+// certificateFromRecord returns the metadata held by a database row, for
+// certificates not indexed on this server
+func certificateFromRecord(record database.Certificate) Certificate {
+	return Certificate{
+		Name:              record.Name,
+		CommonName:        record.CommonName,
+		Subject:           record.Subject,
+		SerialNumber:      record.SerialNumber,
+		NotBefore:         record.NotBefore,
+		NotAfter:          record.NotAfter,
+		Issuer:            record.Issuer,
+		IsClient:          record.IsClient,
+		Profile:           record.Profile,
+		OwnerEmail:        record.OwnerEmail,
+		Team:              record.Team,
+		Labels:            decodeLabels(record.Labels),
+		Notes:             record.Notes,
+		FingerprintSHA1:   record.FingerprintSHA1,
+		FingerprintSHA256: record.FingerprintSHA256,
+		Revoked:           record.IsRevoked,
+		RevokedAt:         record.RevokedAt,
+	}
+}
+
+// encodeLabels returns labels as sorted key=value lines with a newline on both
+// ends, so a LIKE pattern can match a whole line
+func encodeLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	lines := make([]string, 0, len(labels))
+	for key, value := range labels {
+		lines = append(lines, key+"="+value)
+	}
+	sort.Strings(lines)
+	return "\n" + strings.Join(lines, "\n") + "\n"
+}
+
+// decodeLabels parses labels encoded by encodeLabels
+func decodeLabels(encoded string) map[string]string {
+	var labels map[string]string
+	for _, line := range strings.Split(encoded, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[key] = value
+		}
+	}
+	return labels
+}
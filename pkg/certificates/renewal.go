@@ -0,0 +1,386 @@
+package certificates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/email"
+)
+
+// DefaultRenewalLifetimeFraction renews a certificate once two thirds of its
+// lifetime have passed
+const DefaultRenewalLifetimeFraction = 2.0 / 3.0
+
+// Automatic renewal timing
+const (
+	// renewalCheckInterval is how often certificates are checked for renewal
+	renewalCheckInterval = 10 * time.Minute
+	// renewalRetryDelay is the wait after a failed renewal; it doubles with
+	// each further failure up to renewalRetryMaxDelay
+	renewalRetryDelay    = 10 * time.Minute
+	renewalRetryMaxDelay = 24 * time.Hour
+)
+
+// Sources of the renewal policy applying to a certificate
+const (
+	RenewalPolicyFromCertificate = "certificate"
+	RenewalPolicyFromProfile     = "profile"
+)
+
+// RenewalPolicy opts certificates into automatic renewal. A certificate is
+// renewed DaysBeforeExpiry days before it expires when set, otherwise once
+// LifetimeFraction of its validity has passed.
+type RenewalPolicy struct {
+	Enabled bool `json:"enabled"`
+	// LifetimeFraction defaults to DefaultRenewalLifetimeFraction
+	LifetimeFraction float64 `json:"lifetime_fraction,omitempty"`
+	DaysBeforeExpiry int     `json:"days_before_expiry,omitempty"`
+	// RotateKey renews with a new key pair of the same type. Certificates
+	// issued from a CSR keep their key.
+	RotateKey bool `json:"rotate_key,omitempty"`
+}
+
+// Validate checks that at most one threshold is set and that it is in range
+func (p RenewalPolicy) Validate() error {
+	if p.LifetimeFraction != 0 && p.DaysBeforeExpiry != 0 {
+		return fmt.Errorf("%w: set either lifetime_fraction or days_before_expiry", ErrInvalidRenewalPolicy)
+	}
+	if math.IsNaN(p.LifetimeFraction) || p.LifetimeFraction < 0 || p.LifetimeFraction >= 1 {
+		return fmt.Errorf("%w: lifetime_fraction must be between 0 and 1", ErrInvalidRenewalPolicy)
+	}
+	if p.DaysBeforeExpiry < 0 || p.DaysBeforeExpiry > MaxProfileValidityDays {
+		return fmt.Errorf("%w: days_before_expiry must be between 0 and %d", ErrInvalidRenewalPolicy, MaxProfileValidityDays)
+	}
+	return nil
+}
+
+// RenewAt returns when a certificate is due for renewal under the policy. A
+// days before expiry threshold that falls before the certificate became valid
+// is replaced by the lifetime fraction, so the certificate is not renewed
+// again right after being issued.
+func (p RenewalPolicy) RenewAt(cert Certificate) time.Time {
+	if p.DaysBeforeExpiry > 0 {
+		if at := cert.NotAfter.AddDate(0, 0, -p.DaysBeforeExpiry); at.After(cert.NotBefore) {
+			return at
+		}
+	}
+
+	fraction := p.LifetimeFraction
+	if fraction == 0 {
+		fraction = DefaultRenewalLifetimeFraction
+	}
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return cert.NotBefore.Add(time.Duration(float64(lifetime) * fraction))
+}
+
+// RenewalStatus describes the automatic renewal of a certificate
+type RenewalStatus struct {
+	// Policy is the policy in effect and Source where it is set; both are
+	// empty when neither the certificate nor its profile has one
+	Policy  *RenewalPolicy `json:"policy,omitempty"`
+	Source  string         `json:"source,omitempty"`
+	RenewAt *time.Time     `json:"renew_at,omitempty"`
+
+	// Failed attempts since the last successful renewal
+	Failures    int        `json:"failures,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	NextAttempt *time.Time `json:"next_attempt,omitempty"`
+}
+
+// renewalFailure tracks failed automatic renewals of a certificate
+type renewalFailure struct {
+	Count       int
+	LastError   string
+	NextAttempt time.Time
+}
+
+// renewalResult is the outcome of an automatic renewal
+type renewalResult struct {
+	Name       string
+	OwnerEmail string
+	// NotAfter is the expiry of the certificate in place after the attempt
+	NotAfter     time.Time
+	SerialNumber string
+	RotatedKey   bool
+	Err          error
+}
+
+// renewalRetryBackoff returns the wait before retrying after a number of
+// consecutive failures
+func renewalRetryBackoff(failures int) time.Duration {
+	delay := renewalRetryDelay
+	for i := 1; i < failures && delay < renewalRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > renewalRetryMaxDelay {
+		delay = renewalRetryMaxDelay
+	}
+	return delay
+}
+
+// getRenewalPolicyPath returns the file holding the renewal policy set on a certificate
+func (c *CertificateService) getRenewalPolicyPath(name string) string {
+	return filepath.Join(c.storage.GetCertificateDirectory(name), "renewal.json")
+}
+
+// loadRenewalPolicy reads the renewal policy set on a certificate; nil means
+// the certificate follows its profile
+func (c *CertificateService) loadRenewalPolicy(certName string) (*RenewalPolicy, error) {
+	data, err := os.ReadFile(c.getRenewalPolicyPath(certName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read renewal policy: %w", err)
+	}
+
+	var policy RenewalPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse renewal policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// SetRenewalPolicy sets the automatic renewal policy of a certificate,
+// overriding that of its profile. A nil policy makes the certificate follow
+// its profile again.
+func (c *CertificateService) SetRenewalPolicy(name string, policy *RenewalPolicy) error {
+	if policy != nil {
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(c.storage.GetCertificatePath(name)); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrCertificateNotFound, name)
+	}
+
+	path := c.getRenewalPolicyPath(name)
+	if policy == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove renewal policy: %w", err)
+		}
+	} else {
+		data, err := json.MarshalIndent(policy, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal renewal policy: %w", err)
+		}
+		if err := writeFileAtomic(path, data, 0644); err != nil {
+			return fmt.Errorf("failed to record renewal policy: %w", err)
+		}
+	}
+
+	// A new policy gets a fresh start instead of waiting out the backoff
+	c.renewalMutex.Lock()
+	delete(c.renewalFailures, name)
+	c.renewalMutex.Unlock()
+
+	c.updateIndex(name)
+	return nil
+}
+
+// renewalPolicyOf returns the renewal policy applying to a certificate and
+// where it is set. Certificates whose profile is gone follow the default
+// profile for their type, as they are renewed with it.
+func renewalPolicyOf(cert Certificate, profiles map[string]*Profile) (*RenewalPolicy, string) {
+	if cert.AutoRenew != nil {
+		return cert.AutoRenew, RenewalPolicyFromCertificate
+	}
+
+	profile, ok := profiles[cert.Profile]
+	if !ok {
+		if cert.IsClient {
+			profile = profiles[ProfileClient]
+		} else {
+			profile = profiles[ProfileServer]
+		}
+	}
+	if profile == nil || profile.AutoRenew == nil {
+		return nil, ""
+	}
+	return profile.AutoRenew, RenewalPolicyFromProfile
+}
+
+// profilesByName returns the current profiles keyed by name
+func (c *CertificateService) profilesByName() (map[string]*Profile, error) {
+	profiles, err := c.ListProfiles()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Profile, len(profiles))
+	for i := range profiles {
+		byName[profiles[i].Name] = &profiles[i]
+	}
+	return byName, nil
+}
+
+// GetRenewalStatus returns the renewal policy applying to a certificate,
+// when it is due and any failed attempts
+func (c *CertificateService) GetRenewalStatus(name string) (*RenewalStatus, error) {
+	cert, err := c.GetCertificateInfo(name)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := c.profilesByName()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &RenewalStatus{}
+	status.Policy, status.Source = renewalPolicyOf(*cert, profiles)
+	if status.Policy != nil && status.Policy.Enabled && !cert.Revoked {
+		renewAt := status.Policy.RenewAt(*cert)
+		status.RenewAt = &renewAt
+	}
+
+	c.renewalMutex.Lock()
+	if failure, ok := c.renewalFailures[name]; ok {
+		nextAttempt := failure.NextAttempt
+		status.Failures = failure.Count
+		status.LastError = failure.LastError
+		status.NextAttempt = &nextAttempt
+	}
+	c.renewalMutex.Unlock()
+
+	return status, nil
+}
+
+// renewDueCertificates renews the unrevoked certificates whose renewal
+// policy makes them due at the given time, skipping those waiting to retry
+// after a failure. Nothing is renewed while the CA is sealed.
+func (c *CertificateService) renewDueCertificates(now time.Time) []renewalResult {
+	if c.Sealed() {
+		return nil
+	}
+
+	certs, err := c.GetAllCertificates()
+	if err != nil {
+		log.Printf("Failed to list certificates for renewal: %v", err)
+		return nil
+	}
+	profiles, err := c.profilesByName()
+	if err != nil {
+		log.Printf("Failed to load profiles for renewal: %v", err)
+		return nil
+	}
+
+	var results []renewalResult
+	for _, cert := range certs {
+		if cert.Revoked {
+			continue
+		}
+		policy, _ := renewalPolicyOf(cert, profiles)
+		if policy == nil || !policy.Enabled || now.Before(policy.RenewAt(cert)) {
+			continue
+		}
+
+		c.renewalMutex.Lock()
+		failure, failed := c.renewalFailures[cert.Name]
+		c.renewalMutex.Unlock()
+		if failed && now.Before(failure.NextAttempt) {
+			continue
+		}
+
+		results = append(results, c.autoRenew(cert, *policy, now))
+	}
+	return results
+}
+
+// autoRenew renews a certificate under its renewal policy, tracks failures
+// for the retry backoff and records the outcome in the audit log
+func (c *CertificateService) autoRenew(cert Certificate, policy RenewalPolicy, now time.Time) renewalResult {
+	opts := RenewOptions{RotateKey: policy.RotateKey && cert.HasPrivateKey}
+	result := renewalResult{
+		Name:         cert.Name,
+		OwnerEmail:   cert.OwnerEmail,
+		NotAfter:     cert.NotAfter,
+		SerialNumber: cert.SerialNumber,
+		RotatedKey:   opts.RotateKey,
+	}
+
+	if cert.IsClient {
+		result.Err = c.RenewClientCertificateWithOptions(cert.Name, opts)
+	} else {
+		result.Err = c.RenewServerCertificateWithOptions(cert.Name, opts)
+	}
+
+	c.renewalMutex.Lock()
+	if result.Err != nil {
+		failure := c.renewalFailures[cert.Name]
+		failure.Count++
+		failure.LastError = result.Err.Error()
+		failure.NextAttempt = now.Add(renewalRetryBackoff(failure.Count))
+		if c.renewalFailures == nil {
+			c.renewalFailures = make(map[string]renewalFailure)
+		}
+		c.renewalFailures[cert.Name] = failure
+		c.renewalMutex.Unlock()
+
+		c.recordAudit("auto_renew", "certificate", cert.Name,
+			fmt.Sprintf("Automatic renewal failed (attempt %d, next attempt at %s)", failure.Count, failure.NextAttempt.UTC().Format(time.RFC3339)), result.Err)
+		return result
+	}
+	delete(c.renewalFailures, cert.Name)
+	c.renewalMutex.Unlock()
+
+	if renewed, err := c.GetCertificateInfo(cert.Name); err == nil {
+		result.NotAfter = renewed.NotAfter
+		result.SerialNumber = renewed.SerialNumber
+	}
+	details := fmt.Sprintf("Renewed certificate automatically (serial %s, expires %s)", result.SerialNumber, result.NotAfter.UTC().Format(time.RFC3339))
+	if result.RotatedKey {
+		details += " with a new key"
+	}
+	c.recordAudit("auto_renew", "certificate", cert.Name, details, nil)
+	return result
+}
+
+// runAutomaticRenewal renews due certificates and notifies their owners and
+// the configured recipient when an email service is given
+func (c *CertificateService) runAutomaticRenewal(emailSvc *email.EmailService) {
+	for _, result := range c.renewDueCertificates(time.Now()) {
+		if result.Err != nil {
+			log.Printf("Failed to renew certificate %s automatically: %v", result.Name, result.Err)
+		} else {
+			log.Printf("Renewed certificate %s automatically", result.Name)
+		}
+
+		if emailSvc == nil {
+			continue
+		}
+		recipients := email.ExpiryRecipients(email.CertificateInfo{OwnerEmail: result.OwnerEmail}, c.config.EmailTo)
+		for _, recipient := range recipients {
+			if err := emailSvc.SendCertificateRenewalNotification(c.config.EmailFrom, recipient, result.Name,
+				result.NotAfter.UTC().Format("2006-01-02"), result.Err); err != nil {
+				log.Printf("Failed to send renewal notification for %s: %v", result.Name, err)
+			}
+		}
+	}
+}
+
+// StartRenewalScheduler renews certificates whose renewal policy makes them
+// due until the context is cancelled
+func (c *CertificateService) StartRenewalScheduler(ctx context.Context) {
+	var emailSvc *email.EmailService
+	if c.config.EmailEnabled {
+		emailSvc = c.newEmailService()
+	}
+	c.runAutomaticRenewal(emailSvc)
+
+	ticker := time.NewTicker(renewalCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.runAutomaticRenewal(emailSvc)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package certificates
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenewalPolicy(t *testing.T) {
+	notBefore := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := Certificate{NotBefore: notBefore, NotAfter: notBefore.AddDate(0, 0, 90)}
+
+	tests := []struct {
+		name   string
+		policy RenewalPolicy
+		want   time.Time
+	}{
+		{"default fraction", RenewalPolicy{Enabled: true}, notBefore.AddDate(0, 0, 60)},
+		{"half lifetime", RenewalPolicy{Enabled: true, LifetimeFraction: 0.5}, notBefore.AddDate(0, 0, 45)},
+		{"days before expiry", RenewalPolicy{Enabled: true, DaysBeforeExpiry: 10}, notBefore.AddDate(0, 0, 80)},
+		{"days beyond lifetime", RenewalPolicy{Enabled: true, DaysBeforeExpiry: 120}, notBefore.AddDate(0, 0, 60)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); err != nil {
+				t.Fatalf("Expected a valid policy, got %v", err)
+			}
+			if got := tt.policy.RenewAt(cert); !got.Equal(tt.want) {
+				t.Errorf("Expected renewal at %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	invalid := []RenewalPolicy{
+		{LifetimeFraction: 0.5, DaysBeforeExpiry: 10},
+		{LifetimeFraction: 1},
+		{LifetimeFraction: -0.1},
+		{LifetimeFraction: math.NaN()},
+		{DaysBeforeExpiry: -1},
+	}
+	for _, policy := range invalid {
+		if err := policy.Validate(); !errors.Is(err, ErrInvalidRenewalPolicy) {
+			t.Errorf("Expected ErrInvalidRenewalPolicy for %+v, got %v", policy, err)
+		}
+	}
+
+	if got := renewalRetryBackoff(1); got != renewalRetryDelay {
+		t.Errorf("Expected the first retry after %v, got %v", renewalRetryDelay, got)
+	}
+	if got := renewalRetryBackoff(3); got != 4*renewalRetryDelay {
+		t.Errorf("Expected the third retry after %v, got %v", 4*renewalRetryDelay, got)
+	}
+	if got := renewalRetryBackoff(100); got != renewalRetryMaxDelay {
+		t.Errorf("Expected the backoff to be capped at %v, got %v", renewalRetryMaxDelay, got)
+	}
+}
+
+func TestAutomaticRenewal(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	// One certificate opts in itself with key rotation, one through its profile
+	autoRenew := &RenewalPolicy{Enabled: true, DaysBeforeExpiry: 30}
+	profile := Profile{Name: "auto", ValidityDays: 365, ExtKeyUsage: []string{"serverAuth"}, AutoRenew: autoRenew}
+	if err := certService.CreateProfile(profile); err != nil {
+		t.Fatalf("Failed to create profile: %v", err)
+	}
+	if err := certService.CreateServerCertificate("rotated.example.com", []string{"alt.example.com"}); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	if err := certService.SetRenewalPolicy("rotated.example.com", &RenewalPolicy{Enabled: true, RotateKey: true}); err != nil {
+		t.Fatalf("Failed to set renewal policy: %v", err)
+	}
+	if err := certService.CreateServerCertificateWithOptions("profiled.example.com", nil, IssueOptions{Profile: "auto"}); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	if err := certService.CreateServerCertificate("manual.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	status, err := certService.GetRenewalStatus("profiled.example.com")
+	if err != nil {
+		t.Fatalf("Failed to get renewal status: %v", err)
+	}
+	if status.Source != RenewalPolicyFromProfile || status.RenewAt == nil {
+		t.Errorf("Expected the profile policy to apply, got %+v", status)
+	}
+	if status, _ := certService.GetRenewalStatus("manual.example.com"); status.Policy != nil {
+		t.Errorf("Expected no policy for the manual certificate, got %+v", status)
+	}
+
+	if results := certService.renewDueCertificates(time.Now()); len(results) != 0 {
+		t.Fatalf("Expected nothing to be due yet, got %+v", results)
+	}
+
+	before, _ := certService.GetCertificateInfo("rotated.example.com")
+	keyPath := certService.storage.GetCertificateKeyPath("rotated.example.com")
+	oldKey, _ := os.ReadFile(keyPath)
+
+	// Two thirds into the lifetime only the rotating certificate is due
+	results := certService.renewDueCertificates(time.Now().AddDate(0, 0, 300))
+	if len(results) != 1 || results[0].Name != "rotated.example.com" || results[0].Err != nil || !results[0].RotatedKey {
+		t.Fatalf("Expected the rotating certificate to be renewed, got %+v", results)
+	}
+	after, err := certService.GetCertificateInfo("rotated.example.com")
+	if err != nil {
+		t.Fatalf("Failed to get certificate info: %v", err)
+	}
+	if after.SerialNumber == before.SerialNumber || after.SerialNumber != results[0].SerialNumber {
+		t.Errorf("Expected a new serial number, got %s", after.SerialNumber)
+	}
+	if strings.Join(after.DNSNames, ",") != strings.Join(before.DNSNames, ",") {
+		t.Errorf("Expected the SANs to be kept, got %v", after.DNSNames)
+	}
+	if newKey, _ := os.ReadFile(keyPath); bytes.Equal(newKey, oldKey) || after.SPKIPin == before.SPKIPin {
+		t.Error("Expected the key to be rotated")
+	}
+	if _, err := tls.LoadX509KeyPair(certService.storage.GetCertificatePath("rotated.example.com"), keyPath); err != nil {
+		t.Errorf("Expected the new key to match the certificate: %v", err)
+	}
+
+	// The profile policy renews without rotating the key; by then the
+	// rotating certificate is due again
+	before, _ = certService.GetCertificateInfo("profiled.example.com")
+	results = certService.renewDueCertificates(time.Now().AddDate(0, 0, 340))
+	if len(results) != 2 || results[0].Name != "profiled.example.com" || results[0].Err != nil || results[0].RotatedKey {
+		t.Fatalf("Expected the profiled certificate to be renewed, got %+v", results)
+	}
+	after, _ = certService.GetCertificateInfo("profiled.example.com")
+	if after.SPKIPin != before.SPKIPin || after.Profile != "auto" {
+		t.Errorf("Expected the key and profile to be kept, got %+v", after)
+	}
+
+	// A failing renewal backs off before it is retried
+	if err := certService.SetRenewalPolicy("manual.example.com", &RenewalPolicy{Enabled: true, DaysBeforeExpiry: 200}); err != nil {
+		t.Fatalf("Failed to set renewal policy: %v", err)
+	}
+	profile.AutoRenew = nil
+	profile.AllowedKeyTypes = []KeyAlgorithm{KeyAlgorithmEd25519}
+	profile.Name = ProfileServer
+	if err := certService.UpdateProfile(profile); err != nil {
+		t.Fatalf("Failed to update profile: %v", err)
+	}
+	now := time.Now().AddDate(0, 0, 200)
+	results = certService.renewDueCertificates(now)
+	if len(results) != 1 || results[0].Name != "manual.example.com" || !errors.Is(results[0].Err, ErrKeyTypeNotAllowed) {
+		t.Fatalf("Expected the renewal to fail, got %+v", results)
+	}
+	if results := certService.renewDueCertificates(now.Add(time.Minute)); len(results) != 0 {
+		t.Errorf("Expected the failed renewal to wait, got %+v", results)
+	}
+	status, _ = certService.GetRenewalStatus("manual.example.com")
+	if status.Failures != 1 || status.NextAttempt == nil || !status.NextAttempt.Equal(now.Add(renewalRetryDelay)) {
+		t.Errorf("Unexpected renewal status after a failure: %+v", status)
+	}
+	results = certService.renewDueCertificates(now.Add(renewalRetryDelay))
+	if len(results) != 1 || results[0].Err == nil {
+		t.Errorf("Expected the renewal to be retried, got %+v", results)
+	}
+	if status, _ := certService.GetRenewalStatus("manual.example.com"); status.Failures != 2 {
+		t.Errorf("Expected two failures, got %+v", status)
+	}
+
+	auditLog, err := os.ReadFile(filepath.Join(certService.storage.GetBasePath(), "audit.log"))
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	if count := strings.Count(string(auditLog), `"action":"auto_renew"`); count != 5 {
+		t.Errorf("Expected 5 renewal audit entries, got %d", count)
+	}
+
+	// Nothing is renewed while the CA is sealed
+	certService.Seal()
+	if results := certService.renewDueCertificates(time.Now().AddDate(0, 0, 400)); len(results) != 0 {
+		t.Errorf("Expected no renewals while sealed, got %+v", results)
+	}
+}
@@ -0,0 +1,295 @@
+package certificates
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RevocationReason is an RFC 5280 CRLReason code
+type RevocationReason int
+
+// RevocationReason constants
+const (
+	ReasonUnspecified          RevocationReason = 0
+	ReasonKeyCompromise        RevocationReason = 1
+	ReasonCACompromise         RevocationReason = 2
+	ReasonAffiliationChanged   RevocationReason = 3
+	ReasonSuperseded           RevocationReason = 4
+	ReasonCessationOfOperation RevocationReason = 5
+	ReasonCertificateHold      RevocationReason = 6
+	ReasonPrivilegeWithdrawn   RevocationReason = 9
+	ReasonAACompromise         RevocationReason = 10
+)
+
+var revocationReasonNames = map[RevocationReason]string{
+	ReasonUnspecified:          "unspecified",
+	ReasonKeyCompromise:        "keyCompromise",
+	ReasonCACompromise:         "cACompromise",
+	ReasonAffiliationChanged:   "affiliationChanged",
+	ReasonSuperseded:           "superseded",
+	ReasonCessationOfOperation: "cessationOfOperation",
+	ReasonCertificateHold:      "certificateHold",
+	ReasonPrivilegeWithdrawn:   "privilegeWithdrawn",
+	ReasonAACompromise:         "aACompromise",
+}
+
+// String returns the RFC 5280 name of the reason
+func (r RevocationReason) String() string {
+	if name, ok := revocationReasonNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(r))
+}
+
+// ParseRevocationReason parses a reason given either by RFC 5280 name or numeric code
+func ParseRevocationReason(value string) (RevocationReason, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ReasonUnspecified, nil
+	}
+
+	if code, err := strconv.Atoi(value); err == nil {
+		reason := RevocationReason(code)
+		if _, ok := revocationReasonNames[reason]; ok {
+			return reason, nil
+		}
+		return ReasonUnspecified, fmt.Errorf("unsupported revocation reason code: %d", code)
+	}
+
+	for reason, name := range revocationReasonNames {
+		if strings.EqualFold(name, value) {
+			return reason, nil
+		}
+	}
+
+	return ReasonUnspecified, fmt.Errorf("unknown revocation reason: %s", value)
+}
+
+// RevokedCertificate is an entry in the revocation database
+type RevokedCertificate struct {
+	SerialNumber   string           `json:"serial_number"`
+	Name           string           `json:"name"`
+	RevokedAt      time.Time        `json:"revoked_at"`
+	Reason         RevocationReason `json:"reason"`
+	InvalidityDate *time.Time       `json:"invalidity_date,omitempty"`
+}
+
+// revocationDatabase is the on-disk representation of the revocation store
+type revocationDatabase struct {
+	CRLNumber int64                `json:"crl_number"`
+	Entries   []RevokedCertificate `json:"entries"`
+}
+
+// getCRLDirectory returns the directory holding revocation data
+func (c *CertificateService) getCRLDirectory() string {
+	return filepath.Join(c.storage.GetCADirectory(), "crl")
+}
+
+// getRevocationDatabasePath returns the path to the revocation database
+func (c *CertificateService) getRevocationDatabasePath() string {
+	return filepath.Join(c.getCRLDirectory(), "revocations.json")
+}
+
+// loadRevocationDatabase reads the revocation database, importing a legacy
+// OpenSSL index.txt on first use
+func (c *CertificateService) loadRevocationDatabase() (*revocationDatabase, error) {
+	data, err := os.ReadFile(c.getRevocationDatabasePath())
+	if os.IsNotExist(err) {
+		return c.importLegacyIndex()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revocation database: %w", err)
+	}
+
+	var db revocationDatabase
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, fmt.Errorf("failed to parse revocation database: %w", err)
+	}
+
+	return &db, nil
+}
+
+// saveRevocationDatabase writes the revocation database atomically
+func (c *CertificateService) saveRevocationDatabase(db *revocationDatabase) error {
+	if err := os.MkdirAll(c.getCRLDirectory(), 0755); err != nil {
+		return fmt.Errorf("failed to create CRL directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal revocation database: %w", err)
+	}
+
+	if err := writeFileAtomic(c.getRevocationDatabasePath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to write revocation database: %w", err)
+	}
+
+	return nil
+}
+
+// importLegacyIndex converts revoked entries from the OpenSSL index.txt used by
+// earlier versions into a revocation database
+func (c *CertificateService) importLegacyIndex() (*revocationDatabase, error) {
+	db := &revocationDatabase{}
+
+	indexFile, err := os.Open(filepath.Join(c.getCRLDirectory(), "index.txt"))
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open legacy CRL index: %w", err)
+	}
+	defer indexFile.Close()
+
+	scanner := bufio.NewScanner(indexFile)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 6 || fields[0] != "R" {
+			continue
+		}
+
+		revokedAt, err := time.Parse("060102150405Z", fields[2])
+		if err != nil {
+			revokedAt = time.Now().UTC()
+		}
+
+		db.Entries = append(db.Entries, RevokedCertificate{
+			SerialNumber: strings.ToUpper(fields[3]),
+			Name:         strings.TrimPrefix(fields[5], "/CN="),
+			RevokedAt:    revokedAt,
+			Reason:       ReasonUnspecified,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read legacy CRL index: %w", err)
+	}
+
+	return db, nil
+}
+
+// GetRevokedCertificates returns all entries in the revocation database
+func (c *CertificateService) GetRevokedCertificates() ([]RevokedCertificate, error) {
+	c.revocationMutex.Lock()
+	defer c.revocationMutex.Unlock()
+
+	db, err := c.loadRevocationDatabase()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.Entries, nil
+}
+
+// RevokeCertificate revokes a certificate with an unspecified reason and updates the CRL
+func (c *CertificateService) RevokeCertificate(commonName string) error {
+	return c.RevokeCertificateWithReason(commonName, ReasonUnspecified, nil)
+}
+
+// RevokeCertificateWithReason records a revocation in the revocation database
+// and regenerates the CRL
+func (c *CertificateService) RevokeCertificateWithReason(commonName string, reason RevocationReason, invalidityDate *time.Time) error {
+	if _, ok := revocationReasonNames[reason]; !ok {
+		return fmt.Errorf("unsupported revocation reason: %d", int(reason))
+	}
+	if c.Sealed() {
+		return ErrCASealed
+	}
+
+	// Check if certificate exists
+	certPath := c.storage.GetCertificatePath(commonName)
+	certBytes, err := os.ReadFile(certPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("certificate not found: %s", commonName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	certBlock, _ := pem.Decode(certBytes)
+	if certBlock == nil {
+		return fmt.Errorf("failed to decode certificate PEM")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if err := c.revokeSerialNumber(formatSerialNumber(cert.SerialNumber), commonName, reason, invalidityDate); err != nil {
+		return err
+	}
+
+	// Mark the certificate as revoked in our system
+	revokedFlagPath := filepath.Join(c.storage.GetCertificateDirectory(commonName), "revoked")
+	if err := os.WriteFile(revokedFlagPath, []byte(now.Format(time.RFC3339)), 0644); err != nil {
+		return fmt.Errorf("failed to mark certificate as revoked: %w", err)
+	}
+	c.updateIndex(commonName)
+
+	// Regenerate the CRL so the revocation is published immediately
+	if err := c.GenerateCRL(); err != nil {
+		return fmt.Errorf("failed to generate CRL: %w", err)
+	}
+
+	return nil
+}
+
+// revokeSerialNumber records the revocation of a serial number issued under a
+// certificate name in the revocation database
+func (c *CertificateService) revokeSerialNumber(serial, name string, reason RevocationReason, invalidityDate *time.Time) error {
+	if _, ok := revocationReasonNames[reason]; !ok {
+		return fmt.Errorf("unsupported revocation reason: %d", int(reason))
+	}
+	if c.Sealed() {
+		return ErrCASealed
+	}
+
+	c.revocationMutex.Lock()
+	db, err := c.loadRevocationDatabase()
+	if err != nil {
+		c.revocationMutex.Unlock()
+		return err
+	}
+
+	for _, entry := range db.Entries {
+		if entry.SerialNumber == serial {
+			c.revocationMutex.Unlock()
+			return ErrCertificateRevoked
+		}
+	}
+
+	entry := RevokedCertificate{
+		SerialNumber: serial,
+		Name:         name,
+		RevokedAt:    time.Now().UTC(),
+		Reason:       reason,
+	}
+	if invalidityDate != nil {
+		invalidity := invalidityDate.UTC()
+		entry.InvalidityDate = &invalidity
+	}
+
+	db.Entries = append(db.Entries, entry)
+	if err := c.saveRevocationDatabase(db); err != nil {
+		c.revocationMutex.Unlock()
+		return err
+	}
+	c.revocationMutex.Unlock()
+	c.invalidateOCSPCache()
+	return nil
+}
+
+// formatSerialNumber formats a serial number the way storage indexes it
+func formatSerialNumber(serial *big.Int) string {
+	return fmt.Sprintf("%X", serial)
+}
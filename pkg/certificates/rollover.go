@@ -0,0 +1,548 @@
+package certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// RetiredCA is a CA replaced by a key rollover. It keeps signing CRLs and
+// OCSP responses for the certificates it issued until the last one expires.
+type RetiredCA struct {
+	ID             string    `json:"id"`
+	Subject        string    `json:"subject"`
+	RetiredAt      time.Time `json:"retired_at"`
+	RootNotAfter   time.Time `json:"root_not_after"`
+	LastLeafExpiry time.Time `json:"last_leaf_expiry"`
+	Active         bool      `json:"active"`
+}
+
+// CARollover describes the outcome of a CA key rollover
+type CARollover struct {
+	Retired        RetiredCA `json:"retired"`
+	NewRootSerial  string    `json:"new_root_serial"`
+	NewRootSubject string    `json:"new_root_subject"`
+	NewRootExpiry  time.Time `json:"new_root_not_after"`
+}
+
+// Files kept for each retired CA
+const (
+	retiredInfoFile      = "retired.json"
+	retiredRootFile      = "ca.pem"
+	retiredRootKeyFile   = "ca.key"
+	retiredCRLFile       = "ca.crl"
+	crossNewByOldFile    = "cross-new-by-old.pem"
+	crossOldByNewFile    = "cross-old-by-new.pem"
+	retiredOCSPDirectory = "ocsp"
+)
+
+// getRetiredDirectory returns the directory holding retired CAs
+func (c *CertificateService) getRetiredDirectory() string {
+	return filepath.Join(c.storage.GetCADirectory(), "retired")
+}
+
+// getRetiredCADirectory returns the directory of one retired CA
+func (c *CertificateService) getRetiredCADirectory(id string) string {
+	return filepath.Join(c.getRetiredDirectory(), filepath.Base(id))
+}
+
+// getRetiredCRLPath returns the path to the CRL of a retired CA
+func (c *CertificateService) getRetiredCRLPath(id string) string {
+	return filepath.Join(c.getRetiredCADirectory(id), retiredCRLFile)
+}
+
+// RolloverCA replaces the root CA key. It generates a new root with the same
+// subject, issues cross-certificates in both directions so either root can
+// validate paths through the other, and retires the old CA. In two-tier mode
+// a new intermediate is certified by the new root and the old intermediate is
+// retired with it. Requires the root key on the server. A rollover that
+// fails leaves the old CA in place, so it can be retried.
+func (c *CertificateService) RolloverCA() (*CARollover, error) {
+	if !c.rootKeyOnline() {
+		return nil, ErrRootKeyOffline
+	}
+
+	oldRoot, err := c.loadCACertificate()
+	if err != nil {
+		return nil, err
+	}
+	oldRootKey, err := c.loadCAPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	oldIssuer, oldIssuerKey, err := c.loadIssuer()
+	if err != nil {
+		return nil, err
+	}
+	twoTier := c.hasIntermediate()
+
+	lastLeafExpiry, err := c.lastLeafExpiry(oldIssuer)
+	if err != nil {
+		return nil, err
+	}
+
+	keySpec, err := c.caKeySpec()
+	if err != nil {
+		return nil, err
+	}
+	newRootKey, err := c.generateCAKey(keySpec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA private key: %w", err)
+	}
+
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	newRootTemplate := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               oldRoot.Subject,
+		NotBefore:             now,
+		NotAfter:              now.AddDate(10, 0, 0), // 10 years validity
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            oldRoot.MaxPathLen,
+		MaxPathLenZero:        oldRoot.MaxPathLenZero,
+	}
+	newRootBytes, err := x509.CreateCertificate(rand.Reader, &newRootTemplate, &newRootTemplate, newRootKey.Public(), newRootKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	newRoot, err := x509.ParseCertificate(newRootBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	// The old root vouches for the new key and the new root for the old key
+	newByOld, err := crossCertify(newRoot, oldRoot, oldRootKey)
+	if err != nil {
+		return nil, err
+	}
+	oldByNew, err := crossCertify(oldRoot, newRoot, newRootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	retired := RetiredCA{
+		ID:             formatSerialNumber(oldRoot.SerialNumber),
+		Subject:        oldRoot.Subject.String(),
+		RetiredAt:      now.UTC(),
+		RootNotAfter:   oldRoot.NotAfter,
+		LastLeafExpiry: lastLeafExpiry,
+	}
+	// Keep the files being replaced, so a failed rollover leaves the old CA
+	// in place and can be retried
+	previous, err := c.readRolloverFiles(twoTier, oldRootKey, oldIssuerKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.archiveCA(retired, twoTier, newByOld, oldByNew); err != nil {
+		return nil, err
+	}
+
+	if err := c.installRolloverCA(twoTier, newRoot, newRootBytes, newRootKey); err != nil {
+		c.restoreRolloverFiles(previous)
+		if removeErr := os.RemoveAll(c.getRetiredCADirectory(retired.ID)); removeErr != nil {
+			log.Printf("Failed to remove retired CA %s after a failed rollover: %v", retired.ID, removeErr)
+		}
+		return nil, err
+	}
+
+	c.invalidateOCSPCache()
+	if err := c.GenerateCRL(); err != nil {
+		return nil, fmt.Errorf("failed to generate CRL: %w", err)
+	}
+
+	retired.Active = time.Now().Before(retired.LastLeafExpiry)
+	return &CARollover{
+		Retired:        retired,
+		NewRootSerial:  formatSerialNumber(newRoot.SerialNumber),
+		NewRootSubject: newRoot.Subject.String(),
+		NewRootExpiry:  newRoot.NotAfter,
+	}, nil
+}
+
+// rolloverFile is a CA file as it was before a rollover replaced it; nil
+// data marks a file that did not exist. Key files also hold the key that was
+// loaded from them.
+type rolloverFile struct {
+	path string
+	data []byte
+	perm os.FileMode
+	key  crypto.Signer
+}
+
+// readRolloverFiles reads the CA files a rollover replaces
+func (c *CertificateService) readRolloverFiles(twoTier bool, rootKey, issuerKey crypto.Signer) ([]rolloverFile, error) {
+	files := []rolloverFile{
+		{path: c.storage.GetCAPublicKeyPath(), perm: 0644},
+		{path: c.storage.GetCAEncryptedKeyPath(), perm: 0600, key: rootKey},
+	}
+	if twoTier {
+		files = append(files,
+			rolloverFile{path: c.getIntermediateCertPath(), perm: 0644},
+			rolloverFile{path: c.getIntermediateKeyPath(), perm: 0600, key: issuerKey},
+		)
+	}
+	for i := range files {
+		data, err := os.ReadFile(files[i].path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(files[i].path), err)
+		}
+		files[i].data = data
+	}
+	return files, nil
+}
+
+// installRolloverCA writes the new root and, in two-tier mode, a new
+// intermediate certified by it
+func (c *CertificateService) installRolloverCA(twoTier bool, newRoot *x509.Certificate, newRootBytes []byte, newRootKey crypto.Signer) error {
+	if err := c.saveRootCA(newRootBytes, newRootKey); err != nil {
+		return err
+	}
+	if twoTier {
+		return c.createIntermediate(newRoot, newRootKey)
+	}
+	return nil
+}
+
+// restoreRolloverFiles puts back the CA files of a failed rollover. Failures
+// are logged, as the rollover error is what the caller reports.
+func (c *CertificateService) restoreRolloverFiles(files []rolloverFile) {
+	for _, file := range files {
+		var err error
+		if file.data == nil {
+			err = os.Remove(file.path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else if file.key != nil {
+			err = c.restoreCAKeyFile(file.path, file.data, file.key)
+		} else {
+			err = writeFileAtomic(file.path, file.data, file.perm)
+		}
+		if err != nil {
+			log.Printf("Failed to restore %s after a failed rollover: %v", filepath.Base(file.path), err)
+		}
+	}
+	if err := safeCopyFile(c.storage.GetCAPublicKeyPath(), c.storage.GetCAPublicCopyPath()); err != nil {
+		log.Printf("Failed to restore the public CA certificate after a failed rollover: %v", err)
+	}
+}
+
+// crossCertify certifies the key and subject of one root with another root,
+// valid no longer than either of them
+func crossCertify(subject, issuer *x509.Certificate, issuerKey crypto.Signer) ([]byte, error) {
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	notAfter := subject.NotAfter
+	if notAfter.After(issuer.NotAfter) {
+		notAfter = issuer.NotAfter
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject.Subject,
+		SubjectKeyId:          subject.SubjectKeyId,
+		NotBefore:             time.Now(),
+		NotAfter:              notAfter,
+		KeyUsage:              subject.KeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            subject.MaxPathLen,
+		MaxPathLenZero:        subject.MaxPathLenZero,
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, &template, issuer, subject.PublicKey, issuerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cross-certificate: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), nil
+}
+
+// archiveCA copies the current CA into the retired directory together with
+// the cross-certificates. Only the key of the CA that issued leaves is kept;
+// in two-tier mode the old root key is not needed any more.
+func (c *CertificateService) archiveCA(retired RetiredCA, twoTier bool, newByOld, oldByNew []byte) (err error) {
+	dir := c.getRetiredCADirectory(retired.ID)
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("retired CA %s already exists", retired.ID)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create retired CA directory: %w", err)
+	}
+	// A partly written archive would make a retry fail
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	type archivedFile struct {
+		src, name string
+		perm      os.FileMode
+	}
+	files := []archivedFile{{c.storage.GetCAPublicKeyPath(), retiredRootFile, 0644}}
+	if twoTier {
+		files = append(files,
+			archivedFile{c.getIntermediateCertPath(), filepath.Base(c.getIntermediateCertPath()), 0644},
+			archivedFile{c.getIntermediateKeyPath(), filepath.Base(c.getIntermediateKeyPath()), 0600},
+		)
+	} else {
+		files = append(files, archivedFile{c.storage.GetCAEncryptedKeyPath(), retiredRootKeyFile, 0600})
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file.src)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(file.src), err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file.name), data, file.perm); err != nil {
+			return fmt.Errorf("failed to archive %s: %w", filepath.Base(file.src), err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, crossNewByOldFile), newByOld, 0644); err != nil {
+		return fmt.Errorf("failed to write cross-certificate: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, crossOldByNewFile), oldByNew, 0644); err != nil {
+		return fmt.Errorf("failed to write cross-certificate: %w", err)
+	}
+
+	data, err := json.MarshalIndent(retired, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal retired CA: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, retiredInfoFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write retired CA: %w", err)
+	}
+
+	return nil
+}
+
+// lastLeafExpiry returns the latest expiry of the stored certificates signed
+// by an issuer, including archived versions of renewed certificates, or the
+// current time when there are none
+func (c *CertificateService) lastLeafExpiry(issuer *x509.Certificate) (time.Time, error) {
+	last := time.Now().UTC()
+
+	names, err := c.storage.ListCertificates()
+	if err != nil {
+		return last, fmt.Errorf("failed to list certificates: %w", err)
+	}
+	for _, name := range names {
+		paths := []string{c.storage.GetCertificatePath(name)}
+		versionsDir := c.getCertificateVersionsDirectory(name)
+		entries, err := os.ReadDir(versionsDir)
+		if err != nil && !os.IsNotExist(err) {
+			return last, fmt.Errorf("failed to read certificate versions: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && versionSerialPattern.MatchString(entry.Name()) {
+				paths = append(paths, filepath.Join(versionsDir, entry.Name(), name+".crt"))
+			}
+		}
+
+		for _, path := range paths {
+			cert, err := readCertificateFile(path)
+			if err != nil || cert.CheckSignatureFrom(issuer) != nil {
+				continue
+			}
+			if cert.NotAfter.After(last) {
+				last = cert.NotAfter.UTC()
+			}
+		}
+	}
+
+	return last, nil
+}
+
+// ListRetiredCAs returns the CAs replaced by key rollovers, newest first
+func (c *CertificateService) ListRetiredCAs() ([]RetiredCA, error) {
+	dirEntries, err := os.ReadDir(c.getRetiredDirectory())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retired CAs: %w", err)
+	}
+
+	now := time.Now()
+	var retired []RetiredCA
+	for _, entry := range dirEntries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(c.getRetiredCADirectory(entry.Name()), retiredInfoFile))
+		if err != nil {
+			continue
+		}
+		var ca RetiredCA
+		if err := json.Unmarshal(data, &ca); err != nil {
+			return nil, fmt.Errorf("failed to parse retired CA %s: %w", entry.Name(), err)
+		}
+		ca.Active = now.Before(ca.LastLeafExpiry)
+		retired = append(retired, ca)
+	}
+
+	sort.Slice(retired, func(i, j int) bool {
+		return retired[i].RetiredAt.After(retired[j].RetiredAt)
+	})
+	return retired, nil
+}
+
+// activeRetiredCAs returns the retired CAs that still have valid certificates
+func (c *CertificateService) activeRetiredCAs() ([]RetiredCA, error) {
+	retired, err := c.ListRetiredCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	active := retired[:0]
+	for _, ca := range retired {
+		if ca.Active {
+			active = append(active, ca)
+		}
+	}
+	return active, nil
+}
+
+// retiredIssuerPaths returns the paths to the certificate and key a retired
+// CA signed leaves with: its intermediate in two-tier mode, otherwise its root
+func (c *CertificateService) retiredIssuerPaths(id string) (string, string) {
+	dir := c.getRetiredCADirectory(id)
+
+	certPath := filepath.Join(dir, filepath.Base(c.getIntermediateCertPath()))
+	keyPath := filepath.Join(dir, filepath.Base(c.getIntermediateKeyPath()))
+	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+		certPath = filepath.Join(dir, retiredRootFile)
+		keyPath = filepath.Join(dir, retiredRootKeyFile)
+	}
+	return certPath, keyPath
+}
+
+// retiredIssuerCertificate returns the certificate a retired CA signed leaves
+// with, without loading its key
+func (c *CertificateService) retiredIssuerCertificate(id string) (*x509.Certificate, error) {
+	certPath, _ := c.retiredIssuerPaths(id)
+	cert, err := readCertificateFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load retired CA certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// loadRetiredIssuer returns the certificate and key a retired CA signed
+// leaves with
+func (c *CertificateService) loadRetiredIssuer(id string) (*x509.Certificate, crypto.Signer, error) {
+	certPath, keyPath := c.retiredIssuerPaths(id)
+
+	cert, err := readCertificateFile(certPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load retired CA certificate: %w", err)
+	}
+	key, err := c.readCAKeyFile(keyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load retired CA private key: %w", err)
+	}
+
+	return cert, key, nil
+}
+
+// GetRetiredCRL returns the PEM encoded CRL of an active retired CA
+func (c *CertificateService) GetRetiredCRL(id string) ([]byte, error) {
+	active, err := c.activeRetiredCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ca := range active {
+		if ca.ID != id {
+			continue
+		}
+		if err := c.refreshCRL(c.getRetiredCRLPath(id)); err != nil {
+			return nil, err
+		}
+		crlPEM, err := os.ReadFile(c.getRetiredCRLPath(id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CRL: %w", err)
+		}
+		return crlPEM, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrRetiredCANotFound, id)
+}
+
+// GetTrustBundle returns the PEM encoded roots relying parties should trust:
+// the current root and, during a rollover transition, the retired roots
+func (c *CertificateService) GetTrustBundle() ([]byte, error) {
+	var bundle bytes.Buffer
+
+	rootPEM, err := os.ReadFile(c.storage.GetCAPublicKeyPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	bundle.Write(rootPEM)
+
+	active, err := c.activeRetiredCAs()
+	if err != nil {
+		return nil, err
+	}
+	for _, ca := range active {
+		retiredPEM, err := os.ReadFile(filepath.Join(c.getRetiredCADirectory(ca.ID), retiredRootFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read retired CA certificate: %w", err)
+		}
+		bundle.Write(retiredPEM)
+	}
+
+	return bundle.Bytes(), nil
+}
+
+// transitionCrossCertificatePEM returns the cross-certificate issued by the
+// most recently retired root for the current root, so clients that only
+// trust the old root can still build a path. It is empty when no transition
+// is in progress.
+func (c *CertificateService) transitionCrossCertificatePEM(root *x509.Certificate) ([]byte, error) {
+	active, err := c.activeRetiredCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ca := range active {
+		crossPEM, err := os.ReadFile(filepath.Join(c.getRetiredCADirectory(ca.ID), crossNewByOldFile))
+		if err != nil {
+			continue
+		}
+		block, _ := pem.Decode(crossPEM)
+		if block == nil {
+			continue
+		}
+		cross, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		if publicKeysEqual(cross.PublicKey, root.PublicKey) {
+			return crossPEM, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,321 @@
+package certificates
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestRolloverCA(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+
+	certService := newTestCertificateService(t)
+	certService.config.CAKeyType = "ecdsa"
+
+	if err := certService.CreateServerCertificate("old.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	oldLeaf, err := readCertificateFile(certService.storage.GetCertificatePath("old.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	oldRoot, err := certService.loadCACertificate()
+	if err != nil {
+		t.Fatalf("Failed to load CA certificate: %v", err)
+	}
+
+	rollover, err := certService.RolloverCA()
+	if err != nil {
+		t.Fatalf("Failed to roll over CA: %v", err)
+	}
+
+	newRoot, err := certService.loadCACertificate()
+	if err != nil {
+		t.Fatalf("Failed to load CA certificate: %v", err)
+	}
+	if publicKeysEqual(newRoot.PublicKey, oldRoot.PublicKey) {
+		t.Fatal("Rollover kept the old CA key")
+	}
+	if newRoot.Subject.String() != oldRoot.Subject.String() {
+		t.Errorf("Rollover changed the CA subject to %s", newRoot.Subject)
+	}
+	if !rollover.Retired.Active || !rollover.Retired.LastLeafExpiry.Equal(oldLeaf.NotAfter.UTC()) {
+		t.Errorf("Unexpected retired CA: %+v", rollover.Retired)
+	}
+
+	// A new leaf chains to the old root through the cross-certificate
+	if err := certService.CreateServerCertificate("new.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	bundleData, err := os.ReadFile(certService.storage.GetCertificateBundlePath("new.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	bundle := parseBundle(t, bundleData)
+	if len(bundle) != 3 {
+		t.Fatalf("Expected leaf, root and cross-certificate in bundle, got %d", len(bundle))
+	}
+	oldRoots := x509.NewCertPool()
+	oldRoots.AddCert(oldRoot)
+	intermediates := x509.NewCertPool()
+	for _, cert := range bundle[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := bundle[0].Verify(x509.VerifyOptions{Roots: oldRoots, Intermediates: intermediates}); err != nil {
+		t.Errorf("New leaf does not verify against the old root: %v", err)
+	}
+
+	// The trust bundle publishes both roots
+	trustData, err := certService.GetTrustBundle()
+	if err != nil {
+		t.Fatalf("Failed to get trust bundle: %v", err)
+	}
+	trusted := parseBundle(t, trustData)
+	if len(trusted) != 2 {
+		t.Fatalf("Expected two roots in trust bundle, got %d", len(trusted))
+	}
+	roots := x509.NewCertPool()
+	for _, cert := range trusted {
+		roots.AddCert(cert)
+	}
+	if _, err := oldLeaf.Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+		t.Errorf("Old leaf does not verify against the trust bundle: %v", err)
+	}
+
+	// The retired CA still answers OCSP and publishes a CRL for its leaves
+	if err := certService.RevokeCertificateWithReason("old.example.com", ReasonKeyCompromise, nil); err != nil {
+		t.Fatalf("Failed to revoke certificate: %v", err)
+	}
+	request, err := ocsp.CreateRequest(oldLeaf, oldRoot, nil)
+	if err != nil {
+		t.Fatalf("Failed to create OCSP request: %v", err)
+	}
+	responseDER, err := certService.OCSPResponse(request)
+	if err != nil {
+		t.Fatalf("Failed to get OCSP response: %v", err)
+	}
+	response, err := ocsp.ParseResponseForCert(responseDER, oldLeaf, oldRoot)
+	if err != nil {
+		t.Fatalf("Failed to parse OCSP response: %v", err)
+	}
+	if response.Status != ocsp.Revoked {
+		t.Errorf("Expected revoked status from the retired CA, got %d", response.Status)
+	}
+
+	crlPEM, err := certService.GetRetiredCRL(rollover.Retired.ID)
+	if err != nil {
+		t.Fatalf("Failed to get retired CRL: %v", err)
+	}
+	block, _ := pem.Decode(crlPEM)
+	if block == nil {
+		t.Fatal("Failed to decode retired CRL")
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse retired CRL: %v", err)
+	}
+	if err := crl.CheckSignatureFrom(oldRoot); err != nil {
+		t.Errorf("Retired CRL is not signed by the old root: %v", err)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 || crl.RevokedCertificateEntries[0].SerialNumber.Cmp(oldLeaf.SerialNumber) != 0 {
+		t.Errorf("Retired CRL does not list the revoked leaf")
+	}
+
+	if _, err := certService.GetRetiredCRL("unknown"); !errors.Is(err, ErrRetiredCANotFound) {
+		t.Errorf("Expected ErrRetiredCANotFound, got %v", err)
+	}
+
+	hierarchy, err := certService.GetCAHierarchy()
+	if err != nil {
+		t.Fatalf("Failed to get CA hierarchy: %v", err)
+	}
+	if len(hierarchy.RetiredCAs) != 1 || hierarchy.RetiredCAs[0].ID != rollover.Retired.ID {
+		t.Errorf("Unexpected retired CAs: %+v", hierarchy.RetiredCAs)
+	}
+}
+
+func TestRolloverCAFailureKeepsOldCA(t *testing.T) {
+	certService := newTestCertificateService(t)
+	certService.config.CAKeyType = "ecdsa"
+
+	certPath := certService.storage.GetCAPublicKeyPath()
+	keyPath := certService.storage.GetCAEncryptedKeyPath()
+	oldCert, _ := os.ReadFile(certPath)
+	oldKey, _ := os.ReadFile(keyPath)
+	oldRoot, err := certService.loadCACertificate()
+	if err != nil {
+		t.Fatalf("Failed to load CA certificate: %v", err)
+	}
+
+	// Saving the new root fails after its certificate and key were written
+	copyPath := certService.storage.GetCAPublicCopyPath()
+	if err := os.Remove(copyPath); err != nil {
+		t.Fatalf("Failed to remove public CA certificate: %v", err)
+	}
+	if err := os.Mkdir(copyPath, 0755); err != nil {
+		t.Fatalf("Failed to block public CA certificate: %v", err)
+	}
+	if _, err := certService.RolloverCA(); err == nil {
+		t.Fatal("Expected the rollover to fail")
+	}
+
+	if cert, _ := os.ReadFile(certPath); !bytes.Equal(cert, oldCert) {
+		t.Error("A failed rollover replaced the CA certificate")
+	}
+	if key, _ := os.ReadFile(keyPath); !bytes.Equal(key, oldKey) {
+		t.Error("A failed rollover replaced the CA key")
+	}
+	if _, err := os.Stat(certService.getRetiredCADirectory(formatSerialNumber(oldRoot.SerialNumber))); !os.IsNotExist(err) {
+		t.Error("A failed rollover left the retired CA behind")
+	}
+
+	// The old CA still issues and the rollover can be retried
+	if err := certService.CreateServerCertificate("after-failure.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate after a failed rollover: %v", err)
+	}
+	leaf, err := readCertificateFile(certService.storage.GetCertificatePath("after-failure.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	if err := leaf.CheckSignatureFrom(oldRoot); err != nil {
+		t.Errorf("Expected the old CA to issue after a failed rollover: %v", err)
+	}
+
+	if err := os.Remove(copyPath); err != nil {
+		t.Fatalf("Failed to unblock public CA certificate: %v", err)
+	}
+	rollover, err := certService.RolloverCA()
+	if err != nil {
+		t.Fatalf("Failed to retry the rollover: %v", err)
+	}
+	if rollover.Retired.ID != formatSerialNumber(oldRoot.SerialNumber) {
+		t.Errorf("Expected the old root to be retired, got %s", rollover.Retired.ID)
+	}
+}
+
+func TestRolloverKeepsIssuerDistributionPoints(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+
+	certService := newTestCertificateService(t)
+	certService.config.CAKeyType = "ecdsa"
+	certService.config.PublicBaseURL = "https://ca.example.com"
+
+	if err := certService.CreateServerCertificate("old.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	oldLeaf, err := readCertificateFile(certService.storage.GetCertificatePath("old.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+
+	if _, err := certService.RolloverCA(); err != nil {
+		t.Fatalf("Failed to roll over CA: %v", err)
+	}
+	if err := certService.RevokeCertificateWithReason("old.example.com", ReasonKeyCompromise, nil); err != nil {
+		t.Fatalf("Failed to revoke certificate: %v", err)
+	}
+	if err := certService.CreateServerCertificate("new.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	newLeaf, err := readCertificateFile(certService.storage.GetCertificatePath("new.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	if newLeaf.CRLDistributionPoints[0] == oldLeaf.CRLDistributionPoints[0] {
+		t.Errorf("Expected leaves of different CA generations to have different CRL URLs")
+	}
+
+	// Each leaf finds its own issuer and a CRL signed by it at its URLs
+	for _, leaf := range []*x509.Certificate{oldLeaf, newLeaf} {
+		issuerSerial := strings.TrimPrefix(leaf.IssuingCertificateURL[0], "https://ca.example.com"+CACertificatePath+"/")
+		issuerPEM, err := certService.GetIssuerCertificate(issuerSerial)
+		if err != nil {
+			t.Fatalf("Failed to get issuer at %s: %v", leaf.IssuingCertificateURL[0], err)
+		}
+		issuer := parseBundle(t, issuerPEM)[0]
+		if err := leaf.CheckSignatureFrom(issuer); err != nil {
+			t.Errorf("%s: certificate at the issuer URL did not sign it: %v", leaf.Subject.CommonName, err)
+		}
+
+		crlSerial := strings.TrimPrefix(leaf.CRLDistributionPoints[0], "https://ca.example.com"+CRLPath+"/")
+		crlPEM, err := certService.GetIssuerCRL(crlSerial)
+		if err != nil {
+			t.Fatalf("Failed to get CRL at %s: %v", leaf.CRLDistributionPoints[0], err)
+		}
+		block, _ := pem.Decode(crlPEM)
+		if block == nil {
+			t.Fatal("Failed to decode CRL")
+		}
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			t.Fatalf("Failed to parse CRL: %v", err)
+		}
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			t.Errorf("%s: CRL at the distribution point is not signed by its issuer: %v", leaf.Subject.CommonName, err)
+		}
+
+		revoked := false
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+				revoked = true
+			}
+		}
+		if revoked != (leaf == oldLeaf) {
+			t.Errorf("%s: unexpected revocation state %v in its CRL", leaf.Subject.CommonName, revoked)
+		}
+	}
+
+	if _, err := certService.GetIssuerCRL("1234"); !errors.Is(err, ErrIssuerNotFound) {
+		t.Errorf("Expected ErrIssuerNotFound, got %v", err)
+	}
+}
+
+func TestRolloverCountsArchivedVersions(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl not available")
+	}
+
+	certService := newTestCertificateService(t)
+	certService.config.CAKeyType = "ecdsa"
+
+	profile := Profile{Name: "shrinking", ValidityDays: 365, ExtKeyUsage: []string{"serverAuth"}}
+	if err := certService.CreateProfile(profile); err != nil {
+		t.Fatalf("Failed to create profile: %v", err)
+	}
+	if err := certService.CreateServerCertificateWithOptions("renewed.example.com", nil, IssueOptions{Profile: "shrinking"}); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	original, err := readCertificateFile(certService.storage.GetCertificatePath("renewed.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+
+	// The renewed certificate expires before the archived version it replaces
+	profile.ValidityDays = 30
+	if err := certService.UpdateProfile(profile); err != nil {
+		t.Fatalf("Failed to update profile: %v", err)
+	}
+	if err := certService.RenewServerCertificateWithOptions("renewed.example.com", RenewOptions{}); err != nil {
+		t.Fatalf("Failed to renew certificate: %v", err)
+	}
+
+	rollover, err := certService.RolloverCA()
+	if err != nil {
+		t.Fatalf("Failed to roll over CA: %v", err)
+	}
+	if !rollover.Retired.LastLeafExpiry.Equal(original.NotAfter.UTC()) {
+		t.Errorf("Expected the retired CA to stay active until the archived version expires at %s, got %s",
+			original.NotAfter.UTC(), rollover.Retired.LastLeafExpiry)
+	}
+}
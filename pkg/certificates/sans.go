@@ -0,0 +1,128 @@
+package certificates
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/security"
+)
+
+// SubjectAltNames holds subject alternative names sorted by type
+type SubjectAltNames struct {
+	DNSNames       []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+	EmailAddresses []string
+}
+
+// ParseSubjectAltNames sorts a list of names into DNS names, IP addresses,
+// URIs and email addresses, validating each. Values containing "://" or
+// starting with "urn:" are URIs, values that parse as an IP address are IP
+// addresses, values containing "@" are email addresses and everything else is
+// a DNS name.
+func ParseSubjectAltNames(values []string) (*SubjectAltNames, error) {
+	sans := &SubjectAltNames{}
+	for _, value := range values {
+		if err := sans.Add(value); err != nil {
+			return nil, err
+		}
+	}
+	return sans, nil
+}
+
+// Add classifies and validates a single name, ignoring empty values and duplicates
+func (s *SubjectAltNames) Add(value string) error {
+	value = strings.TrimSpace(value)
+	switch {
+	case value == "":
+		return nil
+	case strings.Contains(value, "://") || strings.HasPrefix(strings.ToLower(value), "urn:"):
+		if !security.ValidateURI(value) {
+			return fmt.Errorf("%w: invalid URI %q", ErrInvalidSAN, value)
+		}
+		uri, err := url.Parse(value)
+		if err != nil {
+			return fmt.Errorf("%w: invalid URI %q", ErrInvalidSAN, value)
+		}
+		for _, existing := range s.URIs {
+			if existing.String() == uri.String() {
+				return nil
+			}
+		}
+		s.URIs = append(s.URIs, uri)
+	case security.ValidateIPAddress(value):
+		ip := net.ParseIP(value)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		for _, existing := range s.IPAddresses {
+			if existing.Equal(ip) {
+				return nil
+			}
+		}
+		s.IPAddresses = append(s.IPAddresses, ip)
+	case strings.Contains(value, "@"):
+		if !security.ValidateEmailAddress(value) {
+			return fmt.Errorf("%w: invalid email address %q", ErrInvalidSAN, value)
+		}
+		if !containsString(s.EmailAddresses, value) {
+			s.EmailAddresses = append(s.EmailAddresses, value)
+		}
+	default:
+		value = strings.ToLower(value)
+		if !security.ValidateDNSName(value) {
+			return fmt.Errorf("%w: invalid DNS name %q", ErrInvalidSAN, value)
+		}
+		if !containsString(s.DNSNames, value) {
+			s.DNSNames = append(s.DNSNames, value)
+		}
+	}
+	return nil
+}
+
+// addCommonName puts a server common name first among the names of its type.
+// Common names that are neither a DNS name nor an IP address are skipped.
+func (s *SubjectAltNames) addCommonName(commonName string) {
+	if security.ValidateIPAddress(commonName) {
+		rest := s.IPAddresses
+		s.IPAddresses = nil
+		s.Add(commonName)
+		for _, ip := range rest {
+			s.Add(ip.String())
+		}
+		return
+	}
+
+	commonName = strings.ToLower(commonName)
+	if !security.ValidateDNSName(commonName) {
+		return
+	}
+	rest := s.DNSNames
+	s.DNSNames = []string{commonName}
+	for _, name := range rest {
+		if name != commonName {
+			s.DNSNames = append(s.DNSNames, name)
+		}
+	}
+}
+
+// apply sets the names on a certificate template
+func (s *SubjectAltNames) apply(template *x509.Certificate) {
+	template.DNSNames = s.DNSNames
+	template.IPAddresses = s.IPAddresses
+	template.URIs = s.URIs
+	template.EmailAddresses = s.EmailAddresses
+}
+
+// subjectAltNamesOf returns the names of an existing certificate
+func subjectAltNamesOf(cert *x509.Certificate) *SubjectAltNames {
+	return &SubjectAltNames{
+		DNSNames:       cert.DNSNames,
+		IPAddresses:    cert.IPAddresses,
+		URIs:           cert.URIs,
+		EmailAddresses: cert.EmailAddresses,
+	}
+}
@@ -0,0 +1,136 @@
+package certificates
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSubjectAltNames(t *testing.T) {
+	sans, err := ParseSubjectAltNames([]string{
+		"www.example.com",
+		"10.0.0.5",
+		"2001:db8::1",
+		"spiffe://example.org/ns/prod/sa/web",
+		"urn:uuid:6e8bc430-9c3a-11d9-9669-0800200c9a66",
+		"ops@example.com",
+		"WWW.example.com",
+		"",
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse SANs: %v", err)
+	}
+
+	if len(sans.DNSNames) != 1 || sans.DNSNames[0] != "www.example.com" {
+		t.Errorf("Unexpected DNS names: %v", sans.DNSNames)
+	}
+	if len(sans.IPAddresses) != 2 || !sans.IPAddresses[0].Equal(net.ParseIP("10.0.0.5")) {
+		t.Errorf("Unexpected IP addresses: %v", sans.IPAddresses)
+	}
+	if len(sans.URIs) != 2 || sans.URIs[0].Scheme != "spiffe" {
+		t.Errorf("Unexpected URIs: %v", sans.URIs)
+	}
+	if len(sans.EmailAddresses) != 1 || sans.EmailAddresses[0] != "ops@example.com" {
+		t.Errorf("Unexpected email addresses: %v", sans.EmailAddresses)
+	}
+
+	for _, value := range []string{"bad name", "spiffe://example.org:1/x", "not-an-email@", "bad_host.example.com"} {
+		if _, err := ParseSubjectAltNames([]string{value}); !errors.Is(err, ErrInvalidSAN) {
+			t.Errorf("Expected ErrInvalidSAN for %q, got %v", value, err)
+		}
+	}
+}
+
+func TestTypedSubjectAltNames(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if err := certService.CreateServerCertificate("api.example.com", []string{"127.0.0.1", "::1", "spiffe://example.org/api", "admin@example.com"}); err != nil {
+		t.Fatalf("Failed to create server certificate: %v", err)
+	}
+
+	serverCert, err := readCertificateFile(certService.storage.GetCertificatePath("api.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read server certificate: %v", err)
+	}
+	if len(serverCert.DNSNames) != 1 || serverCert.DNSNames[0] != "api.example.com" {
+		t.Errorf("Expected only the common name as DNS name, got %v", serverCert.DNSNames)
+	}
+	if len(serverCert.IPAddresses) != 2 {
+		t.Errorf("Expected two IP addresses, got %v", serverCert.IPAddresses)
+	}
+	if len(serverCert.URIs) != 1 || serverCert.URIs[0].String() != "spiffe://example.org/api" {
+		t.Errorf("Unexpected URIs: %v", serverCert.URIs)
+	}
+	if len(serverCert.EmailAddresses) != 1 {
+		t.Errorf("Unexpected email addresses: %v", serverCert.EmailAddresses)
+	}
+
+	// Renewal keeps the typed names
+	if err := certService.RenewServerCertificate("api.example.com"); err != nil {
+		t.Fatalf("Failed to renew server certificate: %v", err)
+	}
+	renewed, err := readCertificateFile(certService.storage.GetCertificatePath("api.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read renewed certificate: %v", err)
+	}
+	if len(renewed.IPAddresses) != 2 || len(renewed.URIs) != 1 || len(renewed.DNSNames) != 1 {
+		t.Errorf("Renewal changed SANs: %v %v %v", renewed.DNSNames, renewed.IPAddresses, renewed.URIs)
+	}
+
+	if err := certService.CreateServerCertificate("bad.example.com", []string{"not a host"}); !errors.Is(err, ErrInvalidSAN) {
+		t.Errorf("Expected ErrInvalidSAN, got %v", err)
+	}
+}
+
+func TestClientCertificateCommonNameNotDNSName(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	opts := IssueOptions{SubjectAltNames: []string{"alice@example.com"}}
+	if err := certService.CreateClientCertificateWithOptions("alice", "client-password", opts); err != nil {
+		t.Fatalf("Failed to create client certificate: %v", err)
+	}
+
+	clientCert, err := readCertificateFile(certService.storage.GetCertificatePath("alice"))
+	if err != nil {
+		t.Fatalf("Failed to read client certificate: %v", err)
+	}
+	if len(clientCert.DNSNames) != 0 {
+		t.Errorf("Client certificate should have no DNS names, got %v", clientCert.DNSNames)
+	}
+	if len(clientCert.EmailAddresses) != 1 || clientCert.EmailAddresses[0] != "alice@example.com" {
+		t.Errorf("Unexpected email addresses: %v", clientCert.EmailAddresses)
+	}
+}
+
+func TestServiceCertificateIPAddresses(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if err := certService.CreateServiceCertificate(); err != nil {
+		t.Fatalf("Failed to create service certificate: %v", err)
+	}
+
+	serviceCert, err := readCertificateFile(filepath.Join(certService.storage.GetBasePath(), "service.crt"))
+	if err != nil {
+		t.Fatalf("Failed to read service certificate: %v", err)
+	}
+
+	for _, name := range serviceCert.DNSNames {
+		if net.ParseIP(name) != nil {
+			t.Errorf("IP address %s must not be a DNS name", name)
+		}
+	}
+
+	hasLoopback := false
+	for _, ip := range serviceCert.IPAddresses {
+		if ip.Equal(net.ParseIP("127.0.0.1")) {
+			hasLoopback = true
+		}
+	}
+	if !hasLoopback {
+		t.Errorf("Expected 127.0.0.1 in IP addresses, got %v", serviceCert.IPAddresses)
+	}
+	if err := serviceCert.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("Service certificate does not verify for 127.0.0.1: %v", err)
+	}
+}
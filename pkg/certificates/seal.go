@@ -0,0 +1,246 @@
+package certificates
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/signer"
+)
+
+// legacyPassphraseFile is where earlier versions stored the CA key passphrase
+const legacyPassphraseFile = "CA_KEY.txt"
+
+// Sealed reports whether the CA keys are locked. Nothing can be signed while
+// the CA is sealed.
+func (c *CertificateService) Sealed() bool {
+	c.sealMutex.RLock()
+	defer c.sealMutex.RUnlock()
+	return c.passphrase == nil
+}
+
+// Seal forgets the passphrase and all decrypted CA keys and locks the signer
+// backend. Unseal shares submitted before are discarded.
+func (c *CertificateService) Seal() {
+	c.sealMutex.Lock()
+	c.seal()
+	c.sealMutex.Unlock()
+
+	// shareMutex is taken before sealMutex when unsealing with shares
+	c.ResetUnsealShares()
+}
+
+// seal locks the CA. The caller must hold sealMutex.
+func (c *CertificateService) seal() {
+	clear(c.passphrase)
+	c.passphrase = nil
+	c.caKeys = nil
+	if c.signerBackend != nil {
+		if err := c.signerBackend.Lock(); err != nil {
+			log.Printf("Failed to lock %s signer backend: %v", c.signerBackend.Name(), err)
+		}
+	}
+}
+
+// Unseal unlocks the CA keys with the passphrase, which is the token PIN or
+// the remote signer passphrase when a signer backend holds the keys. Without
+// a CA the passphrase is kept to encrypt the keys CreateCA generates.
+// Plaintext CA keys left by earlier versions are encrypted with the
+// passphrase and removed. The CA stays sealed when the passphrase is wrong;
+// an unsealed CA returns ErrCANotSealed and is left as it is.
+func (c *CertificateService) Unseal(passphrase string) error {
+	if passphrase == "" {
+		return ErrInvalidPassphrase
+	}
+	secret := []byte(passphrase)
+
+	c.sealMutex.Lock()
+	defer c.sealMutex.Unlock()
+
+	if c.passphrase != nil {
+		return ErrCANotSealed
+	}
+
+	keys := make(map[string]crypto.Signer)
+	if c.signerBackend != nil {
+		if err := c.signerBackend.Unlock(passphrase); err != nil {
+			return err
+		}
+	} else if err := c.migrateLegacyKeys(secret, keys); err != nil {
+		return err
+	}
+
+	// One key is enough to check the passphrase, the rest are opened on
+	// demand. The service stays sealed until the check passes.
+	if len(keys) == 0 {
+		for _, path := range []string{c.storage.GetCAEncryptedKeyPath(), c.getIntermediateKeyPath()} {
+			data, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err == nil {
+				keys[path], err = c.decryptCAKeyPEM(data, secret)
+			}
+			if err != nil {
+				if c.signerBackend != nil {
+					if lockErr := c.signerBackend.Lock(); lockErr != nil {
+						log.Printf("Failed to lock %s signer backend: %v", c.signerBackend.Name(), lockErr)
+					}
+				}
+				if errors.Is(err, ErrInvalidPassphrase) {
+					return err
+				}
+				return fmt.Errorf("failed to open CA private key: %w", err)
+			}
+			break
+		}
+	}
+
+	c.passphrase = secret
+	c.caKeys = keys
+	return nil
+}
+
+// migrateLegacyKeys encrypts the plaintext root, intermediate and retired CA
+// keys written by earlier versions and removes the stored passphrase. When
+// that passphrase exists it must match. Migrated keys are added to keys.
+func (c *CertificateService) migrateLegacyKeys(passphrase []byte, keys map[string]crypto.Signer) error {
+	legacyPassphrasePath := filepath.Join(c.storage.GetCADirectory(), legacyPassphraseFile)
+	stored, err := os.ReadFile(legacyPassphrasePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read stored passphrase: %w", err)
+	}
+	if err == nil && subtle.ConstantTimeCompare(stored, passphrase) != 1 {
+		return ErrInvalidPassphrase
+	}
+
+	// The plaintext root key replaces the copy encrypted by openssl
+	type legacyKey struct{ src, dst string }
+	legacy := []legacyKey{
+		{c.storage.GetCAPrivateKeyPath(), c.storage.GetCAEncryptedKeyPath()},
+		{c.getIntermediateKeyPath(), c.getIntermediateKeyPath()},
+	}
+	retiredDirs, err := os.ReadDir(c.getRetiredDirectory())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read retired CA directory: %w", err)
+	}
+	for _, entry := range retiredDirs {
+		dir := c.getRetiredCADirectory(entry.Name())
+		for _, name := range []string{retiredRootKeyFile, filepath.Base(c.getIntermediateKeyPath())} {
+			legacy = append(legacy, legacyKey{filepath.Join(dir, name), filepath.Join(dir, name)})
+		}
+	}
+
+	for _, file := range legacy {
+		data, err := os.ReadFile(file.src)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read private key: %w", err)
+		}
+		if signer.IsEncryptedKeyPEM(data) {
+			continue
+		}
+
+		key, err := parsePrivateKeyPEM(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse private key %s: %w", filepath.Base(file.src), err)
+		}
+		if err := signer.WriteEncryptedKeyFile(file.dst, key, passphrase); err != nil {
+			return fmt.Errorf("failed to encrypt private key %s: %w", filepath.Base(file.src), err)
+		}
+		if file.src != file.dst {
+			if err := os.Remove(file.src); err != nil {
+				return fmt.Errorf("failed to remove plaintext private key: %w", err)
+			}
+		}
+		keys[file.dst] = key
+	}
+
+	if err := os.Remove(legacyPassphrasePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stored passphrase: %w", err)
+	}
+	return nil
+}
+
+// readCAKeyFile returns the CA key stored at path
+func (c *CertificateService) readCAKeyFile(path string) (crypto.Signer, error) {
+	c.sealMutex.Lock()
+	defer c.sealMutex.Unlock()
+
+	if c.passphrase == nil {
+		return nil, ErrCASealed
+	}
+	if key, ok := c.caKeys[path]; ok {
+		return key, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	key, err := c.openCAKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+
+	c.caKeys[path] = key
+	return key, nil
+}
+
+// writeCAKeyFile stores a key from generateCAKey at path
+func (c *CertificateService) writeCAKeyFile(path string, key crypto.Signer) error {
+	c.sealMutex.Lock()
+	defer c.sealMutex.Unlock()
+
+	if c.passphrase == nil {
+		return ErrCASealed
+	}
+	if err := c.storeCAKey(path, key); err != nil {
+		return err
+	}
+
+	c.caKeys[path] = key
+	return nil
+}
+
+// restoreCAKeyFile puts back a CA key file and the key loaded from it, as
+// they were before a failed operation replaced them
+func (c *CertificateService) restoreCAKeyFile(path string, data []byte, key crypto.Signer) error {
+	c.sealMutex.Lock()
+	defer c.sealMutex.Unlock()
+
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return err
+	}
+	if c.caKeys != nil {
+		c.caKeys[path] = key
+	}
+	return nil
+}
+
+// removeCAKeyFile deletes a CA key from disk and from memory. A backend key
+// stays in its backend, only the reference is deleted.
+func (c *CertificateService) removeCAKeyFile(path string) error {
+	c.sealMutex.Lock()
+	defer c.sealMutex.Unlock()
+
+	delete(c.caKeys, path)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// loadCAKeyPEM opens the content of a CA key file that is not stored at its
+// usual path, such as an uploaded offline root key
+func (c *CertificateService) loadCAKeyPEM(data []byte) (crypto.Signer, error) {
+	c.sealMutex.RLock()
+	defer c.sealMutex.RUnlock()
+	return c.openCAKeyPEM(data)
+}
@@ -0,0 +1,197 @@
+package certificates
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/config"
+	"github.com/Lazarev-Cloud/localca-go/pkg/signer"
+	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestSealedCA(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if err := certService.CreateServerCertificate("before.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	if err := certService.GenerateCRL(); err != nil {
+		t.Fatalf("Failed to generate CRL: %v", err)
+	}
+	leaf, err := readCertificateFile(certService.storage.GetCertificatePath("before.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	issuer, err := certService.loadCACertificate()
+	if err != nil {
+		t.Fatalf("Failed to load CA certificate: %v", err)
+	}
+
+	certService.Seal()
+	if !certService.Sealed() {
+		t.Fatal("Expected the CA to be sealed")
+	}
+
+	if err := certService.CreateServerCertificate("sealed.example.com", nil); !errors.Is(err, ErrCASealed) {
+		t.Errorf("Expected ErrCASealed when issuing, got %v", err)
+	}
+	if err := certService.CreateClientCertificate("sealed-client", "password123"); !errors.Is(err, ErrCASealed) {
+		t.Errorf("Expected ErrCASealed when issuing a client certificate, got %v", err)
+	}
+	for _, name := range []string{"sealed.example.com", "sealed-client"} {
+		if _, err := os.Stat(certService.storage.GetCertificateDirectory(name)); !os.IsNotExist(err) {
+			t.Errorf("A sealed CA left files behind for %s", name)
+		}
+	}
+	if err := certService.RevokeCertificate("before.example.com"); !errors.Is(err, ErrCASealed) {
+		t.Errorf("Expected ErrCASealed when revoking, got %v", err)
+	}
+
+	// The last CRL is still published and OCSP asks clients to retry
+	if _, err := certService.GetCRL(); err != nil {
+		t.Errorf("Failed to get CRL while sealed: %v", err)
+	}
+	request, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		t.Fatalf("Failed to create OCSP request: %v", err)
+	}
+	response, err := certService.OCSPResponse(request)
+	if err != nil {
+		t.Fatalf("Failed to get OCSP response: %v", err)
+	}
+	if string(response) != string(ocsp.TryLaterErrorResponse) {
+		t.Errorf("Expected tryLater OCSP response while sealed")
+	}
+
+	if err := certService.Unseal("wrong passphrase"); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase, got %v", err)
+	}
+	if !certService.Sealed() {
+		t.Fatal("A wrong passphrase unsealed the CA")
+	}
+
+	if err := certService.Unseal(certService.config.CAKeyPassword); err != nil {
+		t.Fatalf("Failed to unseal CA: %v", err)
+	}
+	if err := certService.CreateServerCertificate("unsealed.example.com", nil); err != nil {
+		t.Errorf("Failed to create certificate after unsealing: %v", err)
+	}
+
+	// Unsealing a running CA, even with a wrong passphrase, leaves it running
+	if err := certService.Unseal("wrong passphrase"); !errors.Is(err, ErrCANotSealed) {
+		t.Errorf("Expected ErrCANotSealed, got %v", err)
+	}
+	if certService.Sealed() {
+		t.Fatal("A wrong passphrase sealed the running CA")
+	}
+	if err := certService.CreateServerCertificate("still-unsealed.example.com", nil); err != nil {
+		t.Errorf("Failed to create certificate after a rejected unseal: %v", err)
+	}
+}
+
+func TestCreateCAWritesOnlyEncryptedKey(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := storage.NewStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	cfg := &config.Config{
+		CAName:        "Test CA",
+		CAKeyPassword: generateTestPassword(),
+		CAKeyType:     "ecdsa",
+		CAMode:        CAModeTwoTier,
+		Organization:  "Test Org",
+		Country:       "US",
+		DataDir:       tempDir,
+	}
+	certService, err := NewCertificateService(cfg, store)
+	if err != nil {
+		t.Fatalf("Failed to create certificate service: %v", err)
+	}
+
+	if err := certService.CreateCA(); !errors.Is(err, ErrCASealed) {
+		t.Fatalf("Expected ErrCASealed before unsealing, got %v", err)
+	}
+	if err := certService.Unseal(cfg.CAKeyPassword); err != nil {
+		t.Fatalf("Failed to unseal CA: %v", err)
+	}
+	if err := certService.CreateCA(); err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+
+	if _, err := os.Stat(store.GetCAPrivateKeyPath()); !os.IsNotExist(err) {
+		t.Errorf("Plaintext CA key was written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store.GetCADirectory(), legacyPassphraseFile)); !os.IsNotExist(err) {
+		t.Errorf("CA passphrase was written: %v", err)
+	}
+	for _, path := range []string{store.GetCAEncryptedKeyPath(), certService.getIntermediateKeyPath()} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read key: %v", err)
+		}
+		if !signer.IsEncryptedKeyPEM(data) {
+			t.Errorf("%s is not encrypted", filepath.Base(path))
+		}
+	}
+
+	// A restarted server starts sealed and unseals with the same passphrase
+	restarted, err := NewCertificateService(cfg, store)
+	if err != nil {
+		t.Fatalf("Failed to create certificate service: %v", err)
+	}
+	if exists, err := restarted.CAExists(); err != nil || !exists {
+		t.Fatalf("Expected the CA to exist, got %v %v", exists, err)
+	}
+	if err := restarted.Unseal("wrong passphrase"); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase, got %v", err)
+	}
+	if err := restarted.Unseal(cfg.CAKeyPassword); err != nil {
+		t.Fatalf("Failed to unseal CA: %v", err)
+	}
+	if err := restarted.CreateServerCertificate("restart.example.com", nil); err != nil {
+		t.Errorf("Failed to create certificate: %v", err)
+	}
+}
+
+func TestUnsealMigratesLegacyKeys(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	// Recreate the layout of an earlier version: plaintext key plus stored passphrase
+	caKey, err := certService.loadCAPrivateKey()
+	if err != nil {
+		t.Fatalf("Failed to load CA key: %v", err)
+	}
+	certService.Seal()
+	if err := writePrivateKeyFile(certService.storage.GetCAPrivateKeyPath(), caKey); err != nil {
+		t.Fatalf("Failed to write plaintext key: %v", err)
+	}
+	passphrasePath := filepath.Join(certService.storage.GetCADirectory(), legacyPassphraseFile)
+	if err := os.WriteFile(passphrasePath, []byte(certService.config.CAKeyPassword), 0600); err != nil {
+		t.Fatalf("Failed to write passphrase: %v", err)
+	}
+
+	// The stored passphrase must match before anything is migrated
+	if err := certService.Unseal("wrong passphrase"); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase, got %v", err)
+	}
+	if _, err := os.Stat(certService.storage.GetCAPrivateKeyPath()); err != nil {
+		t.Fatalf("Plaintext key was removed after a failed unseal: %v", err)
+	}
+
+	if err := certService.Unseal(certService.config.CAKeyPassword); err != nil {
+		t.Fatalf("Failed to unseal CA: %v", err)
+	}
+	for _, path := range []string{certService.storage.GetCAPrivateKeyPath(), passphrasePath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed: %v", filepath.Base(path), err)
+		}
+	}
+	if err := certService.CreateServerCertificate("migrated.example.com", nil); err != nil {
+		t.Errorf("Failed to create certificate after migration: %v", err)
+	}
+}
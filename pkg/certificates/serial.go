@@ -0,0 +1,158 @@
+package certificates
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"sort"
+)
+
+// serialNumberBits is the size of random certificate serial numbers
+const serialNumberBits = 128
+
+// maxSerialAttempts bounds the retries when a random serial is already taken
+const maxSerialAttempts = 8
+
+// DuplicateSerial is a serial number held by more than one certificate
+type DuplicateSerial struct {
+	SerialNumber string   `json:"serial_number"`
+	Certificates []string `json:"certificates"`
+}
+
+// SerialReport lists duplicate serial numbers found in the data directory
+type SerialReport struct {
+	CertificatesChecked int               `json:"certificates_checked"`
+	Duplicates          []DuplicateSerial `json:"duplicates"`
+}
+
+// randomSerialNumber returns a random positive serial number of serialNumberBits bits
+func randomSerialNumber() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), serialNumberBits)
+	for {
+		serial, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate serial number: %w", err)
+		}
+		if serial.Sign() > 0 {
+			return serial, nil
+		}
+	}
+}
+
+// newSerialNumber returns a random serial number that is not used by any
+// mapped, indexed or revoked certificate
+func (c *CertificateService) newSerialNumber() (*big.Int, error) {
+	revoked, err := c.GetRevokedCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < maxSerialAttempts; attempt++ {
+		serial, err := randomSerialNumber()
+		if err != nil {
+			return nil, err
+		}
+		serialNumber := formatSerialNumber(serial)
+
+		inUse, err := c.serialNumberKnown(serialNumber)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range revoked {
+			if entry.SerialNumber == serialNumber {
+				inUse = true
+				break
+			}
+		}
+
+		if !inUse {
+			return serial, nil
+		}
+	}
+
+	return nil, ErrSerialExhausted
+}
+
+// serialNumberKnown reports whether a serial number is held by a certificate
+// in the serial mapping or the certificate index, without reading any
+// certificate
+func (c *CertificateService) serialNumberKnown(serialNumber string) (bool, error) {
+	inUse, err := c.storage.SerialNumberInUse(serialNumber)
+	if err != nil || inUse {
+		return inUse, err
+	}
+	return c.serialNumberIndexed(serialNumber), nil
+}
+
+// recordSerialNumber maps an issued serial number to its certificate
+func (c *CertificateService) recordSerialNumber(serial *big.Int, name string) error {
+	if err := c.storage.SaveCertificateSerialMapping(formatSerialNumber(serial), name); err != nil {
+		return fmt.Errorf("failed to save serial mapping: %w", err)
+	}
+	return nil
+}
+
+// CheckSerialNumbers reports serial numbers shared by more than one
+// certificate, looking at stored certificates, the CA certificates and the
+// revocation database
+func (c *CertificateService) CheckSerialNumbers() (*SerialReport, error) {
+	holders := make(map[string]map[string]bool)
+	addHolder := func(serialNumber, holder string) {
+		if holders[serialNumber] == nil {
+			holders[serialNumber] = make(map[string]bool)
+		}
+		holders[serialNumber][holder] = true
+	}
+
+	report := &SerialReport{}
+
+	names, err := c.storage.ListCertificates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list certificates: %w", err)
+	}
+	for _, name := range names {
+		cert, err := readCertificateFile(c.storage.GetCertificatePath(name))
+		if err != nil {
+			continue
+		}
+		report.CertificatesChecked++
+		addHolder(formatSerialNumber(cert.SerialNumber), name)
+	}
+
+	for _, path := range []string{c.storage.GetCAPublicKeyPath(), c.getIntermediateCertPath()} {
+		cert, err := readCertificateFile(path)
+		if err != nil {
+			continue
+		}
+		report.CertificatesChecked++
+		addHolder(formatSerialNumber(cert.SerialNumber), filepath.Join("ca", filepath.Base(path)))
+	}
+
+	// A revoked serial reused by another certificate makes that certificate
+	// appear revoked on the CRL
+	revoked, err := c.GetRevokedCertificates()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range revoked {
+		addHolder(entry.SerialNumber, entry.Name)
+	}
+
+	for serialNumber, names := range holders {
+		if len(names) < 2 {
+			continue
+		}
+		duplicate := DuplicateSerial{SerialNumber: serialNumber}
+		for name := range names {
+			duplicate.Certificates = append(duplicate.Certificates, name)
+		}
+		sort.Strings(duplicate.Certificates)
+		report.Duplicates = append(report.Duplicates, duplicate)
+	}
+	sort.Slice(report.Duplicates, func(i, j int) bool {
+		return report.Duplicates[i].SerialNumber < report.Duplicates[j].SerialNumber
+	})
+
+	return report, nil
+}
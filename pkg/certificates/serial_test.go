@@ -0,0 +1,127 @@
+package certificates
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRandomSerialNumber(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		serial, err := randomSerialNumber()
+		if err != nil {
+			t.Fatalf("Failed to generate serial number: %v", err)
+		}
+		if serial.Sign() <= 0 {
+			t.Fatalf("Serial number must be positive, got %s", serial)
+		}
+		if serial.BitLen() > serialNumberBits {
+			t.Fatalf("Serial number has %d bits, want at most %d", serial.BitLen(), serialNumberBits)
+		}
+		if seen[serial.String()] {
+			t.Fatalf("Duplicate serial number %s", serial)
+		}
+		seen[serial.String()] = true
+	}
+}
+
+func TestIssuedSerialNumbersAreUnique(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	// Certificates issued within the same second must not share a serial
+	seen := make(map[string]string)
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("bulk%d.example.com", i)
+		if err := certService.CreateServerCertificate(name, nil); err != nil {
+			t.Fatalf("Failed to create certificate: %v", err)
+		}
+
+		cert, err := readCertificateFile(certService.storage.GetCertificatePath(name))
+		if err != nil {
+			t.Fatalf("Failed to read certificate: %v", err)
+		}
+		serialNumber := formatSerialNumber(cert.SerialNumber)
+		if other, ok := seen[serialNumber]; ok {
+			t.Fatalf("Certificates %s and %s share serial %s", other, name, serialNumber)
+		}
+		seen[serialNumber] = name
+
+		// The serial is recorded in the mapping
+		inUse, err := certService.storage.SerialNumberInUse(serialNumber)
+		if err != nil || !inUse {
+			t.Errorf("Serial %s of %s is not recorded: %v", serialNumber, name, err)
+		}
+		mapped, err := certService.storage.GetCertificateNameBySerial(serialNumber)
+		if err != nil || mapped != name {
+			t.Errorf("Serial %s maps to %q, want %s (%v)", serialNumber, mapped, name, err)
+		}
+	}
+
+	report, err := certService.CheckSerialNumbers()
+	if err != nil {
+		t.Fatalf("Failed to check serial numbers: %v", err)
+	}
+	if len(report.Duplicates) != 0 {
+		t.Errorf("Expected no duplicates, got %+v", report.Duplicates)
+	}
+}
+
+func TestSerialNumberKnown(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if err := certService.CreateServerCertificate("legacy.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	if _, err := certService.GetAllCertificates(); err != nil {
+		t.Fatalf("Failed to index certificates: %v", err)
+	}
+	info, err := certService.GetCertificateInfo("legacy.example.com")
+	if err != nil {
+		t.Fatalf("Failed to get certificate info: %v", err)
+	}
+
+	// A certificate stored without a mapping is still found through the index
+	if err := os.Remove(filepath.Join(certService.storage.GetBasePath(), "serials", info.SerialNumber)); err != nil {
+		t.Fatalf("Failed to remove serial mapping: %v", err)
+	}
+	if known, err := certService.serialNumberKnown(info.SerialNumber); err != nil || !known {
+		t.Errorf("Expected the indexed serial to be known, got %v %v", known, err)
+	}
+	if known, err := certService.serialNumberKnown("0123456789ABCDEF"); err != nil || known {
+		t.Errorf("Expected an unused serial to be unknown, got %v %v", known, err)
+	}
+}
+
+func TestCheckSerialNumbersFindsDuplicates(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if err := certService.CreateServerCertificate("a.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	// Simulate a legacy certificate issued with the same serial
+	certPEM, err := os.ReadFile(certService.storage.GetCertificatePath("a.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	if err := os.MkdirAll(certService.storage.GetCertificateDirectory("b.example.com"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(certService.storage.GetCertificatePath("b.example.com"), certPEM, 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+
+	report, err := certService.CheckSerialNumbers()
+	if err != nil {
+		t.Fatalf("Failed to check serial numbers: %v", err)
+	}
+	if len(report.Duplicates) != 1 {
+		t.Fatalf("Expected one duplicate serial, got %+v", report.Duplicates)
+	}
+	duplicate := report.Duplicates[0]
+	if len(duplicate.Certificates) != 2 || duplicate.Certificates[0] != "a.example.com" || duplicate.Certificates[1] != "b.example.com" {
+		t.Errorf("Unexpected duplicate holders: %v", duplicate.Certificates)
+	}
+}
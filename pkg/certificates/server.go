@@ -2,275 +2,331 @@ package certificates
 
 import (
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
-	"math/big"
 	"os"
-	"os/exec"
-	"strings"
 	"time"
-
-	"github.com/Lazarev-Cloud/localca-go/pkg/security"
 )
 
-// Certificate represents a certificate
+// Certificate holds the parsed metadata of an issued certificate
 type Certificate struct {
-	CommonName   string
-	SerialNumber string
-	NotBefore    time.Time
-	NotAfter     time.Time
-	Issuer       string
-	IsClient     bool
-	Path         string
+	Name         string    `json:"name"`
+	CommonName   string    `json:"common_name"`
+	Subject      string    `json:"subject"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	Issuer       string    `json:"issuer"`
+	IsClient     bool      `json:"is_client"`
+	Path         string    `json:"-"`
+	Profile      string    `json:"profile,omitempty"`
+
+	// Ownership metadata; Labels are user-assigned key=value tags
+	OwnerEmail string            `json:"owner_email,omitempty"`
+	Team       string            `json:"team,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Notes      string            `json:"notes,omitempty"`
+
+	// AutoRenew is the renewal policy set on the certificate itself; without
+	// one the policy of its profile applies
+	AutoRenew *RenewalPolicy `json:"auto_renew,omitempty"`
+
+	// Subject alternative names by type
+	DNSNames       []string `json:"dns_names,omitempty"`
+	IPAddresses    []string `json:"ip_addresses,omitempty"`
+	URIs           []string `json:"uris,omitempty"`
+	EmailAddresses []string `json:"email_addresses,omitempty"`
+
+	KeyAlgorithm       KeyAlgorithm `json:"key_algorithm"`
+	KeySize            int          `json:"key_size,omitempty"`
+	SignatureAlgorithm string       `json:"signature_algorithm"`
+	KeyUsage           []string     `json:"key_usage,omitempty"`
+	ExtKeyUsage        []string     `json:"ext_key_usage,omitempty"`
+	HasPrivateKey      bool         `json:"has_private_key"`
+
+	FingerprintSHA1   string `json:"fingerprint_sha1"`
+	FingerprintSHA256 string `json:"fingerprint_sha256"`
+	// SPKIPin is the base64 SHA-256 hash of the subject public key info
+	SPKIPin string `json:"spki_pin_sha256"`
+
+	Revoked          bool       `json:"revoked"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevocationReason string     `json:"revocation_reason,omitempty"`
+
+	// Replaces is the serial number of the version this certificate renewed;
+	// it is only set by GetCertificateInfo
+	Replaces string `json:"replaces,omitempty"`
+
+	// Chain holds the CA certificates above the certificate, issuer first
+	Chain []ChainCertificate `json:"chain,omitempty"`
+	PEM   string             `json:"pem,omitempty"`
+}
+
+// IssueOptions controls how a new certificate is issued
+type IssueOptions struct {
+	KeyAlgorithm KeyAlgorithm
+	KeySize      int
+	// Profile names the certificate profile; empty selects the default for the certificate type
+	Profile string
+	// SubjectAltNames are extra names for client certificates, parsed like the
+	// additional domains of a server certificate
+	SubjectAltNames []string
+	// Metadata is the owner, team, labels and notes to attach to the certificate
+	Metadata CertificateMetadata
+}
+
+// RenewOptions controls how a certificate is renewed
+type RenewOptions struct {
+	// RotateKey replaces the key pair instead of certifying the existing
+	// public key again. Certificates issued from a CSR have no key to rotate.
+	RotateKey bool
+	// RevokeSuperseded overrides the supersede policy of the profile for
+	// the certificate being replaced
+	RevokeSuperseded *SupersedePolicy
+}
+
+// validate checks the supersede policy of the options
+func (o RenewOptions) validate() error {
+	if o.RevokeSuperseded != nil {
+		return o.RevokeSuperseded.Validate()
+	}
+	return nil
+}
+
+// keySpec returns the validated key spec for the options
+func (o IssueOptions) keySpec() (KeySpec, error) {
+	return ParseKeySpec(string(o.KeyAlgorithm), o.KeySize)
 }
 
 // CreateServerCertificate creates a new server certificate
 func (c *CertificateService) CreateServerCertificate(commonName string, additionalDomains []string) error {
-	// Create directory for the certificate
-	certDir := c.storage.GetCertificateDirectory(commonName)
-	if err := os.MkdirAll(certDir, 0755); err != nil {
-		return fmt.Errorf("failed to create certificate directory: %w", err)
-	}
+	return c.CreateServerCertificateWithOptions(commonName, additionalDomains, IssueOptions{})
+}
 
-	// Generate server key pair
-	serverPrivKey, err := rsa.GenerateKey(rand.Reader, 2048)
+// CreateServerCertificateWithOptions creates a new server certificate using the given issue options
+func (c *CertificateService) CreateServerCertificateWithOptions(commonName string, additionalDomains []string, opts IssueOptions) error {
+	keySpec, err := opts.keySpec()
 	if err != nil {
-		return fmt.Errorf("failed to generate server private key: %w", err)
+		return err
 	}
-
-	// Save server private key to file
-	serverKeyPath := c.storage.GetCertificateKeyPath(commonName)
-	serverKeyFile, err := os.Create(serverKeyPath)
-	if err != nil {
-		return fmt.Errorf("failed to create server key file: %w", err)
+	if err := opts.Metadata.Validate(); err != nil {
+		return err
 	}
-	defer serverKeyFile.Close()
 
-	if err := pem.Encode(serverKeyFile, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(serverPrivKey),
-	}); err != nil {
-		return fmt.Errorf("failed to encode server private key: %w", err)
+	sans, err := ParseSubjectAltNames(additionalDomains)
+	if err != nil {
+		return err
 	}
+	sans.addCommonName(commonName)
 
-	// Create server certificate template
-	dnsNames := append([]string{commonName}, additionalDomains...)
-	serverTemplate := x509.Certificate{
-		SerialNumber: big.NewInt(time.Now().Unix()),
-		Subject: pkix.Name{
-			CommonName: commonName,
-		},
-		NotBefore:   time.Now(),
-		NotAfter:    time.Now().AddDate(1, 0, 0), // 1 year validity
-		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		DNSNames:    dnsNames,
+	// Refuse to replace an existing certificate and fail on a sealed CA
+	// before anything is written
+	if _, err := os.Stat(c.storage.GetCertificatePath(commonName)); err == nil {
+		return ErrCertificateAlreadyExists
 	}
 
-	// Load CA certificate
-	caCertBytes, err := os.ReadFile(c.storage.GetCAPublicKeyPath())
+	profile, err := c.resolveProfile(opts.Profile, false)
 	if err != nil {
-		return fmt.Errorf("failed to read CA certificate: %w", err)
+		return err
 	}
-
-	caCertBlock, _ := pem.Decode(caCertBytes)
-	if caCertBlock == nil {
-		return fmt.Errorf("failed to decode CA certificate PEM")
+	if err := profile.allowsAlgorithm(keySpec.Algorithm); err != nil {
+		return err
 	}
 
-	caCert, err := x509.ParseCertificate(caCertBlock.Bytes)
+	// Load issuing CA certificate and key
+	caCert, caKey, err := c.loadIssuer()
 	if err != nil {
-		return fmt.Errorf("failed to parse CA certificate: %w", err)
+		return err
 	}
 
-	// Load CA private key
-	caKeyBytes, err := os.ReadFile(c.storage.GetCAPrivateKeyPath())
+	// Generate server key pair
+	serverPrivKey, err := generateKey(keySpec)
 	if err != nil {
-		return fmt.Errorf("failed to read CA private key: %w", err)
+		return fmt.Errorf("failed to generate server private key: %w", err)
 	}
 
-	caKeyBlock, _ := pem.Decode(caKeyBytes)
-	if caKeyBlock == nil {
-		return fmt.Errorf("failed to decode CA private key PEM")
+	serial, err := c.newSerialNumber()
+	if err != nil {
+		return err
 	}
 
-	caKey, err := x509.ParsePKCS1PrivateKey(caKeyBlock.Bytes)
-	if err != nil {
-		return fmt.Errorf("failed to parse CA private key: %w", err)
+	// Create server certificate template
+	serverTemplate := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+	}
+	sans.apply(&serverTemplate)
+	if err := profile.apply(&serverTemplate, serverPrivKey.Public()); err != nil {
+		return err
 	}
+	c.applyDistributionPoints(&serverTemplate, caCert)
 
 	// Create server certificate
-	serverCertBytes, err := x509.CreateCertificate(rand.Reader, &serverTemplate, caCert, &serverPrivKey.PublicKey, caKey)
+	serverCertBytes, err := x509.CreateCertificate(rand.Reader, &serverTemplate, caCert, serverPrivKey.Public(), caKey)
 	if err != nil {
 		return fmt.Errorf("failed to create server certificate: %w", err)
 	}
 
-	// Save server certificate to file
-	serverCertPath := c.storage.GetCertificatePath(commonName)
-	serverCertFile, err := os.Create(serverCertPath)
-	if err != nil {
-		return fmt.Errorf("failed to create server certificate file: %w", err)
+	// Create directory for the certificate
+	certDir := c.storage.GetCertificateDirectory(commonName)
+	if err := os.MkdirAll(certDir, 0755); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
 	}
-	defer serverCertFile.Close()
 
-	if err := pem.Encode(serverCertFile, &pem.Block{Type: "CERTIFICATE", Bytes: serverCertBytes}); err != nil {
-		return fmt.Errorf("failed to encode server certificate: %w", err)
+	// Save server private key to file
+	serverKeyPath := c.storage.GetCertificateKeyPath(commonName)
+	if err := writePrivateKeyFile(serverKeyPath, serverPrivKey); err != nil {
+		return fmt.Errorf("failed to save server private key: %w", err)
+	}
+
+	// Save server certificate to file
+	serverCertPath := c.storage.GetCertificatePath(commonName)
+	serverCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCertBytes})
+	if err := os.WriteFile(serverCertPath, serverCertPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write server certificate: %w", err)
 	}
 
 	// Create certificate bundle with CA
 	bundlePath := c.storage.GetCertificateBundlePath(commonName)
-	bundleFile, err := os.Create(bundlePath)
-	if err != nil {
-		return fmt.Errorf("failed to create certificate bundle file: %w", err)
+	if err := c.createCertificateBundle(serverCertPath, bundlePath); err != nil {
+		return fmt.Errorf("failed to create certificate bundle: %w", err)
 	}
-	defer bundleFile.Close()
 
-	// Write server certificate
-	if err := pem.Encode(bundleFile, &pem.Block{Type: "CERTIFICATE", Bytes: serverCertBytes}); err != nil {
-		return fmt.Errorf("failed to encode server certificate in bundle: %w", err)
+	if err := c.recordSerialNumber(serial, commonName); err != nil {
+		return err
 	}
 
-	// Write CA certificate
-	if _, err := bundleFile.Write(caCertBytes); err != nil {
-		return fmt.Errorf("failed to write CA certificate to bundle: %w", err)
+	if err := c.recordCertificateProfile(commonName, profile.Name); err != nil {
+		return err
 	}
 
-	// Set permissions
-	os.Chmod(serverKeyPath, 0600)
-	os.Chmod(serverCertPath, 0644)
-	os.Chmod(bundlePath, 0644)
+	if err := c.recordCertificateMetadata(commonName, opts.Metadata); err != nil {
+		return err
+	}
 
+	c.updateIndex(commonName)
 	return nil
 }
 
 // RenewServerCertificate renews an existing server certificate
 func (c *CertificateService) RenewServerCertificate(commonName string) error {
+	return c.RenewServerCertificateWithOptions(commonName, RenewOptions{})
+}
+
+// RenewServerCertificateWithOptions renews a server certificate, optionally
+// with a new key
+func (c *CertificateService) RenewServerCertificateWithOptions(commonName string, opts RenewOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
 	// Check if certificate exists
 	certPath := c.storage.GetCertificatePath(commonName)
-	keyPath := c.storage.GetCertificateKeyPath(commonName)
 
 	if _, err := os.Stat(certPath); os.IsNotExist(err) {
 		return fmt.Errorf("certificate does not exist: %s", commonName)
 	}
-	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
-		return fmt.Errorf("certificate key does not exist: %s", commonName)
-	}
 
-	// Get DNS names from existing certificate
-	cmd := exec.Command(
-		"openssl", "x509",
-		"-in", certPath,
-		"-noout",
-		"-text",
-	)
-	output, err := cmd.Output()
+	// Reuse the names and public key of the existing certificate, so
+	// certificates issued from a CSR renew without a key file
+	existing, err := readCertificateFile(certPath)
 	if err != nil {
-		return fmt.Errorf("failed to get certificate info: %w", err)
-	}
-
-	// Parse DNS names
-	outputStr := string(output)
-	dnsNames := []string{commonName}
-	sanIndex := strings.Index(outputStr, "DNS:")
-	if sanIndex != -1 {
-		sanPart := outputStr[sanIndex:]
-		endIndex := strings.Index(sanPart, "\n")
-		if endIndex != -1 {
-			sanList := sanPart[:endIndex]
-			parts := strings.Split(sanList, ",")
-			for _, part := range parts {
-				part = strings.TrimSpace(part)
-				if strings.HasPrefix(part, "DNS:") {
-					name := strings.TrimPrefix(part, "DNS:")
-					if name != commonName {
-						dnsNames = append(dnsNames, name)
-					}
-				}
-			}
-		}
+		return err
 	}
 
-	// Generate CSR
-	csrPath := c.storage.GetCertificateDirectory(commonName) + "/" + commonName + ".csr"
-	cmd = exec.Command(
-		"openssl", "req",
-		"-new",
-		"-key", keyPath,
-		"-out", csrPath,
-		"-subj", "/CN="+security.ValidateSubjectDN(commonName),
-	)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create CSR: %w", err)
+	// Renew with the profile the certificate was issued with
+	profile, err := c.certificateProfile(commonName, false)
+	if err != nil {
+		return err
 	}
 
-	// Create SAN extension config
-	sanConfig := "basicConstraints = CA:FALSE\n"
-	sanConfig += "nsCertType = server\n"
-	sanConfig += "nsComment = \"OpenSSL Generated Server Certificate\"\n"
-	sanConfig += "subjectKeyIdentifier = hash\n"
-	sanConfig += "authorityKeyIdentifier = keyid,issuer:always\n"
-	sanConfig += "keyUsage = critical, digitalSignature, keyEncipherment\n"
-	sanConfig += "extendedKeyUsage = serverAuth\n"
-	sanConfig += "subjectAltName = @alt_names\n\n"
-	sanConfig += "[alt_names]\n"
+	serial, err := c.newSerialNumber()
+	if err != nil {
+		return err
+	}
 
-	for i, name := range dnsNames {
-		sanConfig += fmt.Sprintf("DNS.%d = %s\n", i+1, name)
+	serverTemplate := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
 	}
+	subjectAltNamesOf(existing).apply(&serverTemplate)
 
-	sanConfigPath := c.storage.GetCertificateDirectory(commonName) + "/" + commonName + ".ext"
-	if err := os.WriteFile(sanConfigPath, []byte(sanConfig), 0644); err != nil {
-		return fmt.Errorf("failed to write SAN config: %w", err)
+	publicKey, newKey, err := c.renewalKey(commonName, existing, opts.RotateKey)
+	if err != nil {
+		return err
+	}
+	if err := profile.apply(&serverTemplate, publicKey); err != nil {
+		return err
 	}
 
 	// Sign certificate with CA
-	cmd = exec.Command(
-		"openssl", "x509",
-		"-req",
-		"-in", csrPath,
-		"-CA", c.storage.GetCAPublicKeyPath(),
-		"-CAkey", c.storage.GetCAPrivateKeyPath(),
-		"-CAcreateserial",
-		"-out", certPath,
-		"-days", "365",
-		"-sha256",
-		"-extfile", sanConfigPath,
-	)
-	if err := cmd.Run(); err != nil {
+	caCert, caKey, err := c.loadIssuer()
+	if err != nil {
+		return err
+	}
+	c.applyDistributionPoints(&serverTemplate, caCert)
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, &serverTemplate, caCert, publicKey, caKey)
+	if err != nil {
 		return fmt.Errorf("failed to sign certificate: %w", err)
 	}
 
+	// Keep the certificate and key being replaced in the version history
+	renewedAt := time.Now()
+	revokeAfter := supersedeDeadline(profile, opts, renewedAt)
+	if err := c.archiveCertificateVersion(commonName, renewedAt, revokeAfter); err != nil {
+		return err
+	}
+
+	if newKey != nil {
+		if err := writePrivateKeyFile(c.storage.GetCertificateKeyPath(commonName), newKey); err != nil {
+			return fmt.Errorf("failed to write private key: %w", err)
+		}
+	}
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+
 	// Update bundle - use Go file operations instead of shell commands
 	bundlePath := c.storage.GetCertificateBundlePath(commonName)
-	if err := createCertificateBundle(certPath, c.storage.GetCAPublicKeyPath(), bundlePath); err != nil {
+	if err := c.createCertificateBundle(certPath, bundlePath); err != nil {
 		return fmt.Errorf("failed to create certificate bundle: %w", err)
 	}
 
-	// Cleanup
-	os.Remove(csrPath)
-	os.Remove(sanConfigPath)
+	if err := c.recordSerialNumber(serial, commonName); err != nil {
+		return err
+	}
+	if revokeAfter != nil && !revokeAfter.After(renewedAt) {
+		c.revokeSupersededNow(commonName)
+	}
 
+	c.updateIndex(commonName)
 	return nil
 }
-// createCertificateBundle safely creates a certificate bundle by concatenating files
-func createCertificateBundle(certPath, caPath, bundlePath string) error {
+
+// createCertificateBundle writes a bundle holding the certificate followed by the full CA chain
+func (c *CertificateService) createCertificateBundle(certPath, bundlePath string) error {
 	// Read certificate file
 	certData, err := os.ReadFile(certPath)
 	if err != nil {
 		return fmt.Errorf("failed to read certificate file: %w", err)
 	}
 
-	// Read CA certificate file
-	caData, err := os.ReadFile(caPath)
+	// Read CA chain
+	chainData, err := c.issuerChainPEM()
 	if err != nil {
-		return fmt.Errorf("failed to read CA certificate file: %w", err)
+		return err
 	}
 
 	// Create bundle by concatenating
-	bundleData := append(certData, caData...)
+	bundleData := append(certData, chainData...)
 
 	// Write bundle file
 	if err := os.WriteFile(bundlePath, bundleData, 0644); err != nil {
@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"math/big"
 	"os"
 	"path/filepath"
@@ -35,7 +36,7 @@ func mockCreateServerCertificate(certService *CertificateService, name string, d
 	if err != nil {
 		return err
 	}
-	caKeyBytes, err := os.ReadFile(certService.storage.GetCAPrivateKeyPath())
+	caKey, err := certService.loadCAPrivateKey()
 	if err != nil {
 		return err
 	}
@@ -49,15 +50,6 @@ func mockCreateServerCertificate(certService *CertificateService, name string, d
 		return err
 	}
 
-	caKeyBlock, _ := pem.Decode(caKeyBytes)
-	if caKeyBlock == nil {
-		return err
-	}
-	caKey, err := x509.ParsePKCS1PrivateKey(caKeyBlock.Bytes)
-	if err != nil {
-		return err
-	}
-
 	// Create server certificate template
 	serverTemplate := x509.Certificate{
 		SerialNumber: big.NewInt(time.Now().Unix()),
@@ -172,6 +164,38 @@ func TestCreateServerCertificate(t *testing.T) {
 	}
 }
 
+func TestCreateCertificateRejectsExistingName(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if err := certService.CreateServerCertificate("existing.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyPath := certService.storage.GetCertificateKeyPath("existing.example.com")
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to read key: %v", err)
+	}
+
+	if err := certService.CreateServerCertificate("existing.example.com", nil); !errors.Is(err, ErrCertificateAlreadyExists) {
+		t.Errorf("Expected ErrCertificateAlreadyExists for a server certificate, got %v", err)
+	}
+	if err := certService.CreateClientCertificate("existing.example.com", "password123"); !errors.Is(err, ErrCertificateAlreadyExists) {
+		t.Errorf("Expected ErrCertificateAlreadyExists for a client certificate, got %v", err)
+	}
+
+	// The existing key is left as it was
+	current, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatalf("Failed to read key: %v", err)
+	}
+	if string(current) != string(keyPEM) {
+		t.Error("Creating an existing certificate replaced its key")
+	}
+	if _, err := os.Stat(certService.storage.GetCertificatePasswordPath("existing.example.com")); !os.IsNotExist(err) {
+		t.Error("Creating an existing certificate wrote a client password")
+	}
+}
+
 // generateTestPassword generates a random password for testing
 func generateTestPassword() string {
 	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*()-_=+"
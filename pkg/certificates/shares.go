@@ -0,0 +1,220 @@
+package certificates
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strings"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/shamir"
+)
+
+// Unseal shares are the CA passphrase split with Shamir's secret sharing.
+// Each share is encoded as version, ceremony id, threshold and the Shamir
+// share followed by a truncated SHA-256 checksum, in base32 groups that only
+// use characters from the QR code alphanumeric set.
+const (
+	shareVersion        = 1
+	shareCeremonyLength = 4
+	shareChecksumLength = 4
+	shareHeaderLength   = 1 + shareCeremonyLength + 1
+	shareGroupLength    = 4
+)
+
+var shareEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// UnsealShares is the result of a key ceremony
+type UnsealShares struct {
+	Threshold int      `json:"threshold"`
+	Shares    []string `json:"shares"`
+}
+
+// UnsealProgress reports the shares collected towards unsealing the CA
+type UnsealProgress struct {
+	Sealed    bool `json:"sealed"`
+	Submitted int  `json:"shares_submitted,omitempty"`
+	Threshold int  `json:"shares_required,omitempty"`
+}
+
+// unsealShare is a decoded unseal share
+type unsealShare struct {
+	ceremony  []byte
+	threshold int
+	index     int
+	share     []byte
+}
+
+// pendingShares holds the shares submitted since the last unseal attempt
+type pendingShares struct {
+	ceremony  []byte
+	threshold int
+	shares    [][]byte
+}
+
+// CreateUnsealShares splits the CA passphrase into count shares of which any
+// threshold unseal the CA. The CA must be unsealed. Shares are not stored,
+// they must be handed to the custodians right away.
+func (c *CertificateService) CreateUnsealShares(count, threshold int) (*UnsealShares, error) {
+	c.sealMutex.RLock()
+	if c.passphrase == nil {
+		c.sealMutex.RUnlock()
+		return nil, ErrCASealed
+	}
+	secret := bytes.Clone(c.passphrase)
+	c.sealMutex.RUnlock()
+	defer clear(secret)
+
+	parts, err := shamir.Split(secret, count, threshold)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShareParameters, err)
+	}
+
+	ceremony := make([]byte, shareCeremonyLength)
+	if _, err := rand.Read(ceremony); err != nil {
+		return nil, fmt.Errorf("failed to generate ceremony id: %w", err)
+	}
+
+	result := &UnsealShares{Threshold: threshold}
+	for _, part := range parts {
+		result.Shares = append(result.Shares, encodeUnsealShare(ceremony, threshold, part))
+		clear(part)
+	}
+	return result, nil
+}
+
+// SubmitUnsealShare adds one share towards unsealing the CA. Once the
+// threshold is reached the passphrase is recovered and the CA unsealed; the
+// collected shares are discarded whether that works or not.
+func (c *CertificateService) SubmitUnsealShare(share string) (*UnsealProgress, error) {
+	decoded, err := parseUnsealShare(share)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Sealed() {
+		return nil, ErrCANotSealed
+	}
+
+	c.shareMutex.Lock()
+	defer c.shareMutex.Unlock()
+
+	pending := &c.pendingShares
+	if len(pending.shares) > 0 && !bytes.Equal(pending.ceremony, decoded.ceremony) {
+		return nil, fmt.Errorf("%w: share belongs to a different key ceremony", ErrInvalidShare)
+	}
+	for _, existing := range pending.shares {
+		if int(existing[len(existing)-1]) == decoded.index {
+			return nil, fmt.Errorf("%w: share %d was already submitted", ErrInvalidShare, decoded.index)
+		}
+	}
+	pending.ceremony = decoded.ceremony
+	pending.threshold = decoded.threshold
+	pending.shares = append(pending.shares, decoded.share)
+
+	if len(pending.shares) < pending.threshold {
+		return &UnsealProgress{Sealed: true, Submitted: len(pending.shares), Threshold: pending.threshold}, nil
+	}
+
+	secret, err := shamir.Combine(pending.shares)
+	c.resetPendingShares()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShare, err)
+	}
+	defer clear(secret)
+
+	if err := c.Unseal(string(secret)); err != nil {
+		return nil, err
+	}
+	return &UnsealProgress{Sealed: false}, nil
+}
+
+// GetUnsealProgress reports whether the CA is sealed and how many shares have
+// been submitted
+func (c *CertificateService) GetUnsealProgress() *UnsealProgress {
+	c.shareMutex.Lock()
+	defer c.shareMutex.Unlock()
+
+	if !c.Sealed() {
+		return &UnsealProgress{Sealed: false}
+	}
+	return &UnsealProgress{
+		Sealed:    true,
+		Submitted: len(c.pendingShares.shares),
+		Threshold: c.pendingShares.threshold,
+	}
+}
+
+// ResetUnsealShares discards the shares submitted so far
+func (c *CertificateService) ResetUnsealShares() {
+	c.shareMutex.Lock()
+	defer c.shareMutex.Unlock()
+	c.resetPendingShares()
+}
+
+// resetPendingShares wipes the submitted shares. The caller must hold shareMutex.
+func (c *CertificateService) resetPendingShares() {
+	for _, share := range c.pendingShares.shares {
+		clear(share)
+	}
+	c.pendingShares = pendingShares{}
+}
+
+// encodeUnsealShare encodes a Shamir share as printable text
+func encodeUnsealShare(ceremony []byte, threshold int, share []byte) string {
+	payload := []byte{shareVersion}
+	payload = append(payload, ceremony...)
+	payload = append(payload, byte(threshold))
+	payload = append(payload, share...)
+	checksum := sha256.Sum256(payload)
+	payload = append(payload, checksum[:shareChecksumLength]...)
+
+	encoded := shareEncoding.EncodeToString(payload)
+	var groups []string
+	for len(encoded) > shareGroupLength {
+		groups = append(groups, encoded[:shareGroupLength])
+		encoded = encoded[shareGroupLength:]
+	}
+	groups = append(groups, encoded)
+	return strings.Join(groups, "-")
+}
+
+// parseUnsealShare decodes a share, ignoring case, spaces and group separators
+func parseUnsealShare(share string) (*unsealShare, error) {
+	cleaned := strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(share))
+
+	payload, err := shareEncoding.DecodeString(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a valid share encoding", ErrInvalidShare)
+	}
+	// A share carries at least one secret byte and its x coordinate
+	if len(payload) < shareHeaderLength+2+shareChecksumLength {
+		return nil, fmt.Errorf("%w: share is too short", ErrInvalidShare)
+	}
+
+	body := payload[:len(payload)-shareChecksumLength]
+	checksum := sha256.Sum256(body)
+	if !bytes.Equal(checksum[:shareChecksumLength], payload[len(body):]) {
+		return nil, fmt.Errorf("%w: checksum mismatch, check the share for typos", ErrInvalidShare)
+	}
+	if body[0] != shareVersion {
+		return nil, fmt.Errorf("%w: unsupported share version %d", ErrInvalidShare, body[0])
+	}
+
+	decoded := &unsealShare{
+		ceremony:  body[1 : 1+shareCeremonyLength],
+		threshold: int(body[1+shareCeremonyLength]),
+		share:     body[shareHeaderLength:],
+	}
+	decoded.index = int(decoded.share[len(decoded.share)-1])
+	if decoded.threshold < 2 || decoded.index == 0 {
+		return nil, fmt.Errorf("%w: malformed share", ErrInvalidShare)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,98 @@
+package certificates
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnsealShares(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if _, err := certService.CreateUnsealShares(3, 4); !errors.Is(err, ErrInvalidShareParameters) {
+		t.Errorf("Expected ErrInvalidShareParameters, got %v", err)
+	}
+
+	result, err := certService.CreateUnsealShares(5, 3)
+	if err != nil {
+		t.Fatalf("Failed to create unseal shares: %v", err)
+	}
+	if len(result.Shares) != 5 || result.Threshold != 3 {
+		t.Fatalf("Expected 5 shares with a threshold of 3, got %d and %d", len(result.Shares), result.Threshold)
+	}
+	for _, share := range result.Shares {
+		// QR alphanumeric mode covers upper case letters, digits and '-'
+		if strings.Trim(share, "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567-") != "" {
+			t.Errorf("Share %q is not QR alphanumeric", share)
+		}
+	}
+
+	if _, err := certService.SubmitUnsealShare(result.Shares[0]); !errors.Is(err, ErrCANotSealed) {
+		t.Errorf("Expected ErrCANotSealed, got %v", err)
+	}
+
+	certService.Seal()
+	if _, err := certService.CreateUnsealShares(5, 3); !errors.Is(err, ErrCASealed) {
+		t.Errorf("Expected ErrCASealed, got %v", err)
+	}
+
+	// A typo is caught by the checksum
+	typo := []byte(result.Shares[1])
+	if typo[0] == 'A' {
+		typo[0] = 'B'
+	} else {
+		typo[0] = 'A'
+	}
+	if _, err := certService.SubmitUnsealShare(string(typo)); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("Expected ErrInvalidShare for a mistyped share, got %v", err)
+	}
+
+	// Shares are accepted in lower case and without separators
+	progress, err := certService.SubmitUnsealShare(strings.ToLower(strings.ReplaceAll(result.Shares[4], "-", " ")))
+	if err != nil {
+		t.Fatalf("Failed to submit share: %v", err)
+	}
+	if !progress.Sealed || progress.Submitted != 1 || progress.Threshold != 3 {
+		t.Errorf("Unexpected progress after one share: %+v", progress)
+	}
+	if _, err := certService.SubmitUnsealShare(result.Shares[4]); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("Expected ErrInvalidShare for a duplicate share, got %v", err)
+	}
+
+	// Shares from another ceremony do not mix
+	if err := certService.Unseal(certService.config.CAKeyPassword); err != nil {
+		t.Fatalf("Failed to unseal CA: %v", err)
+	}
+	other, err := certService.CreateUnsealShares(2, 2)
+	if err != nil {
+		t.Fatalf("Failed to create unseal shares: %v", err)
+	}
+	certService.Seal()
+	if got := certService.GetUnsealProgress(); got.Submitted != 0 {
+		t.Errorf("Expected sealing to start without shares, got %+v", got)
+	}
+	if _, err := certService.SubmitUnsealShare(result.Shares[4]); err != nil {
+		t.Fatalf("Failed to submit share: %v", err)
+	}
+	if _, err := certService.SubmitUnsealShare(other.Shares[0]); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("Expected ErrInvalidShare for a share of another ceremony, got %v", err)
+	}
+
+	certService.ResetUnsealShares()
+	if got := certService.GetUnsealProgress(); !got.Sealed || got.Submitted != 0 {
+		t.Errorf("Expected no shares after reset, got %+v", got)
+	}
+
+	for i, share := range []string{result.Shares[2], result.Shares[0], result.Shares[3]} {
+		progress, err = certService.SubmitUnsealShare(share)
+		if err != nil {
+			t.Fatalf("Failed to submit share %d: %v", i, err)
+		}
+	}
+	if progress.Sealed || certService.Sealed() {
+		t.Fatal("Expected three shares to unseal the CA")
+	}
+	if err := certService.CreateServerCertificate("shares.example.com", nil); err != nil {
+		t.Errorf("Failed to create certificate after unsealing with shares: %v", err)
+	}
+}
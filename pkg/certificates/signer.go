@@ -0,0 +1,106 @@
+package certificates
+
+import (
+	"crypto"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/config"
+	"github.com/Lazarev-Cloud/localca-go/pkg/signer"
+)
+
+// keyReferencePEMType marks a CA key file that names a key held by a signer
+// backend instead of holding the key itself
+const keyReferencePEMType = "CA KEY REFERENCE"
+
+// newSignerBackend returns the signer backend selected by CA_SIGNER, or nil
+// for the default of encrypted key files in the data directory
+func newSignerBackend(cfg *config.Config) (signer.Backend, error) {
+	switch cfg.CASigner {
+	case "", signer.BackendFile:
+		return nil, nil
+	case signer.BackendPKCS11:
+		return signer.NewPKCS11Backend(cfg.PKCS11Module, cfg.PKCS11TokenLabel)
+	case signer.BackendRemote:
+		return signer.NewRemoteBackend(cfg.RemoteSignerSocket), nil
+	}
+	return nil, fmt.Errorf("unsupported CA signer backend: %s", cfg.CASigner)
+}
+
+// encodeKeyReference returns the content of a CA key file for a backend key
+func encodeKeyReference(backend string, label string) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:    keyReferencePEMType,
+		Headers: map[string]string{"Backend": backend, "Label": label},
+	})
+}
+
+// parseKeyReference returns the backend and label named by a CA key file
+func parseKeyReference(data []byte) (backend string, label string, ok bool) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != keyReferencePEMType {
+		return "", "", false
+	}
+	return block.Headers["Backend"], block.Headers["Label"], true
+}
+
+// isKeyReferencePEM reports whether data names a backend key
+func isKeyReferencePEM(data []byte) bool {
+	_, _, ok := parseKeyReference(data)
+	return ok
+}
+
+// generateCAKey generates a CA key in the signer backend, or in memory when
+// keys are stored in files. Store it with writeCAKeyFile.
+func (c *CertificateService) generateCAKey(spec KeySpec) (crypto.Signer, error) {
+	if c.Sealed() {
+		return nil, ErrCASealed
+	}
+	if c.signerBackend == nil {
+		return generateKey(spec)
+	}
+	return c.signerBackend.GenerateKey(string(spec.Algorithm), spec.Size)
+}
+
+// openCAKeyPEM returns the key a CA key file holds: a backend reference is
+// resolved through the signer backend, a key file is decrypted with the
+// unsealed passphrase. The caller must hold sealMutex.
+func (c *CertificateService) openCAKeyPEM(data []byte) (crypto.Signer, error) {
+	if c.passphrase == nil {
+		return nil, ErrCASealed
+	}
+	return c.decryptCAKeyPEM(data, c.passphrase)
+}
+
+// decryptCAKeyPEM opens a CA key file with a passphrase, or through the
+// signer backend holding the key
+func (c *CertificateService) decryptCAKeyPEM(data, passphrase []byte) (crypto.Signer, error) {
+	backend, label, ok := parseKeyReference(data)
+	if !ok {
+		return signer.DecryptPrivateKeyPEM(data, passphrase)
+	}
+	if c.signerBackend == nil || backend != c.signerBackend.Name() {
+		return nil, fmt.Errorf("CA key is held by the %s signer backend", backend)
+	}
+	return c.signerBackend.Key(label)
+}
+
+// storeCAKey writes a CA key file for key: a reference for backend keys, the
+// key encrypted with the unsealed passphrase otherwise. The caller must hold
+// sealMutex.
+func (c *CertificateService) storeCAKey(path string, key crypto.Signer) error {
+	if c.signerBackend == nil {
+		return signer.WriteEncryptedKeyFile(path, key, c.passphrase)
+	}
+
+	backendKey, ok := key.(signer.Key)
+	if !ok {
+		return fmt.Errorf("CA key was not generated by the %s signer backend", c.signerBackend.Name())
+	}
+	if err := os.WriteFile(path, encodeKeyReference(c.signerBackend.Name(), backendKey.Label()), 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0600)
+}
@@ -0,0 +1,100 @@
+package certificates
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/config"
+	"github.com/Lazarev-Cloud/localca-go/pkg/signer"
+	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
+)
+
+func TestRemoteSignerBackend(t *testing.T) {
+	tempDir := t.TempDir()
+	backend, err := signer.NewDirectoryBackend(filepath.Join(tempDir, "signer"))
+	if err != nil {
+		t.Fatalf("Failed to create signer backend: %v", err)
+	}
+	socket := filepath.Join(tempDir, "signer.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on socket: %v", err)
+	}
+	defer listener.Close()
+	go signer.Serve(listener, backend)
+
+	dataDir := filepath.Join(tempDir, "data")
+	store, err := storage.NewStorage(dataDir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	cfg := &config.Config{
+		CAName:             "Test CA",
+		CAKeyPassword:      generateTestPassword(),
+		CAKeyType:          "ecdsa",
+		CAMode:             CAModeTwoTier,
+		Organization:       "Test Org",
+		Country:            "US",
+		DataDir:            dataDir,
+		CASigner:           signer.BackendRemote,
+		RemoteSignerSocket: socket,
+	}
+	certService, err := NewCertificateService(cfg, store)
+	if err != nil {
+		t.Fatalf("Failed to create certificate service: %v", err)
+	}
+	if err := certService.Unseal(cfg.CAKeyPassword); err != nil {
+		t.Fatalf("Failed to unseal CA: %v", err)
+	}
+	if err := certService.CreateCA(); err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+
+	// Only references to the signer keys are stored in the data directory
+	for _, path := range []string{store.GetCAEncryptedKeyPath(), certService.getIntermediateKeyPath()} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read key file: %v", err)
+		}
+		if !isKeyReferencePEM(data) {
+			t.Errorf("%s does not reference a signer key", filepath.Base(path))
+		}
+	}
+	if err := certService.CreateServerCertificate("remote.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	// The exported root key is a reference that brings an offline root back
+	rootKeyPEM, err := certService.ExportRootKey()
+	if err != nil {
+		t.Fatalf("Failed to export root key: %v", err)
+	}
+	if err := certService.RemoveRootKey(); err != nil {
+		t.Fatalf("Failed to remove root key: %v", err)
+	}
+	if err := certService.ReissueIntermediate(rootKeyPEM); err != nil {
+		t.Errorf("Failed to reissue intermediate with the root key reference: %v", err)
+	}
+
+	// A restarted server unlocks the signer with the passphrase
+	certService.Seal()
+	restarted, err := NewCertificateService(cfg, store)
+	if err != nil {
+		t.Fatalf("Failed to create certificate service: %v", err)
+	}
+	if err := restarted.Unseal("wrong passphrase"); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase, got %v", err)
+	}
+	if !restarted.Sealed() {
+		t.Fatal("A wrong passphrase unsealed the CA")
+	}
+	if err := restarted.Unseal(cfg.CAKeyPassword); err != nil {
+		t.Fatalf("Failed to unseal CA: %v", err)
+	}
+	if err := restarted.CreateServerCertificate("restart.example.com", nil); err != nil {
+		t.Errorf("Failed to create certificate after restart: %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package certificates
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// supersedeCheckInterval is how often superseded certificates are checked
+// for the end of their overlap window
+const supersedeCheckInterval = 5 * time.Minute
+
+// SupersedePolicy revokes the certificate replaced by a renewal with reason
+// superseded once OverlapHours have passed, giving deployments time to pick
+// up the new certificate. An overlap of zero revokes it right away.
+type SupersedePolicy struct {
+	Enabled      bool `json:"enabled"`
+	OverlapHours int  `json:"overlap_hours,omitempty"`
+}
+
+// Validate checks that the overlap window is in range
+func (p SupersedePolicy) Validate() error {
+	if p.OverlapHours < 0 || p.OverlapHours > MaxProfileValidityDays*24 {
+		return fmt.Errorf("%w: overlap_hours must be between 0 and %d", ErrInvalidRenewalPolicy, MaxProfileValidityDays*24)
+	}
+	return nil
+}
+
+// supersedeDeadline returns when the version replaced by a renewal at the
+// given time is revoked: the policy of the request when given, otherwise that
+// of the profile. Nil leaves it valid until it expires.
+func supersedeDeadline(profile *Profile, opts RenewOptions, renewedAt time.Time) *time.Time {
+	policy := profile.RevokeSuperseded
+	if opts.RevokeSuperseded != nil {
+		policy = opts.RevokeSuperseded
+	}
+	if policy == nil || !policy.Enabled {
+		return nil
+	}
+	deadline := renewedAt.Add(time.Duration(policy.OverlapHours) * time.Hour)
+	return &deadline
+}
+
+// revokeSupersededVersions revokes the superseded versions of a certificate
+// whose overlap window has passed at the given time. Versions that already
+// expired are left alone. The caller regenerates the CRL when any were
+// revoked.
+func (c *CertificateService) revokeSupersededVersions(name string, now time.Time) (int, error) {
+	versions, err := c.ListCertificateVersions(name)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, version := range versions {
+		if version.Current || version.Revoked || version.RevokeAfter == nil ||
+			now.Before(*version.RevokeAfter) || !now.Before(version.NotAfter) {
+			continue
+		}
+
+		err := c.revokeSerialNumber(version.SerialNumber, name, ReasonSuperseded, nil)
+		c.recordAudit("revoke", "certificate", name,
+			fmt.Sprintf("Revoked superseded certificate %s (serial: %s, replaced by %s, reason: %s)",
+				name, version.SerialNumber, version.ReplacedBy, ReasonSuperseded), err)
+		if err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// pendingRevocation is a superseded version scheduled for revocation at the
+// end of its overlap window. The certificate index keeps them so the
+// scheduler only reads the versions of certificates with one due.
+type pendingRevocation struct {
+	SerialNumber string    `json:"serial_number"`
+	RevokeAfter  time.Time `json:"revoke_after"`
+	NotAfter     time.Time `json:"not_after"`
+}
+
+// readPendingRevocations returns the archived versions of a certificate that
+// are scheduled for revocation. Only versions with a revoke-after file are
+// read; the current version is skipped, as in ListCertificateVersions.
+func (c *CertificateService) readPendingRevocations(name, currentSerial string) []pendingRevocation {
+	versionsDir := c.getCertificateVersionsDirectory(name)
+	entries, err := os.ReadDir(versionsDir)
+	if err != nil {
+		return nil
+	}
+
+	var pending []pendingRevocation
+	for _, entry := range entries {
+		if !entry.IsDir() || !versionSerialPattern.MatchString(entry.Name()) || entry.Name() == currentSerial {
+			continue
+		}
+		versionDir := filepath.Join(versionsDir, entry.Name())
+		revokeAfter := readVersionTime(filepath.Join(versionDir, "revoke-after"))
+		if revokeAfter == nil {
+			continue
+		}
+		cert, err := readCertificateFile(filepath.Join(versionDir, name+".crt"))
+		if err != nil {
+			log.Printf("Ignoring version %s of certificate %s: %v", entry.Name(), name, err)
+			continue
+		}
+		pending = append(pending, pendingRevocation{
+			SerialNumber: entry.Name(),
+			RevokeAfter:  *revokeAfter,
+			NotAfter:     cert.NotAfter,
+		})
+	}
+	return pending
+}
+
+// dueSupersededCertificates returns the names of the indexed certificates
+// with a superseded version whose overlap window has passed and that has not
+// expired yet
+func (c *CertificateService) dueSupersededCertificates(now time.Time) ([]string, error) {
+	c.indexMutex.Lock()
+	defer c.indexMutex.Unlock()
+
+	// Renewals update a loaded index, so only the first run syncs it
+	if c.index == nil {
+		if err := c.syncIndex(); err != nil {
+			return nil, err
+		}
+	}
+
+	var names []string
+	for name, entry := range c.index.Entries {
+		for _, pending := range entry.PendingRevocations {
+			if !now.Before(pending.RevokeAfter) && now.Before(pending.NotAfter) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// revokeSupersededCertificates revokes every superseded version whose overlap
+// window has passed and publishes a new CRL when any were revoked. Only the
+// certificates the index lists with a due version are read. Nothing is
+// revoked while the CA is sealed.
+func (c *CertificateService) revokeSupersededCertificates(now time.Time) int {
+	if c.Sealed() {
+		return 0
+	}
+
+	names, err := c.dueSupersededCertificates(now)
+	if err != nil {
+		log.Printf("Failed to find superseded certificates to revoke: %v", err)
+		return 0
+	}
+
+	total := 0
+	for _, name := range names {
+		revoked, err := c.revokeSupersededVersions(name, now)
+		if err != nil {
+			log.Printf("Failed to revoke superseded versions of certificate %s: %v", name, err)
+		}
+		if revoked > 0 {
+			c.updateIndex(name)
+		}
+		total += revoked
+	}
+
+	if total > 0 {
+		if err := c.GenerateCRL(); err != nil {
+			log.Printf("Failed to generate CRL: %v", err)
+		}
+	}
+	return total
+}
+
+// StartSupersedeScheduler revokes superseded certificates at the end of
+// their overlap window until the context is cancelled
+func (c *CertificateService) StartSupersedeScheduler(ctx context.Context) {
+	c.revokeSupersededCertificates(time.Now())
+
+	ticker := time.NewTicker(supersedeCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if count := c.revokeSupersededCertificates(time.Now()); count > 0 {
+				log.Printf("Revoked %d superseded certificates", count)
+			}
+		}
+	}
+}
+
+// revokeSupersededNow revokes the superseded versions of a certificate whose
+// overlap window has already passed, right after a renewal instead of on the
+// next scheduler run. Failures are left for the scheduler to retry.
+func (c *CertificateService) revokeSupersededNow(name string) {
+	revoked, err := c.revokeSupersededVersions(name, time.Now())
+	if err != nil {
+		log.Printf("Failed to revoke superseded versions of certificate %s: %v", name, err)
+	}
+	if revoked > 0 {
+		if err := c.GenerateCRL(); err != nil {
+			log.Printf("Failed to generate CRL: %v", err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package certificates
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSupersedeAndRevoke(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	profile := Profile{Name: "rotating", ValidityDays: 90, ExtKeyUsage: []string{"serverAuth"},
+		RevokeSuperseded: &SupersedePolicy{Enabled: true, OverlapHours: 48}}
+	if err := certService.CreateProfile(profile); err != nil {
+		t.Fatalf("Failed to create profile: %v", err)
+	}
+	if err := certService.CreateServerCertificateWithOptions("overlap.example.com", nil, IssueOptions{Profile: "rotating"}); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	if err := certService.CreateServerCertificate("plain.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	first, _ := certService.GetCertificateInfo("overlap.example.com")
+	plain, _ := certService.GetCertificateInfo("plain.example.com")
+
+	// The profile policy schedules the replaced version for revocation
+	if err := certService.RenewServerCertificate("overlap.example.com"); err != nil {
+		t.Fatalf("Failed to renew certificate: %v", err)
+	}
+	if err := certService.RenewServerCertificate("plain.example.com"); err != nil {
+		t.Fatalf("Failed to renew certificate: %v", err)
+	}
+	renewed, err := certService.GetCertificateInfo("overlap.example.com")
+	if err != nil {
+		t.Fatalf("Failed to get certificate info: %v", err)
+	}
+	if renewed.Replaces != first.SerialNumber {
+		t.Errorf("Expected the renewed certificate to replace %s, got %q", first.SerialNumber, renewed.Replaces)
+	}
+	version, err := certService.GetCertificateVersion("overlap.example.com", first.SerialNumber)
+	if err != nil {
+		t.Fatalf("Failed to get version: %v", err)
+	}
+	if version.ReplacedBy != renewed.SerialNumber || version.RevokeAfter == nil || version.Revoked {
+		t.Fatalf("Expected the old version to be scheduled for revocation, got %+v", version)
+	}
+	if overlap := version.RevokeAfter.Sub(*version.SupersededAt); overlap != 48*time.Hour {
+		t.Errorf("Expected a 48 hour overlap, got %v", overlap)
+	}
+
+	// The index lists only the certificate with a version due, so the
+	// scheduler reads no other certificate
+	if names, err := certService.dueSupersededCertificates(time.Now().Add(49 * time.Hour)); err != nil ||
+		len(names) != 1 || names[0] != "overlap.example.com" {
+		t.Errorf("Expected only overlap.example.com to be due, got %v (%v)", names, err)
+	}
+	if names, _ := certService.dueSupersededCertificates(time.Now().Add(24 * time.Hour)); len(names) != 0 {
+		t.Errorf("Expected nothing due within the overlap window, got %v", names)
+	}
+
+	// Nothing is revoked within the overlap window
+	if count := certService.revokeSupersededCertificates(time.Now().Add(24 * time.Hour)); count != 0 {
+		t.Errorf("Expected no revocations within the overlap window, got %d", count)
+	}
+	if count := certService.revokeSupersededCertificates(time.Now().Add(49 * time.Hour)); count != 1 {
+		t.Fatalf("Expected one revocation after the overlap window, got %d", count)
+	}
+	if names, _ := certService.dueSupersededCertificates(time.Now().Add(49 * time.Hour)); len(names) != 0 {
+		t.Errorf("Expected the revoked version to leave the index, got %v", names)
+	}
+	version, _ = certService.GetCertificateVersion("overlap.example.com", first.SerialNumber)
+	if !version.Revoked || version.RevocationReason != "superseded" {
+		t.Errorf("Expected the old version to be revoked as superseded, got %+v", version)
+	}
+	if version, _ := certService.GetCertificateVersion("plain.example.com", plain.SerialNumber); version.Revoked || version.RevokeAfter != nil {
+		t.Errorf("Expected a certificate without a policy to stay valid, got %+v", version)
+	}
+	crl := readTestCRL(t, certService)
+	if len(crl.RevokedCertificateEntries) != 1 || crl.RevokedCertificateEntries[0].ReasonCode != int(ReasonSuperseded) {
+		t.Errorf("Expected the superseded version on the CRL, got %+v", crl.RevokedCertificateEntries)
+	}
+
+	// A request without an overlap revokes right away, overriding the profile
+	if err := certService.RenewServerCertificateWithOptions("plain.example.com",
+		RenewOptions{RevokeSuperseded: &SupersedePolicy{Enabled: true}}); err != nil {
+		t.Fatalf("Failed to renew certificate: %v", err)
+	}
+	versions, _ := certService.ListCertificateVersions("plain.example.com")
+	if len(versions) != 3 || versions[1].Current || !versions[1].Revoked || versions[2].Revoked {
+		t.Errorf("Expected only the version just replaced to be revoked, got %+v", versions)
+	}
+	if err := certService.RenewServerCertificateWithOptions("overlap.example.com",
+		RenewOptions{RevokeSuperseded: &SupersedePolicy{Enabled: false}}); err != nil {
+		t.Fatalf("Failed to renew certificate: %v", err)
+	}
+	if version, _ := certService.GetCertificateVersion("overlap.example.com", renewed.SerialNumber); version.RevokeAfter != nil {
+		t.Errorf("Expected the request to disable the profile policy, got %+v", version)
+	}
+
+	if err := certService.RenewServerCertificateWithOptions("plain.example.com",
+		RenewOptions{RevokeSuperseded: &SupersedePolicy{Enabled: true, OverlapHours: -1}}); !errors.Is(err, ErrInvalidRenewalPolicy) {
+		t.Errorf("Expected ErrInvalidRenewalPolicy for a negative overlap, got %v", err)
+	}
+	profile.RevokeSuperseded.OverlapHours = -1
+	if err := profile.Validate(); !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("Expected ErrInvalidProfile for a negative overlap, got %v", err)
+	}
+
+	// Revocations wait while the CA is sealed
+	certService.Seal()
+	if count := certService.revokeSupersededCertificates(time.Now().AddDate(0, 0, 30)); count != 0 {
+		t.Errorf("Expected no revocations while sealed, got %d", count)
+	}
+}
@@ -0,0 +1,243 @@
+package certificates
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// versionSerialPattern matches serial numbers as formatSerialNumber writes
+// them, so they are safe to use as directory names
+var versionSerialPattern = regexp.MustCompile(`^[0-9A-F]{1,40}$`)
+
+// CertificateVersion is one issued certificate in the history of a
+// certificate name. Renewal archives the version it replaces.
+type CertificateVersion struct {
+	SerialNumber      string       `json:"serial_number"`
+	NotBefore         time.Time    `json:"not_before"`
+	NotAfter          time.Time    `json:"not_after"`
+	FingerprintSHA256 string       `json:"fingerprint_sha256"`
+	SPKIPin           string       `json:"spki_pin_sha256"`
+	KeyAlgorithm      KeyAlgorithm `json:"key_algorithm"`
+	KeySize           int          `json:"key_size,omitempty"`
+	HasPrivateKey     bool         `json:"has_private_key"`
+	// Current marks the version served for the certificate name; the others
+	// record when renewal replaced them
+	Current      bool       `json:"current"`
+	SupersededAt *time.Time `json:"superseded_at,omitempty"`
+	// RevokeAfter is when a superseded version is revoked, after the overlap
+	// window of its renewal; nil leaves it valid until it expires
+	RevokeAfter *time.Time `json:"revoke_after,omitempty"`
+
+	// Serial numbers of the neighbouring versions
+	Replaces   string `json:"replaces,omitempty"`
+	ReplacedBy string `json:"replaced_by,omitempty"`
+
+	Revoked          bool       `json:"revoked"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevocationReason string     `json:"revocation_reason,omitempty"`
+
+	// Path and KeyPath locate the certificate and key files of the version;
+	// KeyPath is empty when the CA holds no key for it
+	Path    string `json:"-"`
+	KeyPath string `json:"-"`
+}
+
+// getCertificateVersionsDirectory returns the directory holding the archived
+// versions of a certificate
+func (c *CertificateService) getCertificateVersionsDirectory(name string) string {
+	return filepath.Join(c.storage.GetCertificateDirectory(name), "versions")
+}
+
+// archiveCertificateVersion copies the current certificate and key of a
+// certificate into its version history before renewal replaces them. A
+// non-nil revokeAfter schedules the version to be revoked as superseded.
+func (c *CertificateService) archiveCertificateVersion(name string, supersededAt time.Time, revokeAfter *time.Time) error {
+	certPath := c.storage.GetCertificatePath(name)
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %w", err)
+	}
+	cert, err := readCertificateFile(certPath)
+	if err != nil {
+		return err
+	}
+
+	versionDir := filepath.Join(c.getCertificateVersionsDirectory(name), formatSerialNumber(cert.SerialNumber))
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		return fmt.Errorf("failed to create version directory: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(versionDir, name+".crt"), certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to archive certificate: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(versionDir, "superseded"), []byte(supersededAt.UTC().Format(time.RFC3339Nano)), 0644); err != nil {
+		return fmt.Errorf("failed to mark certificate version as superseded: %w", err)
+	}
+	revokeAfterPath := filepath.Join(versionDir, "revoke-after")
+	if revokeAfter != nil {
+		if err := os.WriteFile(revokeAfterPath, []byte(revokeAfter.UTC().Format(time.RFC3339Nano)), 0644); err != nil {
+			return fmt.Errorf("failed to schedule revocation of certificate version: %w", err)
+		}
+	} else if err := os.Remove(revokeAfterPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear revocation of certificate version: %w", err)
+	}
+
+	keyPEM, err := os.ReadFile(c.storage.GetCertificateKeyPath(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read private key: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(versionDir, name+".key"), keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to archive private key: %w", err)
+	}
+	return nil
+}
+
+// readCertificateVersion reads the version stored at a certificate path
+func readCertificateVersion(certPath, keyPath string, revoked []RevokedCertificate) (CertificateVersion, error) {
+	cert, err := readCertificateFile(certPath)
+	if err != nil {
+		return CertificateVersion{}, err
+	}
+	info := describeCertificate(cert)
+	info.applyRevocation(revoked)
+
+	version := CertificateVersion{
+		SerialNumber:      info.SerialNumber,
+		NotBefore:         info.NotBefore,
+		NotAfter:          info.NotAfter,
+		FingerprintSHA256: info.FingerprintSHA256,
+		SPKIPin:           info.SPKIPin,
+		KeyAlgorithm:      info.KeyAlgorithm,
+		KeySize:           info.KeySize,
+		Revoked:           info.Revoked,
+		RevokedAt:         info.RevokedAt,
+		RevocationReason:  info.RevocationReason,
+		Path:              certPath,
+	}
+	if _, err := os.Stat(keyPath); err == nil {
+		version.HasPrivateKey = true
+		version.KeyPath = keyPath
+	}
+	return version, nil
+}
+
+// ListCertificateVersions returns every version issued under a certificate
+// name, newest first
+func (c *CertificateService) ListCertificateVersions(name string) ([]CertificateVersion, error) {
+	certPath := c.storage.GetCertificatePath(name)
+	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrCertificateNotFound, name)
+	}
+	revoked, err := c.GetRevokedCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := readCertificateVersion(certPath, c.storage.GetCertificateKeyPath(name), revoked)
+	if err != nil {
+		return nil, err
+	}
+	current.Current = true
+	versions := []CertificateVersion{current}
+
+	versionsDir := c.getCertificateVersionsDirectory(name)
+	entries, err := os.ReadDir(versionsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read certificate versions: %w", err)
+	}
+	for _, entry := range entries {
+		// A renewal that failed after archiving leaves a copy of the current version
+		if !entry.IsDir() || !versionSerialPattern.MatchString(entry.Name()) || entry.Name() == current.SerialNumber {
+			continue
+		}
+		versionDir := filepath.Join(versionsDir, entry.Name())
+		version, err := readCertificateVersion(filepath.Join(versionDir, name+".crt"), filepath.Join(versionDir, name+".key"), revoked)
+		if err != nil {
+			log.Printf("Ignoring version %s of certificate %s: %v", entry.Name(), name, err)
+			continue
+		}
+		version.SupersededAt = readVersionTime(filepath.Join(versionDir, "superseded"))
+		version.RevokeAfter = readVersionTime(filepath.Join(versionDir, "revoke-after"))
+		versions = append(versions, version)
+	}
+
+	// The current version comes first, then the others by when they were
+	// replaced
+	archived := versions[1:]
+	sort.SliceStable(archived, func(i, j int) bool {
+		a, b := archived[i].SupersededAt, archived[j].SupersededAt
+		if a != nil && b != nil && !a.Equal(*b) {
+			return a.After(*b)
+		}
+		return archived[i].NotBefore.After(archived[j].NotBefore)
+	})
+	for i := 1; i < len(versions); i++ {
+		versions[i].ReplacedBy = versions[i-1].SerialNumber
+		versions[i-1].Replaces = versions[i].SerialNumber
+	}
+	return versions, nil
+}
+
+// readVersionTime reads a timestamp file of an archived version; a missing or
+// malformed file yields nil
+func readVersionTime(path string) *time.Time {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// GetCertificateVersion returns the version of a certificate with a serial number
+func (c *CertificateService) GetCertificateVersion(name, serialNumber string) (*CertificateVersion, error) {
+	serialNumber = strings.ToUpper(strings.TrimSpace(serialNumber))
+	if !versionSerialPattern.MatchString(serialNumber) {
+		return nil, fmt.Errorf("%w: version %s of %s", ErrCertificateNotFound, serialNumber, name)
+	}
+
+	versions, err := c.ListCertificateVersions(name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].SerialNumber == serialNumber {
+			return &versions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: version %s of %s", ErrCertificateNotFound, serialNumber, name)
+}
+
+// RevokeCertificateVersion revokes one version of a certificate. Revoking
+// the current version is the same as revoking the certificate.
+func (c *CertificateService) RevokeCertificateVersion(name, serialNumber string, reason RevocationReason, invalidityDate *time.Time) error {
+	version, err := c.GetCertificateVersion(name, serialNumber)
+	if err != nil {
+		return err
+	}
+	if version.Current {
+		return c.RevokeCertificateWithReason(name, reason, invalidityDate)
+	}
+	if version.Revoked {
+		return ErrCertificateRevoked
+	}
+
+	if err := c.revokeSerialNumber(version.SerialNumber, name, reason, invalidityDate); err != nil {
+		return err
+	}
+	if err := c.GenerateCRL(); err != nil {
+		return fmt.Errorf("failed to generate CRL: %w", err)
+	}
+	return nil
+}
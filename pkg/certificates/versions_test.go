@@ -0,0 +1,102 @@
+package certificates
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestCertificateVersions(t *testing.T) {
+	certService := newTestCertificateService(t)
+
+	if err := certService.CreateServerCertificate("versioned.example.com", nil); err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	first, err := certService.GetCertificateInfo("versioned.example.com")
+	if err != nil {
+		t.Fatalf("Failed to get certificate info: %v", err)
+	}
+	firstKey, err := os.ReadFile(certService.storage.GetCertificateKeyPath("versioned.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to read key: %v", err)
+	}
+
+	versions, err := certService.ListCertificateVersions("versioned.example.com")
+	if err != nil {
+		t.Fatalf("Failed to list versions: %v", err)
+	}
+	if len(versions) != 1 || !versions[0].Current || versions[0].SerialNumber != first.SerialNumber {
+		t.Fatalf("Expected only the current version, got %+v", versions)
+	}
+
+	if err := certService.RenewServerCertificate("versioned.example.com"); err != nil {
+		t.Fatalf("Failed to renew certificate: %v", err)
+	}
+	if err := certService.RenewServerCertificateWithOptions("versioned.example.com", RenewOptions{RotateKey: true}); err != nil {
+		t.Fatalf("Failed to renew certificate: %v", err)
+	}
+	current, _ := certService.GetCertificateInfo("versioned.example.com")
+
+	versions, err = certService.ListCertificateVersions("versioned.example.com")
+	if err != nil {
+		t.Fatalf("Failed to list versions: %v", err)
+	}
+	if len(versions) != 3 {
+		t.Fatalf("Expected three versions, got %+v", versions)
+	}
+	if !versions[0].Current || versions[0].SerialNumber != current.SerialNumber || versions[1].Current || versions[2].Current {
+		t.Errorf("Expected the current version first and only once, got %+v", versions)
+	}
+	if versions[0].SupersededAt != nil || versions[1].SupersededAt == nil || versions[1].SupersededAt.Before(*versions[2].SupersededAt) {
+		t.Errorf("Expected the archived versions to record when they were replaced, got %+v", versions)
+	}
+	if versions[2].SerialNumber != first.SerialNumber || !versions[2].HasPrivateKey {
+		t.Errorf("Expected the first version last with its key, got %+v", versions[2])
+	}
+	archivedKey, err := os.ReadFile(versions[2].KeyPath)
+	if err != nil || string(archivedKey) != string(firstKey) {
+		t.Errorf("Expected the archived key to be the original one: %v", err)
+	}
+	if versions[1].SPKIPin != first.SPKIPin || versions[0].SPKIPin == first.SPKIPin {
+		t.Error("Expected only the last renewal to change the key")
+	}
+
+	// Revoking an old version leaves the current certificate valid
+	if err := certService.RevokeCertificateVersion("versioned.example.com", first.SerialNumber, ReasonKeyCompromise, nil); err != nil {
+		t.Fatalf("Failed to revoke version: %v", err)
+	}
+	if err := certService.RevokeCertificateVersion("versioned.example.com", first.SerialNumber, ReasonKeyCompromise, nil); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("Expected ErrCertificateRevoked, got %v", err)
+	}
+	version, err := certService.GetCertificateVersion("versioned.example.com", first.SerialNumber)
+	if err != nil {
+		t.Fatalf("Failed to get version: %v", err)
+	}
+	if !version.Revoked || version.RevocationReason != "keyCompromise" {
+		t.Errorf("Expected the version to be revoked for key compromise, got %+v", version)
+	}
+	if current, _ := certService.GetCertificateInfo("versioned.example.com"); current.Revoked {
+		t.Error("Expected the current version to stay valid")
+	}
+	crl := readTestCRL(t, certService)
+	if len(crl.RevokedCertificateEntries) != 1 || formatSerialNumber(crl.RevokedCertificateEntries[0].SerialNumber) != first.SerialNumber {
+		t.Errorf("Expected the old version on the CRL, got %+v", crl.RevokedCertificateEntries)
+	}
+
+	// Revoking the current version revokes the certificate
+	if err := certService.RevokeCertificateVersion("versioned.example.com", current.SerialNumber, ReasonSuperseded, nil); err != nil {
+		t.Fatalf("Failed to revoke current version: %v", err)
+	}
+	if current, _ := certService.GetCertificateInfo("versioned.example.com"); !current.Revoked {
+		t.Error("Expected the certificate to be revoked")
+	}
+
+	for _, serial := range []string{"00FF", "../ca", ""} {
+		if _, err := certService.GetCertificateVersion("versioned.example.com", serial); !errors.Is(err, ErrCertificateNotFound) {
+			t.Errorf("Expected ErrCertificateNotFound for %q, got %v", serial, err)
+		}
+	}
+	if _, err := certService.ListCertificateVersions("missing.example.com"); !errors.Is(err, ErrCertificateNotFound) {
+		t.Errorf("Expected ErrCertificateNotFound, got %v", err)
+	}
+}
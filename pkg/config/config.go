@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -12,6 +13,9 @@ import (
 type Config struct {
 	CAName         string
 	CAKeyPassword  string
+	CAKeyType      string
+	CAKeySize      int
+	CAMode         string
 	Organization   string
 	Country        string
 	StoragePath    string
@@ -54,6 +58,22 @@ type Config struct {
 	LogLevel  string
 	LogFormat string
 	LogOutput string
+	// CRL configuration
+	CRLValidityHours int
+	CRLRefreshHours  int
+	// OCSP configuration
+	OCSPSigner string
+	// PublicBaseURL is the externally reachable URL embedded in certificates
+	PublicBaseURL string
+	// CA signer backend configuration
+	CASigner           string
+	PKCS11Module       string
+	PKCS11TokenLabel   string
+	RemoteSignerSocket string
+	// ACME challenge validation configuration
+	ACMEHTTP01Port    int
+	ACMETLSALPN01Port int
+	ACMEResolvers     []string
 }
 
 // LoadConfig loads the configuration from environment variables or defaults
@@ -100,6 +120,22 @@ func LoadConfig() (*Config, error) {
 		cfg.CAKeyPassword = ""
 	}
 
+	// Load CA key algorithm settings, validated when the CA is created
+	cfg.CAKeyType = strings.ToLower(getEnv("CA_KEY_TYPE", "rsa"))
+	if caKeySize := getEnv("CA_KEY_SIZE", ""); caKeySize != "" {
+		size, err := strconv.Atoi(caKeySize)
+		if err != nil {
+			return nil, errors.New("invalid CA_KEY_SIZE value")
+		}
+		cfg.CAKeySize = size
+	}
+
+	// Load CA hierarchy mode
+	cfg.CAMode = strings.ToLower(getEnv("CA_MODE", "single"))
+	if cfg.CAMode != "single" && cfg.CAMode != "two-tier" {
+		return nil, errors.New("invalid CA_MODE value, expected single or two-tier")
+	}
+
 	// Load Email settings
 	emailEnabled := getEnv("EMAIL_NOTIFY", "false")
 	cfg.EmailEnabled = strings.ToLower(emailEnabled) == "true"
@@ -210,6 +246,77 @@ func LoadConfig() (*Config, error) {
 	cfg.LogFormat = getEnv("LOG_FORMAT", "json")
 	cfg.LogOutput = getEnv("LOG_OUTPUT", "stdout")
 
+	// Load CRL settings
+	crlValidity := getEnv("CRL_VALIDITY_HOURS", "168")
+	validity, err := strconv.Atoi(crlValidity)
+	if err != nil || validity <= 0 {
+		return nil, errors.New("invalid CRL_VALIDITY_HOURS value")
+	}
+	cfg.CRLValidityHours = validity
+
+	crlRefresh := getEnv("CRL_REFRESH_HOURS", "24")
+	refresh, err := strconv.Atoi(crlRefresh)
+	if err != nil || refresh <= 0 {
+		return nil, errors.New("invalid CRL_REFRESH_HOURS value")
+	}
+	if refresh >= validity {
+		return nil, errors.New("CRL_REFRESH_HOURS must be less than CRL_VALIDITY_HOURS")
+	}
+	cfg.CRLRefreshHours = refresh
+
+	// Load OCSP settings
+	cfg.OCSPSigner = strings.ToLower(getEnv("OCSP_SIGNER", "delegated"))
+	if cfg.OCSPSigner != "ca" && cfg.OCSPSigner != "delegated" {
+		return nil, errors.New("invalid OCSP_SIGNER value, expected ca or delegated")
+	}
+
+	// Load the public base URL used for CRL and AIA extensions
+	cfg.PublicBaseURL = strings.TrimRight(getEnv("PUBLIC_BASE_URL", ""), "/")
+	if cfg.PublicBaseURL != "" {
+		u, err := url.Parse(cfg.PublicBaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+			return nil, errors.New("invalid PUBLIC_BASE_URL value, expected an http or https URL")
+		}
+	}
+
+	// Load CA signer backend settings
+	cfg.CASigner = strings.ToLower(getEnv("CA_SIGNER", "file"))
+	switch cfg.CASigner {
+	case "file":
+	case "pkcs11":
+		cfg.PKCS11Module = getEnv("PKCS11_MODULE", "")
+		cfg.PKCS11TokenLabel = getEnv("PKCS11_TOKEN_LABEL", "")
+		if cfg.PKCS11Module == "" || cfg.PKCS11TokenLabel == "" {
+			return nil, errors.New("PKCS11_MODULE and PKCS11_TOKEN_LABEL are required when CA_SIGNER is pkcs11")
+		}
+	case "remote":
+		cfg.RemoteSignerSocket = getEnv("REMOTE_SIGNER_SOCKET", "")
+		if cfg.RemoteSignerSocket == "" {
+			return nil, errors.New("REMOTE_SIGNER_SOCKET is required when CA_SIGNER is remote")
+		}
+	default:
+		return nil, errors.New("invalid CA_SIGNER value, expected file, pkcs11 or remote")
+	}
+
+	// Load ACME challenge validation settings
+	http01Port, err := strconv.Atoi(getEnv("ACME_HTTP01_PORT", "80"))
+	if err != nil || http01Port <= 0 || http01Port > 65535 {
+		return nil, errors.New("invalid ACME_HTTP01_PORT value")
+	}
+	cfg.ACMEHTTP01Port = http01Port
+
+	tlsALPN01Port, err := strconv.Atoi(getEnv("ACME_TLSALPN01_PORT", "443"))
+	if err != nil || tlsALPN01Port <= 0 || tlsALPN01Port > 65535 {
+		return nil, errors.New("invalid ACME_TLSALPN01_PORT value")
+	}
+	cfg.ACMETLSALPN01Port = tlsALPN01Port
+
+	for _, resolver := range strings.Split(getEnv("ACME_RESOLVERS", ""), ",") {
+		if resolver = strings.TrimSpace(resolver); resolver != "" {
+			cfg.ACMEResolvers = append(cfg.ACMEResolvers, resolver)
+		}
+	}
+
 	return cfg, nil
 }
 
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Certificate statuses; they are mutually exclusive and checked in this order
+const (
+	StatusRevoked  = "revoked"
+	StatusExpired  = "expired"
+	StatusExpiring = "expiring"
+	StatusActive   = "active"
+)
+
+// CertificateFilter selects and orders certificates. Empty fields match any
+// certificate.
+type CertificateFilter struct {
+	Status string
+	// IsClient selects client or server certificates when set
+	IsClient *bool
+	// Search is a case-insensitive substring of the name, common name or a SAN
+	Search string
+	// Issuer is a case-insensitive substring of the issuer DN
+	Issuer       string
+	SerialNumber string
+	// Fingerprint is an upper case, colon separated SHA-1 or SHA-256 fingerprint
+	Fingerprint   string
+	Profile       string
+	ExpiresAfter  time.Time
+	ExpiresBefore time.Time
+	// Labels are "key" or "key=value" terms that must all match
+	Labels []string
+
+	// ExpiringWindow is how long before expiry a certificate counts as expiring
+	ExpiringWindow time.Duration
+	Now            time.Time
+
+	// SortColumn is the column to order by; name breaks ties
+	SortColumn string
+	Descending bool
+	// AfterValue and AfterName continue a listing after the last certificate
+	// of the previous page; AfterValue has the type of SortColumn
+	AfterValue interface{}
+	AfterName  string
+	// Limit caps the number of certificates returned; zero returns all
+	Limit int
+}
+
+// certificateSortColumns are the columns certificates can be ordered by
+var certificateSortColumns = map[string]bool{
+	"name":          true,
+	"common_name":   true,
+	"serial_number": true,
+	"not_before":    true,
+	"not_after":     true,
+}
+
+// SaveCertificate inserts a certificate or updates the one with the same name
+func (d *Database) SaveCertificate(cert *Certificate) error {
+	return d.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"serial_number", "subject", "issuer", "not_before", "not_after", "is_revoked", "revoked_at",
+			"common_name", "subject_alt_names", "is_client", "profile", "fingerprint_sha1",
+			"fingerprint_sha256", "labels", "owner_email", "team", "notes", "updated_at",
+		}),
+	}).Create(cert).Error
+}
+
+// DeleteCertificate removes the certificate with a name
+func (d *Database) DeleteCertificate(name string) error {
+	return d.DB.Where("name = ?", name).Delete(&Certificate{}).Error
+}
+
+// QueryCertificates returns one page of the certificates matching a filter
+// together with the number of matching certificates across all pages
+func (d *Database) QueryCertificates(filter CertificateFilter) ([]Certificate, int64, error) {
+	if filter.SortColumn == "" {
+		filter.SortColumn = "name"
+	}
+	if !certificateSortColumns[filter.SortColumn] {
+		return nil, 0, fmt.Errorf("unsupported sort column: %s", filter.SortColumn)
+	}
+
+	count, err := filter.apply(d.DB.Model(&Certificate{}))
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	if err := count.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	page, err := filter.apply(d.DB.Model(&Certificate{}))
+	if err != nil {
+		return nil, 0, err
+	}
+	if filter.AfterName != "" {
+		page = page.Where(
+			fmt.Sprintf("%[1]s %[2]s ? OR (%[1]s = ? AND name %[2]s ?)", filter.SortColumn, comparison),
+			filter.AfterValue, filter.AfterValue, filter.AfterName)
+	}
+	page = page.Order(fmt.Sprintf("%s %s, name %s", filter.SortColumn, direction, direction))
+	if filter.Limit > 0 {
+		page = page.Limit(filter.Limit)
+	}
+
+	var certs []Certificate
+	if err := page.Find(&certs).Error; err != nil {
+		return nil, 0, err
+	}
+	return certs, total, nil
+}
+
+// apply adds the conditions of the filter to a query
+func (f CertificateFilter) apply(query *gorm.DB) (*gorm.DB, error) {
+	now := f.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	switch f.Status {
+	case "":
+	case StatusRevoked:
+		query = query.Where("is_revoked = ?", true)
+	case StatusExpired:
+		query = query.Where("is_revoked = ? AND not_after < ?", false, now)
+	case StatusExpiring:
+		query = query.Where("is_revoked = ? AND not_after >= ? AND not_after < ?", false, now, now.Add(f.ExpiringWindow))
+	case StatusActive:
+		query = query.Where("is_revoked = ? AND not_after >= ?", false, now.Add(f.ExpiringWindow))
+	default:
+		return nil, fmt.Errorf("unsupported status: %s", f.Status)
+	}
+
+	if f.IsClient != nil {
+		query = query.Where("is_client = ?", *f.IsClient)
+	}
+	if f.Search != "" {
+		pattern := containsPattern(f.Search)
+		query = query.Where("LOWER(name) LIKE ? OR LOWER(common_name) LIKE ? OR LOWER(subject_alt_names) LIKE ?",
+			pattern, pattern, pattern)
+	}
+	if f.Issuer != "" {
+		query = query.Where("LOWER(issuer) LIKE ?", containsPattern(f.Issuer))
+	}
+	if f.SerialNumber != "" {
+		query = query.Where("serial_number = ?", f.SerialNumber)
+	}
+	if f.Fingerprint != "" {
+		query = query.Where("fingerprint_sha256 = ? OR fingerprint_sha1 = ?", f.Fingerprint, f.Fingerprint)
+	}
+	if f.Profile != "" {
+		query = query.Where("profile = ?", f.Profile)
+	}
+	if !f.ExpiresAfter.IsZero() {
+		query = query.Where("not_after >= ?", f.ExpiresAfter)
+	}
+	if !f.ExpiresBefore.IsZero() {
+		query = query.Where("not_after < ?", f.ExpiresBefore)
+	}
+	for _, label := range f.Labels {
+		// Labels are stored as "\nkey=value\n" lines, so a key alone matches "\nkey="
+		term := "\n" + label
+		if strings.Contains(label, "=") {
+			term += "\n"
+		} else {
+			term += "="
+		}
+		query = query.Where("labels LIKE ?", "%"+escapeLike(term)+"%")
+	}
+
+	return query, nil
+}
+
+// containsPattern returns a LIKE pattern matching a lower-cased substring
+func containsPattern(s string) string {
+	return "%" + escapeLike(strings.ToLower(s)) + "%"
+}
+
+// escapeLike escapes the LIKE wildcards in s, using the PostgreSQL default
+// escape character
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -6,6 +6,9 @@ import (
 
 	"github.com/Lazarev-Cloud/localca-go/pkg/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 )
 
 func TestNewDatabase_Disabled(t *testing.T) {
@@ -251,3 +254,38 @@ func TestAuditLog_SuccessAndError(t *testing.T) {
 	assert.False(t, failedAudit.Success)
 	assert.Equal(t, "Operation failed", failedAudit.Error)
 }
+
+func TestCertificateFilter_SQL(t *testing.T) {
+	// A dry run renders the SQL without a PostgreSQL connection
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost sslmode=disable"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	require.NoError(t, err)
+
+	isClient := false
+	filter := CertificateFilter{
+		Status:         StatusExpiring,
+		IsClient:       &isClient,
+		Search:         "API_1",
+		Labels:         []string{"team=platform", "env"},
+		ExpiringWindow: 30 * 24 * time.Hour,
+	}
+	query, err := filter.apply(db.Model(&Certificate{}))
+	require.NoError(t, err)
+	stmt := query.Find(&[]Certificate{}).Statement
+
+	sql := stmt.SQL.String()
+	assert.Contains(t, sql, "is_revoked = $1 AND not_after >= $2 AND not_after < $3")
+	assert.Contains(t, sql, "is_client = $4")
+	assert.Contains(t, sql, "(LOWER(name) LIKE $5 OR LOWER(common_name) LIKE $6 OR LOWER(subject_alt_names) LIKE $7)")
+	assert.Equal(t, `%api\_1%`, stmt.Vars[4])
+	assert.Equal(t, "%\nteam=platform\n%", stmt.Vars[7])
+	assert.Equal(t, "%\nenv=%", stmt.Vars[8])
+
+	_, err = CertificateFilter{Status: "valid"}.apply(db.Model(&Certificate{}))
+	assert.Error(t, err)
+
+	_, _, err = (&Database{DB: db}).QueryCertificates(CertificateFilter{SortColumn: "issuer"})
+	assert.Error(t, err)
+}
@@ -23,12 +23,25 @@ type Certificate struct {
 	Subject      string     `gorm:"not null" json:"subject"`
 	Issuer       string     `gorm:"not null" json:"issuer"`
 	NotBefore    time.Time  `json:"not_before"`
-	NotAfter     time.Time  `json:"not_after"`
+	NotAfter     time.Time  `gorm:"index" json:"not_after"`
 	IsRevoked    bool       `gorm:"default:false" json:"is_revoked"`
 	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
 	S3Path       string     `json:"s3_path,omitempty"` // Path in S3 bucket
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// Searchable metadata mirrored from the certificate index
+	CommonName        string `gorm:"index" json:"common_name"`
+	SubjectAltNames   string `gorm:"type:text" json:"subject_alt_names,omitempty"` // Newline separated DNS, IP, URI and email SANs
+	IsClient          bool   `gorm:"default:false;index" json:"is_client"`
+	Profile           string `gorm:"index" json:"profile,omitempty"`
+	FingerprintSHA1   string `json:"fingerprint_sha1"`
+	FingerprintSHA256 string `gorm:"index" json:"fingerprint_sha256"`
+	Labels            string `gorm:"type:text" json:"labels,omitempty"` // Newline separated key=value pairs, with a newline on both ends
+	OwnerEmail        string `gorm:"index" json:"owner_email,omitempty"`
+	Team              string `gorm:"index" json:"team,omitempty"`
+	Notes             string `gorm:"type:text" json:"notes,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // EmailSettings stores email configuration
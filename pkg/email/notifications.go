@@ -30,6 +30,8 @@ type CertificateInfo struct {
 	ExpiryDate   string
 	IsClient     bool
 	SerialNumber string
+	// OwnerEmail is notified about the certificate in addition to the global recipient
+	OwnerEmail string
 }
 
 // NewEmailService creates a new email service
@@ -189,9 +191,58 @@ func (e *EmailService) SendCertificateExpiryNotification(from, to, certName, exp
 	return e.SendEmail(from, to, subject, body)
 }
 
-// CheckCertificatesExpiry checks for certificates that will expire soon and sends notifications
+// SendCertificateRenewalNotification reports the outcome of an automatic
+// certificate renewal; expiryDate is the expiry of the certificate in place
+// after the attempt
+func (e *EmailService) SendCertificateRenewalNotification(from, to, certName, expiryDate string, renewErr error) error {
+	if renewErr != nil {
+		subject := fmt.Sprintf("Certificate Renewal Failed: %s", certName)
+		body := fmt.Sprintf(
+			"Certificate Renewal Failed\n\n"+
+				"LocalCA could not automatically renew the following certificate:\n\n"+
+				"Certificate Name: %s\n"+
+				"Expiry Date: %s\n"+
+				"Error: %s\n\n"+
+				"The renewal will be retried. Please renew this certificate manually if the problem persists.\n\n"+
+				"This is an automated message from LocalCA.\n"+
+				"Time: %s",
+			certName, expiryDate, renewErr, time.Now().Format("2006-01-02 15:04:05"))
+		return e.SendEmail(from, to, subject, body)
+	}
+
+	subject := fmt.Sprintf("Certificate Renewed: %s", certName)
+	body := fmt.Sprintf(
+		"Certificate Renewed\n\n"+
+			"LocalCA automatically renewed the following certificate:\n\n"+
+			"Certificate Name: %s\n"+
+			"New Expiry Date: %s\n\n"+
+			"Please deploy the renewed certificate.\n\n"+
+			"This is an automated message from LocalCA.\n"+
+			"Time: %s",
+		certName, expiryDate, time.Now().Format("2006-01-02 15:04:05"))
+	return e.SendEmail(from, to, subject, body)
+}
+
+// ExpiryRecipients returns the addresses to notify about a certificate: its
+// owner followed by the global recipient, without duplicates or empty entries
+func ExpiryRecipients(cert CertificateInfo, to string) []string {
+	var recipients []string
+	for _, recipient := range []string{cert.OwnerEmail, to} {
+		if recipient == "" {
+			continue
+		}
+		if len(recipients) > 0 && strings.EqualFold(recipients[0], recipient) {
+			continue
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients
+}
+
+// CheckCertificatesExpiry checks for certificates that will expire soon and
+// notifies their owners and the global recipient
 func (e *EmailService) CheckCertificatesExpiry(certificateList []CertificateInfo, from, to string, warningDays int) []string {
-	if e.SMTPServer == "" || to == "" {
+	if e.SMTPServer == "" {
 		return nil
 	}
 
@@ -207,8 +258,14 @@ func (e *EmailService) CheckCertificatesExpiry(certificateList []CertificateInfo
 
 		// Check if certificate will expire within the warning period
 		if now.Add(warningPeriod).After(expiryDate) && now.Before(expiryDate) {
-			// Send notification
-			if err := e.SendCertificateExpiryNotification(from, to, cert.CommonName, cert.ExpiryDate); err == nil {
+			// Send notification to each recipient
+			notified := false
+			for _, recipient := range ExpiryRecipients(cert, to) {
+				if err := e.SendCertificateExpiryNotification(from, recipient, cert.CommonName, cert.ExpiryDate); err == nil {
+					notified = true
+				}
+			}
+			if notified {
 				notifiedCerts = append(notifiedCerts, cert.CommonName)
 			}
 		}
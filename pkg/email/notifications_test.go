@@ -246,3 +246,14 @@ func TestCheckCertificatesExpiry_NoEmailTo(t *testing.T) {
 	// Should return nil since no recipient is specified
 	assert.Nil(t, result)
 }
+
+func TestExpiryRecipients(t *testing.T) {
+	owned := CertificateInfo{CommonName: "api.example.com", OwnerEmail: "team@example.com"}
+	unowned := CertificateInfo{CommonName: "web.example.com"}
+
+	assert.Equal(t, []string{"team@example.com", "admin@example.com"}, ExpiryRecipients(owned, "admin@example.com"))
+	assert.Equal(t, []string{"team@example.com"}, ExpiryRecipients(owned, ""))
+	assert.Equal(t, []string{"team@example.com"}, ExpiryRecipients(owned, "TEAM@example.com"))
+	assert.Equal(t, []string{"admin@example.com"}, ExpiryRecipients(unowned, "admin@example.com"))
+	assert.Nil(t, ExpiryRecipients(unowned, ""))
+}
@@ -5,6 +5,8 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -41,17 +43,50 @@ func SetupAPIRoutes(router *gin.Engine, certSvc certificates.CertificateServiceI
 
 		// Certificate endpoints
 		api.GET("/certificates", apiGetCertificatesHandler(certSvc, store))
-		api.POST("/certificates", apiCreateCertificateHandler(certSvc, store))
+		api.GET("/certificates/:name", apiGetCertificateHandler(certSvc, store))
+		api.PUT("/certificates/:name/metadata", apiUpdateCertificateMetadataHandler(certSvc, store))
+		api.GET("/certificates/:name/renewal", apiGetRenewalStatusHandler(certSvc, store))
+		api.PUT("/certificates/:name/renewal", apiSetRenewalPolicyHandler(certSvc, store))
+		api.DELETE("/certificates/:name/renewal", apiSetRenewalPolicyHandler(certSvc, store))
+		api.GET("/certificates/:name/versions", apiListCertificateVersionsHandler(certSvc, store))
+		api.GET("/certificates/:name/versions/:serial/:type", downloadCertificateVersionHandler(certSvc, store))
+		api.POST("/certificates/:name/versions/:serial/revoke", requireUnsealed(certSvc), apiRevokeCertificateVersionHandler(certSvc, store))
+		api.POST("/certificates/index", apiRebuildIndexHandler(certSvc, store))
+		api.POST("/certificates", requireUnsealed(certSvc), apiCreateCertificateHandler(certSvc, store))
+		api.POST("/certificates/csr", requireUnsealed(certSvc), apiSignCSRHandler(certSvc, store))
 
 		// CA info endpoint
 		api.GET("/ca-info", apiGetCAInfoHandler(certSvc, store))
 
+		// CA hierarchy endpoints
+		api.GET("/ca/hierarchy", apiGetCAHierarchyHandler(certSvc, store))
+		api.GET("/ca/root-key", apiExportRootKeyHandler(certSvc, store))
+		api.DELETE("/ca/root-key", apiRemoveRootKeyHandler(certSvc, store))
+		api.POST("/ca/intermediate", requireUnsealed(certSvc), apiReissueIntermediateHandler(certSvc, store))
+		api.POST("/ca/rollover", requireUnsealed(certSvc), apiRolloverCAHandler(certSvc, store))
+
+		// CA seal endpoints
+		api.GET("/ca/seal", apiGetSealStatusHandler(certSvc, store))
+		api.POST("/ca/seal", apiSealCAHandler(certSvc, store))
+		api.POST("/ca/unseal", apiUnsealCAHandler(certSvc, store))
+		api.POST("/ca/shares", requireUnsealed(certSvc), apiCreateUnsealSharesHandler(certSvc, store))
+		api.GET("/ca/unseal/shares", apiGetUnsealProgressHandler(certSvc, store))
+		api.POST("/ca/unseal/shares", apiSubmitUnsealShareHandler(certSvc, store))
+		api.DELETE("/ca/unseal/shares", apiResetUnsealSharesHandler(certSvc, store))
+
+		// Certificate profile endpoints
+		api.GET("/profiles", apiListProfilesHandler(certSvc, store))
+		api.POST("/profiles", apiCreateProfileHandler(certSvc, store))
+		api.GET("/profiles/:name", apiGetProfileHandler(certSvc, store))
+		api.PUT("/profiles/:name", apiUpdateProfileHandler(certSvc, store))
+		api.DELETE("/profiles/:name", apiDeleteProfileHandler(certSvc, store))
+
 		// System statistics endpoint
 		api.GET("/statistics", apiGetStatisticsHandler(certSvc, store))
 
 		// Certificate operations
-		api.POST("/revoke", apiRevokeCertificateHandler(certSvc, store))
-		api.POST("/renew", apiRenewCertificateHandler(certSvc, store))
+		api.POST("/revoke", requireUnsealed(certSvc), apiRevokeCertificateHandler(certSvc, store))
+		api.POST("/renew", requireUnsealed(certSvc), apiRenewCertificateHandler(certSvc, store))
 		api.POST("/delete", apiDeleteCertificateHandler(certSvc, store))
 
 		// Settings endpoints
@@ -68,7 +103,9 @@ func SetupAPIRoutes(router *gin.Engine, certSvc certificates.CertificateServiceI
 		// Download endpoints
 		api.GET("/download/ca", downloadCAHandler(certSvc, store))
 		api.GET("/download/crl", downloadCRLHandler(certSvc, store))
-		api.GET("/download/:name/:type", downloadCertificateHandler(certSvc, store))
+		api.GET("/download/intermediate", downloadIntermediateHandler(certSvc, store))
+		api.GET("/download/trust-bundle", downloadTrustBundleHandler(certSvc, store))
+		api.GET("/download/:name/:type", downloadHandler(certSvc, store))
 	}
 }
 
@@ -150,8 +187,9 @@ func apiSecurityMiddleware() gin.HandlerFunc {
 			strings.HasSuffix(path, "/setup") ||
 			strings.HasSuffix(path, "/auth/status")
 
-		// Only require User-Agent for non-auth endpoints
-		if !isAuthEndpoint {
+		// Only require User-Agent for non-auth endpoints; relying parties
+		// fetching CA certificates and CRLs often do not send one
+		if !isAuthEndpoint && !isDistributionPath(path) {
 			userAgent := c.GetHeader("User-Agent")
 			if userAgent == "" {
 				c.JSON(http.StatusBadRequest, APIResponse{
@@ -185,11 +223,27 @@ func apiSecurityMiddleware() gin.HandlerFunc {
 	}
 }
 
-// apiGetCertificatesHandler returns all certificates as JSON
+// apiGetCertificatesHandler returns the certificates matching the query
+// parameters as JSON. Without a limit all matching certificates are returned.
 func apiGetCertificatesHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// List all certificates
-		certNames, err := store.ListCertificates()
+		query, err := parseCertificateQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		page, err := certSvc.QueryCertificates(query)
+		if errors.Is(err, certificates.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			log.Printf("Failed to list certificates: %v", err)
 			c.JSON(http.StatusInternalServerError, APIResponse{
@@ -199,15 +253,9 @@ func apiGetCertificatesHandler(certSvc certificates.CertificateServiceInterface,
 			return
 		}
 
-		// Get certificate details
-		certificates := make([]CertificateInfo, 0, len(certNames))
-		for _, name := range certNames {
-			certInfo, err := getCertificateInfo(store, name)
-			if err != nil {
-				log.Printf("Failed to get certificate info for %s: %v", name, err)
-				continue
-			}
-			certificates = append(certificates, certInfo)
+		certificates := make([]CertificateInfo, 0, len(page.Certificates))
+		for _, cert := range page.Certificates {
+			certificates = append(certificates, certificateInfoFrom(cert))
 		}
 
 		c.JSON(http.StatusOK, APIResponse{
@@ -215,6 +263,230 @@ func apiGetCertificatesHandler(certSvc certificates.CertificateServiceInterface,
 			Message: "Certificates retrieved successfully",
 			Data: map[string]interface{}{
 				"certificates": certificates,
+				"total":        page.Total,
+				"next_cursor":  page.NextCursor,
+			},
+		})
+	}
+}
+
+// parseCertificateQuery reads the filter, sort and pagination parameters of a
+// certificate listing
+func parseCertificateQuery(c *gin.Context) (certificates.CertificateQuery, error) {
+	query := certificates.CertificateQuery{
+		Status:       c.Query("status"),
+		Type:         c.Query("type"),
+		Search:       c.Query("q"),
+		SerialNumber: c.Query("serial"),
+		Fingerprint:  c.Query("fingerprint"),
+		Issuer:       c.Query("issuer"),
+		Tags:         c.QueryArray("tag"),
+		Profile:      c.Query("profile"),
+		Sort:         c.Query("sort"),
+		Cursor:       c.Query("cursor"),
+	}
+
+	switch c.Query("order") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return query, fmt.Errorf("order must be asc or desc")
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 {
+			return query, fmt.Errorf("limit must be a positive number")
+		}
+		query.Limit = l
+	}
+
+	var err error
+	if query.ExpiresAfter, err = parseQueryTime(c.Query("expires_after")); err != nil {
+		return query, fmt.Errorf("expires_after: %w", err)
+	}
+	if query.ExpiresBefore, err = parseQueryTime(c.Query("expires_before")); err != nil {
+		return query, fmt.Errorf("expires_before: %w", err)
+	}
+	return query, nil
+}
+
+// parseCertificateMetadata reads the owner_email, team, labels and notes form
+// fields; labels are comma separated key=value pairs
+func parseCertificateMetadata(c *gin.Context) (certificates.CertificateMetadata, error) {
+	metadata := certificates.CertificateMetadata{
+		OwnerEmail: strings.TrimSpace(c.PostForm("owner_email")),
+		Team:       strings.TrimSpace(c.PostForm("team")),
+		Notes:      strings.TrimSpace(c.PostForm("notes")),
+	}
+
+	labels, err := certificates.ParseLabels(parseCSVList(c.PostForm("labels")))
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Labels = labels
+
+	return metadata, metadata.Validate()
+}
+
+// parseQueryTime parses an RFC 3339 timestamp or a YYYY-MM-DD date in UTC.
+// An empty value yields the zero time.
+func parseQueryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("expected an RFC 3339 timestamp or YYYY-MM-DD date")
+}
+
+// apiGetCertificateHandler returns the full parsed metadata of a certificate
+func apiGetCertificateHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+
+		// Validate certificate name
+		if strings.Contains(name, "/") || strings.Contains(name, "\\") || strings.Contains(name, "..") {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid certificate name",
+			})
+			return
+		}
+
+		cert, err := certSvc.GetCertificateInfo(name)
+		if errors.Is(err, certificates.ErrCertificateNotFound) {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Certificate not found",
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get certificate info for %s: %v", name, err)
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get certificate info",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Certificate retrieved successfully",
+			Data:    cert,
+		})
+	}
+}
+
+// apiUpdateCertificateMetadataHandler replaces the owner, team, labels and
+// notes of a certificate from a JSON body
+func apiUpdateCertificateMetadataHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		userIP := c.ClientIP()
+		userAgent := c.GetHeader("User-Agent")
+
+		// Validate certificate name
+		if strings.Contains(name, "/") || strings.Contains(name, "\\") || strings.Contains(name, "..") {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid certificate name",
+			})
+			return
+		}
+
+		var metadata certificates.CertificateMetadata
+		if err := c.ShouldBindJSON(&metadata); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid metadata",
+			})
+			return
+		}
+		metadata.OwnerEmail = strings.TrimSpace(metadata.OwnerEmail)
+		metadata.Team = strings.TrimSpace(metadata.Team)
+		metadata.Notes = strings.TrimSpace(metadata.Notes)
+
+		err := certSvc.UpdateCertificateMetadata(name, metadata)
+		if err != nil {
+			writeAuditLog(store, "update_metadata", "certificate", name, userIP, userAgent,
+				"Failed to update certificate metadata", false, err.Error())
+
+			switch {
+			case errors.Is(err, certificates.ErrInvalidMetadata):
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: err.Error(),
+				})
+			case errors.Is(err, certificates.ErrCertificateNotFound):
+				c.JSON(http.StatusNotFound, APIResponse{
+					Success: false,
+					Message: "Certificate not found",
+				})
+			default:
+				log.Printf("Failed to update metadata of certificate %s: %v", name, err)
+				c.JSON(http.StatusInternalServerError, APIResponse{
+					Success: false,
+					Message: "Failed to update certificate metadata",
+				})
+			}
+			return
+		}
+
+		writeAuditLog(store, "update_metadata", "certificate", name, userIP, userAgent,
+			fmt.Sprintf("Updated certificate metadata (owner %q, team %q, %d labels)", metadata.OwnerEmail, metadata.Team, len(metadata.Labels)), true, "")
+
+		cert, err := certSvc.GetCertificateInfo(name)
+		if err != nil {
+			log.Printf("Failed to get certificate info for %s: %v", name, err)
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get certificate info",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Certificate metadata updated successfully",
+			Data:    cert,
+		})
+	}
+}
+
+// apiRebuildIndexHandler discards the certificate index and parses every
+// stored certificate again
+func apiRebuildIndexHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIP := c.ClientIP()
+		userAgent := c.GetHeader("User-Agent")
+
+		count, err := certSvc.RebuildIndex()
+		if err != nil {
+			log.Printf("Failed to rebuild certificate index: %v", err)
+			writeAuditLog(store, "rebuild_index", "certificate", "index", userIP, userAgent,
+				"Failed to rebuild certificate index", false, err.Error())
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to rebuild certificate index",
+			})
+			return
+		}
+
+		writeAuditLog(store, "rebuild_index", "certificate", "index", userIP, userAgent,
+			fmt.Sprintf("Rebuilt certificate index with %d certificates", count), true, "")
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Certificate index rebuilt successfully",
+			Data: map[string]interface{}{
+				"certificates": count,
 			},
 		})
 	}
@@ -277,7 +549,7 @@ func apiCreateCertificateHandler(certSvc certificates.CertificateServiceInterfac
 			}
 		}
 
-		// Process additional domains
+		// Process additional domains: DNS names, IP addresses, URIs and email addresses
 		var domains []string
 		if additionalDomains != "" {
 			domains = parseCSVList(additionalDomains)
@@ -291,15 +563,64 @@ func apiCreateCertificateHandler(certSvc certificates.CertificateServiceInterfac
 					return
 				}
 			}
+			if _, err := certificates.ParseSubjectAltNames(domains); err != nil {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: err.Error(),
+				})
+				return
+			}
+		}
+
+		// Parse optional key algorithm and size
+		keySize := 0
+		if value := c.PostForm("key_size"); value != "" {
+			size, err := strconv.Atoi(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "Key size must be a number",
+				})
+				return
+			}
+			keySize = size
+		}
+
+		keySpec, err := certificates.ParseKeySpec(c.PostForm("key_algorithm"), keySize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		metadata, err := parseCertificateMetadata(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		opts := certificates.IssueOptions{
+			KeyAlgorithm: keySpec.Algorithm,
+			KeySize:      keySpec.Size,
+			Profile:      strings.TrimSpace(c.PostForm("profile")),
+			Metadata:     metadata,
+		}
+		if isClient {
+			opts.SubjectAltNames = domains
 		}
 
 		var err2 error
 		if isClient {
 			// Create client certificate
-			err2 = certSvc.CreateClientCertificate(commonName, password)
+			err2 = certSvc.CreateClientCertificateWithOptions(commonName, password, opts)
 		} else {
 			// Create server certificate
-			err2 = certSvc.CreateServerCertificate(commonName, domains)
+			err2 = certSvc.CreateServerCertificateWithOptions(commonName, domains, opts)
 		}
 
 		if err2 != nil {
@@ -315,6 +636,23 @@ func apiCreateCertificateHandler(certSvc certificates.CertificateServiceInterfac
 			writeAuditLog(store, "create", "certificate", commonName, userIP, userAgent,
 				fmt.Sprintf("Failed to create %s certificate for %s", certType, commonName), false, err2.Error())
 
+			if errors.Is(err2, certificates.ErrProfileNotFound) || errors.Is(err2, certificates.ErrKeyTypeNotAllowed) ||
+				errors.Is(err2, certificates.ErrInvalidMetadata) {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: err2.Error(),
+				})
+				return
+			}
+
+			if errors.Is(err2, certificates.ErrCertificateAlreadyExists) {
+				c.JSON(http.StatusConflict, APIResponse{
+					Success: false,
+					Message: "Certificate with this Common Name already exists",
+				})
+				return
+			}
+
 			c.JSON(http.StatusInternalServerError, APIResponse{
 				Success: false,
 				Message: fmt.Sprintf("Failed to create certificate: %v", err2),
@@ -330,92 +668,410 @@ func apiCreateCertificateHandler(certSvc certificates.CertificateServiceInterfac
 			certType = "client"
 		}
 		writeAuditLog(store, "create", "certificate", commonName, userIP, userAgent,
-			fmt.Sprintf("Successfully created %s certificate for %s", certType, commonName), true, "")
+			fmt.Sprintf("Successfully created %s certificate for %s (%s, profile %s)", certType, commonName, keySpec, profileLabel(opts.Profile, isClient)), true, "")
+
+		log.Printf("Certificate created: %s (%s) by %s [%s]", commonName, certType, userIP, userAgent)
+
+		// Return success
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Certificate created successfully",
+		})
+	}
+}
+
+// apiGetCAInfoHandler returns CA information as JSON
+func apiGetCAInfoHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get CA info
+		caInfo, err := getCAInfo(store)
+		if err != nil {
+			log.Printf("Failed to get CA info: %v", err)
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get CA information",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "CA info retrieved successfully",
+			Data:    caInfo,
+		})
+	}
+}
+
+// parseRevocationForm reads the optional reason and RFC 3339 invalidity_date
+// form fields of a revocation request
+func parseRevocationForm(c *gin.Context) (certificates.RevocationReason, *time.Time, error) {
+	reason, err := certificates.ParseRevocationReason(c.PostForm("reason"))
+	if err != nil {
+		return reason, nil, err
+	}
+
+	value := c.PostForm("invalidity_date")
+	if value == "" {
+		return reason, nil, nil
+	}
+	invalidityDate, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return reason, nil, errors.New("Invalid invalidity_date, expected RFC 3339 format")
+	}
+	return reason, &invalidityDate, nil
+}
+
+// apiRevokeCertificateHandler revokes a certificate via API
+func apiRevokeCertificateHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Get and validate serial number
+		serialNumber := security.ValidateSerialNumber(c.PostForm("serial_number"))
+		if serialNumber == "" {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Serial number is required",
+			})
+			return
+		}
+
+		// Find certificate by serial number
+		certName, err := store.GetCertificateNameBySerial(serialNumber)
+		if err != nil {
+			log.Printf("Failed to find certificate with serial %s: %v", serialNumber, err)
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Certificate not found",
+			})
+			return
+		}
+
+		// Parse optional revocation reason and invalidity date
+		reason, invalidityDate, err := parseRevocationForm(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		// Revoke certificate
+		if err := certSvc.RevokeCertificateWithReason(certName, reason, invalidityDate); err != nil {
+			log.Printf("Failed to revoke certificate: %v", err)
+
+			// Log failed revocation
+			userIP := c.ClientIP()
+			userAgent := c.GetHeader("User-Agent")
+			writeAuditLog(store, "revoke", "certificate", certName, userIP, userAgent,
+				fmt.Sprintf("Failed to revoke certificate %s (serial: %s)", certName, serialNumber), false, err.Error())
+
+			if errors.Is(err, certificates.ErrCertificateRevoked) {
+				c.JSON(http.StatusConflict, APIResponse{
+					Success: false,
+					Message: "Certificate is already revoked",
+				})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Failed to revoke certificate: %v", err),
+			})
+			return
+		}
+
+		// Log successful certificate revocation
+		userIP := c.ClientIP()
+		userAgent := c.GetHeader("User-Agent")
+		writeAuditLog(store, "revoke", "certificate", certName, userIP, userAgent,
+			fmt.Sprintf("Successfully revoked certificate %s (serial: %s, reason: %s)", certName, serialNumber, reason), true, "")
+
+		log.Printf("Certificate revoked: %s (serial: %s, reason: %s) by %s [%s]", certName, serialNumber, reason, userIP, userAgent)
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Certificate revoked successfully",
+		})
+	}
+}
+
+// apiGetRenewalStatusHandler returns the automatic renewal policy applying to
+// a certificate, when it is due and any failed attempts
+func apiGetRenewalStatusHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+
+		// Validate certificate name
+		if strings.Contains(name, "/") || strings.Contains(name, "\\") || strings.Contains(name, "..") {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid certificate name",
+			})
+			return
+		}
+
+		status, err := certSvc.GetRenewalStatus(name)
+		if errors.Is(err, certificates.ErrCertificateNotFound) {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Certificate not found",
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get renewal status of certificate %s: %v", name, err)
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get renewal status",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Renewal status retrieved successfully",
+			Data:    status,
+		})
+	}
+}
+
+// apiSetRenewalPolicyHandler sets the automatic renewal policy of a
+// certificate from a JSON body (PUT), or removes it so the certificate follows
+// its profile again (DELETE)
+func apiSetRenewalPolicyHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		userIP := c.ClientIP()
+		userAgent := c.GetHeader("User-Agent")
+
+		// Validate certificate name
+		if strings.Contains(name, "/") || strings.Contains(name, "\\") || strings.Contains(name, "..") {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid certificate name",
+			})
+			return
+		}
+
+		var policy *certificates.RenewalPolicy
+		details := "Removed certificate renewal policy"
+		if c.Request.Method != http.MethodDelete {
+			policy = &certificates.RenewalPolicy{}
+			if err := c.ShouldBindJSON(policy); err != nil {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "Invalid renewal policy",
+				})
+				return
+			}
+			details = fmt.Sprintf("Set certificate renewal policy (enabled %t, lifetime fraction %g, days before expiry %d, rotate key %t)",
+				policy.Enabled, policy.LifetimeFraction, policy.DaysBeforeExpiry, policy.RotateKey)
+		}
+
+		err := certSvc.SetRenewalPolicy(name, policy)
+		if err != nil {
+			writeAuditLog(store, "update_renewal_policy", "certificate", name, userIP, userAgent,
+				"Failed to update certificate renewal policy", false, err.Error())
+
+			switch {
+			case errors.Is(err, certificates.ErrInvalidRenewalPolicy):
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: err.Error(),
+				})
+			case errors.Is(err, certificates.ErrCertificateNotFound):
+				c.JSON(http.StatusNotFound, APIResponse{
+					Success: false,
+					Message: "Certificate not found",
+				})
+			default:
+				log.Printf("Failed to update renewal policy of certificate %s: %v", name, err)
+				c.JSON(http.StatusInternalServerError, APIResponse{
+					Success: false,
+					Message: "Failed to update renewal policy",
+				})
+			}
+			return
+		}
 
-		log.Printf("Certificate created: %s (%s) by %s [%s]", commonName, certType, userIP, userAgent)
+		writeAuditLog(store, "update_renewal_policy", "certificate", name, userIP, userAgent, details, true, "")
+
+		status, err := certSvc.GetRenewalStatus(name)
+		if err != nil {
+			log.Printf("Failed to get renewal status of certificate %s: %v", name, err)
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get renewal status",
+			})
+			return
+		}
 
-		// Return success
 		c.JSON(http.StatusOK, APIResponse{
 			Success: true,
-			Message: "Certificate created successfully",
+			Message: "Renewal policy updated successfully",
+			Data:    status,
 		})
 	}
 }
 
-// apiGetCAInfoHandler returns CA information as JSON
-func apiGetCAInfoHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+// apiListCertificateVersionsHandler lists every version issued under a
+// certificate name, newest first, marking the current one
+func apiListCertificateVersionsHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get CA info
-		caInfo, err := getCAInfo(store)
+		name := c.Param("name")
+
+		// Validate certificate name
+		if strings.Contains(name, "/") || strings.Contains(name, "\\") || strings.Contains(name, "..") {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid certificate name",
+			})
+			return
+		}
+
+		versions, err := certSvc.ListCertificateVersions(name)
+		if errors.Is(err, certificates.ErrCertificateNotFound) {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Certificate not found",
+			})
+			return
+		}
 		if err != nil {
-			log.Printf("Failed to get CA info: %v", err)
+			log.Printf("Failed to list versions of certificate %s: %v", name, err)
 			c.JSON(http.StatusInternalServerError, APIResponse{
 				Success: false,
-				Message: "Failed to get CA information",
+				Message: "Failed to list certificate versions",
 			})
 			return
 		}
 
 		c.JSON(http.StatusOK, APIResponse{
 			Success: true,
-			Message: "CA info retrieved successfully",
-			Data:    caInfo,
+			Message: "Certificate versions retrieved successfully",
+			Data:    versions,
 		})
 	}
 }
 
-// apiRevokeCertificateHandler revokes a certificate via API
-func apiRevokeCertificateHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+// downloadCertificateVersionHandler serves the certificate (crt) or private
+// key (key) of one version of a certificate
+func downloadCertificateVersionHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get and validate serial number
-		serialNumber := security.ValidateSerialNumber(c.PostForm("serial_number"))
-		if serialNumber == "" {
+		name := c.Param("name")
+		serial := c.Param("serial")
+
+		// Validate certificate name
+		if strings.Contains(name, "/") || strings.Contains(name, "\\") || strings.Contains(name, "..") {
 			c.JSON(http.StatusBadRequest, APIResponse{
 				Success: false,
-				Message: "Serial number is required",
+				Message: "Invalid certificate name",
 			})
 			return
 		}
 
-		// Find certificate by serial number
-		certName, err := store.GetCertificateNameBySerial(serialNumber)
-		if err != nil {
-			log.Printf("Failed to find certificate with serial %s: %v", serialNumber, err)
+		version, err := certSvc.GetCertificateVersion(name, serial)
+		if errors.Is(err, certificates.ErrCertificateNotFound) {
 			c.JSON(http.StatusNotFound, APIResponse{
 				Success: false,
-				Message: "Certificate not found",
+				Message: "Certificate version not found",
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to get version %s of certificate %s: %v", serial, name, err)
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get certificate version",
 			})
 			return
 		}
 
-		// Revoke certificate
-		if err := certSvc.RevokeCertificate(certName); err != nil {
-			log.Printf("Failed to revoke certificate: %v", err)
-
-			// Log failed revocation
-			userIP := c.ClientIP()
-			userAgent := c.GetHeader("User-Agent")
-			writeAuditLog(store, "revoke", "certificate", certName, userIP, userAgent,
-				fmt.Sprintf("Failed to revoke certificate %s (serial: %s)", certName, serialNumber), false, err.Error())
+		var filePath, fileName string
+		switch c.Param("type") {
+		case "crt":
+			filePath = version.Path
+			fileName = fmt.Sprintf("%s-%s.crt", name, version.SerialNumber)
+		case "key":
+			filePath = version.KeyPath
+			fileName = fmt.Sprintf("%s-%s.key", name, version.SerialNumber)
+		default:
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid file type",
+			})
+			return
+		}
 
-			c.JSON(http.StatusInternalServerError, APIResponse{
+		if filePath == "" {
+			c.JSON(http.StatusNotFound, APIResponse{
 				Success: false,
-				Message: fmt.Sprintf("Failed to revoke certificate: %v", err),
+				Message: "File not found",
 			})
 			return
 		}
 
-		// Log successful certificate revocation
+		c.FileAttachment(filePath, fileName)
+	}
+}
+
+// apiRevokeCertificateVersionHandler revokes one version of a certificate
+func apiRevokeCertificateVersionHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		serial := c.Param("serial")
 		userIP := c.ClientIP()
 		userAgent := c.GetHeader("User-Agent")
-		writeAuditLog(store, "revoke", "certificate", certName, userIP, userAgent,
-			fmt.Sprintf("Successfully revoked certificate %s (serial: %s)", certName, serialNumber), true, "")
 
-		log.Printf("Certificate revoked: %s (serial: %s) by %s [%s]", certName, serialNumber, userIP, userAgent)
+		// Validate certificate name
+		if strings.Contains(name, "/") || strings.Contains(name, "\\") || strings.Contains(name, "..") {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid certificate name",
+			})
+			return
+		}
+
+		reason, invalidityDate, err := parseRevocationForm(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		if err := certSvc.RevokeCertificateVersion(name, serial, reason, invalidityDate); err != nil {
+			writeAuditLog(store, "revoke", "certificate", name, userIP, userAgent,
+				fmt.Sprintf("Failed to revoke certificate %s (serial: %s)", name, serial), false, err.Error())
+
+			switch {
+			case errors.Is(err, certificates.ErrCertificateNotFound):
+				c.JSON(http.StatusNotFound, APIResponse{
+					Success: false,
+					Message: "Certificate version not found",
+				})
+			case errors.Is(err, certificates.ErrCertificateRevoked):
+				c.JSON(http.StatusConflict, APIResponse{
+					Success: false,
+					Message: "Certificate is already revoked",
+				})
+			default:
+				log.Printf("Failed to revoke version %s of certificate %s: %v", serial, name, err)
+				c.JSON(http.StatusInternalServerError, APIResponse{
+					Success: false,
+					Message: fmt.Sprintf("Failed to revoke certificate: %v", err),
+				})
+			}
+			return
+		}
+
+		writeAuditLog(store, "revoke", "certificate", name, userIP, userAgent,
+			fmt.Sprintf("Successfully revoked certificate %s (serial: %s, reason: %s)", name, serial, reason), true, "")
 
 		c.JSON(http.StatusOK, APIResponse{
 			Success: true,
-			Message: "Certificate revoked successfully",
+			Message: "Certificate version revoked successfully",
 		})
 	}
 }
@@ -444,20 +1100,44 @@ func apiRenewCertificateHandler(certSvc certificates.CertificateServiceInterface
 			return
 		}
 
-		// Check if it's a client certificate
-		p12Path := store.GetCertificateP12Path(certName)
-		isClient := false
-		if _, err := os.Stat(p12Path); err == nil {
-			isClient = true
-		}
+		// Renew certificate, with a new key when requested
+		opts := certificates.RenewOptions{RotateKey: c.PostForm("rotate_key") == "true"}
 
-		// Renew certificate
-		if isClient {
-			err = certSvc.RenewClientCertificate(certName)
+		// Override the supersede policy of the profile when requested
+		if value := c.PostForm("revoke_superseded"); value != "" {
+			opts.RevokeSuperseded = &certificates.SupersedePolicy{Enabled: value == "true"}
+			if hours := c.PostForm("overlap_hours"); hours != "" {
+				overlap, err := strconv.Atoi(hours)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, APIResponse{
+						Success: false,
+						Message: "Invalid overlap_hours",
+					})
+					return
+				}
+				opts.RevokeSuperseded.OverlapHours = overlap
+			}
+		}
+		if isClientCertificate(store, certName) {
+			err = certSvc.RenewClientCertificateWithOptions(certName, opts)
 		} else {
-			err = certSvc.RenewServerCertificate(certName)
+			err = certSvc.RenewServerCertificateWithOptions(certName, opts)
 		}
 
+		if errors.Is(err, certificates.ErrNoPrivateKey) {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Certificate was issued from a CSR; its key cannot be rotated",
+			})
+			return
+		}
+		if errors.Is(err, certificates.ErrInvalidRenewalPolicy) {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			log.Printf("Failed to renew certificate: %v", err)
 			c.JSON(http.StatusInternalServerError, APIResponse{
@@ -488,7 +1168,7 @@ func apiDeleteCertificateHandler(certSvc certificates.CertificateServiceInterfac
 		}
 
 		// Find certificate by serial number
-		certName, err := store.GetCertificateNameBySerial(serialNumber)
+		cert, err := certSvc.FindCertificateBySerial(serialNumber)
 		if err != nil {
 			log.Printf("Failed to find certificate with serial %s: %v", serialNumber, err)
 			c.JSON(http.StatusNotFound, APIResponse{
@@ -497,9 +1177,10 @@ func apiDeleteCertificateHandler(certSvc certificates.CertificateServiceInterfac
 			})
 			return
 		}
+		certName := cert.Name
 
 		// Delete certificate
-		if err := store.DeleteCertificate(certName); err != nil {
+		if err := certSvc.DeleteCertificate(certName); err != nil {
 			log.Printf("Failed to delete certificate: %v", err)
 
 			// Log failed deletion
@@ -547,7 +1228,7 @@ func parseCSVList(csv string) []string {
 func apiGetSettingsHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get CA info for general settings
-		caName, _, organization, country, err := store.GetCAInfo()
+		caName, organization, country, err := store.GetCAInfo()
 		if err != nil {
 			log.Printf("Failed to get CA info: %v", err)
 			// Use defaults if CA info is not available
@@ -839,8 +1520,8 @@ func apiLogoutHandler(store *storage.Storage) gin.HandlerFunc {
 // apiGetStatisticsHandler handles GET /api/statistics
 func apiGetStatisticsHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get all certificates
-		certNames, err := store.ListCertificates()
+		// Get all certificates from the certificate index
+		certs, err := certSvc.GetAllCertificates()
 		if err != nil {
 			log.Printf("Failed to list certificates: %v", err)
 			c.JSON(http.StatusInternalServerError, APIResponse{
@@ -852,7 +1533,7 @@ func apiGetStatisticsHandler(certSvc certificates.CertificateServiceInterface, s
 
 		// Calculate statistics
 		stats := map[string]interface{}{
-			"total_certificates":  len(certNames),
+			"total_certificates":  len(certs),
 			"active_certificates": 0,
 			"expiring_soon":       0,
 			"expired":             0,
@@ -862,12 +1543,8 @@ func apiGetStatisticsHandler(certSvc certificates.CertificateServiceInterface, s
 		}
 
 		// Count certificates by status
-		for _, name := range certNames {
-			certInfo, err := getCertificateInfo(store, name)
-			if err != nil {
-				log.Printf("Failed to get certificate info for %s: %v", name, err)
-				continue
-			}
+		for _, cert := range certs {
+			certInfo := certificateInfoFrom(cert)
 
 			if certInfo.IsRevoked {
 				stats["revoked"] = stats["revoked"].(int) + 1
@@ -1145,7 +1822,8 @@ func writeAuditLog(store *storage.Storage, action, resource, resourceID, userIP,
 
 // Download handlers for API
 
-// downloadCAHandler handles CA certificate download
+// downloadCAHandler handles CA certificate download. The certificate is
+// served as DER for the AIA caIssuers URL, or as PEM with ?format=pem.
 func downloadCAHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		caPath := store.GetCAPublicKeyPath()
@@ -1156,23 +1834,208 @@ func downloadCAHandler(certSvc certificates.CertificateServiceInterface, store *
 			})
 			return
 		}
-		c.FileAttachment(caPath, "ca.crt")
+
+		if wantsPEM(c) {
+			c.FileAttachment(caPath, "ca.crt")
+			return
+		}
+
+		caPEM, err := os.ReadFile(caPath)
+		if err != nil {
+			log.Printf("Failed to read CA certificate: %v", err)
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to read CA certificate",
+			})
+			return
+		}
+		writeDERDownload(c, caPEM, "application/pkix-cert", "ca.cer")
+	}
+}
+
+// downloadIntermediateHandler handles download of the issuing intermediate in
+// two-tier mode, as DER or as PEM with ?format=pem
+func downloadIntermediateHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		intermediatePEM, err := certSvc.GetIntermediateCertificate()
+		if err != nil {
+			if !errors.Is(err, certificates.ErrNotTwoTier) {
+				log.Printf("Failed to get intermediate certificate: %v", err)
+			}
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Intermediate certificate not found",
+			})
+			return
+		}
+
+		if wantsPEM(c) {
+			c.Header("Content-Disposition", `attachment; filename="intermediate.crt"`)
+			c.Data(http.StatusOK, "application/x-pem-file", intermediatePEM)
+			return
+		}
+		writeDERDownload(c, intermediatePEM, "application/pkix-cert", "intermediate.cer")
+	}
+}
+
+// downloadTrustBundleHandler serves the PEM encoded roots to trust, which
+// include the retired root during a CA key rollover
+func downloadTrustBundleHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bundle, err := certSvc.GetTrustBundle()
+		if err != nil {
+			log.Printf("Failed to get trust bundle: %v", err)
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Trust bundle not found",
+			})
+			return
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="trust-bundle.pem"`)
+		c.Data(http.StatusOK, "application/x-pem-file", bundle)
 	}
 }
 
-// downloadCRLHandler handles CRL download
+// downloadCRLHandler handles CRL download. The CRL is served as DER for the
+// CRL distribution point, or as PEM with ?format=pem. A retired CA's CRL is
+// selected with ?ca=<id>.
 func downloadCRLHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		crlPath := filepath.Join(store.GetBasePath(), "ca.crl")
-		if _, err := os.Stat(crlPath); os.IsNotExist(err) {
+		// GetCRL regenerates the list when it is missing or close to expiry
+		var crlData []byte
+		var err error
+		if id := c.Query("ca"); id != "" {
+			crlData, err = certSvc.GetRetiredCRL(id)
+		} else {
+			crlData, err = certSvc.GetCRL()
+		}
+		if err != nil {
+			log.Printf("Failed to get CRL: %v", err)
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "CRL not found",
+			})
+			return
+		}
+
+		if wantsPEM(c) {
+			c.Header("Content-Disposition", `attachment; filename="ca.crl.pem"`)
+			c.Data(http.StatusOK, "application/x-pem-file", crlData)
+			return
+		}
+		writeDERDownload(c, crlData, "application/pkix-crl", "ca.crl")
+	}
+}
+
+// downloadHandler serves the CA certificates and CRLs of one CA generation,
+// which share the /download/:name/:type route with certificate downloads.
+// Certificate file types are lower case, so an upper case hex serial number
+// cannot be confused with one.
+func downloadHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	issuerCertificate := downloadIssuerCertificateHandler(certSvc)
+	issuerCRL := downloadIssuerCRLHandler(certSvc)
+	certificate := downloadCertificateHandler(certSvc, store)
+
+	return func(c *gin.Context) {
+		if isIssuerSerial(c.Param("type")) {
+			switch c.Param("name") {
+			case "ca", "intermediate":
+				issuerCertificate(c)
+				return
+			case "crl":
+				issuerCRL(c)
+				return
+			}
+		}
+		certificate(c)
+	}
+}
+
+// downloadIssuerCertificateHandler serves a current or retired CA
+// certificate by serial number, as DER or as PEM with ?format=pem. Leaves
+// embed this URL as their issuer URL.
+func downloadIssuerCertificateHandler(certSvc certificates.CertificateServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		certPEM, err := certSvc.GetIssuerCertificate(c.Param("type"))
+		if err != nil {
+			if !errors.Is(err, certificates.ErrIssuerNotFound) {
+				log.Printf("Failed to get CA certificate: %v", err)
+			}
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "CA certificate not found",
+			})
+			return
+		}
+
+		if wantsPEM(c) {
+			c.Header("Content-Disposition", `attachment; filename="ca.crt"`)
+			c.Data(http.StatusOK, "application/x-pem-file", certPEM)
+			return
+		}
+		writeDERDownload(c, certPEM, "application/pkix-cert", "ca.cer")
+	}
+}
+
+// downloadIssuerCRLHandler serves the CRL of the current or a retired
+// issuing CA by the serial number of its certificate, as DER or as PEM with
+// ?format=pem. Leaves embed this URL as their CRL distribution point.
+func downloadIssuerCRLHandler(certSvc certificates.CertificateServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		crlData, err := certSvc.GetIssuerCRL(c.Param("type"))
+		if err != nil {
+			if !errors.Is(err, certificates.ErrIssuerNotFound) {
+				log.Printf("Failed to get CRL: %v", err)
+			}
 			c.JSON(http.StatusNotFound, APIResponse{
 				Success: false,
 				Message: "CRL not found",
 			})
 			return
 		}
-		c.FileAttachment(crlPath, "ca.crl")
+
+		if wantsPEM(c) {
+			c.Header("Content-Disposition", `attachment; filename="ca.crl.pem"`)
+			c.Data(http.StatusOK, "application/x-pem-file", crlData)
+			return
+		}
+		writeDERDownload(c, crlData, "application/pkix-crl", "ca.crl")
+	}
+}
+
+// isIssuerSerial reports whether a path segment is a CA serial number in the
+// upper case hex form embedded in issued certificates
+func isIssuerSerial(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if (r < '0' || r > '9') && (r < 'A' || r > 'F') {
+			return false
+		}
 	}
+	return true
+}
+
+// wantsPEM reports whether a CA or CRL download was requested as PEM
+func wantsPEM(c *gin.Context) bool {
+	return strings.EqualFold(c.Query("format"), "pem")
+}
+
+// writeDERDownload writes the first PEM block of data as a DER attachment
+func writeDERDownload(c *gin.Context, pemData []byte, contentType, filename string) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to decode PEM data",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, contentType, block.Bytes)
 }
 
 // downloadCertificateHandler handles certificate file downloads
@@ -1658,60 +2521,26 @@ func getCAInfo(store *storage.Storage) (CAInfo, error) {
 	return caInfo, nil
 }
 
-// getCertificateInfo retrieves certificate information
-func getCertificateInfo(store *storage.Storage, name string) (CertificateInfo, error) {
-	var certInfo CertificateInfo
-	certInfo.CommonName = name
-
-	certPath := store.GetCertificatePath(name)
-	if _, err := os.Stat(certPath); os.IsNotExist(err) {
-		return certInfo, fmt.Errorf("certificate not found")
-	}
-
-	// Check if it's a client certificate
-	p12Path := store.GetCertificateP12Path(name)
-	if _, err := os.Stat(p12Path); err == nil {
-		certInfo.IsClient = true
-	}
-
-	// Get certificate details using openssl
-	cmd := exec.Command("openssl", "x509", "-in", certPath, "-noout", "-text")
-	output, err := cmd.Output()
-	if err != nil {
-		return certInfo, fmt.Errorf("failed to get certificate details: %w", err)
-	}
-
-	outputStr := string(output)
-
-	// Parse certificate details
-	if idx := strings.Index(outputStr, "Serial Number:"); idx != -1 {
-		serialLine := outputStr[idx:]
-		if endIdx := strings.Index(serialLine, "\n"); endIdx != -1 {
-			certInfo.SerialNumber = strings.TrimSpace(serialLine[14:endIdx])
-		}
-	}
-
-	if idx := strings.Index(outputStr, "Not After :"); idx != -1 {
-		dateLine := outputStr[idx:]
-		if endIdx := strings.Index(dateLine, "\n"); endIdx != -1 {
-			certInfo.ExpiryDate = strings.TrimSpace(dateLine[11:endIdx])
-			// Check if certificate is expired or expiring soon
-			if expiryTime, err := time.Parse("Jan  2 15:04:05 2006 MST", certInfo.ExpiryDate); err == nil {
-				now := time.Now()
-				if expiryTime.Before(now) {
-					certInfo.IsExpired = true
-				} else if expiryTime.Before(now.Add(30 * 24 * time.Hour)) {
-					certInfo.IsExpiringSoon = true
-				}
-			}
-		}
-	}
-
-	// Check if certificate is revoked
-	revokedPath := filepath.Join(store.GetCertificateDirectory(name), "revoked")
-	if _, err := os.Stat(revokedPath); err == nil {
-		certInfo.IsRevoked = true
+// certificateInfoFrom converts indexed certificate metadata for display
+func certificateInfoFrom(cert certificates.Certificate) CertificateInfo {
+	now := time.Now()
+	return CertificateInfo{
+		CommonName:     cert.Name,
+		ExpiryDate:     cert.NotAfter.UTC().Format(time.RFC3339),
+		IsClient:       cert.IsClient,
+		SerialNumber:   cert.SerialNumber,
+		IsExpired:      cert.NotAfter.Before(now),
+		IsExpiringSoon: !cert.NotAfter.Before(now) && cert.NotAfter.Before(now.Add(certificates.ExpiringWindow)),
+		IsRevoked:      cert.Revoked,
+		HasPrivateKey:  cert.HasPrivateKey,
+		Profile:        cert.Profile,
+		OwnerEmail:     cert.OwnerEmail,
+		Team:           cert.Team,
+		Labels:         cert.Labels,
+		Notes:          cert.Notes,
+		DNSNames:       cert.DNSNames,
+		IPAddresses:    cert.IPAddresses,
+		URIs:           cert.URIs,
+		EmailAddresses: cert.EmailAddresses,
 	}
-
-	return certInfo, nil
 }
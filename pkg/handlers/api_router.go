@@ -24,6 +24,9 @@ func SetupAPIOnlyRoutes(router *gin.Engine, certSvc certificates.CertificateServ
 	// Setup API routes
 	SetupAPIRoutes(router, certSvc, store)
 
+	// OCSP responder (public)
+	SetupOCSPRoutes(router, certSvc)
+
 	// Health check endpoint (public)
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -150,6 +153,10 @@ func apiAuthMiddleware(store *storage.Storage) gin.HandlerFunc {
 
 // isPublicAPIPath checks if the API path is publicly accessible
 func isPublicAPIPath(path string) bool {
+	if isDistributionPath(path) {
+		return true
+	}
+
 	publicPaths := []string{
 		"/health",
 		"/version",
@@ -157,9 +164,8 @@ func isPublicAPIPath(path string) bool {
 		"/api/setup",
 		"/api/auth/status",
 		"/.well-known/acme-challenge/",
-		"/api/download/ca",
-		"/api/download/crl",
 		"/acme/",
+		certificates.OCSPPath,
 	}
 
 	for _, prefix := range publicPaths {
@@ -169,3 +175,21 @@ func isPublicAPIPath(path string) bool {
 	}
 	return false
 }
+
+// isDistributionPath reports whether a path serves CA certificates or the CRL
+// to relying parties. These are matched exactly, or followed by a CA serial
+// number, so that certificate downloads under /api/download/ stay behind
+// authentication.
+func isDistributionPath(path string) bool {
+	switch path {
+	case certificates.CACertificatePath, certificates.IntermediateCertificatePath, certificates.CRLPath, certificates.TrustBundlePath:
+		return true
+	}
+
+	for _, prefix := range []string{certificates.CACertificatePath, certificates.IntermediateCertificatePath, certificates.CRLPath} {
+		if serial, ok := strings.CutPrefix(path, prefix+"/"); ok && isIssuerSerial(serial) {
+			return true
+		}
+	}
+	return false
+}
@@ -348,3 +348,36 @@ func TestAuthMiddleware(t *testing.T) {
 	assert.Equal(t, http.StatusSeeOther, w.Code)
 	assert.Equal(t, "/login", w.Header().Get("Location"))
 }
+
+func TestIsPublicAPIPath(t *testing.T) {
+	publicPaths := []string{
+		"/health",
+		"/api/login",
+		"/api/download/ca",
+		"/api/download/intermediate",
+		"/api/download/crl",
+		"/api/download/ca/1F2E3D",
+		"/api/download/intermediate/1F2E3D",
+		"/api/download/crl/1F2E3D",
+		"/ocsp",
+		"/ocsp/MEIwQDA-MDwwOjAJBgUrDgMCGgUA",
+	}
+
+	for _, path := range publicPaths {
+		assert.True(t, isPublicAPIPath(path), "Path should be public: %s", path)
+	}
+
+	// Certificate downloads share the /api/download/ prefix but need a session
+	nonPublicPaths := []string{
+		"/api/certificates",
+		"/api/download/cache.example.com/key",
+		"/api/download/crl.example.com/p12",
+		"/api/download/ca/key",
+		"/api/download/crl/crt",
+		"/api/download/crl/1F2E3D/extra",
+	}
+
+	for _, path := range nonPublicPaths {
+		assert.False(t, isPublicAPIPath(path), "Path should not be public: %s", path)
+	}
+}
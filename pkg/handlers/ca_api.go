@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/certificates"
+	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// maxRootKeyUploadSize limits the size of an uploaded root key
+const maxRootKeyUploadSize = 64 * 1024
+
+// apiGetCAHierarchyHandler returns the root and intermediate certificates in use
+func apiGetCAHierarchyHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hierarchy, err := certSvc.GetCAHierarchy()
+		if err != nil {
+			log.Printf("Failed to get CA hierarchy: %v", err)
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get CA hierarchy",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "CA hierarchy retrieved successfully",
+			Data:    hierarchy,
+		})
+	}
+}
+
+// apiExportRootKeyHandler downloads the root private key so it can be stored offline
+func apiExportRootKeyHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIP := c.ClientIP()
+		userAgent := c.GetHeader("User-Agent")
+
+		keyPEM, err := certSvc.ExportRootKey()
+		if err != nil {
+			writeAuditLog(store, "export", "ca", "root-key", userIP, userAgent,
+				"Failed to export root CA key", false, err.Error())
+
+			if errors.Is(err, certificates.ErrRootKeyOffline) {
+				c.JSON(http.StatusNotFound, APIResponse{
+					Success: false,
+					Message: "Root CA key is not present on this server",
+				})
+				return
+			}
+
+			log.Printf("Failed to export root key: %v", err)
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to export root CA key",
+			})
+			return
+		}
+
+		writeAuditLog(store, "export", "ca", "root-key", userIP, userAgent,
+			"Exported root CA key", true, "")
+
+		c.Header("Content-Disposition", `attachment; filename="root-ca.key"`)
+		c.Data(http.StatusOK, "application/x-pem-file", keyPEM)
+	}
+}
+
+// apiRemoveRootKeyHandler deletes the root private key from the server
+func apiRemoveRootKeyHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIP := c.ClientIP()
+		userAgent := c.GetHeader("User-Agent")
+
+		if err := certSvc.RemoveRootKey(); err != nil {
+			writeAuditLog(store, "remove", "ca", "root-key", userIP, userAgent,
+				"Failed to remove root CA key", false, err.Error())
+
+			switch {
+			case errors.Is(err, certificates.ErrNotTwoTier):
+				c.JSON(http.StatusConflict, APIResponse{
+					Success: false,
+					Message: "The root key can only be removed when an issuing intermediate exists",
+				})
+			case errors.Is(err, certificates.ErrRootKeyOffline):
+				c.JSON(http.StatusNotFound, APIResponse{
+					Success: false,
+					Message: "Root CA key is not present on this server",
+				})
+			default:
+				log.Printf("Failed to remove root key: %v", err)
+				c.JSON(http.StatusInternalServerError, APIResponse{
+					Success: false,
+					Message: "Failed to remove root CA key",
+				})
+			}
+			return
+		}
+
+		writeAuditLog(store, "remove", "ca", "root-key", userIP, userAgent,
+			"Removed root CA key from server", true, "")
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Root CA key removed from server",
+		})
+	}
+}
+
+// apiReissueIntermediateHandler re-certifies the issuing intermediate with the
+// root key, taken from the request when the root is offline
+func apiReissueIntermediateHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIP := c.ClientIP()
+		userAgent := c.GetHeader("User-Agent")
+
+		// The root key may be sent as a form field or an uploaded file
+		rootKeyPEM := []byte(c.PostForm("root_key"))
+		if file, err := c.FormFile("root_key"); err == nil {
+			if file.Size > maxRootKeyUploadSize {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "Root key file is too large",
+				})
+				return
+			}
+			f, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "Failed to read root key file",
+				})
+				return
+			}
+			defer f.Close()
+			rootKeyPEM, err = io.ReadAll(io.LimitReader(f, maxRootKeyUploadSize))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "Failed to read root key file",
+				})
+				return
+			}
+		}
+
+		if err := certSvc.ReissueIntermediate(rootKeyPEM); err != nil {
+			writeAuditLog(store, "reissue", "ca", "intermediate", userIP, userAgent,
+				"Failed to reissue intermediate CA", false, err.Error())
+
+			switch {
+			case errors.Is(err, certificates.ErrNotTwoTier):
+				c.JSON(http.StatusConflict, APIResponse{
+					Success: false,
+					Message: "CA is not running in two-tier mode",
+				})
+			case errors.Is(err, certificates.ErrRootKeyOffline):
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "Root CA key is offline, provide it as root_key",
+				})
+			case errors.Is(err, certificates.ErrInvalidRootKey):
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: err.Error(),
+				})
+			default:
+				log.Printf("Failed to reissue intermediate: %v", err)
+				c.JSON(http.StatusInternalServerError, APIResponse{
+					Success: false,
+					Message: "Failed to reissue intermediate CA",
+				})
+			}
+			return
+		}
+
+		writeAuditLog(store, "reissue", "ca", "intermediate", userIP, userAgent,
+			"Reissued intermediate CA", true, "")
+
+		hierarchy, err := certSvc.GetCAHierarchy()
+		if err != nil {
+			log.Printf("Failed to get CA hierarchy: %v", err)
+		}
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Intermediate CA reissued successfully",
+			Data:    hierarchy,
+		})
+	}
+}
+
+// apiRolloverCAHandler replaces the CA key, cross-certifying the old and new
+// roots and keeping the old CA for revocation checks of its certificates
+func apiRolloverCAHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIP := c.ClientIP()
+		userAgent := c.GetHeader("User-Agent")
+
+		rollover, err := certSvc.RolloverCA()
+		if err != nil {
+			writeAuditLog(store, "rollover", "ca", "root", userIP, userAgent,
+				"Failed to roll over CA key", false, err.Error())
+
+			if errors.Is(err, certificates.ErrRootKeyOffline) {
+				c.JSON(http.StatusConflict, APIResponse{
+					Success: false,
+					Message: "Root CA key is not present on this server",
+				})
+				return
+			}
+
+			log.Printf("Failed to roll over CA: %v", err)
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to roll over CA key",
+			})
+			return
+		}
+
+		writeAuditLog(store, "rollover", "ca", "root", userIP, userAgent,
+			"Rolled over CA key, retired CA "+rollover.Retired.ID+" until "+rollover.Retired.LastLeafExpiry.Format(time.RFC3339), true, "")
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "CA key rolled over successfully",
+			Data:    rollover,
+		})
+	}
+}
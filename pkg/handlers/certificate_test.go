@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -23,6 +24,8 @@ import (
 type mockCertificateService struct {
 	certificates map[string]*certificates.Certificate
 	nextID       int
+	sealed       bool
+	shares       int
 }
 
 func newMockCertificateService() *mockCertificateService {
@@ -49,8 +52,127 @@ func (m *mockCertificateService) CreateServiceCertificate() error {
 	return nil
 }
 
+func (m *mockCertificateService) GetCAHierarchy() (*certificates.CAHierarchy, error) {
+	return &certificates.CAHierarchy{Mode: certificates.CAModeSingle, RootKeyOnline: true}, nil
+}
+
+func (m *mockCertificateService) ExportRootKey() ([]byte, error) {
+	return nil, certificates.ErrRootKeyOffline
+}
+
+func (m *mockCertificateService) RemoveRootKey() error {
+	return certificates.ErrNotTwoTier
+}
+
+func (m *mockCertificateService) GetIntermediateCertificate() ([]byte, error) {
+	return nil, certificates.ErrNotTwoTier
+}
+
+func (m *mockCertificateService) RolloverCA() (*certificates.CARollover, error) {
+	return nil, certificates.ErrRootKeyOffline
+}
+
+func (m *mockCertificateService) GetTrustBundle() ([]byte, error) {
+	return []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n"), nil
+}
+
+func (m *mockCertificateService) Sealed() bool {
+	return m.sealed
+}
+
+func (m *mockCertificateService) Seal() {
+	m.sealed = true
+}
+
+func (m *mockCertificateService) Unseal(passphrase string) error {
+	if passphrase != "correct passphrase" {
+		return certificates.ErrInvalidPassphrase
+	}
+	m.sealed = false
+	return nil
+}
+
+func (m *mockCertificateService) CreateUnsealShares(count, threshold int) (*certificates.UnsealShares, error) {
+	if threshold < 2 || threshold > count {
+		return nil, certificates.ErrInvalidShareParameters
+	}
+	result := &certificates.UnsealShares{Threshold: threshold}
+	for i := 1; i <= count; i++ {
+		result.Shares = append(result.Shares, fmt.Sprintf("SHARE-%d", i))
+	}
+	return result, nil
+}
+
+func (m *mockCertificateService) SubmitUnsealShare(share string) (*certificates.UnsealProgress, error) {
+	if !m.sealed {
+		return nil, certificates.ErrCANotSealed
+	}
+	if !strings.HasPrefix(share, "SHARE-") {
+		return nil, certificates.ErrInvalidShare
+	}
+	m.shares++
+	if m.shares < 2 {
+		return m.GetUnsealProgress(), nil
+	}
+	m.shares = 0
+	m.sealed = false
+	return &certificates.UnsealProgress{Sealed: false}, nil
+}
+
+func (m *mockCertificateService) GetUnsealProgress() *certificates.UnsealProgress {
+	if !m.sealed {
+		return &certificates.UnsealProgress{Sealed: false}
+	}
+	return &certificates.UnsealProgress{Sealed: true, Submitted: m.shares, Threshold: 2}
+}
+
+func (m *mockCertificateService) ResetUnsealShares() {
+	m.shares = 0
+}
+
+func (m *mockCertificateService) ReissueIntermediate(rootKeyPEM []byte) error {
+	return certificates.ErrNotTwoTier
+}
+
+func (m *mockCertificateService) ListProfiles() ([]certificates.Profile, error) {
+	return certificates.DefaultProfiles(), nil
+}
+
+func (m *mockCertificateService) GetProfile(name string) (*certificates.Profile, error) {
+	for _, profile := range certificates.DefaultProfiles() {
+		if profile.Name == name {
+			return &profile, nil
+		}
+	}
+	return nil, certificates.ErrProfileNotFound
+}
+
+func (m *mockCertificateService) CreateProfile(profile certificates.Profile) error {
+	return profile.Validate()
+}
+
+func (m *mockCertificateService) UpdateProfile(profile certificates.Profile) error {
+	if _, err := m.GetProfile(profile.Name); err != nil {
+		return err
+	}
+	return profile.Validate()
+}
+
+func (m *mockCertificateService) DeleteProfile(name string) error {
+	if name == certificates.ProfileServer || name == certificates.ProfileClient {
+		return certificates.ErrProfileProtected
+	}
+	_, err := m.GetProfile(name)
+	return err
+}
+
+func (m *mockCertificateService) SignCSR(csrData []byte, opts certificates.CSRSignOptions) (*certificates.SignedCertificate, error) {
+	return nil, certificates.ErrInvalidCSR
+}
+
 func (m *mockCertificateService) CreateServerCertificate(commonName string, domains []string) error {
 	cert := &certificates.Certificate{
+		Name:         commonName,
 		CommonName:   commonName,
 		SerialNumber: fmt.Sprintf("serial_%d", m.nextID),
 		NotBefore:    time.Now(),
@@ -66,6 +188,7 @@ func (m *mockCertificateService) CreateServerCertificate(commonName string, doma
 
 func (m *mockCertificateService) CreateClientCertificate(commonName, password string) error {
 	cert := &certificates.Certificate{
+		Name:         commonName,
 		CommonName:   commonName,
 		SerialNumber: fmt.Sprintf("serial_%d", m.nextID),
 		NotBefore:    time.Now(),
@@ -79,6 +202,20 @@ func (m *mockCertificateService) CreateClientCertificate(commonName, password st
 	return nil
 }
 
+func (m *mockCertificateService) CreateServerCertificateWithOptions(commonName string, domains []string, opts certificates.IssueOptions) error {
+	if err := opts.Metadata.Validate(); err != nil {
+		return err
+	}
+	if err := m.CreateServerCertificate(commonName, domains); err != nil {
+		return err
+	}
+	return m.UpdateCertificateMetadata(commonName, opts.Metadata)
+}
+
+func (m *mockCertificateService) CreateClientCertificateWithOptions(commonName, password string, opts certificates.IssueOptions) error {
+	return m.CreateClientCertificate(commonName, password)
+}
+
 func (m *mockCertificateService) RevokeCertificate(name string) error {
 	// Find certificate by name
 	for _, cert := range m.certificates {
@@ -90,12 +227,17 @@ func (m *mockCertificateService) RevokeCertificate(name string) error {
 	return fmt.Errorf("certificate not found: %s", name)
 }
 
+func (m *mockCertificateService) RevokeCertificateWithReason(name string, reason certificates.RevocationReason, invalidityDate *time.Time) error {
+	return m.RevokeCertificate(name)
+}
+
 func (m *mockCertificateService) RenewServerCertificate(name string) error {
 	// Find certificate by name and renew it
 	for _, cert := range m.certificates {
 		if cert.CommonName == name && !cert.IsClient {
 			// Create renewed certificate
 			renewed := &certificates.Certificate{
+				Name:         cert.Name,
 				CommonName:   cert.CommonName,
 				SerialNumber: fmt.Sprintf("serial_%d", m.nextID),
 				NotBefore:    time.Now(),
@@ -120,6 +262,7 @@ func (m *mockCertificateService) RenewClientCertificate(name string) error {
 		if cert.CommonName == name && cert.IsClient {
 			// Create renewed certificate
 			renewed := &certificates.Certificate{
+				Name:         cert.Name,
 				CommonName:   cert.CommonName,
 				SerialNumber: fmt.Sprintf("serial_%d", m.nextID),
 				NotBefore:    time.Now(),
@@ -138,6 +281,14 @@ func (m *mockCertificateService) RenewClientCertificate(name string) error {
 	return fmt.Errorf("client certificate not found: %s", name)
 }
 
+func (m *mockCertificateService) RenewServerCertificateWithOptions(name string, opts certificates.RenewOptions) error {
+	return m.RenewServerCertificate(name)
+}
+
+func (m *mockCertificateService) RenewClientCertificateWithOptions(name string, opts certificates.RenewOptions) error {
+	return m.RenewClientCertificate(name)
+}
+
 func (m *mockCertificateService) GetAllCertificates() ([]certificates.Certificate, error) {
 	var certs []certificates.Certificate
 	for _, cert := range m.certificates {
@@ -146,13 +297,161 @@ func (m *mockCertificateService) GetAllCertificates() ([]certificates.Certificat
 	return certs, nil
 }
 
+func (m *mockCertificateService) QueryCertificates(query certificates.CertificateQuery) (*certificates.CertificatePage, error) {
+	certs, _ := m.GetAllCertificates()
+	return certificates.FilterCertificates(certs, query)
+}
+
 func (m *mockCertificateService) GetCertificateInfo(name string) (*certificates.Certificate, error) {
 	for _, cert := range m.certificates {
 		if cert.CommonName == name {
 			return cert, nil
 		}
 	}
-	return nil, fmt.Errorf("certificate not found: %s", name)
+	return nil, fmt.Errorf("%w: %s", certificates.ErrCertificateNotFound, name)
+}
+
+func (m *mockCertificateService) FindCertificateBySerial(serialNumber string) (*certificates.Certificate, error) {
+	for _, cert := range m.certificates {
+		if cert.SerialNumber == serialNumber {
+			return cert, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: serial %s", certificates.ErrCertificateNotFound, serialNumber)
+}
+
+func (m *mockCertificateService) ListCertificateVersions(name string) ([]certificates.CertificateVersion, error) {
+	var versions []certificates.CertificateVersion
+	for _, cert := range m.certificates {
+		if cert.Name == name {
+			versions = append(versions, certificates.CertificateVersion{
+				SerialNumber: cert.SerialNumber,
+				NotBefore:    cert.NotBefore,
+				NotAfter:     cert.NotAfter,
+				Revoked:      cert.Revoked,
+				Path:         cert.Path,
+			})
+		}
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", certificates.ErrCertificateNotFound, name)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].NotBefore.After(versions[j].NotBefore)
+	})
+	versions[0].Current = true
+	return versions, nil
+}
+
+func (m *mockCertificateService) GetCertificateVersion(name, serialNumber string) (*certificates.CertificateVersion, error) {
+	versions, err := m.ListCertificateVersions(name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].SerialNumber == serialNumber {
+			return &versions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: version %s of %s", certificates.ErrCertificateNotFound, serialNumber, name)
+}
+
+func (m *mockCertificateService) RevokeCertificateVersion(name, serialNumber string, reason certificates.RevocationReason, invalidityDate *time.Time) error {
+	for _, cert := range m.certificates {
+		if cert.Name == name && cert.SerialNumber == serialNumber {
+			if cert.Revoked {
+				return certificates.ErrCertificateRevoked
+			}
+			cert.Revoked = true
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: version %s of %s", certificates.ErrCertificateNotFound, serialNumber, name)
+}
+
+func (m *mockCertificateService) DeleteCertificate(name string) error {
+	for id, cert := range m.certificates {
+		if cert.Name == name {
+			delete(m.certificates, id)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", certificates.ErrCertificateNotFound, name)
+}
+
+func (m *mockCertificateService) UpdateCertificateMetadata(name string, metadata certificates.CertificateMetadata) error {
+	if err := metadata.Validate(); err != nil {
+		return err
+	}
+	for _, cert := range m.certificates {
+		if cert.Name == name {
+			cert.OwnerEmail = metadata.OwnerEmail
+			cert.Team = metadata.Team
+			cert.Labels = metadata.Labels
+			cert.Notes = metadata.Notes
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", certificates.ErrCertificateNotFound, name)
+}
+
+func (m *mockCertificateService) SetRenewalPolicy(name string, policy *certificates.RenewalPolicy) error {
+	if policy != nil {
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, cert := range m.certificates {
+		if cert.Name == name {
+			cert.AutoRenew = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", certificates.ErrCertificateNotFound, name)
+}
+
+func (m *mockCertificateService) GetRenewalStatus(name string) (*certificates.RenewalStatus, error) {
+	cert, err := m.GetCertificateInfo(name)
+	if err != nil {
+		return nil, err
+	}
+	status := &certificates.RenewalStatus{}
+	if cert.AutoRenew != nil {
+		renewAt := cert.AutoRenew.RenewAt(*cert)
+		status.Policy = cert.AutoRenew
+		status.Source = certificates.RenewalPolicyFromCertificate
+		status.RenewAt = &renewAt
+	}
+	return status, nil
+}
+
+func (m *mockCertificateService) RebuildIndex() (int, error) {
+	return len(m.certificates), nil
+}
+
+func (m *mockCertificateService) GenerateCRL() error {
+	return nil
+}
+
+func (m *mockCertificateService) GetCRL() ([]byte, error) {
+	return []byte("-----BEGIN X509 CRL-----\n-----END X509 CRL-----\n"), nil
+}
+
+func (m *mockCertificateService) GetRetiredCRL(id string) ([]byte, error) {
+	return nil, certificates.ErrRetiredCANotFound
+}
+
+func (m *mockCertificateService) GetIssuerCRL(serial string) ([]byte, error) {
+	return nil, certificates.ErrIssuerNotFound
+}
+
+func (m *mockCertificateService) GetIssuerCertificate(serial string) ([]byte, error) {
+	return nil, certificates.ErrIssuerNotFound
+}
+
+func (m *mockCertificateService) OCSPResponse(requestDER []byte) ([]byte, error) {
+	// Echo the request so tests can check how it was decoded
+	return requestDER, nil
 }
 
 func TestCertificateOperations(t *testing.T) {
@@ -366,3 +665,379 @@ func createTestSession(t *testing.T, store *storage.Storage, sessionToken, usern
 	err = os.WriteFile(sessionPath, sessionBytes, 0600)
 	require.NoError(t, err)
 }
+
+func TestSealEndpoints(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := storage.NewStorage(tempDir)
+	require.NoError(t, err)
+
+	mockSvc := newMockCertificateService()
+	mockSvc.Seal()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupAPIRoutes(router, mockSvc, store)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("User-Agent", "test")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Signing endpoints are unavailable while sealed
+	w := post("/api/certificates", "common_name=sealed.local")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	w = post("/api/revoke", "serial_number=01")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	w = post("/api/ca/unseal", "passphrase=wrong")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.True(t, mockSvc.Sealed())
+
+	w = post("/api/ca/unseal", "passphrase=correct+passphrase")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, mockSvc.Sealed())
+
+	w = post("/api/ca/seal", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, mockSvc.Sealed())
+}
+
+func TestUnsealShareEndpoints(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := storage.NewStorage(tempDir)
+	require.NoError(t, err)
+
+	mockSvc := newMockCertificateService()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupAPIRoutes(router, mockSvc, store)
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("User-Agent", "test")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/api/ca/shares", "shares=2&threshold=3")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request("POST", "/api/ca/shares", "shares=3&threshold=2")
+	require.Equal(t, http.StatusOK, w.Code)
+	var created struct {
+		Data certificates.UnsealShares `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Len(t, created.Data.Shares, 3)
+
+	w = request("POST", "/api/ca/unseal/shares", "share="+created.Data.Shares[0])
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	mockSvc.Seal()
+	w = request("POST", "/api/ca/shares", "shares=3&threshold=2")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	w = request("POST", "/api/ca/unseal/shares", "share=garbage")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request("POST", "/api/ca/unseal/shares", "share="+created.Data.Shares[0])
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, mockSvc.Sealed())
+
+	w = request("GET", "/api/ca/unseal/shares", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"shares_submitted":1`)
+
+	w = request("POST", "/api/ca/unseal/shares", "share="+created.Data.Shares[2])
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, mockSvc.Sealed())
+
+	// Every submission is audited without the share itself
+	auditLog, err := os.ReadFile(filepath.Join(tempDir, "audit.log"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(auditLog), `"action":"submit_share"`))
+	assert.NotContains(t, string(auditLog), created.Data.Shares[0])
+}
+
+func TestGetCertificateEndpoint(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := storage.NewStorage(tempDir)
+	require.NoError(t, err)
+
+	mockSvc := newMockCertificateService()
+	require.NoError(t, mockSvc.CreateServerCertificate("detail.local", nil))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupAPIRoutes(router, mockSvc, store)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("User-Agent", "test")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/api/certificates/detail.local")
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Data certificates.Certificate `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "detail.local", response.Data.CommonName)
+	assert.Equal(t, "serial_1", response.Data.SerialNumber)
+	assert.NotContains(t, w.Body.String(), "/test/certs")
+
+	w = get("/api/certificates/missing.local")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = get("/api/certificates/..")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestListCertificatesQuery(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := storage.NewStorage(tempDir)
+	require.NoError(t, err)
+
+	mockSvc := newMockCertificateService()
+	require.NoError(t, mockSvc.CreateServerCertificate("b.local", nil))
+	require.NoError(t, mockSvc.CreateServerCertificate("a.local", nil))
+	require.NoError(t, mockSvc.CreateClientCertificate("user@local", "password"))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupAPIRoutes(router, mockSvc, store)
+
+	type listResponse struct {
+		Data struct {
+			Certificates []CertificateInfo `json:"certificates"`
+			Total        int               `json:"total"`
+			NextCursor   string            `json:"next_cursor"`
+		} `json:"data"`
+	}
+	list := func(query string) (int, listResponse) {
+		req := httptest.NewRequest("GET", "/api/certificates?"+query, nil)
+		req.Header.Set("User-Agent", "test")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response listResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	// Without parameters the whole inventory is returned
+	code, response := list("")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, response.Data.Total)
+	assert.Len(t, response.Data.Certificates, 3)
+	assert.Empty(t, response.Data.NextCursor)
+
+	code, response = list("type=server&limit=1")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, response.Data.Total)
+	require.Len(t, response.Data.Certificates, 1)
+	assert.Equal(t, "a.local", response.Data.Certificates[0].CommonName)
+	require.NotEmpty(t, response.Data.NextCursor)
+
+	code, response = list("type=server&limit=1&cursor=" + response.Data.NextCursor)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, response.Data.Certificates, 1)
+	assert.Equal(t, "b.local", response.Data.Certificates[0].CommonName)
+	assert.Empty(t, response.Data.NextCursor)
+
+	code, response = list("q=USER&sort=name&order=desc")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, response.Data.Certificates, 1)
+	assert.True(t, response.Data.Certificates[0].IsClient)
+
+	for _, query := range []string{"status=valid", "limit=0", "order=up", "expires_before=tomorrow", "sort=issuer"} {
+		code, _ = list(query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
+func TestCertificateMetadataEndpoints(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := storage.NewStorage(tempDir)
+	require.NoError(t, err)
+
+	mockSvc := newMockCertificateService()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupAPIRoutes(router, mockSvc, store)
+
+	request := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("User-Agent", "test")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	const form = "application/x-www-form-urlencoded"
+
+	w := request("POST", "/api/certificates", form,
+		"common_name=api-gateway-prod&owner_email=platform%40example.com&team=Platform&labels=env%3Dprod,tier%3Dedge")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = request("POST", "/api/certificates", form, "common_name=bad.local&labels=nokey")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("POST", "/api/certificates", form, "common_name=bad.local&owner_email=nobody")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request("GET", "/api/certificates?tag=env%3Dprod", "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Data struct {
+			Certificates []CertificateInfo `json:"certificates"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Data.Certificates, 1)
+	assert.Equal(t, "platform@example.com", list.Data.Certificates[0].OwnerEmail)
+	assert.Equal(t, "edge", list.Data.Certificates[0].Labels["tier"])
+
+	w = request("PUT", "/api/certificates/api-gateway-prod/metadata", "application/json",
+		`{"owner_email":"edge@example.com","team":"Edge","labels":{"env":"prod"},"notes":"Rotated quarterly"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var detail struct {
+		Data certificates.Certificate `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+	assert.Equal(t, "edge@example.com", detail.Data.OwnerEmail)
+	assert.Equal(t, "Rotated quarterly", detail.Data.Notes)
+	assert.Equal(t, map[string]string{"env": "prod"}, detail.Data.Labels)
+
+	w = request("PUT", "/api/certificates/api-gateway-prod/metadata", "application/json", `{"labels":{"bad key":"x"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("PUT", "/api/certificates/missing.local/metadata", "application/json", `{"team":"Edge"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	auditLog, err := os.ReadFile(filepath.Join(tempDir, "audit.log"))
+	require.NoError(t, err)
+	assert.Contains(t, string(auditLog), `"action":"update_metadata"`)
+}
+
+func TestCertificateRenewalPolicyEndpoints(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := storage.NewStorage(tempDir)
+	require.NoError(t, err)
+
+	mockSvc := newMockCertificateService()
+	require.NoError(t, mockSvc.CreateServerCertificate("api.local", nil))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupAPIRoutes(router, mockSvc, store)
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("User-Agent", "test")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	var response struct {
+		Data certificates.RenewalStatus `json:"data"`
+	}
+
+	w := request("GET", "/api/certificates/api.local/renewal", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Nil(t, response.Data.Policy)
+
+	w = request("PUT", "/api/certificates/api.local/renewal", `{"enabled":true,"days_before_expiry":14,"rotate_key":true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.NotNil(t, response.Data.Policy)
+	assert.Equal(t, 14, response.Data.Policy.DaysBeforeExpiry)
+	assert.True(t, response.Data.Policy.RotateKey)
+	assert.Equal(t, certificates.RenewalPolicyFromCertificate, response.Data.Source)
+	assert.NotNil(t, response.Data.RenewAt)
+
+	w = request("PUT", "/api/certificates/api.local/renewal", `{"enabled":true,"lifetime_fraction":1.5}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("PUT", "/api/certificates/missing.local/renewal", `{"enabled":true}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = request("DELETE", "/api/certificates/api.local/renewal", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	response.Data = certificates.RenewalStatus{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Nil(t, response.Data.Policy)
+
+	auditLog, err := os.ReadFile(filepath.Join(tempDir, "audit.log"))
+	require.NoError(t, err)
+	assert.Contains(t, string(auditLog), `"action":"update_renewal_policy"`)
+}
+
+func TestCertificateVersionEndpoints(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := storage.NewStorage(tempDir)
+	require.NoError(t, err)
+
+	mockSvc := newMockCertificateService()
+	require.NoError(t, mockSvc.CreateServerCertificate("api.local", nil))
+	first, err := mockSvc.GetCertificateInfo("api.local")
+	require.NoError(t, err)
+	first.NotBefore = time.Now().AddDate(0, 0, -30)
+	require.NoError(t, mockSvc.RenewServerCertificate("api.local"))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	SetupAPIRoutes(router, mockSvc, store)
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("User-Agent", "test")
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("GET", "/api/certificates/api.local/versions", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var list struct {
+		Data []certificates.CertificateVersion `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Data, 2)
+	assert.True(t, list.Data[0].Current)
+	assert.False(t, list.Data[1].Current)
+	assert.Equal(t, first.SerialNumber, list.Data[1].SerialNumber)
+
+	w = request("GET", "/api/certificates/missing.local/versions", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = request("GET", "/api/certificates/api.local/versions/"+first.SerialNumber+"/key", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = request("GET", "/api/certificates/api.local/versions/"+first.SerialNumber+"/p12", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request("POST", "/api/certificates/api.local/versions/"+first.SerialNumber+"/revoke", "reason=keyCompromise")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, first.Revoked)
+	w = request("POST", "/api/certificates/api.local/versions/"+first.SerialNumber+"/revoke", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = request("POST", "/api/certificates/api.local/versions/"+first.SerialNumber+"/revoke", "reason=bogus")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("POST", "/api/certificates/api.local/versions/FFFF/revoke", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	auditLog, err := os.ReadFile(filepath.Join(tempDir, "audit.log"))
+	require.NoError(t, err)
+	assert.Contains(t, string(auditLog), "reason: keyCompromise")
+}
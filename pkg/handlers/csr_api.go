@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/certificates"
+	"github.com/Lazarev-Cloud/localca-go/pkg/security"
+	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// maxCSRUploadSize limits the size of an uploaded certificate signing request
+const maxCSRUploadSize = 64 * 1024
+
+// SignedCertificateResponse is returned after signing a certificate signing request
+type SignedCertificateResponse struct {
+	Name         string `json:"name"`
+	SerialNumber string `json:"serial_number"`
+	Certificate  string `json:"certificate"`
+	Chain        string `json:"chain"`
+}
+
+// apiSignCSRHandler signs an externally generated certificate signing request.
+// The CSR may be sent as a form field or an uploaded file.
+func apiSignCSRHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIP := c.ClientIP()
+		userAgent := c.GetHeader("User-Agent")
+
+		csrData := []byte(c.PostForm("csr"))
+		if file, err := c.FormFile("csr"); err == nil {
+			if file.Size > maxCSRUploadSize {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "CSR file is too large",
+				})
+				return
+			}
+			f, err := file.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "Failed to read CSR file",
+				})
+				return
+			}
+			defer f.Close()
+			csrData, err = io.ReadAll(io.LimitReader(f, maxCSRUploadSize))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "Failed to read CSR file",
+				})
+				return
+			}
+		}
+
+		if len(csrData) == 0 {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "CSR is required",
+			})
+			return
+		}
+
+		metadata, err := parseCertificateMetadata(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		opts := certificates.CSRSignOptions{
+			IsClient: c.PostForm("is_client") == "true",
+			Profile:  strings.TrimSpace(c.PostForm("profile")),
+			Metadata: metadata,
+		}
+		if name := c.PostForm("name"); name != "" {
+			opts.Name = security.ValidateCommonName(name)
+			if opts.Name == "" || opts.Name == "." || strings.Contains(name, "/") || strings.Contains(name, "\\") ||
+				strings.Contains(name, "..") {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "Invalid certificate name",
+				})
+				return
+			}
+		}
+
+		signed, err := certSvc.SignCSR(csrData, opts)
+		if err != nil {
+			writeAuditLog(store, "sign", "certificate", opts.Name, userIP, userAgent,
+				"Failed to sign certificate signing request", false, err.Error())
+
+			switch {
+			case errors.Is(err, certificates.ErrInvalidCSR),
+				errors.Is(err, certificates.ErrInvalidMetadata),
+				errors.Is(err, certificates.ErrProfileNotFound),
+				errors.Is(err, certificates.ErrKeyTypeNotAllowed):
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: err.Error(),
+				})
+			case errors.Is(err, certificates.ErrCertificateAlreadyExists):
+				c.JSON(http.StatusConflict, APIResponse{
+					Success: false,
+					Message: "A certificate with this name already exists",
+				})
+			default:
+				log.Printf("Failed to sign CSR: %v", err)
+				c.JSON(http.StatusInternalServerError, APIResponse{
+					Success: false,
+					Message: "Failed to sign certificate signing request",
+				})
+			}
+			return
+		}
+
+		writeAuditLog(store, "sign", "certificate", signed.Name, userIP, userAgent,
+			"Signed certificate signing request (serial: "+signed.SerialNumber+")", true, "")
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Certificate signed successfully",
+			Data: SignedCertificateResponse{
+				Name:         signed.Name,
+				SerialNumber: signed.SerialNumber,
+				Certificate:  string(signed.CertificatePEM),
+				Chain:        string(signed.ChainPEM),
+			},
+		})
+	}
+}
+
+// isClientCertificate reports whether a stored certificate is a client
+// certificate. Certificates issued from a CSR have no PKCS#12 file, so their
+// extended key usage is checked instead.
+func isClientCertificate(store *storage.Storage, name string) bool {
+	if _, err := os.Stat(store.GetCertificateP12Path(name)); err == nil {
+		return true
+	}
+
+	cert, err := readStoredCertificate(store, name)
+	if err != nil {
+		return false
+	}
+
+	client, server := false, false
+	for _, usage := range cert.ExtKeyUsage {
+		switch usage {
+		case x509.ExtKeyUsageClientAuth:
+			client = true
+		case x509.ExtKeyUsageServerAuth:
+			server = true
+		}
+	}
+	return client && !server
+}
+
+// readStoredCertificate parses the PEM certificate stored under a name
+func readStoredCertificate(store *storage.Storage, name string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(store.GetCertificatePath(name))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("certificate %s is not PEM encoded", name)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
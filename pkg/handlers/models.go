@@ -16,6 +16,20 @@ type CertificateInfo struct {
 	IsExpired      bool   `json:"is_expired"`
 	IsExpiringSoon bool   `json:"is_expiring_soon"`
 	IsRevoked      bool   `json:"is_revoked"`
+	HasPrivateKey  bool   `json:"has_private_key"`
+	Profile        string `json:"profile,omitempty"`
+
+	// Ownership metadata; Labels are user-assigned key=value tags
+	OwnerEmail string            `json:"owner_email,omitempty"`
+	Team       string            `json:"team,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Notes      string            `json:"notes,omitempty"`
+
+	// Subject alternative names by type
+	DNSNames       []string `json:"dns_names,omitempty"`
+	IPAddresses    []string `json:"ip_addresses,omitempty"`
+	URIs           []string `json:"uris,omitempty"`
+	EmailAddresses []string `json:"email_addresses,omitempty"`
 }
 
 // CAInfo represents CA information for display
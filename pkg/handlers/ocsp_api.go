@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/certificates"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ocsp"
+)
+
+// maxOCSPRequestSize limits the size of an OCSP request body
+const maxOCSPRequestSize = 16 * 1024
+
+// SetupOCSPRoutes registers the public RFC 6960 OCSP responder. The routes sit
+// outside the /api group because OCSP clients send binary bodies and often no
+// User-Agent.
+func SetupOCSPRoutes(router *gin.Engine, certSvc certificates.CertificateServiceInterface) {
+	router.POST("/ocsp", ocspPostHandler(certSvc))
+	router.GET("/ocsp/*request", ocspGetHandler(certSvc))
+}
+
+// ocspPostHandler answers an OCSP request sent as the request body
+func ocspPostHandler(certSvc certificates.CertificateServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestDER, err := io.ReadAll(io.LimitReader(c.Request.Body, maxOCSPRequestSize+1))
+		if err != nil || len(requestDER) > maxOCSPRequestSize {
+			writeOCSPResponse(c, ocsp.MalformedRequestErrorResponse)
+			return
+		}
+		respondOCSP(c, certSvc, requestDER)
+	}
+}
+
+// ocspGetHandler answers an OCSP request encoded in the URL path as
+// URL-escaped base64
+func ocspGetHandler(certSvc certificates.CertificateServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoded := strings.TrimPrefix(c.Param("request"), "/")
+		if unescaped, err := url.PathUnescape(encoded); err == nil {
+			encoded = unescaped
+		}
+
+		requestDER, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			// Some clients use the URL-safe alphabet
+			requestDER, err = base64.URLEncoding.DecodeString(encoded)
+		}
+		if err != nil || len(requestDER) > maxOCSPRequestSize {
+			writeOCSPResponse(c, ocsp.MalformedRequestErrorResponse)
+			return
+		}
+		respondOCSP(c, certSvc, requestDER)
+	}
+}
+
+// respondOCSP signs and writes the response to an OCSP request
+func respondOCSP(c *gin.Context, certSvc certificates.CertificateServiceInterface, requestDER []byte) {
+	response, err := certSvc.OCSPResponse(requestDER)
+	if err != nil {
+		log.Printf("Failed to answer OCSP request: %v", err)
+		writeOCSPResponse(c, ocsp.InternalErrorErrorResponse)
+		return
+	}
+	writeOCSPResponse(c, response)
+}
+
+// writeOCSPResponse writes a DER encoded OCSP response
+func writeOCSPResponse(c *gin.Context, response []byte) {
+	c.Data(http.StatusOK, "application/ocsp-response", response)
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/certificates"
+	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// profileLabel returns the profile name shown in audit logs
+func profileLabel(name string, isClient bool) string {
+	if name != "" {
+		return name
+	}
+	if isClient {
+		return certificates.ProfileClient
+	}
+	return certificates.ProfileServer
+}
+
+// respondProfileError maps profile errors to API responses
+func respondProfileError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, certificates.ErrInvalidProfile):
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+	case errors.Is(err, certificates.ErrProfileNotFound):
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Profile not found",
+		})
+	case errors.Is(err, certificates.ErrProfileExists):
+		c.JSON(http.StatusConflict, APIResponse{
+			Success: false,
+			Message: "A profile with this name already exists",
+		})
+	case errors.Is(err, certificates.ErrProfileProtected):
+		c.JSON(http.StatusConflict, APIResponse{
+			Success: false,
+			Message: "Built-in profiles cannot be deleted",
+		})
+	default:
+		log.Printf("Failed to %s profile: %v", action, err)
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to " + action + " profile",
+		})
+	}
+}
+
+// apiListProfilesHandler returns all certificate profiles
+func apiListProfilesHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profiles, err := certSvc.ListProfiles()
+		if err != nil {
+			respondProfileError(c, err, "list")
+			return
+		}
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Profiles retrieved successfully",
+			Data:    profiles,
+		})
+	}
+}
+
+// apiGetProfileHandler returns a single certificate profile
+func apiGetProfileHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profile, err := certSvc.GetProfile(c.Param("name"))
+		if err != nil {
+			respondProfileError(c, err, "get")
+			return
+		}
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Profile retrieved successfully",
+			Data:    profile,
+		})
+	}
+}
+
+// apiCreateProfileHandler creates a certificate profile from a JSON body
+func apiCreateProfileHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var profile certificates.Profile
+		if err := c.ShouldBindJSON(&profile); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid profile: " + err.Error(),
+			})
+			return
+		}
+
+		if err := certSvc.CreateProfile(profile); err != nil {
+			writeAuditLog(store, "create", "profile", profile.Name, c.ClientIP(), c.GetHeader("User-Agent"),
+				"Failed to create certificate profile", false, err.Error())
+			respondProfileError(c, err, "create")
+			return
+		}
+
+		writeAuditLog(store, "create", "profile", profile.Name, c.ClientIP(), c.GetHeader("User-Agent"),
+			"Created certificate profile "+profile.Name, true, "")
+
+		c.JSON(http.StatusCreated, APIResponse{
+			Success: true,
+			Message: "Profile created successfully",
+			Data:    profile,
+		})
+	}
+}
+
+// apiUpdateProfileHandler replaces a certificate profile from a JSON body
+func apiUpdateProfileHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var profile certificates.Profile
+		if err := c.ShouldBindJSON(&profile); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid profile: " + err.Error(),
+			})
+			return
+		}
+
+		// The name in the path is authoritative
+		profile.Name = c.Param("name")
+
+		if err := certSvc.UpdateProfile(profile); err != nil {
+			writeAuditLog(store, "update", "profile", profile.Name, c.ClientIP(), c.GetHeader("User-Agent"),
+				"Failed to update certificate profile", false, err.Error())
+			respondProfileError(c, err, "update")
+			return
+		}
+
+		writeAuditLog(store, "update", "profile", profile.Name, c.ClientIP(), c.GetHeader("User-Agent"),
+			"Updated certificate profile "+profile.Name, true, "")
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Profile updated successfully",
+			Data:    profile,
+		})
+	}
+}
+
+// apiDeleteProfileHandler deletes a certificate profile
+func apiDeleteProfileHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+
+		if err := certSvc.DeleteProfile(name); err != nil {
+			writeAuditLog(store, "delete", "profile", name, c.ClientIP(), c.GetHeader("User-Agent"),
+				"Failed to delete certificate profile", false, err.Error())
+			respondProfileError(c, err, "delete")
+			return
+		}
+
+		writeAuditLog(store, "delete", "profile", name, c.ClientIP(), c.GetHeader("User-Agent"),
+			"Deleted certificate profile "+name, true, "")
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Profile deleted successfully",
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Lazarev-Cloud/localca-go/pkg/certificates"
+	"github.com/Lazarev-Cloud/localca-go/pkg/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// sealStatus is returned by the seal endpoints
+type sealStatus struct {
+	Sealed bool `json:"sealed"`
+}
+
+// requireUnsealed rejects requests that need a CA signature while the CA is sealed
+func requireUnsealed(certSvc certificates.CertificateServiceInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if certSvc.Sealed() {
+			c.JSON(http.StatusServiceUnavailable, APIResponse{
+				Success: false,
+				Message: "CA is sealed, unseal it with the CA passphrase first",
+				Data:    sealStatus{Sealed: true},
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// apiGetSealStatusHandler reports whether the CA is sealed
+func apiGetSealStatusHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "CA seal status retrieved successfully",
+			Data:    sealStatus{Sealed: certSvc.Sealed()},
+		})
+	}
+}
+
+// apiUnsealCAHandler unlocks the CA keys with the CA passphrase. A server
+// started without a CA creates it once unsealed.
+func apiUnsealCAHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIP := c.ClientIP()
+		userAgent := c.GetHeader("User-Agent")
+
+		var request struct {
+			Passphrase string `json:"passphrase" form:"passphrase"`
+		}
+		if err := c.ShouldBind(&request); err != nil || request.Passphrase == "" {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "CA passphrase is required",
+			})
+			return
+		}
+
+		if err := certSvc.Unseal(request.Passphrase); err != nil {
+			writeAuditLog(store, "unseal", "ca", "ca", userIP, userAgent,
+				"Failed to unseal CA", false, err.Error())
+
+			if errors.Is(err, certificates.ErrInvalidPassphrase) {
+				c.JSON(http.StatusForbidden, APIResponse{
+					Success: false,
+					Message: "Invalid CA passphrase",
+				})
+				return
+			}
+			if errors.Is(err, certificates.ErrCANotSealed) {
+				c.JSON(http.StatusConflict, APIResponse{
+					Success: false,
+					Message: "CA is not sealed",
+					Data:    sealStatus{Sealed: false},
+				})
+				return
+			}
+
+			log.Printf("Failed to unseal CA: %v", err)
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to unseal CA",
+			})
+			return
+		}
+
+		writeAuditLog(store, "unseal", "ca", "ca", userIP, userAgent,
+			"Unsealed CA", true, "")
+
+		if !ensureCAAfterUnseal(c, certSvc, store) {
+			return
+		}
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "CA unsealed successfully",
+			Data:    sealStatus{Sealed: false},
+		})
+	}
+}
+
+// ensureCAAfterUnseal creates the CA of a server started without one. It
+// writes the error response and returns false when that fails.
+func ensureCAAfterUnseal(c *gin.Context, certSvc certificates.CertificateServiceInterface, store *storage.Storage) bool {
+	exists, err := certSvc.CAExists()
+	if err == nil && !exists {
+		err = certSvc.CreateCA()
+		if err == nil {
+			writeAuditLog(store, "create", "ca", "ca", c.ClientIP(), c.GetHeader("User-Agent"),
+				"CA created after unseal", true, "")
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to create CA: %v", err)
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "CA unsealed but could not be created",
+			Data:    sealStatus{Sealed: false},
+		})
+		return false
+	}
+	return true
+}
+
+// apiSealCAHandler forgets the CA passphrase and keys until the next unseal
+func apiSealCAHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		certSvc.Seal()
+
+		writeAuditLog(store, "seal", "ca", "ca", c.ClientIP(), c.GetHeader("User-Agent"),
+			"Sealed CA", true, "")
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "CA sealed successfully",
+			Data:    sealStatus{Sealed: true},
+		})
+	}
+}
+
+// apiCreateUnsealSharesHandler runs a key ceremony that splits the CA
+// passphrase into shares for the custodians. The shares are only returned in
+// this response, never stored or logged.
+func apiCreateUnsealSharesHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIP := c.ClientIP()
+		userAgent := c.GetHeader("User-Agent")
+
+		var request struct {
+			Shares    int `json:"shares" form:"shares"`
+			Threshold int `json:"threshold" form:"threshold"`
+		}
+		if err := c.ShouldBind(&request); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Share count and threshold must be numbers",
+			})
+			return
+		}
+
+		result, err := certSvc.CreateUnsealShares(request.Shares, request.Threshold)
+		if err != nil {
+			writeAuditLog(store, "create_shares", "ca", "ca", userIP, userAgent,
+				"Failed to create unseal shares", false, err.Error())
+
+			if errors.Is(err, certificates.ErrInvalidShareParameters) {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: err.Error(),
+				})
+				return
+			}
+
+			log.Printf("Failed to create unseal shares: %v", err)
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to create unseal shares",
+			})
+			return
+		}
+
+		writeAuditLog(store, "create_shares", "ca", "ca", userIP, userAgent,
+			fmt.Sprintf("Created %d unseal shares with a threshold of %d", len(result.Shares), result.Threshold), true, "")
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Unseal shares created successfully",
+			Data:    result,
+		})
+	}
+}
+
+// apiGetUnsealProgressHandler reports how many unseal shares were submitted
+func apiGetUnsealProgressHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Unseal progress retrieved successfully",
+			Data:    certSvc.GetUnsealProgress(),
+		})
+	}
+}
+
+// apiSubmitUnsealShareHandler accepts one unseal share and unseals the CA
+// once the threshold is reached. Every submission is audited, without the
+// share itself.
+func apiSubmitUnsealShareHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIP := c.ClientIP()
+		userAgent := c.GetHeader("User-Agent")
+
+		var request struct {
+			Share string `json:"share" form:"share"`
+		}
+		if err := c.ShouldBind(&request); err != nil || request.Share == "" {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Unseal share is required",
+			})
+			return
+		}
+
+		progress, err := certSvc.SubmitUnsealShare(request.Share)
+		if err != nil {
+			writeAuditLog(store, "submit_share", "ca", "ca", userIP, userAgent,
+				"Rejected unseal share", false, err.Error())
+
+			switch {
+			case errors.Is(err, certificates.ErrInvalidShare):
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: err.Error(),
+					Data:    certSvc.GetUnsealProgress(),
+				})
+			case errors.Is(err, certificates.ErrCANotSealed):
+				c.JSON(http.StatusConflict, APIResponse{
+					Success: false,
+					Message: "CA is not sealed",
+					Data:    sealStatus{Sealed: false},
+				})
+			case errors.Is(err, certificates.ErrInvalidPassphrase):
+				c.JSON(http.StatusForbidden, APIResponse{
+					Success: false,
+					Message: "Shares did not recover the CA passphrase, submit them again",
+					Data:    certSvc.GetUnsealProgress(),
+				})
+			default:
+				log.Printf("Failed to unseal CA with shares: %v", err)
+				c.JSON(http.StatusInternalServerError, APIResponse{
+					Success: false,
+					Message: "Failed to unseal CA",
+				})
+			}
+			return
+		}
+
+		if progress.Sealed {
+			writeAuditLog(store, "submit_share", "ca", "ca", userIP, userAgent,
+				fmt.Sprintf("Accepted unseal share %d of %d", progress.Submitted, progress.Threshold), true, "")
+
+			c.JSON(http.StatusOK, APIResponse{
+				Success: true,
+				Message: fmt.Sprintf("Unseal share accepted, %d more required", progress.Threshold-progress.Submitted),
+				Data:    progress,
+			})
+			return
+		}
+
+		writeAuditLog(store, "submit_share", "ca", "ca", userIP, userAgent,
+			"Accepted final unseal share", true, "")
+		writeAuditLog(store, "unseal", "ca", "ca", userIP, userAgent,
+			"Unsealed CA with shares", true, "")
+
+		if !ensureCAAfterUnseal(c, certSvc, store) {
+			return
+		}
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "CA unsealed successfully",
+			Data:    progress,
+		})
+	}
+}
+
+// apiResetUnsealSharesHandler discards the unseal shares submitted so far
+func apiResetUnsealSharesHandler(certSvc certificates.CertificateServiceInterface, store *storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		certSvc.ResetUnsealShares()
+
+		writeAuditLog(store, "reset_shares", "ca", "ca", c.ClientIP(), c.GetHeader("User-Agent"),
+			"Discarded submitted unseal shares", true, "")
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Message: "Submitted unseal shares discarded",
+			Data:    certSvc.GetUnsealProgress(),
+		})
+	}
+}
@@ -33,7 +33,7 @@ func (sm *StorageManager) ListCertificates() ([]string, error) {
 }
 
 // GetCAInfo returns CA info using cache if available
-func (sm *StorageManager) GetCAInfo() (string, string, string, string, error) {
+func (sm *StorageManager) GetCAInfo() (string, string, string, error) {
 	if sm.cachedStore != nil {
 		return sm.cachedStore.GetCAInfo()
 	}
@@ -41,11 +41,11 @@ func (sm *StorageManager) GetCAInfo() (string, string, string, string, error) {
 }
 
 // SaveCAInfo saves CA info and invalidates cache if available
-func (sm *StorageManager) SaveCAInfo(caName, caKey, organization, country string) error {
+func (sm *StorageManager) SaveCAInfo(caName, organization, country string) error {
 	if sm.cachedStore != nil {
-		return sm.cachedStore.SaveCAInfo(caName, caKey, organization, country)
+		return sm.cachedStore.SaveCAInfo(caName, organization, country)
 	}
-	return sm.baseStore.SaveCAInfo(caName, caKey, organization, country)
+	return sm.baseStore.SaveCAInfo(caName, organization, country)
 }
 
 // GetEmailSettings returns email settings using cache if available
@@ -2,6 +2,8 @@ package security
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -86,6 +88,48 @@ func ValidateEmailAddress(email string) bool {
 	return emailRegex.MatchString(email) && len(email) <= 254
 }
 
+// ValidateDNSName checks that a name is a valid DNS host name, optionally with
+// a single leading wildcard label
+func ValidateDNSName(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+
+	name = strings.TrimPrefix(name, "*.")
+	labelRegex := regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+	for _, label := range strings.Split(name, ".") {
+		if !labelRegex.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateIPAddress checks that a value is an IPv4 or IPv6 address
+func ValidateIPAddress(value string) bool {
+	return value != "" && net.ParseIP(value) != nil
+}
+
+// ValidateURI checks that a value is an absolute URI usable as a subject
+// alternative name, such as a SPIFFE ID
+func ValidateURI(value string) bool {
+	if value == "" || len(value) > 2048 || strings.ContainsAny(value, " \t\r\n") {
+		return false
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" {
+		return false
+	}
+
+	// SPIFFE IDs name a trust domain and carry no port, user info, query or fragment
+	if strings.EqualFold(u.Scheme, "spiffe") {
+		return u.Host != "" && u.Port() == "" && u.User == nil && u.RawQuery == "" && u.Fragment == ""
+	}
+
+	return u.Host != "" || u.Opaque != ""
+}
+
 // SanitizeInput removes potentially dangerous characters from general input
 func SanitizeInput(input string) string {
 	if input == "" {
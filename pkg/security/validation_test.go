@@ -110,6 +110,77 @@ func TestValidateEmailAddress(t *testing.T) {
 	}
 }
 
+func TestValidateDNSName(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{"Valid domain", "example.com", true},
+		{"Single label", "localhost", true},
+		{"Wildcard", "*.example.com", true},
+		{"Nested wildcard", "a.*.example.com", false},
+		{"Empty input", "", false},
+		{"Leading hyphen", "-bad.example.com", false},
+		{"Empty label", "bad..example.com", false},
+		{"Underscore", "bad_name.example.com", false},
+		{"Label too long", strings.Repeat("a", 64) + ".com", false},
+		{"Name too long", strings.Repeat("a.", 127) + "com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ValidateDNSName(tt.input))
+		})
+	}
+}
+
+func TestValidateIPAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{"IPv4", "192.168.1.10", true},
+		{"IPv6", "2001:db8::1", true},
+		{"IPv6 loopback", "::1", true},
+		{"Empty input", "", false},
+		{"Out of range", "256.1.1.1", false},
+		{"Host name", "example.com", false},
+		{"CIDR", "10.0.0.0/8", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ValidateIPAddress(tt.input))
+		})
+	}
+}
+
+func TestValidateURI(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected bool
+	}{
+		{"SPIFFE ID", "spiffe://example.org/ns/prod/sa/web", true},
+		{"HTTPS URL", "https://example.com/path", true},
+		{"URN", "urn:uuid:6e8bc430-9c3a-11d9-9669-0800200c9a66", true},
+		{"Empty input", "", false},
+		{"No scheme", "example.com/path", false},
+		{"Whitespace", "https://example.com/a b", false},
+		{"SPIFFE with port", "spiffe://example.org:8443/web", false},
+		{"SPIFFE with query", "spiffe://example.org/web?x=1", false},
+		{"SPIFFE without trust domain", "spiffe:///web", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ValidateURI(tt.input))
+		})
+	}
+}
+
 func TestValidatePassword(t *testing.T) {
 	tests := []struct {
 		name        string
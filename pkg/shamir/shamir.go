@@ -0,0 +1,134 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Errors returned when shares cannot be combined
+var (
+	ErrTooFewShares     = errors.New("at least two shares are required")
+	ErrShareLength      = errors.New("shares have different lengths")
+	ErrDuplicateShare   = errors.New("duplicate share")
+	ErrInvalidThreshold = errors.New("threshold must be between 2 and the number of shares")
+)
+
+// MaxShares is the largest number of shares, one per non-zero field element
+const MaxShares = 255
+
+// Split divides secret into parts shares of which any threshold recover it.
+// Each share is the secret length plus one byte; the last byte is the x
+// coordinate the share was evaluated at.
+func Split(secret []byte, parts, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secret must not be empty")
+	}
+	if parts < 2 || parts > MaxShares {
+		return nil, fmt.Errorf("number of shares must be between 2 and %d", MaxShares)
+	}
+	if threshold < 2 || threshold > parts {
+		return nil, ErrInvalidThreshold
+	}
+
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	// One random polynomial of degree threshold-1 per secret byte, with the
+	// secret byte as its constant term
+	coefficients := make([]byte, threshold)
+	for j, b := range secret {
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("failed to generate polynomial: %w", err)
+		}
+		coefficients[0] = b
+		for i := range shares {
+			shares[i][j] = evaluate(coefficients, byte(i+1))
+		}
+	}
+	clear(coefficients)
+
+	return shares, nil
+}
+
+// Combine recovers the secret from threshold or more shares produced by
+// Split. Too few shares yield a wrong secret rather than an error, callers
+// must verify the result.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, ErrTooFewShares
+	}
+	length := len(shares[0])
+	if length < 2 {
+		return nil, ErrShareLength
+	}
+
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool)
+	for i, share := range shares {
+		if len(share) != length {
+			return nil, ErrShareLength
+		}
+		x := share[length-1]
+		if x == 0 || seen[x] {
+			return nil, ErrDuplicateShare
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	// Lagrange interpolation at x = 0
+	secret := make([]byte, length-1)
+	for j := range secret {
+		var value byte
+		for i, share := range shares {
+			basis := byte(1)
+			for k := range shares {
+				if k == i {
+					continue
+				}
+				// xs[k] / (xs[k] - xs[i]); subtraction is xor in GF(256)
+				basis = mul(basis, div(xs[k], xs[k]^xs[i]))
+			}
+			value ^= mul(share[j], basis)
+		}
+		secret[j] = value
+	}
+
+	return secret, nil
+}
+
+// evaluate computes the polynomial at x using Horner's method
+func evaluate(coefficients []byte, x byte) byte {
+	var result byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = mul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// mul multiplies in GF(256) with the AES polynomial x^8 + x^4 + x^3 + x + 1,
+// without branching on the operands
+func mul(a, b byte) byte {
+	var product byte
+	for i := 0; i < 8; i++ {
+		product ^= -(b & 1) & a
+		carry := -(a >> 7)
+		a = (a << 1) ^ (carry & 0x1b)
+		b >>= 1
+	}
+	return product
+}
+
+// div divides in GF(256). The divisor must not be zero.
+func div(a, b byte) byte {
+	// b^254 is the inverse of b since b^255 = 1
+	inverse := b
+	for i := 0; i < 6; i++ {
+		inverse = mul(mul(inverse, inverse), b)
+	}
+	return mul(a, mul(inverse, inverse))
+}
@@ -0,0 +1,62 @@
+package shamir
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Failed to split secret: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("Expected 5 shares, got %d", len(shares))
+	}
+
+	// Every combination of three shares recovers the secret
+	for i := 0; i < 5; i++ {
+		for j := i + 1; j < 5; j++ {
+			for k := j + 1; k < 5; k++ {
+				combined, err := Combine([][]byte{shares[k], shares[i], shares[j]})
+				if err != nil {
+					t.Fatalf("Failed to combine shares: %v", err)
+				}
+				if !bytes.Equal(combined, secret) {
+					t.Errorf("Shares %d, %d and %d recovered %q", i, j, k, combined)
+				}
+			}
+		}
+	}
+
+	// Two shares are not enough
+	combined, err := Combine(shares[:2])
+	if err != nil {
+		t.Fatalf("Failed to combine shares: %v", err)
+	}
+	if bytes.Equal(combined, secret) {
+		t.Error("Two shares recovered the secret with a threshold of three")
+	}
+
+	if _, err := Combine([][]byte{shares[0], shares[0], shares[1]}); !errors.Is(err, ErrDuplicateShare) {
+		t.Errorf("Expected ErrDuplicateShare, got %v", err)
+	}
+	if _, err := Split(secret, 3, 4); !errors.Is(err, ErrInvalidThreshold) {
+		t.Errorf("Expected ErrInvalidThreshold, got %v", err)
+	}
+}
+
+func TestFieldArithmetic(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		if got := mul(byte(a), div(1, byte(a))); got != 1 {
+			t.Fatalf("%d * 1/%d = %d", a, a, got)
+		}
+	}
+	// 0x53 * 0xca = 0x01 in the AES field
+	if got := mul(0x53, 0xca); got != 0x01 {
+		t.Errorf("Expected 0x01, got %#x", got)
+	}
+}
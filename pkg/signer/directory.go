@@ -0,0 +1,156 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DirectoryBackend keeps keys encrypted with the passphrase in a directory.
+// It backs the standalone signer process, the server never reads its keys.
+type DirectoryBackend struct {
+	dir        string
+	mutex      sync.Mutex
+	passphrase []byte
+	keys       map[string]Key
+}
+
+// NewDirectoryBackend creates a backend storing keys in dir
+func NewDirectoryBackend(dir string) (*DirectoryBackend, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	return &DirectoryBackend{dir: dir}, nil
+}
+
+// Name returns the backend name
+func (d *DirectoryBackend) Name() string {
+	return "directory"
+}
+
+// Unlock checks the passphrase against a stored key. Any passphrase unlocks
+// an empty directory and encrypts the keys generated afterwards.
+func (d *DirectoryBackend) Unlock(secret string) error {
+	if secret == "" {
+		return ErrInvalidPassphrase
+	}
+	passphrase := []byte(secret)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(d.dir, "*.key"))
+	if err != nil {
+		return fmt.Errorf("failed to list keys: %w", err)
+	}
+	keys := make(map[string]Key)
+	if len(paths) > 0 {
+		key, err := readKeyFile(paths[0], passphrase)
+		if err != nil {
+			return err
+		}
+		keys[key.Label()] = key
+	}
+
+	d.passphrase = passphrase
+	d.keys = keys
+	return nil
+}
+
+// Lock forgets the passphrase and the decrypted keys
+func (d *DirectoryBackend) Lock() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	clear(d.passphrase)
+	d.passphrase = nil
+	d.keys = nil
+	return nil
+}
+
+// GenerateKey generates a key and stores it encrypted under a random label
+func (d *DirectoryBackend) GenerateKey(algorithm string, size int) (Key, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.passphrase == nil {
+		return nil, ErrLocked
+	}
+
+	signer, err := GenerateKey(algorithm, size)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate key label: %w", err)
+	}
+
+	key := softwareKey{Signer: signer, label: hex.EncodeToString(id)}
+	if err := WriteEncryptedKeyFile(d.keyPath(key.label), signer, d.passphrase); err != nil {
+		return nil, fmt.Errorf("failed to write key: %w", err)
+	}
+	d.keys[key.label] = key
+	return key, nil
+}
+
+// Key returns a stored key
+func (d *DirectoryBackend) Key(label string) (Key, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.passphrase == nil {
+		return nil, ErrLocked
+	}
+	if key, ok := d.keys[label]; ok {
+		return key, nil
+	}
+
+	// Labels are hex, anything else could escape the directory
+	if _, err := hex.DecodeString(label); err != nil || label == "" {
+		return nil, ErrKeyNotFound
+	}
+	key, err := readKeyFile(d.keyPath(label), d.passphrase)
+	if os.IsNotExist(err) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.keys[label] = key
+	return key, nil
+}
+
+// keyPath returns the file holding a key
+func (d *DirectoryBackend) keyPath(label string) string {
+	return filepath.Join(d.dir, label+".key")
+}
+
+// readKeyFile decrypts a key file, labelled after its file name
+func readKeyFile(path string, passphrase []byte) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := DecryptPrivateKeyPEM(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return softwareKey{Signer: signer, label: strings.TrimSuffix(filepath.Base(path), ".key")}, nil
+}
+
+// softwareKey is a key held in memory
+type softwareKey struct {
+	crypto.Signer
+	label string
+}
+
+// Label returns the key label
+func (k softwareKey) Label() string {
+	return k.label
+}
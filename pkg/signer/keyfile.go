@@ -0,0 +1,211 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Private keys are stored as PKCS#8 EncryptedPrivateKeyInfo using PBES2
+// with scrypt (RFC 7914) as the key derivation function and AES-256-GCM
+// (RFC 5084) as the cipher. The passphrase only ever lives in memory.
+const EncryptedKeyPEMType = "ENCRYPTED PRIVATE KEY"
+
+// scrypt parameters for newly encrypted keys
+const (
+	scryptCost        = 1 << 15
+	scryptBlockSize   = 8
+	scryptParallelism = 1
+	scryptKeyLength   = 32
+	scryptSaltLength  = 16
+
+	// maxScryptCost bounds the work a tampered key file can make us do
+	maxScryptCost = 1 << 20
+)
+
+var (
+	oidPBES2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidScrypt    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidAES256GCM = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 46}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+type gcmParams struct {
+	Nonce  []byte
+	ICVLen int `asn1:"default:12"`
+}
+
+// EncryptPrivateKeyPEM encrypts a private key with a passphrase
+func EncryptPrivateKeyPEM(key crypto.Signer, passphrase []byte) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	kdf := scryptParams{
+		Salt:                     make([]byte, scryptSaltLength),
+		CostParameter:            scryptCost,
+		BlockSize:                scryptBlockSize,
+		ParallelizationParameter: scryptParallelism,
+		KeyLength:                scryptKeyLength,
+	}
+	if _, err := rand.Read(kdf.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	aead, err := scryptAEAD(passphrase, kdf)
+	if err != nil {
+		return nil, err
+	}
+	enc := gcmParams{Nonce: make([]byte, aead.NonceSize()), ICVLen: aead.Overhead()}
+	if _, err := rand.Read(enc.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	kdfParams, err := asn1.Marshal(kdf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal scrypt parameters: %w", err)
+	}
+	encParams, err := asn1.Marshal(enc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cipher parameters: %w", err)
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidScrypt, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256GCM, Parameters: asn1.RawValue{FullBytes: encParams}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal PBES2 parameters: %w", err)
+	}
+
+	info, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: aead.Seal(nil, enc.Nonce, der, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal encrypted private key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: EncryptedKeyPEMType, Bytes: info}), nil
+}
+
+// DecryptPrivateKeyPEM decrypts a private key written by EncryptPrivateKeyPEM.
+// A wrong passphrase yields ErrInvalidPassphrase.
+func DecryptPrivateKeyPEM(data, passphrase []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != EncryptedKeyPEMType {
+		return nil, fmt.Errorf("failed to decode encrypted private key PEM")
+	}
+
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(block.Bytes, &info); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("failed to parse encrypted private key")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption: %s", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse PBES2 parameters: %w", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidScrypt) {
+		return nil, fmt.Errorf("unsupported key derivation function: %s", params.KeyDerivationFunc.Algorithm)
+	}
+	if !params.EncryptionScheme.Algorithm.Equal(oidAES256GCM) {
+		return nil, fmt.Errorf("unsupported key encryption cipher: %s", params.EncryptionScheme.Algorithm)
+	}
+
+	var kdf scryptParams
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("failed to parse scrypt parameters: %w", err)
+	}
+	if kdf.CostParameter > maxScryptCost || (kdf.KeyLength != 0 && kdf.KeyLength != scryptKeyLength) {
+		return nil, fmt.Errorf("unsupported scrypt parameters")
+	}
+	var enc gcmParams
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &enc); err != nil {
+		return nil, fmt.Errorf("failed to parse cipher parameters: %w", err)
+	}
+
+	aead, err := scryptAEAD(passphrase, kdf)
+	if err != nil {
+		return nil, err
+	}
+	if len(enc.Nonce) != aead.NonceSize() || enc.ICVLen != aead.Overhead() {
+		return nil, fmt.Errorf("unsupported cipher parameters")
+	}
+
+	der, err := aead.Open(nil, enc.Nonce, info.EncryptedData, nil)
+	if err != nil {
+		return nil, ErrInvalidPassphrase
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type: %T", key)
+	}
+	return signer, nil
+}
+
+// scryptAEAD derives the AES-256-GCM cipher for a passphrase
+func scryptAEAD(passphrase []byte, kdf scryptParams) (cipher.AEAD, error) {
+	derived, err := scrypt.Key(passphrase, kdf.Salt, kdf.CostParameter, kdf.BlockSize, kdf.ParallelizationParameter, scryptKeyLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsEncryptedKeyPEM reports whether data holds an encrypted private key
+func IsEncryptedKeyPEM(data []byte) bool {
+	block, _ := pem.Decode(data)
+	return block != nil && block.Type == EncryptedKeyPEMType
+}
+
+// WriteEncryptedKeyFile writes an encrypted private key readable only by the owner
+func WriteEncryptedKeyFile(path string, key crypto.Signer, passphrase []byte) error {
+	keyPEM, err := EncryptPrivateKeyPEM(key, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, keyPEM, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0600)
+}
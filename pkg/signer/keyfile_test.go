@@ -0,0 +1,36 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestEncryptPrivateKeyPEM(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	encrypted, err := EncryptPrivateKeyPEM(key, []byte("correct passphrase"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt key: %v", err)
+	}
+	if !IsEncryptedKeyPEM(encrypted) {
+		t.Fatalf("Expected an encrypted private key PEM, got %q", encrypted)
+	}
+
+	decrypted, err := DecryptPrivateKeyPEM(encrypted, []byte("correct passphrase"))
+	if err != nil {
+		t.Fatalf("Failed to decrypt key: %v", err)
+	}
+	if !key.PublicKey.Equal(decrypted.Public()) {
+		t.Error("Decrypted key does not match the original")
+	}
+
+	if _, err := DecryptPrivateKeyPEM(encrypted, []byte("wrong passphrase")); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase, got %v", err)
+	}
+}
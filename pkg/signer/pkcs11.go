@@ -0,0 +1,143 @@
+//go:build cgo
+
+package signer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ThalesIgnite/crypto11"
+	"github.com/miekg/pkcs11"
+)
+
+// PKCS11Backend holds keys in a PKCS#11 token. The token PIN is the CA
+// passphrase. Keys are generated on the token and cannot be extracted.
+type PKCS11Backend struct {
+	module     string
+	tokenLabel string
+	mutex      sync.Mutex
+	ctx        *crypto11.Context
+}
+
+// NewPKCS11Backend creates a backend for the token with tokenLabel in the
+// PKCS#11 module library
+func NewPKCS11Backend(module, tokenLabel string) (Backend, error) {
+	return &PKCS11Backend{module: module, tokenLabel: tokenLabel}, nil
+}
+
+// Name returns the backend name
+func (p *PKCS11Backend) Name() string {
+	return BackendPKCS11
+}
+
+// Unlock logs in to the token with the PIN
+func (p *PKCS11Backend) Unlock(secret string) error {
+	if secret == "" {
+		return ErrInvalidPassphrase
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ctx, err := crypto11.Configure(&crypto11.Config{
+		Path:       p.module,
+		TokenLabel: p.tokenLabel,
+		Pin:        secret,
+	})
+	if err != nil {
+		var p11Err pkcs11.Error
+		if errors.As(err, &p11Err) && (p11Err == pkcs11.CKR_PIN_INCORRECT || p11Err == pkcs11.CKR_PIN_LEN_RANGE) {
+			return ErrInvalidPassphrase
+		}
+		return fmt.Errorf("failed to open PKCS#11 token: %w", err)
+	}
+
+	if p.ctx != nil {
+		p.ctx.Close()
+	}
+	p.ctx = ctx
+	return nil
+}
+
+// Lock closes the token session
+func (p *PKCS11Backend) Lock() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.ctx == nil {
+		return nil
+	}
+	err := p.ctx.Close()
+	p.ctx = nil
+	return err
+}
+
+// GenerateKey generates a key pair on the token. Ed25519 is not supported.
+func (p *PKCS11Backend) GenerateKey(algorithm string, size int) (Key, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.ctx == nil {
+		return nil, ErrLocked
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate key id: %w", err)
+	}
+	label := "localca-" + hex.EncodeToString(id)
+
+	var signer crypto11.Signer
+	var err error
+	switch algorithm {
+	case "rsa":
+		signer, err = p.ctx.GenerateRSAKeyPairWithLabel(id, []byte(label), size)
+	case "ecdsa":
+		curve, curveErr := ecdsaCurve(size)
+		if curveErr != nil {
+			return nil, curveErr
+		}
+		signer, err = p.ctx.GenerateECDSAKeyPairWithLabel(id, []byte(label), curve)
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm for PKCS#11: %s", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key on PKCS#11 token: %w", err)
+	}
+
+	return pkcs11Key{Signer: signer, label: label}, nil
+}
+
+// Key finds a key pair on the token by label
+func (p *PKCS11Backend) Key(label string) (Key, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.ctx == nil {
+		return nil, ErrLocked
+	}
+
+	signer, err := p.ctx.FindKeyPair(nil, []byte(label))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find key on PKCS#11 token: %w", err)
+	}
+	if signer == nil {
+		return nil, ErrKeyNotFound
+	}
+
+	return pkcs11Key{Signer: signer, label: label}, nil
+}
+
+// pkcs11Key is a key pair on the token
+type pkcs11Key struct {
+	crypto11.Signer
+	label string
+}
+
+// Label returns the CKA_LABEL of the key
+func (k pkcs11Key) Label() string {
+	return k.label
+}
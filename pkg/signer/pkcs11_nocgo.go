@@ -0,0 +1,10 @@
+//go:build !cgo
+
+package signer
+
+import "errors"
+
+// NewPKCS11Backend is not available without cgo, the PKCS#11 module is a C library
+func NewPKCS11Backend(module, tokenLabel string) (Backend, error) {
+	return nil, errors.New("PKCS#11 signer backend requires a build with cgo enabled")
+}
@@ -0,0 +1,102 @@
+//go:build cgo
+
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// softHSMModules are the usual install locations of the SoftHSM library
+var softHSMModules = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib64/pkcs11/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+	"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+}
+
+// newSoftHSMToken initialises a SoftHSM token in a temporary directory and
+// returns the module path, or skips the test when SoftHSM is not installed
+func newSoftHSMToken(t *testing.T, label, pin string) string {
+	t.Helper()
+
+	module := os.Getenv("SOFTHSM2_MODULE")
+	for _, candidate := range softHSMModules {
+		if module != "" {
+			break
+		}
+		if _, err := os.Stat(candidate); err == nil {
+			module = candidate
+			break
+		}
+	}
+	util, err := exec.LookPath("softhsm2-util")
+	if module == "" || err != nil {
+		t.Skip("SoftHSM not available")
+	}
+
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "softhsm2.conf")
+	tokens := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokens, 0700); err != nil {
+		t.Fatalf("Failed to create token directory: %v", err)
+	}
+	if err := os.WriteFile(conf, []byte(fmt.Sprintf("directories.tokendir = %s\n", tokens)), 0600); err != nil {
+		t.Fatalf("Failed to write SoftHSM config: %v", err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	cmd := exec.Command(util, "--init-token", "--free", "--label", label, "--so-pin", pin, "--pin", pin)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to initialise token: %v: %s", err, output)
+	}
+
+	return module
+}
+
+func TestPKCS11Backend(t *testing.T) {
+	module := newSoftHSMToken(t, "localca-test", "1234")
+
+	backend, err := NewPKCS11Backend(module, "localca-test")
+	if err != nil {
+		t.Fatalf("Failed to create PKCS#11 backend: %v", err)
+	}
+	if err := backend.Unlock("4321"); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase for a wrong PIN, got %v", err)
+	}
+	if err := backend.Unlock("1234"); err != nil {
+		t.Fatalf("Failed to unlock token: %v", err)
+	}
+	defer backend.Lock()
+
+	key, err := backend.GenerateKey("ecdsa", 256)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	found, err := backend.Key(key.Label())
+	if err != nil {
+		t.Fatalf("Failed to find key: %v", err)
+	}
+
+	digest := sha256.Sum256([]byte("to be signed"))
+	signature, err := found.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if !ecdsa.VerifyASN1(key.Public().(*ecdsa.PublicKey), digest[:], signature) {
+		t.Error("Invalid signature from the token")
+	}
+
+	if _, err := backend.Key("localca-missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
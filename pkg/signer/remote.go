@@ -0,0 +1,188 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"time"
+)
+
+// remoteService is the JSON-RPC service name of the signer protocol
+const remoteService = "Signer"
+
+// remoteDialTimeout bounds how long a call waits for the signer socket
+const remoteDialTimeout = 5 * time.Second
+
+// remoteCallTimeout bounds how long a call waits for the signer to answer,
+// so a hung signer cannot block issuance indefinitely. Key generation on a
+// token is the slowest call.
+const remoteCallTimeout = 60 * time.Second
+
+// UnlockArgs are the arguments of Signer.Unlock
+type UnlockArgs struct {
+	Secret string `json:"secret"`
+}
+
+// GenerateKeyArgs are the arguments of Signer.GenerateKey
+type GenerateKeyArgs struct {
+	Algorithm string `json:"algorithm"`
+	Size      int    `json:"size"`
+}
+
+// KeyArgs are the arguments of Signer.PublicKey
+type KeyArgs struct {
+	Label string `json:"label"`
+}
+
+// KeyReply describes a key by label and DER encoded PKIX public key
+type KeyReply struct {
+	Label     string `json:"label"`
+	PublicKey []byte `json:"public_key"`
+}
+
+// SignArgs are the arguments of Signer.Sign. Hash is the crypto.Hash the
+// digest was computed with, zero for Ed25519 where Digest is the message.
+type SignArgs struct {
+	Label         string `json:"label"`
+	Digest        []byte `json:"digest"`
+	Hash          uint   `json:"hash"`
+	PSS           bool   `json:"pss,omitempty"`
+	PSSSaltLength int    `json:"pss_salt_length,omitempty"`
+}
+
+// SignReply is the result of Signer.Sign
+type SignReply struct {
+	Signature []byte `json:"signature"`
+}
+
+// Empty is used for calls without arguments or results
+type Empty struct{}
+
+// RemoteBackend reaches a separate signing process over a Unix socket using
+// JSON-RPC. Keys stay in that process, only digests and signatures cross the
+// socket.
+type RemoteBackend struct {
+	socket  string
+	timeout time.Duration
+}
+
+// NewRemoteBackend creates a backend for the signer listening on socket
+func NewRemoteBackend(socket string) *RemoteBackend {
+	return &RemoteBackend{socket: socket, timeout: remoteCallTimeout}
+}
+
+// Name returns the backend name
+func (r *RemoteBackend) Name() string {
+	return BackendRemote
+}
+
+// Unlock passes the CA passphrase to the signer
+func (r *RemoteBackend) Unlock(secret string) error {
+	return r.call("Unlock", UnlockArgs{Secret: secret}, &Empty{})
+}
+
+// Lock asks the signer to lock its keys
+func (r *RemoteBackend) Lock() error {
+	return r.call("Lock", Empty{}, &Empty{})
+}
+
+// GenerateKey asks the signer to generate a key
+func (r *RemoteBackend) GenerateKey(algorithm string, size int) (Key, error) {
+	var reply KeyReply
+	if err := r.call("GenerateKey", GenerateKeyArgs{Algorithm: algorithm, Size: size}, &reply); err != nil {
+		return nil, err
+	}
+	return r.newKey(reply)
+}
+
+// Key looks up a key held by the signer
+func (r *RemoteBackend) Key(label string) (Key, error) {
+	var reply KeyReply
+	if err := r.call("PublicKey", KeyArgs{Label: label}, &reply); err != nil {
+		return nil, err
+	}
+	return r.newKey(reply)
+}
+
+// newKey wraps a key description returned by the signer
+func (r *RemoteBackend) newKey(reply KeyReply) (Key, error) {
+	pub, err := x509.ParsePKIXPublicKey(reply.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signer public key: %w", err)
+	}
+	return &remoteKey{backend: r, label: reply.Label, pub: pub}, nil
+}
+
+// call performs one JSON-RPC call on a fresh connection, so a restarted
+// signer is picked up without reconnect logic
+func (r *RemoteBackend) call(method string, args, reply interface{}) error {
+	conn, err := net.DialTimeout("unix", r.socket, remoteDialTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to signer: %w", err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(r.timeout)); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to set signer deadline: %w", err)
+	}
+	client := jsonrpc.NewClient(conn)
+	defer client.Close()
+
+	if err := client.Call(remoteService+"."+method, args, reply); err != nil {
+		var serverErr rpc.ServerError
+		if errors.As(err, &serverErr) {
+			return remoteError(string(serverErr))
+		}
+		return fmt.Errorf("signer call %s failed: %w", method, err)
+	}
+	return nil
+}
+
+// remoteError maps an error message from the signer back to the sentinel
+// errors of this package
+func remoteError(message string) error {
+	for _, err := range []error{ErrInvalidPassphrase, ErrLocked, ErrKeyNotFound} {
+		if message == err.Error() {
+			return err
+		}
+	}
+	return fmt.Errorf("signer: %s", message)
+}
+
+// remoteKey signs through the signer process
+type remoteKey struct {
+	backend *RemoteBackend
+	label   string
+	pub     crypto.PublicKey
+}
+
+// Label returns the key label
+func (k *remoteKey) Label() string {
+	return k.label
+}
+
+// Public returns the public key
+func (k *remoteKey) Public() crypto.PublicKey {
+	return k.pub
+}
+
+// Sign sends the digest to the signer. The random source is ignored, the
+// signer uses its own.
+func (k *remoteKey) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	args := SignArgs{Label: k.label, Digest: digest, Hash: uint(opts.HashFunc())}
+	if pss, ok := opts.(*rsa.PSSOptions); ok {
+		args.PSS = true
+		args.PSSSaltLength = pss.SaltLength
+	}
+
+	var reply SignReply
+	if err := k.backend.call("Sign", args, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Signature, nil
+}
@@ -0,0 +1,163 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startTestSigner serves a directory backend on a temporary Unix socket
+func startTestSigner(t *testing.T) *RemoteBackend {
+	t.Helper()
+
+	dir := t.TempDir()
+	backend, err := NewDirectoryBackend(filepath.Join(dir, "keys"))
+	if err != nil {
+		t.Fatalf("Failed to create directory backend: %v", err)
+	}
+	socket := filepath.Join(dir, "signer.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go Serve(listener, backend)
+
+	return NewRemoteBackend(socket)
+}
+
+func TestRemoteBackend(t *testing.T) {
+	remote := startTestSigner(t)
+
+	if _, err := remote.GenerateKey("ecdsa", 256); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected ErrLocked before unlocking, got %v", err)
+	}
+	if err := remote.Unlock("signer passphrase"); err != nil {
+		t.Fatalf("Failed to unlock signer: %v", err)
+	}
+
+	message := []byte("to be signed")
+	digest := sha256.Sum256(message)
+	labels := make(map[string]string)
+	for _, algorithm := range []struct {
+		name string
+		size int
+	}{{"rsa", 2048}, {"ecdsa", 384}, {"ed25519", 0}} {
+		key, err := remote.GenerateKey(algorithm.name, algorithm.size)
+		if err != nil {
+			t.Fatalf("Failed to generate %s key: %v", algorithm.name, err)
+		}
+		labels[algorithm.name] = key.Label()
+
+		switch pub := key.Public().(type) {
+		case *rsa.PublicKey:
+			pss := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}
+			signature, err := key.Sign(rand.Reader, digest[:], pss)
+			if err != nil {
+				t.Fatalf("Failed to sign with RSA-PSS: %v", err)
+			}
+			if err := rsa.VerifyPSS(pub, crypto.SHA256, digest[:], signature, pss); err != nil {
+				t.Errorf("Invalid RSA-PSS signature: %v", err)
+			}
+			signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+			if err != nil {
+				t.Fatalf("Failed to sign with RSA: %v", err)
+			}
+			if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+				t.Errorf("Invalid RSA signature: %v", err)
+			}
+		case *ecdsa.PublicKey:
+			signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+			if err != nil {
+				t.Fatalf("Failed to sign with ECDSA: %v", err)
+			}
+			if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+				t.Error("Invalid ECDSA signature")
+			}
+		case ed25519.PublicKey:
+			signature, err := key.Sign(rand.Reader, message, crypto.Hash(0))
+			if err != nil {
+				t.Fatalf("Failed to sign with Ed25519: %v", err)
+			}
+			if !ed25519.Verify(pub, message, signature) {
+				t.Error("Invalid Ed25519 signature")
+			}
+		default:
+			t.Errorf("Unexpected public key type %T", pub)
+		}
+	}
+
+	if _, err := remote.Key("0000"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if _, err := remote.Key("../../etc/passwd"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound for a path label, got %v", err)
+	}
+
+	// Keys survive locking and need the same passphrase again
+	if err := remote.Lock(); err != nil {
+		t.Fatalf("Failed to lock signer: %v", err)
+	}
+	if _, err := remote.Key(labels["ecdsa"]); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected ErrLocked after locking, got %v", err)
+	}
+	if err := remote.Unlock("wrong passphrase"); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("Expected ErrInvalidPassphrase, got %v", err)
+	}
+	if err := remote.Unlock("signer passphrase"); err != nil {
+		t.Fatalf("Failed to unlock signer: %v", err)
+	}
+	key, err := remote.Key(labels["ecdsa"])
+	if err != nil {
+		t.Fatalf("Failed to find key: %v", err)
+	}
+	signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if !ecdsa.VerifyASN1(key.Public().(*ecdsa.PublicKey), digest[:], signature) {
+		t.Error("Invalid ECDSA signature after unlocking again")
+	}
+}
+
+func TestRemoteBackendTimeout(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "signer.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	// A signer that accepts connections but never answers
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	remote := NewRemoteBackend(socket)
+	remote.timeout = 100 * time.Millisecond
+
+	done := make(chan error, 1)
+	go func() { done <- remote.Unlock("signer passphrase") }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected an error from a signer that does not answer")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Call to a hung signer did not time out")
+	}
+}
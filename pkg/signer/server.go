@@ -0,0 +1,107 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+)
+
+// Serve answers RemoteBackend calls on listener with the keys of backend
+// until the listener is closed
+func Serve(listener net.Listener, backend Backend) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName(remoteService, &service{backend: backend}); err != nil {
+		return fmt.Errorf("failed to register signer service: %w", err)
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// service exposes a backend over net/rpc
+type service struct {
+	backend Backend
+}
+
+// Unlock unlocks the backend
+func (s *service) Unlock(args UnlockArgs, reply *Empty) error {
+	return serviceError(s.backend.Unlock(args.Secret))
+}
+
+// Lock locks the backend
+func (s *service) Lock(args Empty, reply *Empty) error {
+	return serviceError(s.backend.Lock())
+}
+
+// GenerateKey generates a key in the backend
+func (s *service) GenerateKey(args GenerateKeyArgs, reply *KeyReply) error {
+	key, err := s.backend.GenerateKey(args.Algorithm, args.Size)
+	if err != nil {
+		return serviceError(err)
+	}
+	return describeKey(key, reply)
+}
+
+// PublicKey describes a key in the backend
+func (s *service) PublicKey(args KeyArgs, reply *KeyReply) error {
+	key, err := s.backend.Key(args.Label)
+	if err != nil {
+		return serviceError(err)
+	}
+	return describeKey(key, reply)
+}
+
+// Sign signs a digest with a key in the backend
+func (s *service) Sign(args SignArgs, reply *SignReply) error {
+	key, err := s.backend.Key(args.Label)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	var opts crypto.SignerOpts = crypto.Hash(args.Hash)
+	if args.PSS {
+		opts = &rsa.PSSOptions{SaltLength: args.PSSSaltLength, Hash: crypto.Hash(args.Hash)}
+	}
+	signature, err := key.Sign(rand.Reader, args.Digest, opts)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	reply.Signature = signature
+	return nil
+}
+
+// describeKey fills in the label and public key of a key
+func describeKey(key Key, reply *KeyReply) error {
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	reply.Label = key.Label()
+	reply.PublicKey = pub
+	return nil
+}
+
+// serviceError unwraps the sentinel errors so the client can recognise them
+func serviceError(err error) error {
+	for _, sentinel := range []error{ErrInvalidPassphrase, ErrLocked, ErrKeyNotFound} {
+		if errors.Is(err, sentinel) {
+			return sentinel
+		}
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+)
+
+// Backend names accepted by CA_SIGNER
+const (
+	BackendFile   = "file"
+	BackendPKCS11 = "pkcs11"
+	BackendRemote = "remote"
+)
+
+var (
+	// ErrInvalidPassphrase is returned when a passphrase or PIN does not unlock the keys
+	ErrInvalidPassphrase = errors.New("invalid CA passphrase")
+
+	// ErrLocked is returned when a backend is used before it is unlocked
+	ErrLocked = errors.New("signer backend is locked")
+
+	// ErrKeyNotFound is returned when a backend holds no key with the label
+	ErrKeyNotFound = errors.New("signer key not found")
+)
+
+// Key is a private key held by a backend. Only the signing operation is
+// exposed, the key material never leaves the backend.
+type Key interface {
+	crypto.Signer
+	// Label identifies the key within its backend
+	Label() string
+}
+
+// Backend generates and holds CA private keys outside the data directory
+type Backend interface {
+	// Name returns the backend name as used by CA_SIGNER
+	Name() string
+	// Unlock opens the backend with the CA passphrase or token PIN
+	Unlock(secret string) error
+	// Lock closes the backend until the next unlock
+	Lock() error
+	// GenerateKey creates a new key. Algorithm and size follow the CA key
+	// settings: rsa with a modulus size, ecdsa with a curve size or ed25519.
+	GenerateKey(algorithm string, size int) (Key, error)
+	// Key returns the key with the label
+	Key(label string) (Key, error)
+}
+
+// GenerateKey generates a software private key
+func GenerateKey(algorithm string, size int) (crypto.Signer, error) {
+	switch algorithm {
+	case "rsa":
+		return rsa.GenerateKey(rand.Reader, size)
+	case "ecdsa":
+		curve, err := ecdsaCurve(size)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unsupported key algorithm: %s", algorithm)
+}
+
+// ecdsaCurve returns the curve for an ECDSA key size
+func ecdsaCurve(size int) (elliptic.Curve, error) {
+	switch size {
+	case 256:
+		return elliptic.P256(), nil
+	case 384:
+		return elliptic.P384(), nil
+	}
+	return nil, fmt.Errorf("unsupported ECDSA curve size: %d", size)
+}
@@ -27,7 +27,6 @@ type CertificateInfo struct {
 // CAInfoCache represents cached CA information
 type CAInfoCache struct {
 	CAName       string    `json:"ca_name"`
-	CAKey        string    `json:"ca_key"`
 	Organization string    `json:"organization"`
 	Country      string    `json:"country"`
 	CachedAt     time.Time `json:"cached_at"`
@@ -81,26 +80,25 @@ func (cs *CachedStorage) ListCertificates() ([]string, error) {
 }
 
 // GetCAInfo returns cached CA info or fetches from storage
-func (cs *CachedStorage) GetCAInfo() (string, string, string, string, error) {
+func (cs *CachedStorage) GetCAInfo() (string, string, string, error) {
 	// Try to get from cache first
 	var caInfo CAInfoCache
 	err := cs.cache.Get(cs.ctx, cache.CAInfoKey, &caInfo)
 	if err == nil {
 		log.Println("Cache hit for CA info")
-		return caInfo.CAName, caInfo.CAKey, caInfo.Organization, caInfo.Country, nil
+		return caInfo.CAName, caInfo.Organization, caInfo.Country, nil
 	}
 
 	// Cache miss, fetch from storage
 	log.Println("Cache miss for CA info, fetching from storage")
-	caName, caKey, organization, country, err := cs.Storage.GetCAInfo()
+	caName, organization, country, err := cs.Storage.GetCAInfo()
 	if err != nil {
-		return "", "", "", "", err
+		return "", "", "", err
 	}
 
 	// Cache the result
 	caInfo = CAInfoCache{
 		CAName:       caName,
-		CAKey:        caKey,
 		Organization: organization,
 		Country:      country,
 		CachedAt:     time.Now(),
@@ -110,13 +108,13 @@ func (cs *CachedStorage) GetCAInfo() (string, string, string, string, error) {
 		log.Printf("Failed to cache CA info: %v", cacheErr)
 	}
 
-	return caName, caKey, organization, country, nil
+	return caName, organization, country, nil
 }
 
 // SaveCAInfo saves CA info and invalidates related cache
-func (cs *CachedStorage) SaveCAInfo(caName, caKey, organization, country string) error {
+func (cs *CachedStorage) SaveCAInfo(caName, organization, country string) error {
 	// Save to storage first
-	err := cs.Storage.SaveCAInfo(caName, caKey, organization, country)
+	err := cs.Storage.SaveCAInfo(caName, organization, country)
 	if err != nil {
 		return err
 	}
@@ -285,7 +283,7 @@ func (cs *CachedStorage) WarmUpCache() error {
 	}
 
 	// Warm up CA info
-	if _, _, _, _, err := cs.GetCAInfo(); err != nil {
+	if _, _, _, err := cs.GetCAInfo(); err != nil {
 		log.Printf("Failed to warm up CA info: %v", err)
 	}
 
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -160,15 +162,18 @@ func (e *EnhancedStorage) GetCertificateBundlePath(name string) string {
 }
 
 // Enhanced CA operations with database and S3 support
-func (e *EnhancedStorage) SaveCAInfo(caName, caKey, organization, country string) error {
+func (e *EnhancedStorage) SaveCAInfo(caName, organization, country string) error {
 	// Save to file storage first (primary)
-	if err := e.fileStorage.SaveCAInfo(caName, caKey, organization, country); err != nil {
+	if err := e.fileStorage.SaveCAInfo(caName, organization, country); err != nil {
 		return err
 	}
 
 	// Save to database if available
 	if e.database != nil {
-		keyHash := fmt.Sprintf("%x", sha256.Sum256([]byte(caKey)))
+		keyHash, err := e.caPublicKeyHash()
+		if err != nil {
+			e.logger.WithError(err).Warn("Failed to hash CA public key")
+		}
 		caInfo := database.CAInfo{
 			Name:         caName,
 			Organization: organization,
@@ -189,17 +194,12 @@ func (e *EnhancedStorage) SaveCAInfo(caName, caKey, organization, country string
 	return nil
 }
 
-func (e *EnhancedStorage) GetCAInfo() (string, string, string, string, error) {
+func (e *EnhancedStorage) GetCAInfo() (string, string, string, error) {
 	// Try database first if available
 	if e.database != nil {
 		var caInfo database.CAInfo
 		if err := e.database.DB.First(&caInfo).Error; err == nil {
-			// Get key from file storage
-			_, key, _, _, err := e.fileStorage.GetCAInfo()
-			if err != nil {
-				return "", "", "", "", err
-			}
-			return caInfo.Name, key, caInfo.Organization, caInfo.Country, nil
+			return caInfo.Name, caInfo.Organization, caInfo.Country, nil
 		}
 	}
 
@@ -209,19 +209,8 @@ func (e *EnhancedStorage) GetCAInfo() (string, string, string, string, error) {
 
 // Enhanced certificate operations
 func (e *EnhancedStorage) ListCertificates() ([]string, error) {
-	// Try database first if available
-	if e.database != nil {
-		var certs []database.Certificate
-		if err := e.database.DB.Find(&certs).Error; err == nil {
-			names := make([]string, len(certs))
-			for i, cert := range certs {
-				names[i] = cert.Name
-			}
-			return names, nil
-		}
-	}
-
-	// Fallback to file storage
+	// The certificates table mirrors the certificate index, which is built
+	// from this listing, so the files are the source of truth
 	return e.fileStorage.ListCertificates()
 }
 
@@ -286,6 +275,18 @@ func (e *EnhancedStorage) SaveCertificateSerialMapping(serialNumber, certName st
 	return nil
 }
 
+func (e *EnhancedStorage) SerialNumberInUse(serialNumber string) (bool, error) {
+	// The database holds mappings that may not have been synced to this node's files
+	if e.database != nil {
+		var count int64
+		if err := e.database.DB.Model(&database.SerialMapping{}).Where("serial_number = ?", serialNumber).Count(&count).Error; err == nil && count > 0 {
+			return true, nil
+		}
+	}
+
+	return e.fileStorage.SerialNumberInUse(serialNumber)
+}
+
 // Enhanced email settings operations
 func (e *EnhancedStorage) SaveEmailSettings(server, port, username, password, from, to string, useTLS, useStartTLS bool) error {
 	// Save to file storage
@@ -406,6 +407,23 @@ func (e *EnhancedStorage) LogAudit(action, resource, resourceID, userIP, userAge
 	}
 }
 
+// caPublicKeyHash returns the SHA-256 hash of the CA certificate public key
+func (e *EnhancedStorage) caPublicKeyHash() (string, error) {
+	certPEM, err := os.ReadFile(e.GetCAPublicKeyPath())
+	if err != nil {
+		return "", fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return "", fmt.Errorf("failed to decode CA certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(cert.RawSubjectPublicKeyInfo)), nil
+}
+
 // uploadCAFilesToS3 uploads CA files to S3
 func (e *EnhancedStorage) uploadCAFilesToS3(caName string) {
 	if e.s3Client == nil || !e.s3Client.IsEnabled() {
@@ -17,8 +17,8 @@ type StorageInterface interface {
 	GetCertificateBundlePath(name string) string
 
 	// CA operations
-	SaveCAInfo(caName, caKey, organization, country string) error
-	GetCAInfo() (string, string, string, string, error)
+	SaveCAInfo(caName, organization, country string) error
+	GetCAInfo() (string, string, string, error)
 
 	// Certificate operations
 	ListCertificates() ([]string, error)
@@ -26,6 +26,7 @@ type StorageInterface interface {
 	CreateCertificateDirectory(name string) error
 	GetCertificateNameBySerial(serialNumber string) (string, error)
 	SaveCertificateSerialMapping(serialNumber, certName string) error
+	SerialNumberInUse(serialNumber string) (bool, error)
 
 	// Email settings
 	SaveEmailSettings(server, port, username, password, from, to string, useTLS, useStartTLS bool) error
@@ -85,8 +85,9 @@ func (s *Storage) GetCertificateBundlePath(name string) string {
 	return filepath.Join(s.GetCertificateDirectory(name), name+".bundle.crt")
 }
 
-// SaveCAInfo saves the CA information to files
-func (s *Storage) SaveCAInfo(caName, caKey, organization, country string) error {
+// SaveCAInfo saves the CA information to files. The CA key passphrase is
+// never stored.
+func (s *Storage) SaveCAInfo(caName, organization, country string) error {
 	caDir := s.GetCADirectory()
 	if err := os.MkdirAll(caDir, 0755); err != nil {
 		return fmt.Errorf("failed to create CA directory: %w", err)
@@ -97,11 +98,6 @@ func (s *Storage) SaveCAInfo(caName, caKey, organization, country string) error
 		return fmt.Errorf("failed to save CA name: %w", err)
 	}
 
-	// Save CA key password
-	if err := os.WriteFile(filepath.Join(caDir, "CA_KEY.txt"), []byte(caKey), 0600); err != nil {
-		return fmt.Errorf("failed to save CA key: %w", err)
-	}
-
 	// Save organization
 	if err := os.WriteFile(filepath.Join(caDir, "O.txt"), []byte(organization), 0644); err != nil {
 		return fmt.Errorf("failed to save organization: %w", err)
@@ -116,38 +112,31 @@ func (s *Storage) SaveCAInfo(caName, caKey, organization, country string) error
 }
 
 // GetCAInfo retrieves the CA information
-func (s *Storage) GetCAInfo() (string, string, string, string, error) {
+func (s *Storage) GetCAInfo() (string, string, string, error) {
 	caDir := s.GetCADirectory()
 
 	// Read CA name
 	caNameBytes, err := os.ReadFile(filepath.Join(caDir, "CA_NAME.txt"))
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("failed to read CA name: %w", err)
+		return "", "", "", fmt.Errorf("failed to read CA name: %w", err)
 	}
 	caName := string(caNameBytes)
 
-	// Read CA key password
-	caKeyBytes, err := os.ReadFile(filepath.Join(caDir, "CA_KEY.txt"))
-	if err != nil {
-		return "", "", "", "", fmt.Errorf("failed to read CA key: %w", err)
-	}
-	caKey := string(caKeyBytes)
-
 	// Read organization
 	orgBytes, err := os.ReadFile(filepath.Join(caDir, "O.txt"))
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("failed to read organization: %w", err)
+		return "", "", "", fmt.Errorf("failed to read organization: %w", err)
 	}
 	organization := string(orgBytes)
 
 	// Read country
 	countryBytes, err := os.ReadFile(filepath.Join(caDir, "C.txt"))
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("failed to read country: %w", err)
+		return "", "", "", fmt.Errorf("failed to read country: %w", err)
 	}
 	country := string(countryBytes)
 
-	return caName, caKey, organization, country, nil
+	return caName, organization, country, nil
 }
 
 // ListCertificates returns a list of all certificates
@@ -353,6 +342,19 @@ func (s *Storage) GetCertificateNameBySerial(serialNumber string) (string, error
 	return "", fmt.Errorf("certificate with serial number %s not found", serialNumber)
 }
 
+// SerialNumberInUse reports whether a serial number is recorded in the serial
+// mapping. Certificates stored without a mapping are not scanned for; callers
+// look them up in their own index.
+func (s *Storage) SerialNumberInUse(serialNumber string) (bool, error) {
+	mappingPath := filepath.Join(s.basePath, "serials", filepath.Base(serialNumber))
+	if _, err := os.Stat(mappingPath); err == nil {
+		return true, nil
+	} else if !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to check serial mapping: %w", err)
+	}
+	return false, nil
+}
+
 // CreateCertificateDirectory creates a directory for a certificate
 func (s *Storage) CreateCertificateDirectory(name string) error {
 	certDir := filepath.Join(s.basePath, name)
@@ -71,17 +71,21 @@ func TestSaveAndGetCAInfo(t *testing.T) {
 
 	// Save CA info
 	caName := "Test CA"
-	caKey := "testpassword"
 	organization := "Test Org"
 	country := "US"
 
-	err = storage.SaveCAInfo(caName, caKey, organization, country)
+	err = storage.SaveCAInfo(caName, organization, country)
 	if err != nil {
 		t.Fatalf("Failed to save CA info: %v", err)
 	}
 
+	// The CA key passphrase is never written to disk
+	if _, err := os.Stat(filepath.Join(storage.GetCADirectory(), "CA_KEY.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected no stored CA key passphrase, got %v", err)
+	}
+
 	// Get CA info
-	retrievedName, retrievedKey, retrievedOrg, retrievedCountry, err := storage.GetCAInfo()
+	retrievedName, retrievedOrg, retrievedCountry, err := storage.GetCAInfo()
 	if err != nil {
 		t.Fatalf("Failed to get CA info: %v", err)
 	}
@@ -90,9 +94,6 @@ func TestSaveAndGetCAInfo(t *testing.T) {
 	if retrievedName != caName {
 		t.Errorf("Expected CA name '%s', got '%s'", caName, retrievedName)
 	}
-	if retrievedKey != caKey {
-		t.Errorf("Expected CA key '%s', got '%s'", caKey, retrievedKey)
-	}
 	if retrievedOrg != organization {
 		t.Errorf("Expected organization '%s', got '%s'", organization, retrievedOrg)
 	}